@@ -0,0 +1,195 @@
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive format names.
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ArchiveFormats are the archive formats supported by ArchiveBinary.
+var ArchiveFormats = []string{ArchiveZip, ArchiveTarGz}
+
+// ValidArchiveFormat returns an error if the given archive format is not
+// one of ArchiveFormats.
+func ValidArchiveFormat(format string) error {
+	for _, f := range ArchiveFormats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// ArchiveSpec maps operating systems to the archive format that binaries
+// for that OS are packaged with. The format for the empty OS is used for
+// any OS without its own entry.
+type ArchiveSpec map[string]string
+
+// ParseArchiveSpec parses the value of the -archive flag. The value is a
+// space-separated list of either a bare format, which applies to every OS,
+// or "os=format" pairs, such as "tar.gz windows=zip".
+func ParseArchiveSpec(value string) (ArchiveSpec, error) {
+	spec := make(ArchiveSpec)
+	for _, v := range strings.Fields(value) {
+		goos, format := "", v
+		if idx := strings.Index(v, "="); idx >= 0 {
+			goos, format = strings.ToLower(v[:idx]), v[idx+1:]
+			if goos == "" {
+				return nil, fmt.Errorf("invalid archive syntax: %s should be os=format", v)
+			}
+		}
+		if err := ValidArchiveFormat(format); err != nil {
+			return nil, err
+		}
+
+		spec[goos] = format
+	}
+
+	return spec, nil
+}
+
+// Format returns the archive format for the given OS, or an empty string
+// if binaries for the OS shouldn't be archived.
+func (s ArchiveSpec) Format(goos string) string {
+	if format, ok := s[goos]; ok {
+		return format
+	}
+
+	return s[""]
+}
+
+// ArchiveBinary packages the binary at the given path into an archive of
+// the given format. The archive is written next to the binary with the
+// format appended as an extension, and its path is returned. The binary
+// keeps its file name inside the archive and is always marked executable,
+// since binaries cross-compiled on Windows have no executable bit. If
+// SOURCE_DATE_EPOCH is set, the binary is dated to it inside the archive,
+// so that the archive is reproducible.
+func ArchiveBinary(path, format string) (string, error) {
+	if err := ValidArchiveFormat(format); err != nil {
+		return "", err
+	}
+
+	archivePath := path + "." + format
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	switch format {
+	case ArchiveZip:
+		err = writeZip(f, path)
+	case ArchiveTarGz:
+		err = writeTarGz(f, path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return archivePath, f.Close()
+}
+
+// writeZip writes a zip archive to w containing the single file at path.
+func writeZip(w io.Writer, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(path)
+	header.Method = zip.Deflate
+	header.SetMode(0755)
+	if err := setArchiveModTime(&header.Modified); err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeTarGz writes a gzipped tar archive to w containing the single file
+// at path.
+func writeTarGz(w io.Writer, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(path)
+	header.Mode = 0755
+	if err := setArchiveModTime(&header.ModTime); err != nil {
+		return err
+	}
+
+	// The owner is whoever ran the build, which means nothing to whoever
+	// extracts the archive.
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, src); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// setArchiveModTime sets the modification time of a file in an archive to
+// SOURCE_DATE_EPOCH, if it is set.
+func setArchiveModTime(t *time.Time) error {
+	epoch, ok, err := SourceDateEpoch()
+	if ok {
+		*t = epoch
+	}
+
+	return err
+}
@@ -0,0 +1,161 @@
+package gox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveBinary_zip(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "app_windows_amd64.exe")
+	testWriteFile(t, path, "binary")
+
+	archivePath, err := ArchiveBinary(path, ArchiveZip)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if archivePath != path+".zip" {
+		t.Fatalf("bad: %#v", archivePath)
+	}
+
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	if len(r.File) != 1 {
+		t.Fatalf("bad: %#v", r.File)
+	}
+	if r.File[0].Name != "app_windows_amd64.exe" {
+		t.Fatalf("bad: %#v", r.File[0].Name)
+	}
+	if r.File[0].Mode().Perm() != 0755 {
+		t.Fatalf("bad: %s", r.File[0].Mode())
+	}
+
+	f, err := r.File[0].Open()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "binary" {
+		t.Fatalf("bad: %#v", string(data))
+	}
+}
+
+func TestArchiveBinary_unknownFormat(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "app")
+	testWriteFile(t, path, "binary")
+
+	if _, err := ArchiveBinary(path, "rar"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestArchiveBinary_tarGz(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	// Written without the executable bit, like a binary built on Windows.
+	path := filepath.Join(td, "app_linux_amd64")
+	testWriteFile(t, path, "binary")
+
+	archivePath, err := ArchiveBinary(path, ArchiveTarGz)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if archivePath != path+".tar.gz" {
+		t.Fatalf("bad: %#v", archivePath)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tr := tar.NewReader(gr)
+
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if header.Name != "app_linux_amd64" {
+		t.Fatalf("bad: %#v", header.Name)
+	}
+	if header.FileInfo().Mode().Perm() != 0755 {
+		t.Fatalf("bad: %s", header.FileInfo().Mode())
+	}
+	data, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "binary" {
+		t.Fatalf("bad: %#v", string(data))
+	}
+
+	if _, err := tr.Next(); err != io.EOF {
+		t.Fatalf("should only have one entry: %v", err)
+	}
+}
+
+func TestParseArchiveSpec(t *testing.T) {
+	cases := []struct {
+		Input string
+		Spec  ArchiveSpec
+		Err   bool
+	}{
+		{"", ArchiveSpec{}, false},
+		{"zip", ArchiveSpec{"": "zip"}, false},
+		{
+			"windows=zip linux=tar.gz darwin=tar.gz",
+			ArchiveSpec{"windows": "zip", "linux": "tar.gz", "darwin": "tar.gz"},
+			false,
+		},
+		{"tar.gz Windows=zip", ArchiveSpec{"": "tar.gz", "windows": "zip"}, false},
+		{"rar", nil, true},
+		{"linux=rar", nil, true},
+		{"=zip", nil, true},
+	}
+
+	for _, tc := range cases {
+		spec, err := ParseArchiveSpec(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if !reflect.DeepEqual(spec, tc.Spec) {
+			t.Fatalf("%s: bad: %#v", tc.Input, spec)
+		}
+	}
+
+	spec := ArchiveSpec{"": "tar.gz", "windows": "zip"}
+	if f := spec.Format("windows"); f != "zip" {
+		t.Fatalf("bad: %#v", f)
+	}
+	if f := spec.Format("linux"); f != "tar.gz" {
+		t.Fatalf("bad: %#v", f)
+	}
+	if f := (ArchiveSpec{"windows": "zip"}).Format("linux"); f != "" {
+		t.Fatalf("bad: %#v", f)
+	}
+}
@@ -0,0 +1,21 @@
+package gox
+
+// Artifact is a file produced by a run, such as a binary, an archive or
+// the checksum file.
+type Artifact struct {
+	Path string
+
+	// Platform is the platform the artifact was built for. It is empty for
+	// artifacts that cover the whole run, such as the checksum file.
+	Platform Platform
+}
+
+// artifactPaths returns the paths of the given artifacts.
+func artifactPaths(artifacts []Artifact) []string {
+	result := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		result = append(result, a.Path)
+	}
+
+	return result
+}
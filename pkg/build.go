@@ -0,0 +1,461 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildConfig is the configuration of a run of Build.
+type BuildConfig struct {
+	// Packages are the directories of the main packages to build, as
+	// returned by GoMainDirs.
+	Packages []string
+
+	// Platforms are the platforms to build every package for.
+	Platforms []Platform
+
+	// GoVersions, if set, are the versions of Go to build every platform
+	// with, as CompileOpts.GoVersion. Otherwise everything is built once,
+	// with the version of Go that is installed.
+	GoVersions []string
+
+	// Filter, if set, is called with the options of each build, and only
+	// the builds it returns true for are built. The others are left out of
+	// the results.
+	Filter func(opts *CompileOpts) bool
+
+	// Parallel is the number of builds that run at the same time. It
+	// defaults to the number of CPUs.
+	Parallel int
+
+	// ParallelCgo, if set, is the number of builds with cgo, which are
+	// much heavier, that run at the same time. They count towards Parallel
+	// as well.
+	ParallelCgo int
+
+	// Opts are the options every build starts from. The PackagePath,
+	// Platform and GoVersion are set for each build.
+	Opts CompileOpts
+
+	// Configure, if set, is called with the options of each build before
+	// it starts, to apply per-platform settings.
+	Configure func(opts *CompileOpts)
+
+	// OnStart, if set, is called when each build starts, and OnFinish
+	// when each build that started is done. They may be called from
+	// multiple goroutines at once.
+	OnStart  func(opts *CompileOpts)
+	OnFinish func(r *Result)
+
+	// UpToDate, if set, is called with the options of each build when its
+	// turn comes. If it returns true, the build is skipped and its result
+	// is marked UpToDate. OnStart and PostBuild aren't called for such
+	// builds, but OnFinish is.
+	UpToDate func(opts *CompileOpts) bool
+
+	// FailFast is what to do with the other builds once a build fails.
+	FailFast FailFastMode
+
+	// Retries is the number of times a failed build is tried again. If
+	// set, OnRetry is called before each retry with the error of the
+	// previous attempt.
+	Retries int
+	OnRetry func(r *Result, err error)
+
+	// PreBuild, if set, is called once before any build starts. If it
+	// fails, no builds are started and Build returns its error.
+	PreBuild func(ctx context.Context) error
+
+	// PostBuild, if set, is called after each build that succeeded, while
+	// it still holds its turn to build so that no more than Parallel run
+	// at once. If it fails, the build fails with its error.
+	PostBuild func(ctx context.Context, r *Result) error
+}
+
+// Result is the result of building a package for a platform.
+type Result struct {
+	Platform    Platform
+	PackagePath string
+
+	// GoVersion is the version of Go the build switched to, as
+	// CompileOpts.GoVersion, or empty if it used the installed one.
+	GoVersion string
+
+	// Output is the path of the file the build wrote, which is empty with
+	// ModeVet.
+	Output string
+
+	// Duration is the time spent running go build, over every attempt. It
+	// doesn't include the time spent waiting for a turn to build.
+	Duration time.Duration
+
+	// Attempts is the number of times the build was tried.
+	Attempts int
+
+	// UpToDate is true if the build was skipped because its output was
+	// up to date already.
+	UpToDate bool
+
+	// Err is the error the build failed with, or nil if it succeeded.
+	Err error
+
+	// Artifacts are the files the build produced for the release, such as
+	// the binary and its archive, if PostBuild set them.
+	Artifacts []Artifact
+
+	// Opts are the options the package was built with.
+	Opts *CompileOpts
+}
+
+// Build builds every package for every platform of the configuration in
+// parallel, and returns a result for each build in the order of the
+// versions of Go, then the platforms, then the packages. The builds start
+// in the same order, as their turns come. A failed build doesn't stop the
+// others, its error is recorded in its result instead. Once ctx is done,
+// the builds that are running are killed and no new builds are started;
+// the builds that didn't start fail with the error of ctx.
+//
+// An error is only returned if the configuration is invalid or PreBuild
+// fails.
+func Build(ctx context.Context, cfg BuildConfig) ([]Result, error) {
+	if len(cfg.Packages) == 0 {
+		return nil, errors.New("no packages to build")
+	}
+	if len(cfg.Platforms) == 0 {
+		return nil, errors.New("no platforms to build for")
+	}
+
+	parallel := cfg.Parallel
+	if parallel < 1 {
+		parallel = runtime.NumCPU()
+	}
+
+	if cfg.PreBuild != nil {
+		if err := cfg.PreBuild(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	builds := cfg.builds()
+	results := make([]Result, 0, len(builds))
+	for i := range builds {
+		opts := &builds[i]
+		results = append(results, Result{
+			Platform:    opts.Platform,
+			PackagePath: opts.PackagePath,
+			GoVersion:   opts.GoVersion,
+			Opts:        opts,
+		})
+	}
+
+	// With fail-fast, the first failure closes failed so that no more
+	// builds start, and cancels buildCtx to kill the running ones if the
+	// mode is FailFastKill.
+	buildCtx, cancelBuilds := context.WithCancel(ctx)
+	defer cancelBuilds()
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	fail := func() {
+		failOnce.Do(func() {
+			close(failed)
+			if cfg.FailFast == FailFastKill {
+				cancelBuilds()
+			}
+		})
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan int, parallel)
+	var cgoSemaphore chan int
+	if cfg.ParallelCgo > 0 {
+		cgoSemaphore = make(chan int, cfg.ParallelCgo)
+	}
+
+	// Builds take their turns in the order of the results, so that the
+	// first platforms are built first. Each build waits for the build
+	// before it with or without cgo, like itself, to have its turn, so
+	// that builds waiting for a cgo turn don't hold up the others.
+	lastTurn := make(map[bool]chan struct{})
+	for i := range results {
+		cgo := cgoSemaphore != nil && UsesCgo(results[i].Opts)
+		after, turn := lastTurn[cgo], make(chan struct{})
+		lastTurn[cgo] = turn
+
+		wg.Add(1)
+		go func(r *Result, cgo bool, after, turn chan struct{}) {
+			defer wg.Done()
+
+			// Once this build has its turn, or won't get one, it's the
+			// next build's turn.
+			var once sync.Once
+			next := func() { once.Do(func() { close(turn) }) }
+			defer next()
+			if after != nil {
+				<-after
+			}
+
+			// Builds with cgo take a cgo turn before their turn to build.
+			// Since they're always taken in this order, the two can't
+			// deadlock, and builds waiting for a cgo turn don't take turns
+			// from builds without cgo.
+			if cgo {
+				select {
+				case cgoSemaphore <- 1:
+					defer func() { <-cgoSemaphore }()
+				case <-ctx.Done():
+					r.Err = ctx.Err()
+					return
+				case <-failed:
+					r.Err = ErrFailFastSkipped
+					return
+				}
+			}
+
+			// Don't start any more builds once ctx is done or a build
+			// failed with fail-fast, even if they were already waiting
+			// for their turn.
+			select {
+			case semaphore <- 1:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				r.Err = ctx.Err()
+				return
+			case <-failed:
+				r.Err = ErrFailFastSkipped
+				return
+			}
+			next()
+			if err := ctx.Err(); err != nil {
+				r.Err = err
+				return
+			}
+			select {
+			case <-failed:
+				r.Err = ErrFailFastSkipped
+				return
+			default:
+			}
+
+			if cfg.UpToDate != nil && cfg.UpToDate(r.Opts) {
+				r.UpToDate = true
+				r.Output, r.Err = OutputPath(r.Opts)
+				if cfg.OnFinish != nil {
+					cfg.OnFinish(r)
+				}
+				return
+			}
+
+			if cfg.OnStart != nil {
+				cfg.OnStart(r.Opts)
+			}
+
+			r.Err = buildWithRetries(buildCtx, cfg, r)
+			if r.Err == nil && r.Opts.Mode != ModeVet {
+				r.Output, r.Err = OutputPath(r.Opts)
+			}
+			if r.Err == nil && cfg.PostBuild != nil {
+				r.Err = cfg.PostBuild(buildCtx, r)
+			}
+
+			if r.Err != nil && ctx.Err() == nil {
+				if buildCtx.Err() != nil {
+					r.Err = ErrFailFastKilled
+				} else if cfg.FailFast != FailFastOff {
+					fail()
+				}
+			}
+
+			if cfg.OnFinish != nil {
+				cfg.OnFinish(r)
+			}
+		}(&results[i], cgo, after, turn)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// builds returns the options of every build of the configuration, in the
+// order of the versions of Go, then the platforms, then the packages. The
+// builds that Filter leaves out aren't included.
+func (cfg *BuildConfig) builds() []CompileOpts {
+	goVersions := cfg.GoVersions
+	if len(goVersions) == 0 {
+		goVersions = []string{""}
+	}
+
+	builds := make([]CompileOpts, 0, len(goVersions)*len(cfg.Platforms)*len(cfg.Packages))
+	for _, goVersion := range goVersions {
+		for _, platform := range cfg.Platforms {
+			for _, path := range cfg.Packages {
+				opts := cfg.compileOpts(goVersion, platform, path)
+				if cfg.Filter != nil && !cfg.Filter(&opts) {
+					continue
+				}
+				builds = append(builds, opts)
+			}
+		}
+	}
+
+	return builds
+}
+
+// compileOpts returns the options to build the package at path for the
+// platform with, with the given version of Go.
+func (cfg *BuildConfig) compileOpts(goVersion string, platform Platform, path string) CompileOpts {
+	opts := cfg.Opts
+	opts.PackagePath = path
+	opts.Platform = platform
+	opts.GoVersion = goVersion
+	if cfg.Configure != nil {
+		cfg.Configure(&opts)
+	}
+
+	return opts
+}
+
+// buildName returns the name of the build with the given options in
+// messages, its platform and, if it switches to another version of Go,
+// that version.
+func buildName(opts *CompileOpts) string {
+	if opts.GoVersion != "" {
+		return opts.Platform.String() + " " + opts.GoVersion
+	}
+
+	return opts.Platform.String()
+}
+
+// CheckOutputCollisions returns an error if more than one build of the
+// configuration would write to the same output path, such as for packages
+// in different directories with the same name, which would overwrite each
+// other. The error lists every path that collides and the builds that
+// write to it. Builds whose output path can't be rendered are left to fail
+// on their own.
+func CheckOutputCollisions(cfg BuildConfig) error {
+	builds := make(map[string][]string)
+	var paths []string
+	for _, opts := range cfg.builds() {
+		output, err := OutputPath(&opts)
+		if err != nil {
+			continue
+		}
+		abs, err := filepath.Abs(output)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := builds[abs]; !ok {
+			paths = append(paths, output)
+		}
+		builds[abs] = append(builds[abs],
+			fmt.Sprintf("%s %s", buildName(&opts), opts.PackagePath))
+	}
+
+	var collisions []string
+	for _, output := range paths {
+		abs, _ := filepath.Abs(output)
+		if len(builds[abs]) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s: %s",
+				output, strings.Join(builds[abs], ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("builds would overwrite each other's output:\n  %s",
+			strings.Join(collisions, "\n  "))
+	}
+
+	return nil
+}
+
+// buildRetryWait is the wait before retrying a failed build, which grows
+// by buildRetryWait with each attempt.
+var buildRetryWait = time.Second
+
+// buildWithRetries builds with the options of the result, trying again up
+// to cfg.Retries times if the build fails. Builds aren't retried once ctx
+// is done. The time each attempt takes is added to the duration of the
+// result.
+func buildWithRetries(ctx context.Context, cfg BuildConfig, r *Result) error {
+	for {
+		r.Attempts++
+		start := time.Now()
+		err := GoCrossCompileContext(ctx, r.Opts)
+		r.Duration += time.Since(start)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if r.Attempts > cfg.Retries {
+			if r.Attempts > 1 {
+				err = fmt.Errorf("failed after %d attempts: %s", r.Attempts, err)
+			}
+			return err
+		}
+
+		if cfg.OnRetry != nil {
+			cfg.OnRetry(r, err)
+		}
+
+		select {
+		case <-time.After(time.Duration(r.Attempts) * buildRetryWait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// FailFastMode is what Build does with the other builds once a build
+// fails. It is a flag.Value that may be used as a boolean flag, which
+// enables FailFastWait, or set to one of the modes.
+type FailFastMode string
+
+const (
+	// FailFastOff runs every build regardless of failures.
+	FailFastOff FailFastMode = ""
+
+	// FailFastWait starts no more builds, but lets the running builds
+	// finish.
+	FailFastWait FailFastMode = "wait"
+
+	// FailFastKill starts no more builds and kills the running ones.
+	FailFastKill FailFastMode = "kill"
+)
+
+var (
+	// ErrFailFastSkipped is the error of the builds that weren't started
+	// because another build failed.
+	ErrFailFastSkipped = errors.New("skipped because another build failed (fail-fast)")
+
+	// ErrFailFastKilled is the error of the builds that were killed
+	// because another build failed.
+	ErrFailFastKilled = errors.New("killed because another build failed (fail-fast)")
+)
+
+func (m *FailFastMode) String() string {
+	return string(*m)
+}
+
+func (m *FailFastMode) Set(value string) error {
+	switch value {
+	case "true":
+		*m = FailFastWait
+	case "false":
+		*m = FailFastOff
+	case string(FailFastWait), string(FailFastKill):
+		*m = FailFastMode(value)
+	default:
+		return fmt.Errorf("invalid fail-fast mode %q, must be true, %s or %s",
+			value, FailFastWait, FailFastKill)
+	}
+
+	return nil
+}
+
+func (m *FailFastMode) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,491 @@
+package gox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuild_invalid(t *testing.T) {
+	_, err := Build(context.Background(), BuildConfig{
+		Platforms: []Platform{{OS: "linux", Arch: "amd64"}},
+	})
+	if err == nil {
+		t.Fatal("should err")
+	}
+
+	_, err = Build(context.Background(), BuildConfig{
+		Packages: []string{"github.com/foo/app"},
+	})
+	if err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestBuild_results(t *testing.T) {
+	var configured int
+	cfg := BuildConfig{
+		Packages: []string{"github.com/foo/app", "github.com/foo/tool"},
+		Platforms: []Platform{
+			{OS: "linux", Arch: "amd64"},
+			{OS: "windows", Arch: "386"},
+		},
+		Parallel: 2,
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+		Configure: func(opts *CompileOpts) {
+			configured++
+			opts.Tags = opts.Platform.OS
+		},
+	}
+
+	results, err := Build(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []struct{ Platform, Path string }{
+		{"linux/amd64", "github.com/foo/app"},
+		{"linux/amd64", "github.com/foo/tool"},
+		{"windows/386", "github.com/foo/app"},
+		{"windows/386", "github.com/foo/tool"},
+	}
+	if len(results) != len(expected) || configured != len(expected) {
+		t.Fatalf("bad: %#v", results)
+	}
+	for i, r := range results {
+		if r.Platform.String() != expected[i].Platform || r.PackagePath != expected[i].Path {
+			t.Fatalf("bad: %#v", r)
+		}
+		if r.Opts.Tags != r.Platform.OS {
+			t.Fatalf("bad: %#v", r.Opts)
+		}
+
+		// The go command doesn't exist, so every build fails.
+		if r.Err == nil || r.Output != "" {
+			t.Fatalf("bad: %#v", r)
+		}
+	}
+}
+
+func TestBuild_filter(t *testing.T) {
+	cfg := BuildConfig{
+		Packages: []string{"github.com/foo/app", "github.com/foo/tool"},
+		Platforms: []Platform{
+			{OS: "linux", Arch: "amd64"},
+			{OS: "windows", Arch: "386"},
+		},
+		Filter: func(opts *CompileOpts) bool {
+			return opts.Platform.OS == "windows" || opts.PackagePath == "github.com/foo/tool"
+		},
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+	}
+
+	results, err := Build(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []struct{ Platform, Path string }{
+		{"linux/amd64", "github.com/foo/tool"},
+		{"windows/386", "github.com/foo/app"},
+		{"windows/386", "github.com/foo/tool"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("bad: %#v", results)
+	}
+	for i, r := range results {
+		if r.Platform.String() != expected[i].Platform || r.PackagePath != expected[i].Path {
+			t.Fatalf("bad: %#v", r)
+		}
+	}
+}
+
+func TestBuild_goVersions(t *testing.T) {
+	cfg := BuildConfig{
+		Packages:   []string{"github.com/foo/app"},
+		Platforms:  []Platform{{OS: "linux", Arch: "amd64"}, {OS: "windows", Arch: "386"}},
+		GoVersions: []string{"go1.21.9", "go1.22.3"},
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+	}
+	if err := CheckOutputCollisions(cfg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	results, err := Build(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []struct{ Platform, GoVersion string }{
+		{"linux/amd64", "go1.21.9"},
+		{"windows/386", "go1.21.9"},
+		{"linux/amd64", "go1.22.3"},
+		{"windows/386", "go1.22.3"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("bad: %#v", results)
+	}
+	for i, r := range results {
+		if r.Platform.String() != expected[i].Platform || r.GoVersion != expected[i].GoVersion ||
+			r.Opts.GoVersion != r.GoVersion {
+			t.Fatalf("bad: %#v", r)
+		}
+	}
+}
+
+func TestBuild_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := Build(ctx, BuildConfig{
+		Packages:  []string{"github.com/foo/app"},
+		Platforms: []Platform{{OS: "linux", Arch: "amd64"}},
+		OnStart: func(*CompileOpts) {
+			t.Fatal("should not start")
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(results) != 1 || results[0].Err != context.Canceled {
+		t.Fatalf("bad: %#v", results)
+	}
+}
+
+func TestBuild_failFast(t *testing.T) {
+	results, err := Build(context.Background(), BuildConfig{
+		Packages: []string{"github.com/foo/app"},
+		Platforms: []Platform{
+			{OS: "linux", Arch: "amd64"},
+			{OS: "linux", Arch: "386"},
+			{OS: "linux", Arch: "arm"},
+		},
+		Parallel: 1,
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+		FailFast: FailFastWait,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var failed, skipped int
+	for _, r := range results {
+		switch r.Err {
+		case nil:
+			t.Fatalf("bad: %#v", r)
+		case ErrFailFastSkipped:
+			skipped++
+		default:
+			failed++
+		}
+	}
+	if failed != 1 || skipped != 2 {
+		t.Fatalf("bad: %d failed, %d skipped", failed, skipped)
+	}
+}
+
+func TestFailFastMode(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected FailFastMode
+		Err      bool
+	}{
+		{"true", FailFastWait, false},
+		{"false", FailFastOff, false},
+		{"wait", FailFastWait, false},
+		{"kill", FailFastKill, false},
+		{"sometimes", FailFastOff, true},
+	}
+
+	for _, tc := range cases {
+		var m FailFastMode
+		err := m.Set(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Input, err)
+		}
+		if m != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Input, m)
+		}
+	}
+}
+
+func TestBuild_retries(t *testing.T) {
+	defer func(wait time.Duration) { buildRetryWait = wait }(buildRetryWait)
+	buildRetryWait = 0
+
+	var retries int
+	results, err := Build(context.Background(), BuildConfig{
+		Packages:  []string{"github.com/foo/app"},
+		Platforms: []Platform{{OS: "linux", Arch: "amd64"}},
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+		Retries: 2,
+		OnRetry: func(r *Result, err error) {
+			retries++
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	r := results[0]
+	if r.Attempts != 3 || retries != 2 {
+		t.Fatalf("bad: %d attempts, %d retries", r.Attempts, retries)
+	}
+	if r.Err == nil || !strings.Contains(r.Err.Error(), "after 3 attempts") {
+		t.Fatalf("bad: %v", r.Err)
+	}
+}
+
+func TestCheckOutputCollisions(t *testing.T) {
+	cfg := BuildConfig{
+		Packages: []string{"github.com/foo/cmd/app", "github.com/foo/tools/app"},
+		Platforms: []Platform{
+			{OS: "linux", Arch: "amd64"},
+			{OS: "darwin", Arch: "amd64"},
+		},
+		Opts: CompileOpts{OutputTpl: DefaultOutputTpl},
+	}
+
+	err := CheckOutputCollisions(cfg)
+	if err == nil {
+		t.Fatal("should err")
+	}
+	expected := "builds would overwrite each other's output:\n" +
+		"  app_linux_amd64: linux/amd64 github.com/foo/cmd/app, linux/amd64 github.com/foo/tools/app\n" +
+		"  app_darwin_amd64: darwin/amd64 github.com/foo/cmd/app, darwin/amd64 github.com/foo/tools/app"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+
+	cfg.Packages = []string{"github.com/foo/cmd/app", "github.com/foo/cmd/other"}
+	if err := CheckOutputCollisions(cfg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A template without the platform collides across platforms
+	cfg.Opts.OutputTpl = "{{.Dir}}"
+	if err := CheckOutputCollisions(cfg); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestBuild_hooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs the true command")
+	}
+
+	cfg := BuildConfig{
+		Packages:  []string{"github.com/foo/app"},
+		Platforms: []Platform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "amd64"}},
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "true",
+		},
+		PreBuild: func(ctx context.Context) error {
+			return errors.New("pre-build failed")
+		},
+	}
+	if _, err := Build(context.Background(), cfg); err == nil {
+		t.Fatal("should err")
+	}
+
+	cfg.PreBuild = nil
+	cfg.PostBuild = func(ctx context.Context, r *Result) error {
+		if r.Platform.OS == "darwin" {
+			return errors.New("hook failed")
+		}
+		return nil
+	}
+	results, err := Build(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if results[0].Err != nil {
+		t.Fatalf("err: %s", results[0].Err)
+	}
+	if results[1].Err == nil || results[1].Err.Error() != "hook failed" {
+		t.Fatalf("bad: %v", results[1].Err)
+	}
+}
+
+func TestBuild_parallelCgo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs the true command")
+	}
+
+	// Half of the platforms build with cgo, which only one may do at a
+	// time, out of three builds at a time.
+	var platforms []Platform
+	for _, arch := range []string{"386", "amd64", "arm", "arm64", "ppc64le", "s390x"} {
+		platforms = append(platforms, Platform{OS: "linux", Arch: arch})
+		platforms = append(platforms, Platform{OS: "windows", Arch: arch})
+	}
+
+	var l sync.Mutex
+	var running, runningCgo, maxRunning, maxRunningCgo int
+	cfg := BuildConfig{
+		Packages:    []string{"github.com/foo/app"},
+		Platforms:   platforms,
+		Parallel:    3,
+		ParallelCgo: 1,
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "true",
+		},
+		Configure: func(opts *CompileOpts) {
+			opts.Cgo = opts.Platform.OS == "linux" && opts.Platform.Arch != "ppc64le"
+			opts.CgoSet = true
+		},
+		OnStart: func(opts *CompileOpts) {
+			l.Lock()
+			defer l.Unlock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			if UsesCgo(opts) {
+				runningCgo++
+				if runningCgo > maxRunningCgo {
+					maxRunningCgo = runningCgo
+				}
+			}
+		},
+		PostBuild: func(ctx context.Context, r *Result) error {
+			// Hold the turn for a bit so that the builds overlap.
+			time.Sleep(10 * time.Millisecond)
+
+			l.Lock()
+			defer l.Unlock()
+			running--
+			if UsesCgo(r.Opts) {
+				runningCgo--
+			}
+			return nil
+		},
+	}
+
+	done := make(chan struct{})
+	var results []Result
+	var err error
+	go func() {
+		defer close(done)
+		results, err = Build(context.Background(), cfg)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("builds deadlocked")
+	}
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every build ran, and the results are in the order of the platforms
+	// whatever order they ran in.
+	if len(results) != len(platforms) {
+		t.Fatalf("bad: %#v", results)
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("err: %s", r.Err)
+		}
+		if r.Platform != platforms[i] {
+			t.Fatalf("bad: %#v", r.Platform)
+		}
+	}
+
+	if maxRunningCgo != 1 {
+		t.Fatalf("bad: %d", maxRunningCgo)
+	}
+	if maxRunning < 2 || maxRunning > 3 {
+		t.Fatalf("bad: %d", maxRunning)
+	}
+}
+
+func TestBuild_upToDate(t *testing.T) {
+	var started, finished []string
+	cfg := BuildConfig{
+		Packages:  []string{"github.com/foo/app"},
+		Platforms: []Platform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "amd64"}},
+		Parallel:  1,
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+		UpToDate: func(opts *CompileOpts) bool {
+			return opts.Platform.OS == "linux"
+		},
+		OnStart: func(opts *CompileOpts) {
+			started = append(started, opts.Platform.String())
+		},
+		OnFinish: func(r *Result) {
+			finished = append(finished, r.Platform.String())
+		},
+		PostBuild: func(ctx context.Context, r *Result) error {
+			t.Fatal("post-build should not be called")
+			return nil
+		},
+	}
+	results, err := Build(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !results[0].UpToDate || results[0].Err != nil || results[0].Output != "app_linux_amd64" {
+		t.Fatalf("bad: %#v", results[0])
+	}
+	if results[1].UpToDate || results[1].Err == nil {
+		t.Fatalf("bad: %#v", results[1])
+	}
+	if len(started) != 1 || started[0] != "darwin/amd64" || len(finished) != 2 {
+		t.Fatalf("bad: %#v %#v", started, finished)
+	}
+}
+
+func TestBuild_order(t *testing.T) {
+	var platforms []Platform
+	for _, arch := range []string{"386", "amd64", "arm", "arm64", "mips", "ppc64le", "riscv64", "s390x"} {
+		platforms = append(platforms, Platform{OS: "linux", Arch: arch})
+	}
+
+	var started []Platform
+	cfg := BuildConfig{
+		Packages:  []string{"github.com/foo/app"},
+		Platforms: platforms,
+		Parallel:  1,
+		Opts: CompileOpts{
+			OutputTpl: DefaultOutputTpl,
+			GoCmd:     "gox-no-such-go",
+		},
+		OnStart: func(opts *CompileOpts) {
+			started = append(started, opts.Platform)
+		},
+	}
+	if _, err := Build(context.Background(), cfg); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(started, platforms) {
+		t.Fatalf("bad: %#v", started)
+	}
+}
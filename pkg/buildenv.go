@@ -0,0 +1,168 @@
+package gox
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvVar is a variable that -env sets for the builds. If Platform is set,
+// as os/arch or as the full name of a platform, such as "linux/arm/v7", it
+// is only set for the builds of the platforms it names.
+type EnvVar struct {
+	Platform string
+	Key      string
+	Value    string
+}
+
+// EnvFlag is the list of variables of -env, KEY=VALUE for every platform
+// or os/arch:KEY=VALUE for one. It is a flag.Value that may be given more
+// than once.
+type EnvFlag []EnvVar
+
+func (f *EnvFlag) String() string {
+	parts := make([]string, 0, len(*f))
+	for _, v := range *f {
+		s := v.Key + "=" + v.Value
+		if v.Platform != "" {
+			s = v.Platform + ":" + s
+		}
+		parts = append(parts, s)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (f *EnvFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 0 {
+		return fmt.Errorf("invalid variable %q, should be KEY=VALUE or os/arch:KEY=VALUE", value)
+	}
+
+	v := EnvVar{Key: value[:i], Value: value[i+1:]}
+	if j := strings.Index(v.Key, ":"); j >= 0 {
+		var platforms appendPlatformValue
+		if err := platforms.Set(v.Key[:j]); err != nil {
+			return err
+		}
+		if len(platforms) != 1 || isOSArchPattern(&platforms[0]) {
+			return fmt.Errorf("invalid platform %q for %s, should be a single os/arch",
+				v.Key[:j], v.Key[j+1:])
+		}
+		v.Platform, v.Key = platforms[0].String(), v.Key[j+1:]
+	}
+	if v.Key == "" {
+		return fmt.Errorf("invalid variable %q, the name is empty", value)
+	}
+
+	*f = append(*f, v)
+	return nil
+}
+
+// Environ returns the variables for the builds of the platform, as
+// KEY=VALUE. The ones for every platform come first and then the ones for
+// the platform, which override them, each in the order they were given.
+func (f EnvFlag) Environ(platform Platform) []string {
+	var global, own []string
+	for _, v := range f {
+		switch {
+		case v.Platform == "":
+			global = append(global, v.Key+"="+v.Value)
+		case v.matches(platform):
+			own = append(own, v.Key+"="+v.Value)
+		}
+	}
+
+	return append(global, own...)
+}
+
+// CommandEnviron returns the environment of the go commands of a run that
+// aren't the build of a platform, such as go list and go generate: that
+// of gox, or only the variables of it that cleanEnviron keeps if clean is
+// set, with the variables for every platform on top. It is nil, for the
+// environment of gox as it is, if there's nothing to change.
+func (f EnvFlag) CommandEnviron(clean bool) []string {
+	var env []string
+	for _, v := range f {
+		if v.Platform == "" {
+			env = append(env, v.Key+"="+v.Value)
+		}
+	}
+	if !clean && len(env) == 0 {
+		return nil
+	}
+
+	base := os.Environ()
+	if clean {
+		base = cleanEnviron(base)
+	}
+	return append(append([]string{}, base...), env...)
+}
+
+// Unmatched returns the platforms of the variables that match none of the
+// given platforms, which is usually a typo.
+func (f EnvFlag) Unmatched(platforms []Platform) []string {
+	var unmatched []string
+	seen := make(map[string]bool)
+	for _, v := range f {
+		if v.Platform == "" || seen[v.Platform] {
+			continue
+		}
+		seen[v.Platform] = true
+
+		found := false
+		for _, p := range platforms {
+			found = found || v.matches(p)
+		}
+		if !found {
+			unmatched = append(unmatched, v.Platform)
+		}
+	}
+
+	return unmatched
+}
+
+func (v *EnvVar) matches(platform Platform) bool {
+	return v.Platform == platform.String() ||
+		v.Platform == platform.OS+"/"+platform.Arch
+}
+
+// CleanEnvVars are the variables that builds with CompileOpts.CleanEnv
+// keep from the environment of gox, along with those that start with GO.
+// Besides PATH and HOME, they are the ones go needs to run at all on some
+// systems, such as SYSTEMROOT on Windows.
+var CleanEnvVars = []string{
+	"PATH", "HOME", "TMPDIR",
+	"SYSTEMROOT", "USERPROFILE", "LOCALAPPDATA", "APPDATA", "TEMP", "TMP",
+}
+
+// cleanEnviron returns the variables of environ, in the format of
+// os.Environ, that are in CleanEnvVars or start with GO. Names are
+// compared without case, since Windows has Path and SystemRoot.
+func cleanEnviron(environ []string) []string {
+	keep := make(map[string]bool, len(CleanEnvVars))
+	for _, name := range CleanEnvVars {
+		keep[name] = true
+	}
+
+	var result []string
+	for _, kv := range environ {
+		name := strings.ToUpper(strings.SplitN(kv, "=", 2)[0])
+		if keep[name] || strings.HasPrefix(name, "GO") {
+			result = append(result, kv)
+		}
+	}
+
+	return result
+}
+
+// buildEnviron returns the environment that the variables of a build are
+// added to: that of gox, or only the variables of it that cleanEnviron
+// keeps with CleanEnv.
+func buildEnviron(opts *CompileOpts) []string {
+	if opts.CleanEnv {
+		return cleanEnviron(os.Environ())
+	}
+
+	return os.Environ()
+}
@@ -0,0 +1,226 @@
+package gox
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEnvFlag_Set(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected EnvVar
+		Err      bool
+	}{
+		{"FOO=bar", EnvVar{Key: "FOO", Value: "bar"}, false},
+		{"FOO=", EnvVar{Key: "FOO"}, false},
+		{"FOO=a=b", EnvVar{Key: "FOO", Value: "a=b"}, false},
+		{"FOO=a:b", EnvVar{Key: "FOO", Value: "a:b"}, false},
+		{"linux/arm64:CC=gcc", EnvVar{"linux/arm64", "CC", "gcc"}, false},
+		{"linux/arm/v7:X=1", EnvVar{"linux/arm/v7", "X", "1"}, false},
+		{"linux/amd64@musl:X=1", EnvVar{"linux/amd64@musl", "X", "1"}, false},
+		{"FOO", EnvVar{}, true},
+		{"=bar", EnvVar{}, true},
+		{"linux/arm64:=bar", EnvVar{}, true},
+		{"linux:FOO=bar", EnvVar{}, true},
+		{"linux/*:FOO=bar", EnvVar{}, true},
+	}
+
+	for _, tc := range cases {
+		var f EnvFlag
+		err := f.Set(tc.Input)
+		if tc.Err {
+			if err == nil {
+				t.Fatalf("%s: should err", tc.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if len(f) != 1 || f[0] != tc.Expected {
+			t.Fatalf("%s: bad: %#v", tc.Input, f)
+		}
+	}
+}
+
+func TestEnvFlag_Environ(t *testing.T) {
+	var f EnvFlag
+	for _, v := range []string{
+		"linux/arm64:FOO=arm64",
+		"FOO=all",
+		"linux/amd64:FOO=amd64",
+		"BAR=1",
+		"linux/arm/v7:FOO=armv7",
+	} {
+		if err := f.Set(v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	cases := []struct {
+		Platform Platform
+		Expected []string
+	}{
+		{
+			Platform{OS: "linux", Arch: "arm64"},
+			[]string{"FOO=all", "BAR=1", "FOO=arm64"},
+		},
+		{
+			Platform{OS: "linux", Arch: "amd64", Libc: "musl"},
+			[]string{"FOO=all", "BAR=1", "FOO=amd64"},
+		},
+		{
+			Platform{OS: "linux", Arch: "arm", Arm: "7"},
+			[]string{"FOO=all", "BAR=1", "FOO=armv7"},
+		},
+		{
+			Platform{OS: "linux", Arch: "arm", Arm: "6"},
+			[]string{"FOO=all", "BAR=1"},
+		},
+	}
+
+	for _, tc := range cases {
+		actual := f.Environ(tc.Platform)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", tc.Platform.String(), actual)
+		}
+	}
+
+	unmatched := f.Unmatched([]Platform{{OS: "linux", Arch: "amd64"}})
+	expected := []string{"linux/arm64", "linux/arm/v7"}
+	if !reflect.DeepEqual(unmatched, expected) {
+		t.Fatalf("bad: %#v", unmatched)
+	}
+}
+
+func TestCleanEnviron(t *testing.T) {
+	actual := cleanEnviron([]string{
+		"PATH=/bin",
+		"HOME=/home/gox",
+		"GOPATH=/go",
+		"GOFLAGS=-mod=mod",
+		"Path=C:\\Windows",
+		"CGO_ENABLED=1",
+		"CC=clang",
+		"SECRET=x",
+		"PATHS=y",
+	})
+
+	expected := []string{
+		"PATH=/bin",
+		"HOME=/home/gox",
+		"GOPATH=/go",
+		"GOFLAGS=-mod=mod",
+		"Path=C:\\Windows",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestGoBuildEnv_envOrder(t *testing.T) {
+	os.Setenv("TEST_GOX_ENV", "inherited")
+	defer os.Unsetenv("TEST_GOX_ENV")
+
+	var f EnvFlag
+	for _, v := range []string{
+		"linux/arm64:TEST_GOX_ENV=platform",
+		"TEST_GOX_ENV=global",
+		"GOOS=windows",
+	} {
+		if err := f.Set(v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The last value of a variable is the one the build gets.
+	last := func(env []string, key string) string {
+		value := ""
+		for _, kv := range env {
+			if len(kv) > len(key) && kv[:len(key)+1] == key+"=" {
+				value = kv[len(key)+1:]
+			}
+		}
+		return value
+	}
+
+	cases := []struct {
+		Platform Platform
+		CleanEnv bool
+		Expected string
+	}{
+		{Platform{OS: "linux", Arch: "arm64"}, false, "platform"},
+		{Platform{OS: "linux", Arch: "amd64"}, false, "global"},
+		{Platform{OS: "linux", Arch: "arm64"}, true, "platform"},
+	}
+
+	for _, tc := range cases {
+		opts := &CompileOpts{
+			Platform: tc.Platform,
+			Env:      f.Environ(tc.Platform),
+			CleanEnv: tc.CleanEnv,
+		}
+		env, err := goBuildEnv(opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if v := last(env, "TEST_GOX_ENV"); v != tc.Expected {
+			t.Fatalf("%s: bad: %s", tc.Platform.String(), v)
+		}
+		if v := last(env, "GOOS"); v != "linux" {
+			t.Fatalf("%s: bad GOOS: %s", tc.Platform.String(), v)
+		}
+	}
+
+	// Without -env, the inherited value is kept, unless the environment
+	// is clean.
+	env, err := goBuildEnv(&CompileOpts{Platform: Platform{OS: "linux", Arch: "amd64"}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := last(env, "TEST_GOX_ENV"); v != "inherited" {
+		t.Fatalf("bad: %s", v)
+	}
+	env, err = goBuildEnv(&CompileOpts{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		CleanEnv: true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v := last(env, "TEST_GOX_ENV"); v != "" {
+		t.Fatalf("bad: %s", v)
+	}
+}
+
+func TestEnvFlag_CommandEnviron(t *testing.T) {
+	os.Setenv("TEST_GOX_ENV", "inherited")
+	defer os.Unsetenv("TEST_GOX_ENV")
+
+	var f EnvFlag
+	if env := f.CommandEnviron(false); env != nil {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	for _, v := range []string{"GOPRIVATE=example.com", "linux/arm64:CC=gcc"} {
+		if err := f.Set(v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	cases := []struct {
+		Clean    bool
+		Expected []string
+	}{
+		{false, append(os.Environ(), "GOPRIVATE=example.com")},
+		{true, append(cleanEnviron(os.Environ()), "GOPRIVATE=example.com")},
+	}
+
+	for _, tc := range cases {
+		actual := f.CommandEnviron(tc.Clean)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
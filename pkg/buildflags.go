@@ -0,0 +1,79 @@
+package gox
+
+import "strings"
+
+// The gcflags, ldflags and asmflags of a build may have more than one
+// value, one per line, and each is passed to go build as a flag of its
+// own. A value may start with a package pattern and an "=", as in
+// "all=-N -l", to be for the packages that match the pattern rather than
+// only the ones being built. As with go build, the last value that
+// matches a package is the one it is built with, and a value without a
+// pattern matches the packages being built.
+
+// flagValues returns the values of the flags, one per line. There is
+// always at least one, which is empty if there are no flags, so that go
+// build is always passed the flag.
+func flagValues(flags string) []string {
+	var values []string
+	for _, line := range strings.Split(flags, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			values = append(values, line)
+		}
+	}
+	if len(values) == 0 {
+		return []string{""}
+	}
+
+	return values
+}
+
+// flagPattern splits a value of the flags into its package pattern and its
+// flags, as go build does: a value that doesn't start with a "-" is a
+// pattern, an "=" and the flags. The pattern is empty if there isn't one.
+func flagPattern(value string) (pattern, flags string) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-") {
+		return "", value
+	}
+
+	// Without a pattern before the "=", go build reports the value as
+	// invalid, so it is left for it to do so.
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return "", value
+	}
+
+	return strings.TrimSpace(value[:i]), value[i+1:]
+}
+
+// eachFlagValue returns the flags with the flags of each value replaced
+// by what f returns for them, keeping the patterns. If no value matches
+// the packages being built for sure, as one without a pattern or with
+// "all" does, f is also given an empty value without a pattern that
+// comes first, so that what it adds is there for those packages too.
+func eachFlagValue(flags string, f func(flags string) (string, error)) (string, error) {
+	values := flagValues(flags)
+	covered := false
+	for _, v := range values {
+		if p, _ := flagPattern(v); p == "" || p == "all" {
+			covered = true
+		}
+	}
+	if !covered {
+		values = append([]string{""}, values...)
+	}
+
+	for i, v := range values {
+		pattern, flags := flagPattern(v)
+		flags, err := f(flags)
+		if err != nil {
+			return "", err
+		}
+		if pattern != "" {
+			flags = pattern + "=" + flags
+		}
+		values[i] = flags
+	}
+
+	return strings.Join(values, "\n"), nil
+}
@@ -0,0 +1,78 @@
+package gox
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlagValues(t *testing.T) {
+	cases := map[string][]string{
+		"":                    {""},
+		"-N -l":               {"-N -l"},
+		"-N\nall=-l\n":        {"-N", "all=-l"},
+		" all=-N -l \n\n-m  ": {"all=-N -l", "-m"},
+	}
+
+	for flags, expected := range cases {
+		if actual := flagValues(flags); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%q: bad: %#v", flags, actual)
+		}
+	}
+}
+
+func TestFlagPattern(t *testing.T) {
+	cases := []struct {
+		Value   string
+		Pattern string
+		Flags   string
+	}{
+		{"", "", ""},
+		{"-N -l", "", "-N -l"},
+		{"-X main.v=1", "", "-X main.v=1"},
+		{"all=-N -l", "all", "-N -l"},
+		{"example.com/...=-X main.v=1", "example.com/...", "-X main.v=1"},
+		{"std=", "std", ""},
+		{"=-N", "", "=-N"},
+	}
+
+	for _, tc := range cases {
+		pattern, flags := flagPattern(tc.Value)
+		if pattern != tc.Pattern || flags != tc.Flags {
+			t.Fatalf("%q: bad: %q %q", tc.Value, pattern, flags)
+		}
+	}
+}
+
+func TestEachFlagValue(t *testing.T) {
+	strip := func(flags string) (string, error) {
+		return strings.TrimSpace(flags + " -s"), nil
+	}
+
+	cases := []struct {
+		Flags    string
+		Expected string
+	}{
+		{"", "-s"},
+		{"-X main.v=1", "-X main.v=1 -s"},
+		{"all=-X main.v=1", "all=-X main.v=1 -s"},
+		{"-w\nstd=-w", "-w -s\nstd=-w -s"},
+
+		// Without a value for the packages being built, one is added
+		{"example.com/...=-w", "-s\nexample.com/...=-w -s"},
+	}
+
+	for _, tc := range cases {
+		actual, err := eachFlagValue(tc.Flags, strip)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%q: bad: %q", tc.Flags, actual)
+		}
+	}
+
+	if _, err := eachFlagValue("all=-buildid=foo", reproducibleLdflags); err == nil {
+		t.Fatal("should err")
+	}
+}
@@ -0,0 +1,185 @@
+package gox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// BuildLogs writes a log of each build of a run to a file of its own, with
+// the go commands the build ran, the variables it set for them, and
+// everything they printed. It is safe to use from multiple goroutines at
+// once.
+type BuildLogs struct {
+	dir  string
+	lock sync.Mutex
+	logs map[string]*buildLog
+}
+
+// buildLog is the log file of a build, which is created by the first go
+// command the build runs.
+type buildLog struct {
+	lock sync.Mutex
+	path string
+	f    *os.File
+	err  error
+}
+
+// NewBuildLogs returns the logs of the builds of a run, which go in dir.
+// The directory is created if it doesn't exist.
+func NewBuildLogs(dir string) (*BuildLogs, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &BuildLogs{dir: dir, logs: make(map[string]*buildLog)}, nil
+}
+
+// logNameRe matches the characters that are replaced in the names of the
+// log files, such as the slashes of package paths.
+var logNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// BuildLogPath returns the path of the log of the build with the given
+// options in dir, <goos>_<goarch>_<pkg>.log, where pkg is the import path
+// of the package, or its path if it has none, with every character that
+// isn't safe in a file name, such as a slash, replaced by an underscore.
+// The variant and libc of the platform and the version of Go come after the
+// arch, if there are any.
+func BuildLogPath(dir string, opts *CompileOpts) string {
+	pkg := opts.ImportPath
+	if pkg == "" {
+		pkg = opts.PackagePath
+	}
+	pkg = strings.Trim(logNameRe.ReplaceAllString(pkg, "_"), "_.")
+
+	parts := []string{opts.Platform.OS, opts.Platform.Arch}
+	if v := opts.Platform.Variant(); v != "" {
+		parts = append(parts, v)
+	}
+	if opts.Platform.Libc != "" {
+		parts = append(parts, opts.Platform.Libc)
+	}
+	if opts.GoVersion != "" {
+		parts = append(parts, opts.GoVersion)
+	}
+	parts = append(parts, pkg)
+
+	return filepath.Join(dir, strings.Join(parts, "_")+".log")
+}
+
+// Attach makes the build with the given options write to its log, on top
+// of calling its own OnCommand and OnOutput. The log file is created, or
+// truncated if it is left from an earlier run, when the first go command
+// of the build runs. Each retry of the build is added to the same log.
+func (l *BuildLogs) Attach(opts *CompileOpts) {
+	path := BuildLogPath(l.dir, opts)
+	l.lock.Lock()
+	log, ok := l.logs[path]
+	if !ok {
+		log = &buildLog{path: path}
+		l.logs[path] = log
+	}
+	l.lock.Unlock()
+
+	onCommand, onOutput := opts.OnCommand, opts.OnOutput
+	opts.OnCommand = func(cmd *BuildCommand) {
+		log.command(cmd)
+		if onCommand != nil {
+			onCommand(cmd)
+		}
+	}
+	opts.OnOutput = func(line string) {
+		log.printf("%s\n", line)
+		if onOutput != nil {
+			onOutput(line)
+		}
+	}
+}
+
+// Finish ends the log of the build of the result with how the build ended,
+// and closes it. An error is returned if the log couldn't be written.
+func (l *BuildLogs) Finish(r *Result) error {
+	l.lock.Lock()
+	log, ok := l.logs[BuildLogPath(l.dir, r.Opts)]
+	l.lock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case r.Err != nil:
+		log.printf("\nfailed: %s\n", strings.SplitN(r.Err.Error(), "\n", 2)[0])
+	case r.UpToDate:
+		log.printf("up to date\n")
+	default:
+		log.printf("\nok\n")
+	}
+	return log.close()
+}
+
+// command writes the go command to the log, with the directory it runs in
+// and the variables it sets, one per line.
+func (l *buildLog) command(cmd *BuildCommand) {
+	parts := []string{shellQuote(cmd.GoCmd)}
+	for _, arg := range cmd.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n", strings.Join(parts, " "))
+	if cmd.Dir != "" {
+		fmt.Fprintf(&b, "dir: %s\n", cmd.Dir)
+	}
+	for _, v := range cmd.Env {
+		fmt.Fprintf(&b, "env: %s\n", v)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// The commands of a retry, or the build after go vet, are set apart
+	// from the output before them.
+	if l.f != nil {
+		l.write("\n")
+	}
+	l.write(b.String())
+}
+
+func (l *buildLog) printf(format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.write(fmt.Sprintf(format, args...))
+}
+
+// write writes s to the log, creating it first if it doesn't exist yet.
+// The first error is kept, for close to return, and nothing more is
+// written after it.
+func (l *buildLog) write(s string) {
+	if l.err != nil {
+		return
+	}
+	if l.f == nil {
+		l.f, l.err = os.Create(l.path)
+		if l.err != nil {
+			return
+		}
+	}
+
+	_, l.err = l.f.WriteString(s)
+}
+
+func (l *buildLog) close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f != nil {
+		if err := l.f.Close(); l.err == nil {
+			l.err = err
+		}
+		l.f = nil
+	}
+
+	return l.err
+}
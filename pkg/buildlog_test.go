@@ -0,0 +1,120 @@
+package gox
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildLogPath(t *testing.T) {
+	cases := []struct {
+		Opts     CompileOpts
+		Expected string
+	}{
+		{
+			CompileOpts{
+				PackagePath: "/src/app/cmd/server",
+				ImportPath:  "example.com/app/cmd/server",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+			},
+			"linux_amd64_example.com_app_cmd_server.log",
+		},
+		{
+			CompileOpts{
+				PackagePath: "./cmd/server",
+				Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+				GoVersion:   "go1.22.3",
+			},
+			"linux_arm_v6_go1.22.3_cmd_server.log",
+		},
+		{
+			CompileOpts{
+				PackagePath: "./cmd/server",
+				Platform:    Platform{OS: "linux", Arch: "amd64", Libc: "musl"},
+			},
+			"linux_amd64_musl_cmd_server.log",
+		},
+		{
+			CompileOpts{
+				PackagePath: `C:\src\app`,
+				Platform:    Platform{OS: "windows", Arch: "amd64"},
+			},
+			"windows_amd64_C_src_app.log",
+		},
+	}
+
+	for _, tc := range cases {
+		actual := BuildLogPath("logs", &tc.Opts)
+		if actual != filepath.Join("logs", tc.Expected) {
+			t.Fatalf("bad: %s", actual)
+		}
+	}
+}
+
+func TestBuildLogs(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	dir := filepath.Join(td, "logs")
+	logs, err := NewBuildLogs(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Logs left from an earlier run are replaced
+	path := filepath.Join(dir, "linux_amd64_app.log")
+	testWriteFile(t, path, "earlier run\n")
+
+	var commands, lines int
+	opts := &CompileOpts{
+		PackagePath: "app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OnCommand:   func(*BuildCommand) { commands++ },
+		OnOutput:    func(string) { lines++ },
+	}
+	logs.Attach(opts)
+
+	cmd := &BuildCommand{
+		GoCmd: "go",
+		Args:  []string{"build", "-o", "app linux", "app"},
+		Env:   []string{"GOOS=linux", "GOARCH=amd64"},
+	}
+	opts.OnCommand(cmd)
+	opts.OnOutput("# app")
+	opts.OnOutput("./main.go:3:2: undefined: x")
+	opts.OnCommand(cmd)
+	if commands != 2 || lines != 2 {
+		t.Fatalf("bad: %d %d", commands, lines)
+	}
+
+	err = logs.Finish(&Result{Opts: opts, Err: errors.New("exit status 2\nStderr: # app")})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	command := "$ go build -o 'app linux' app\nenv: GOOS=linux\nenv: GOARCH=amd64\n"
+	expected := command + "# app\n./main.go:3:2: undefined: x\n\n" + command + "\nfailed: exit status 2\n"
+	if string(data) != expected {
+		t.Fatalf("bad: %s", data)
+	}
+
+	// Builds that weren't attached have no log
+	other := &CompileOpts{PackagePath: "app", Platform: Platform{OS: "darwin", Arch: "arm64"}}
+	if err := logs.Finish(&Result{Opts: other}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(files) != 1 || strings.Contains(files[0].Name(), "darwin") {
+		t.Fatalf("bad: %#v", files)
+	}
+}
@@ -0,0 +1,112 @@
+package gox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// buildmodePlatforms maps the build modes gox supports to the platforms
+// that support them, as "os/arch" or "os/*" for every arch of an OS. Modes
+// that every platform supports map to nil.
+var buildmodePlatforms = map[string][]string{
+	"default": nil,
+	"exe":     nil,
+	"pie": {
+		"aix/ppc64",
+		"android/*",
+		"darwin/*",
+		"freebsd/amd64",
+		"ios/*",
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64",
+		"linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x",
+		"windows/386", "windows/amd64", "windows/arm", "windows/arm64",
+	},
+	"c-shared": {
+		"android/*",
+		"darwin/amd64", "darwin/arm64",
+		"freebsd/amd64",
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64",
+		"linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x",
+		"windows/386", "windows/amd64", "windows/arm64",
+	},
+	"c-archive": {
+		"aix/ppc64",
+		"android/*",
+		"darwin/*",
+		"freebsd/amd64",
+		"ios/*",
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64",
+		"linux/loong64", "linux/ppc64le", "linux/riscv64", "linux/s390x",
+		"windows/*",
+	},
+}
+
+// ValidBuildmode returns an error if gox doesn't know the given build
+// mode. An empty mode is valid and leaves the flag unset.
+func ValidBuildmode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	if _, ok := buildmodePlatforms[mode]; ok {
+		return nil
+	}
+
+	modes := make([]string, 0, len(buildmodePlatforms))
+	for m := range buildmodePlatforms {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+
+	return fmt.Errorf("invalid -buildmode value %q, must be one of: %s",
+		mode, strings.Join(modes, ", "))
+}
+
+// SupportsBuildmode returns true if the given build mode can be used when
+// building for this platform.
+func (p *Platform) SupportsBuildmode(mode string) bool {
+	if mode == "" {
+		return true
+	}
+
+	supported, ok := buildmodePlatforms[mode]
+	if !ok {
+		return false
+	}
+	if supported == nil {
+		return true
+	}
+
+	for _, s := range supported {
+		if s == p.OS+"/"+p.Arch || s == p.OS+"/*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildmodeNeedsCgo returns true if the build mode requires cgo.
+func buildmodeNeedsCgo(mode string) bool {
+	return mode == "c-shared" || mode == "c-archive"
+}
+
+// buildmodeExt returns the file extension of the output of the given build
+// mode for the platform, such as ".so" for a c-shared library on Linux.
+func buildmodeExt(mode string, p Platform) string {
+	switch mode {
+	case "c-shared":
+		switch p.OS {
+		case "windows":
+			return ".dll"
+		case "darwin", "ios":
+			return ".dylib"
+		default:
+			return ".so"
+		}
+	case "c-archive":
+		return ".a"
+	default:
+		return p.ExeSuffix()
+	}
+}
@@ -0,0 +1,41 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestValidBuildmode(t *testing.T) {
+	for _, mode := range []string{"", "default", "exe", "pie", "c-shared", "c-archive"} {
+		if err := ValidBuildmode(mode); err != nil {
+			t.Fatalf("%s: err: %s", mode, err)
+		}
+	}
+
+	if err := ValidBuildmode("shared-lib"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestPlatformSupportsBuildmode(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Mode     string
+		Expected bool
+	}{
+		{Platform{OS: "linux", Arch: "mips"}, "", true},
+		{Platform{OS: "linux", Arch: "mips"}, "exe", true},
+		{Platform{OS: "linux", Arch: "amd64"}, "pie", true},
+		{Platform{OS: "openbsd", Arch: "386"}, "pie", false},
+		{Platform{OS: "darwin", Arch: "arm64"}, "c-shared", true},
+		{Platform{OS: "linux", Arch: "mips"}, "c-shared", false},
+		{Platform{OS: "windows", Arch: "arm"}, "c-archive", true},
+		{Platform{OS: "linux", Arch: "amd64"}, "nope", false},
+	}
+
+	for _, tc := range cases {
+		actual := tc.Platform.SupportsBuildmode(tc.Mode)
+		if actual != tc.Expected {
+			t.Fatalf("%s %s: bad: %v", tc.Platform.String(), tc.Mode, actual)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package gox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// cgoSetting is whether cgo is enabled for a platform, and whether that
+// was asked for explicitly rather than left to the default.
+type cgoSetting struct {
+	Enabled  bool
+	Explicit bool
+}
+
+// resolveCgo returns the cgo setting of each of the platforms, keyed by
+// the platform string. Cgo is enabled for every platform if all is true,
+// or for the platforms listed in only. GOX_[OS]_[ARCH]_CGO overrides both.
+func resolveCgo(platforms []Platform, all bool, only []Platform) (map[string]cgoSetting, error) {
+	listed := make(map[string]struct{}, len(only))
+	for _, p := range only {
+		listed[p.String()] = struct{}{}
+	}
+
+	result := make(map[string]cgoSetting, len(platforms))
+	for _, p := range platforms {
+		_, ok := listed[p.String()]
+		setting := cgoSetting{
+			Enabled:  all || ok,
+			Explicit: all || len(only) > 0,
+		}
+
+		if v := envOverrideValue(p, "CGO"); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"invalid cgo setting for %s: %q", p.String(), v)
+			}
+
+			setting = cgoSetting{Enabled: enabled, Explicit: true}
+		}
+
+		result[p.String()] = setting
+	}
+
+	return result, nil
+}
+
+// cgoProbeSource is a program that uses cgo in the simplest way possible,
+// to check that a C toolchain works.
+const cgoProbeSource = `package main
+
+// int probe(void) { return 0; }
+import "C"
+
+func main() { C.probe() }
+`
+
+// CheckCgoToolchain checks that there is a working C toolchain for the
+// platform of the given options, by building a trivial cgo program with
+// the same environment that the real build would have.
+func CheckCgoToolchain(opts *CompileOpts) error {
+	probe := *opts
+	probe.Cgo = true
+	env, err := goBuildEnv(&probe)
+	if err != nil {
+		return err
+	}
+
+	// The probe is its own module, so it mustn't pick up flags such as
+	// -mod=vendor meant for the real build.
+	env = append(env, "GOFLAGS=")
+
+	dir, err := ioutil.TempDir("", "gox-cgo")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":  "module probe\n",
+		"main.go": cgoProbeSource,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+
+	_, err = execGo(opts.GoCmd, env, dir, "build", "-o", filepath.Join(dir, "probe"), ".")
+	return err
+}
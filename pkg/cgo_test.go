@@ -0,0 +1,126 @@
+package gox
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestResolveCgo(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "windows", Arch: "amd64"},
+	}
+
+	cases := []struct {
+		All      bool
+		Only     []Platform
+		Env      map[string]string
+		Expected map[string]cgoSetting
+	}{
+		{
+			false,
+			nil,
+			nil,
+			map[string]cgoSetting{
+				"linux/amd64":   {false, false},
+				"darwin/arm64":  {false, false},
+				"windows/amd64": {false, false},
+			},
+		},
+		{
+			true,
+			nil,
+			nil,
+			map[string]cgoSetting{
+				"linux/amd64":   {true, true},
+				"darwin/arm64":  {true, true},
+				"windows/amd64": {true, true},
+			},
+		},
+		{
+			false,
+			[]Platform{{OS: "linux", Arch: "amd64"}},
+			nil,
+			map[string]cgoSetting{
+				"linux/amd64":   {true, true},
+				"darwin/arm64":  {false, true},
+				"windows/amd64": {false, true},
+			},
+		},
+		{
+			true,
+			nil,
+			map[string]string{
+				"GOX_WINDOWS_AMD64_CGO": "0",
+			},
+			map[string]cgoSetting{
+				"linux/amd64":   {true, true},
+				"darwin/arm64":  {true, true},
+				"windows/amd64": {false, true},
+			},
+		},
+		{
+			false,
+			nil,
+			map[string]string{
+				"GOX_DARWIN_ARM64_CGO": "1",
+			},
+			map[string]cgoSetting{
+				"linux/amd64":   {false, false},
+				"darwin/arm64":  {true, true},
+				"windows/amd64": {false, false},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		for k, v := range tc.Env {
+			os.Setenv(k, v)
+		}
+
+		actual, err := resolveCgo(platforms, tc.All, tc.Only)
+
+		for k := range tc.Env {
+			os.Unsetenv(k)
+		}
+
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestResolveCgo_invalid(t *testing.T) {
+	os.Setenv("GOX_LINUX_AMD64_CGO", "sometimes")
+	defer os.Unsetenv("GOX_LINUX_AMD64_CGO")
+
+	_, err := resolveCgo([]Platform{{OS: "linux", Arch: "amd64"}}, false, nil)
+	if err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestCheckCgoToolchain(t *testing.T) {
+	host := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	opts := &CompileOpts{Platform: host, GoCmd: "go", CC: "gox-no-such-cc"}
+	if err := CheckCgoToolchain(opts); err == nil {
+		t.Fatal("should err")
+	}
+
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler found")
+	}
+
+	opts = &CompileOpts{Platform: host, GoCmd: "go", CC: "cc"}
+	if err := CheckCgoToolchain(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
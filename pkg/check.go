@@ -0,0 +1,89 @@
+package gox
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkSource is the program CheckPlatforms builds for each platform, and
+// checkCgoSource the one for the platforms that build with cgo, which
+// needs the C toolchain as well.
+const (
+	checkSource = `package main
+
+func main() {}
+`
+	checkCgoSource = `package main
+
+// int answer(void) { return 42; }
+import "C"
+
+func main() { C.answer() }
+`
+)
+
+// CheckPlatforms checks that every platform of the configuration can
+// really be built for, by building a tiny program for each of them into
+// a temporary directory that is removed afterwards. This catches what a
+// real build would fail on, such as a standard library that isn't there,
+// a missing C toolchain for a platform with cgo, or a platform this
+// version of Go doesn't support.
+//
+// The packages, outputs and hooks of the configuration are ignored, and
+// nothing is up to date. The rest applies as for a real build: the checks
+// run Parallel at a time, and Configure, the cgo settings, C compilers,
+// tags and flags of the options are used. There is a result for each
+// platform, in order, whose Err is why the platform can't be built for.
+// Their outputs are gone, so Output is empty.
+func CheckPlatforms(ctx context.Context, cfg BuildConfig) ([]Result, error) {
+	td, err := ioutil.TempDir("", "gox-check")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(td)
+
+	// The programs are built as files rather than as packages, so that
+	// go builds them even though they are outside of the module in the
+	// current directory.
+	plain := filepath.Join(td, "main.go")
+	withCgo := filepath.Join(td, "cgo", "main.go")
+	if err := os.MkdirAll(filepath.Dir(withCgo), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(plain, []byte(checkSource), 0644); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(withCgo, []byte(checkCgoSource), 0644); err != nil {
+		return nil, err
+	}
+
+	configure := cfg.Configure
+	cfg.Packages = []string{plain}
+	cfg.Filter = nil
+	cfg.UpToDate = nil
+	cfg.PreBuild = nil
+	cfg.PostBuild = nil
+	cfg.Configure = func(opts *CompileOpts) {
+		if configure != nil {
+			configure(opts)
+		}
+
+		opts.OutputDir = td
+		opts.OutputTpl = "check_{{.OS}}_{{.Arch}}_{{.Variant}}_{{.Libc}}{{.Exe}}"
+		opts.Mode = ModeBuild
+		opts.Vet = false
+		opts.Mod = ""
+		if UsesCgo(opts) {
+			opts.PackagePath = withCgo
+		}
+	}
+
+	results, err := Build(ctx, cfg)
+	for i := range results {
+		results[i].Output = ""
+	}
+
+	return results, err
+}
@@ -0,0 +1,49 @@
+package gox
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestCheckPlatforms(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	host := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	cfg := BuildConfig{
+		Platforms: []Platform{host, {OS: "gox", Arch: "nope"}},
+		Opts: CompileOpts{
+			OutputDir: td,
+			GoCmd:     "go",
+		},
+		Configure: func(opts *CompileOpts) {
+			opts.CgoSet = true
+		},
+	}
+
+	results, err := CheckPlatforms(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("bad: %#v", results)
+	}
+	if results[0].Platform != host || results[0].Err != nil || results[0].Output != "" {
+		t.Fatalf("bad: %#v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Fatal("should err")
+	}
+
+	// Nothing is written to the output directory
+	entries, err := ioutil.ReadDir(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("bad: %#v", entries)
+	}
+}
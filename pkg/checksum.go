@@ -0,0 +1,159 @@
+package gox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ChecksumFile is the default name of the checksum file.
+const ChecksumFile = "SHA256SUMS"
+
+// ChecksumAlgos are the hash algorithms that checksums can be made with.
+// BLAKE2b is the 512-bit one that b2sum makes.
+var ChecksumAlgos = []string{"sha256", "sha512", "blake2b"}
+
+// ChecksumFileName returns the default name of the checksum file of the
+// algorithm, such as SHA512SUMS, or B2SUMS for BLAKE2b as b2sum names it.
+func ChecksumFileName(algo string) string {
+	if algo == "blake2b" {
+		return "B2SUMS"
+	}
+
+	return strings.ToUpper(algo) + "SUMS"
+}
+
+// ValidChecksumAlgo returns an error if algo isn't one of ChecksumAlgos.
+func ValidChecksumAlgo(algo string) error {
+	_, err := newChecksumHash(algo)
+	return err
+}
+
+func newChecksumHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "blake2b":
+		return blake2b.New512(nil)
+	default:
+		return nil, fmt.Errorf("unknown checksum algorithm %q, must be one of: %s",
+			algo, strings.Join(ChecksumAlgos, ", "))
+	}
+}
+
+// WriteChecksums writes a checksum file to path covering the given files,
+// in the same "<hex>  <filename>" format as sha256sum, with the given
+// algorithm. File names are relative to the directory of the checksum
+// file, and are sorted so that the file is the same for the same
+// artifacts.
+func WriteChecksums(path, algo string, files []string) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	sums := make(map[string]string, len(files))
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		sum, err := FileChecksum(file, algo)
+		if err != nil {
+			return err
+		}
+
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, abs)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		sums[name] = sum
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return writeChecksumLines(path, sums, names)
+}
+
+// WriteFileChecksum writes the checksum of a single file next to it, to
+// the path of the file with the algorithm as an extension, such as
+// app.zip.sha256, and returns that path. It has the same format as
+// WriteChecksums, with the base name of the file.
+func WriteFileChecksum(file, algo string) (string, error) {
+	sum, err := FileChecksum(file, algo)
+	if err != nil {
+		return "", err
+	}
+
+	path := file + "." + algo
+	name := filepath.Base(file)
+	return path, writeChecksumLines(path, map[string]string{name: sum}, []string{name})
+}
+
+// isChecksumFile returns true if the file is a checksum file by its name,
+// either one that covers many files, such as SHA256SUMS, or the checksum
+// of a single file, such as app.zip.sha256.
+func isChecksumFile(file string) bool {
+	for _, algo := range ChecksumAlgos {
+		if strings.HasSuffix(file, ChecksumFileName(algo)) ||
+			strings.HasSuffix(file, "."+algo) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeChecksumLines writes the sums of the named files to path, one
+// "<hex>  <filename>" line each, in the order of names.
+func writeChecksumLines(path string, sums map[string]string, names []string) error {
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", sums[name], name)
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// FileChecksum returns the hex-encoded checksum of the file at path with
+// the given algorithm. The file is read through the hash as it goes, so
+// large files aren't read into memory.
+func FileChecksum(path, algo string) (string, error) {
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sha256File returns the hex-encoded SHA-256 hash of the file at path.
+func sha256File(path string) (string, error) {
+	return FileChecksum(path, "sha256")
+}
@@ -0,0 +1,129 @@
+package gox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	if err := os.MkdirAll(filepath.Join(td, "linux"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(td, "linux", "app"), "foo")
+	testWriteFile(t, filepath.Join(td, "app.exe"), "bar")
+
+	path := filepath.Join(td, ChecksumFile)
+	files := []string{
+		filepath.Join(td, "linux", "app"),
+		filepath.Join(td, "app.exe"),
+	}
+	if err := WriteChecksums(path, "sha256", files); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9  app.exe\n" +
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  linux/app\n"
+	if string(data) != expected {
+		t.Fatalf("bad: %s", data)
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	cases := []struct {
+		Algo     string
+		Data     string
+		Expected string
+	}{
+		{"sha256", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"sha256", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{
+			"sha512", "",
+			"cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce" +
+				"47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+		},
+		{
+			"sha512", "abc",
+			"ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a" +
+				"2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+		},
+		{
+			"blake2b", "",
+			"786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419" +
+				"d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce",
+		},
+		{
+			"blake2b", "abc",
+			"ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d1" +
+				"7d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923",
+		},
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "app")
+	for _, tc := range cases {
+		testWriteFile(t, path, tc.Data)
+		actual, err := FileChecksum(path, tc.Algo)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%s %q: bad: %s", tc.Algo, tc.Data, actual)
+		}
+	}
+
+	if _, err := FileChecksum(path, "md5"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestWriteFileChecksum(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	file := filepath.Join(td, "app.zip")
+	testWriteFile(t, file, "foo")
+
+	path, err := WriteFileChecksum(file, "sha256")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != file+".sha256" {
+		t.Fatalf("bad: %s", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae  app.zip\n"
+	if string(data) != expected {
+		t.Fatalf("bad: %s", data)
+	}
+}
+
+func TestChecksumFileName(t *testing.T) {
+	cases := map[string]string{
+		"sha256":  "SHA256SUMS",
+		"sha512":  "SHA512SUMS",
+		"blake2b": "B2SUMS",
+	}
+
+	for algo, expected := range cases {
+		if actual := ChecksumFileName(algo); actual != expected {
+			t.Fatalf("%s: bad: %s", algo, actual)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CleanFiles returns the files that the builds of the configuration write,
+// which may have been left by earlier runs: the output of every build and
+// its archive in each of ArchiveFormats. Builds whose output path can't be
+// rendered are skipped.
+func CleanFiles(cfg BuildConfig) []string {
+	var files []string
+	for _, opts := range cfg.builds() {
+		output, err := OutputPath(&opts)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, output)
+		for _, format := range ArchiveFormats {
+			files = append(files, output+"."+format)
+		}
+	}
+
+	return files
+}
+
+// Clean removes the given files and returns the ones it removed. Only
+// regular files inside the directory root are removed, anything else is
+// left alone, as are files that don't exist. If dryRun is true, nothing is
+// removed and the files that would be are returned.
+func Clean(files []string, root string, dryRun bool) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return removed, err
+		}
+		if seen[abs] || !insideDir(root, abs) {
+			continue
+		}
+		seen[abs] = true
+
+		fi, err := os.Lstat(abs)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(abs); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, file)
+	}
+
+	return removed, nil
+}
+
+// insideDir returns true if the absolute path is inside the absolute
+// directory dir.
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != "." && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator)) &&
+		!filepath.IsAbs(rel)
+}
@@ -0,0 +1,69 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCleanFiles(t *testing.T) {
+	files := CleanFiles(BuildConfig{
+		Packages:  []string{"github.com/foo/app"},
+		Platforms: []Platform{{OS: "windows", Arch: "amd64"}},
+		Opts:      CompileOpts{OutputTpl: DefaultOutputTpl, OutputDir: "dist"},
+	})
+
+	output := filepath.Join("dist", "app_windows_amd64.exe")
+	expected := []string{output, output + ".zip", output + ".tar.gz"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("bad: %#v", files)
+	}
+}
+
+func TestClean(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	root := filepath.Join(td, "dist")
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	binary := filepath.Join(root, "app_linux_amd64")
+	outside := filepath.Join(td, "app_linux_amd64")
+	testWriteFile(t, binary, "")
+	testWriteFile(t, outside, "")
+
+	files := []string{
+		binary,
+		binary + ".zip",
+		outside,
+		filepath.Join(root, "sub"),
+		filepath.Join(root, "..", "app_linux_amd64"),
+	}
+
+	removed, err := Clean(files, root, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(removed, []string{binary}) {
+		t.Fatalf("bad: %#v", removed)
+	}
+	if _, err := os.Stat(binary); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	removed, err = Clean(files, root, false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(removed, []string{binary}) {
+		t.Fatalf("bad: %#v", removed)
+	}
+	if _, err := os.Stat(binary); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
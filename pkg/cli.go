@@ -2,180 +2,2313 @@
 package gox
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"text/template"
 	"time"
 )
 
 var VERSION string
 
+// exitInterrupted is the exit code when the builds were cancelled by a
+// signal, following the shell convention of 128 plus SIGINT.
+const exitInterrupted = 130
+
+// buildCancelTimeout is how long to wait for cancelled builds to stop.
+const buildCancelTimeout = 10 * time.Second
+
 func MainCLI() int {
 	var buildToolchain bool
 	var ldflags string
-	var outputTpl string
-	var parallel int
+	var outputTpl, outputDir string
+	parallelFlag := ParallelValue(ParallelAuto)
 	var platformFlag PlatformFlag
 	var tags string
 	var verbose, version bool
 
-	var flagGcflags, flagAsmflags string
-	var flagCgo, flagRebuild, flagListOSArch bool
-	var flagGoCmd string
-	flags := flag.NewFlagSet("gox", flag.ExitOnError)
-	flags.Usage = func() { printUsage() }
-	flags.Var(platformFlag.ArchFlagValue(), "arch", "arch to build for or skip")
-	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "os/arch pairs to build for or skip")
-	flags.Var(platformFlag.OSFlagValue(), "os", "os to build for or skip")
-	flags.StringVar(&ldflags, "ldflags", "", "linker flags")
-	flags.StringVar(&tags, "tags", "", "go build tags")
-	flags.StringVar(&outputTpl, "output", "{{.Dir}}_{{.OS}}_{{.Arch}}", "output path")
-	flags.IntVar(&parallel, "parallel", -1, "parallelization factor")
-	flags.BoolVar(&buildToolchain, "build-toolchain", false, "build toolchain")
-	flags.BoolVar(&version, "version", false, "version")
-	flags.BoolVar(&verbose, "verbose", false, "verbose")
-	flags.BoolVar(&flagCgo, "cgo", false, "")
-	flags.BoolVar(&flagRebuild, "rebuild", false, "")
-	flags.BoolVar(&flagListOSArch, "osarch-list", false, "")
-	flags.StringVar(&flagGcflags, "gcflags", "", "")
-	flags.StringVar(&flagAsmflags, "asmflags", "", "")
-	flags.StringVar(&flagGoCmd, "gocmd", "go", "")
-	if err := flags.Parse(os.Args[1:]); err != nil {
-		flags.Usage()
-		return 1
+	var flagGcflags, flagAsmflags string
+	var flagCgo, flagRebuild, flagListOSArch bool
+	var cgoOSArch []Platform
+	var flagCgoSkipMissing bool
+	var flagParallelCgo int
+	flagGoCacheMode := GoCacheShared
+	var flagFailFast FailFastMode
+	var flagPartialOK bool
+	var flagLogDir string
+	flagLogLevel := LogInfo
+	var flagRequiredOSArch string
+	var flagRetries int
+	var flagJSON, flagProgress, flagQuiet bool
+	var flagColor, flagNoColor bool
+	var flagTiming, flagReportSize bool
+	var flagManifest string
+	var flagDryRun, flagX bool
+	var flagForceOverwrite, flagClean bool
+	var flagEnv EnvFlag
+	var flagCleanEnv bool
+	var flagStrictGoflags, flagIgnoreGoflags bool
+	var flagWatch, flagGenerate bool
+	var flagPreHook, flagPostHook string
+	var flagUPX bool
+	var flagWinRes, flagWinIcon string
+	var flagUPXArgs string
+	var flagRace, flagRaceStrict bool
+	var flagTrimpath, flagStrip bool
+	var flagWindowsGUI, flagStatic bool
+	var flagDarwinUniversal, flagDarwinUniversalOnly bool
+	var flagDarwinSign string
+	var flagReproducible, flagVerifyReproducible bool
+	var flagStampVersion, flagStampCommit, flagStampDate stampVarsValue
+	flagEnvOverrideMode := EnvOverrideReplace
+	var flagMod, flagBuildmode, flagBuildVCS, flagPGO, flagOverlay string
+	var flagInstallSuffix string
+	var flagAndroidAPI int
+	var flagGoCmd, flagConfig, flagProfile string
+	var flagOSArchFile string
+	var flagTest bool
+	var flagVet, flagVetOnly bool
+	var flagCheck bool
+	var flagGoVersions string
+	var flagRequireMain bool
+	var flagIncremental, flagState, flagResume bool
+	var flagStateFile string
+	var flagArchive string
+	var flagArchiveRmBinary bool
+	var flagChecksum, flagChecksumPerFile bool
+	var flagChecksumFile string
+	var flagChecksumAlgos []string
+	var flagSignKey, flagGPGCmd string
+	var flagUpload string
+	var uploadOpts UploadOpts
+	flags := flag.NewFlagSet("gox", flag.ExitOnError)
+	flags.Usage = func() { printUsage() }
+	flags.Var(platformFlag.ArchFlagValue(), "arch", "arch to build for or skip")
+	flags.Var(platformFlag.OSArchFlagValue(), "osarch", "os/arch pairs to build for or skip")
+	flags.Var(platformFlag.OSFlagValue(), "os", "os to build for or skip")
+	flags.StringVar(&ldflags, "ldflags", "", "linker flags")
+	flags.StringVar(&tags, "tags", "", "go build tags")
+	flags.StringVar(&outputTpl, "output", DefaultOutputTpl, "output path")
+	flags.StringVar(&outputDir, "output-dir", "", "output directory")
+	flags.Var(&parallelFlag, "parallel", "parallelization factor")
+	flags.BoolVar(&buildToolchain, "build-toolchain", false, "")
+	flags.BoolVar(&buildToolchain, "warm-std", false, "")
+	flags.BoolVar(&flagCheck, "check", false, "")
+	flags.StringVar(&flagGoVersions, "goversions", "", "")
+	flags.BoolVar(&version, "version", false, "version")
+	flags.BoolVar(&verbose, "verbose", false, "verbose")
+	flags.BoolVar(&flagCgo, "cgo", false, "")
+	flags.Var((*appendPlatformValue)(&cgoOSArch), "cgo-osarch", "")
+	flags.BoolVar(&flagCgoSkipMissing, "cgo-skip-missing", false, "")
+	flags.IntVar(&flagParallelCgo, "parallel-cgo", -1, "")
+	flags.Var(&flagGoCacheMode, "gocache-mode", "")
+	flags.Var(&flagFailFast, "fail-fast", "")
+	flags.BoolVar(&flagPartialOK, "partial-ok", false, "")
+	flags.StringVar(&flagLogDir, "log-dir", "", "")
+	flags.Var(&flagLogLevel, "log-level", "")
+	flags.StringVar(&flagRequiredOSArch, "required-osarch", "", "")
+	flags.IntVar(&flagRetries, "retries", 0, "")
+	flags.BoolVar(&flagJSON, "json", false, "")
+	flags.BoolVar(&flagProgress, "progress", false, "")
+	flags.BoolVar(&flagQuiet, "quiet", false, "")
+	flags.BoolVar(&flagQuiet, "q", false, "")
+	flags.BoolVar(&flagColor, "color", false, "")
+	flags.BoolVar(&flagNoColor, "no-color", false, "")
+	flags.BoolVar(&flagTiming, "timing", false, "")
+	flags.BoolVar(&flagReportSize, "report-size", false, "")
+	flags.StringVar(&flagManifest, "manifest", "", "")
+	flags.BoolVar(&flagDryRun, "dry-run", false, "")
+	flags.BoolVar(&flagX, "x", false, "")
+	flags.BoolVar(&flagForceOverwrite, "force-overwrite", false, "")
+	flags.BoolVar(&flagClean, "clean", false, "")
+	flags.BoolVar(&flagWatch, "watch", false, "")
+	flags.BoolVar(&flagGenerate, "generate", false, "")
+	flags.StringVar(&flagPreHook, "pre-hook", "", "")
+	flags.StringVar(&flagPostHook, "post-hook", "", "")
+	flags.BoolVar(&flagUPX, "upx", false, "")
+	flags.StringVar(&flagUPXArgs, "upx-args", "", "")
+	flags.StringVar(&flagWinRes, "winres", "", "")
+	flags.StringVar(&flagWinIcon, "winicon", "", "")
+	flags.BoolVar(&flagRebuild, "rebuild", false, "")
+	flags.BoolVar(&flagIncremental, "incremental", false, "")
+	flags.BoolVar(&flagState, "state", false, "")
+	flags.StringVar(&flagStateFile, "state-file", DefaultStateFile, "")
+	flags.BoolVar(&flagResume, "resume", false, "")
+	flags.BoolVar(&flagRace, "race", false, "")
+	flags.BoolVar(&flagRaceStrict, "race-strict", false, "")
+	flags.BoolVar(&flagTrimpath, "trimpath", false, "")
+	flags.BoolVar(&flagStrip, "strip", false, "")
+	flags.BoolVar(&flagWindowsGUI, "windows-gui", false, "")
+	flags.BoolVar(&flagStatic, "static", false, "")
+	flags.BoolVar(&flagDarwinUniversal, "darwin-universal", false, "")
+	flags.BoolVar(&flagDarwinUniversalOnly, "darwin-universal-only", false, "")
+	flags.StringVar(&flagDarwinSign, "darwin-sign", "", "")
+	flags.BoolVar(&flagTest, "test", false, "")
+	flags.BoolVar(&flagVet, "vet", false, "")
+	flags.BoolVar(&flagVetOnly, "vet-only", false, "")
+	flags.BoolVar(&flagRequireMain, "require-main", false, "")
+	flags.BoolVar(&flagReproducible, "reproducible", false, "")
+	flags.BoolVar(&flagVerifyReproducible, "verify-reproducible", false, "")
+	flags.Var(&flagStampVersion, "stamp-version", "")
+	flags.Var(&flagStampCommit, "stamp-commit", "")
+	flags.Var(&flagStampDate, "stamp-date", "")
+	flags.Var(&flagEnvOverrideMode, "env-override-mode", "")
+	flags.Var(&flagEnv, "env", "")
+	flags.BoolVar(&flagCleanEnv, "clean-env", false, "")
+	flags.BoolVar(&flagStrictGoflags, "strict-goflags", false, "")
+	flags.BoolVar(&flagIgnoreGoflags, "ignore-goflags", false, "")
+	flags.StringVar(&flagMod, "mod", "", "")
+	flags.StringVar(&flagBuildVCS, "buildvcs", "", "")
+	flags.StringVar(&flagPGO, "pgo", "", "")
+	flags.StringVar(&flagOverlay, "overlay", "", "")
+	flags.StringVar(&flagBuildmode, "buildmode", "", "")
+	flags.StringVar(&flagInstallSuffix, "installsuffix", "", "")
+	flags.IntVar(&flagAndroidAPI, "android-api", DefaultAndroidAPI, "")
+	flags.BoolVar(&flagListOSArch, "osarch-list", false, "")
+	flags.StringVar(&flagOSArchFile, "osarch-file", "", "")
+	flags.BoolVar(&platformFlag.PrimaryOnly, "primary-only", false, "")
+	flags.StringVar(&flagGcflags, "gcflags", "", "")
+	flags.StringVar(&flagAsmflags, "asmflags", "", "")
+	flags.StringVar(&flagGoCmd, "gocmd", "go", "")
+	flags.StringVar(&flagConfig, "config", "", "config file")
+	flags.StringVar(&flagProfile, "profile", DefaultProfile, "")
+	flags.StringVar(&flagArchive, "archive", "", "")
+	flags.BoolVar(&flagArchiveRmBinary, "archive-rm-binary", false, "")
+	flags.BoolVar(&flagChecksum, "checksum", false, "")
+	flags.StringVar(&flagChecksumFile, "checksum-file", "", "")
+	flags.Var((*appendStringValue)(&flagChecksumAlgos), "checksum-algo", "")
+	flags.BoolVar(&flagChecksumPerFile, "checksum-per-file", false, "")
+	flags.StringVar(&flagSignKey, "sign-key", "", "")
+	flags.StringVar(&flagGPGCmd, "gpg-cmd", "gpg", "")
+	flags.StringVar(&flagUpload, "upload", "", "")
+	flags.StringVar(&uploadOpts.Repo, "upload-repo", "", "")
+	flags.StringVar(&uploadOpts.Tag, "upload-tag", "", "")
+	flags.BoolVar(&uploadOpts.Draft, "upload-draft", false, "")
+	flags.StringVar(&uploadOpts.ACL, "upload-acl", "", "")
+	flags.StringVar(&uploadOpts.Endpoint, "upload-endpoint", "", "")
+	flags.StringVar(&uploadOpts.CacheControl, "upload-cache-control", "", "")
+	flags.BoolVar(&uploadOpts.DryRun, "upload-dry-run", false, "")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		flags.Usage()
+		return 1
+	}
+
+	// Load the config file, if there is one, and layer the selected profile
+	// and the environment on top of it. These values are only used for
+	// flags that weren't set on the command-line.
+	var config *Config
+	var err error
+	if flagConfig != "" {
+		config, err = LoadConfig(flagConfig)
+	} else {
+		config, err = LoadDefaultConfig()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	profile, err := config.Profile(flagProfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	config.Merge(profile)
+	envConfig, err := ConfigFromEnv(os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+	config.Merge(envConfig)
+	if err := config.Apply(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		return 1
+	}
+
+	if flagOSArchFile != "" {
+		if err := platformFlag.ReadOSArchFile(flagOSArchFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading -osarch-file: %s\n", err)
+			return 1
+		}
+	}
+
+	if flagQuiet && (verbose || flagJSON) {
+		fmt.Fprintf(os.Stderr, "-quiet can't be used with -verbose or -json\n")
+		return 1
+	}
+
+	// With -json, stdout is reserved for the events and everything else
+	// goes to stderr. With -quiet, only errors and the artifacts of a
+	// successful run are printed. Above -log-level=info, the usual output
+	// isn't printed either, and only the warnings, if they're let through,
+	// and the errors are.
+	out := io.Writer(os.Stdout)
+	var events *EventWriter
+	if flagJSON {
+		out = os.Stderr
+		events = NewEventWriter(os.Stdout)
+	}
+	if flagQuiet || flagLogLevel > LogInfo {
+		out = ioutil.Discard
+	}
+	outColors := newColors(out, flagColor, flagNoColor)
+	logger := &ConsoleLogger{Out: out, Err: os.Stderr, Level: flagLogLevel}
+
+	// Like go build, build for GOOS and GOARCH if they're set and no
+	// platforms were asked for.
+	if platformFlag.DefaultFromEnv(os.Getenv) {
+		var vars []string
+		for _, key := range []string{"GOOS", "GOARCH"} {
+			if v := os.Getenv(key); v != "" {
+				vars = append(vars, key+"="+v)
+			}
+		}
+		fmt.Fprintf(out, "Building for %s from the environment\n", strings.Join(vars, " "))
+	}
+	errColors := newColors(os.Stderr, flagColor, flagNoColor)
+
+	// Determine what amount of parallelism we want. The flag was checked
+	// when it was set, so this can't fail.
+	parallel, _ := parallelFlag.Parallel(runtime.NumCPU(), runtime.GOOS)
+
+	// Builds with cgo run one at a time by default when -cgo is set, since
+	// running a C compiler for every platform at once takes a lot of
+	// memory. Otherwise they are only limited by -parallel.
+	if flagParallelCgo < 0 {
+		flagParallelCgo = 0
+		if flagCgo {
+			flagParallelCgo = 1
+		}
+	}
+
+	if version {
+		printInfo()
+		os.Exit(0)
+		return 1
+	}
+
+	if buildToolchain {
+		return mainBuildToolchain(parallel, platformFlag, flagGoCmd, flagCgo,
+			flagGoCacheMode, verbose, logger)
+	}
+
+	if _, err := exec.LookPath(flagGoCmd); err != nil {
+		fmt.Fprintf(os.Stderr, "%s executable must be on the PATH\n",
+			flagGoCmd)
+		return 1
+	}
+
+	goEnv, err := GoEnvironment(flagGoCmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading Go version: %s", err)
+		return 1
+	}
+	goVersion := goEnv.GoVersion
+	logAt(logger, LogDebug, "%s is %s, with GOROOT %s", flagGoCmd, goVersion, goEnv.GoRoot)
+	if _, err := ParseGoVersion(goVersion); err != nil {
+		logAt(logger, LogWarn,
+			"%s, assuming it supports the platforms of the latest Go release", err)
+	}
+
+	// With -goversions, everything is built with each of the versions of
+	// Go given, which go switches to with GOTOOLCHAIN.
+	var goVersions []string
+	if fields := strings.Fields(flagGoVersions); len(fields) > 0 {
+		goVersions, err = CheckGoToolchains(goVersion, fields)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -goversions: %s\n", err)
+			return 1
+		}
+	}
+
+	// Platforms may be built with another go command than -gocmd, such as
+	// a patched Go, set per-platform in the config file and the
+	// environment, in that order of precedence. The platforms each of them
+	// supports are listed with its own version of Go.
+	platformGoCmd := func(platform Platform) string {
+		cmd := flagGoCmd
+		if v := config.PlatformGoCmd(platform); v != "" {
+			cmd = v
+		}
+		envOverride(&cmd, platform, "GOCMD")
+		return cmd
+	}
+	var configGoCmds []string
+	for _, cmd := range config.GoCmds {
+		configGoCmds = append(configGoCmds, cmd)
+	}
+	sort.Strings(configGoCmds)
+	goCmds := []string{flagGoCmd}
+	seenGoCmds := map[string]bool{flagGoCmd: true}
+	for _, cmd := range append(configGoCmds, envOverrideValues(os.Environ(), "GOCMD")...) {
+		if !seenGoCmds[cmd] {
+			seenGoCmds[cmd] = true
+			goCmds = append(goCmds, cmd)
+		}
+	}
+	toolchainVersions := map[string]string{flagGoCmd: goVersion}
+	toolchainVersion := func(cmd string) string {
+		if v, ok := toolchainVersions[cmd]; ok {
+			return v
+		}
+		if env, err := GoEnvironment(cmd); err == nil {
+			return env.GoVersion
+		}
+		return ""
+	}
+	supportedPlatforms := ListPlatformsByGoCmd(goCmds, platformGoCmd, toolchainVersion)
+
+	if flagListOSArch {
+		format := "text"
+		if flagJSON {
+			format = "json"
+		}
+		return mainListOSArch(supportedPlatforms, goVersion, format)
+	}
+
+	// With -vet-only nothing is built, so the flags that work with the
+	// binaries have nothing to work with.
+	if flagVetOnly {
+		var conflicts []string
+		for name, set := range map[string]bool{
+			"test":                flagTest,
+			"archive":             flagArchive != "",
+			"checksum":            flagChecksum,
+			"checksum-algo":       len(flagChecksumAlgos) > 0,
+			"checksum-per-file":   flagChecksumPerFile,
+			"manifest":            flagManifest != "",
+			"upx":                 flagUPX,
+			"sign-key":            flagSignKey != "",
+			"upload":              flagUpload != "",
+			"verify-reproducible": flagVerifyReproducible,
+			"report-size":         flagReportSize,
+			"post-hook":           flagPostHook != "",
+			"darwin-universal":    flagDarwinUniversal || flagDarwinUniversalOnly,
+			"darwin-sign":         flagDarwinSign != "",
+		} {
+			if set {
+				conflicts = append(conflicts, "-"+name)
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			fmt.Fprintf(os.Stderr, "-vet-only can't be used with %s, which need binaries\n",
+				strings.Join(conflicts, ", "))
+			return 1
+		}
+	}
+
+	// -resume picks up where the last run left off, which nothing does
+	// with -vet-only or -watch, and -clean would remove what it keeps.
+	if flagResume {
+		for name, set := range map[string]bool{
+			"vet-only": flagVetOnly,
+			"watch":    flagWatch,
+			"clean":    flagClean,
+		} {
+			if set {
+				fmt.Fprintf(os.Stderr, "-resume can't be used with -%s\n", name)
+				return 1
+			}
+		}
+	}
+
+	// Reproducible builds need -trimpath, so it can't be turned off, and
+	// nothing may stamp the binaries with the state of the build machine.
+	if flagVerifyReproducible {
+		flagReproducible = true
+	}
+	if err := ValidBuildVCS(flagBuildVCS); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	buildVCS := flagBuildVCS
+	if flagReproducible {
+		if buildVCS != "" && buildVCS != "false" {
+			fmt.Fprintf(os.Stderr, "-buildvcs=%s conflicts with -reproducible\n", buildVCS)
+			return 1
+		}
+		trimpathSet := false
+		flags.Visit(func(f *flag.Flag) {
+			trimpathSet = trimpathSet || f.Name == "trimpath"
+		})
+		if trimpathSet && !flagTrimpath {
+			fmt.Fprintf(os.Stderr, "-trimpath=false conflicts with -reproducible\n")
+			return 1
+		}
+		if err := CheckReproducibleGoflags(os.Getenv("GOFLAGS")); err != nil && !flagIgnoreGoflags {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		if _, err := eachFlagValue(ldflags, reproducibleLdflags); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+
+		// Archives are dated to the last commit unless a date was given.
+		if _, _, err := SourceDateEpoch(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		if os.Getenv("SOURCE_DATE_EPOCH") == "" {
+			if epoch := execGit(".", "log", "-1", "--format=%ct"); epoch != "" {
+				os.Setenv("SOURCE_DATE_EPOCH", epoch)
+			}
+		}
+
+		flagTrimpath = true
+		if GoVersionAtLeast(goVersion, "1.18") {
+			buildVCS = "false"
+		}
+	}
+
+	if flagTrimpath && !GoVersionAtLeast(goVersion, "1.13") {
+		fmt.Fprintf(os.Stderr,
+			"-trimpath requires Go 1.13 or later, but %s was found\n", goVersion)
+		return 1
+	}
+	if flagBuildVCS != "" && !GoVersionAtLeast(goVersion, "1.18") {
+		fmt.Fprintf(os.Stderr,
+			"-buildvcs requires Go 1.18 or later, but %s was found\n", goVersion)
+		return 1
+	}
+
+	// The builds may run go in the directories of the packages, so the
+	// overlay is passed to them by its absolute path.
+	if flagOverlay != "" {
+		if !GoVersionAtLeast(goVersion, "1.16") {
+			fmt.Fprintf(os.Stderr,
+				"-overlay requires Go 1.16 or later, but %s was found\n", goVersion)
+			return 1
+		}
+		if _, err := ReadOverlay(flagOverlay); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading overlay: %s\n", err)
+			return 1
+		}
+		if abs, err := filepath.Abs(flagOverlay); err == nil {
+			flagOverlay = abs
+		}
+	}
+
+	// Determine the packages that we want to compile. Default to the
+	// current directory if none are specified.
+	packages := flags.Args()
+	if len(packages) == 0 {
+		packages = []string{"."}
+	}
+
+	if err := ValidModMode(flagMod); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	// The go commands that aren't builds, such as go list, get the -env
+	// variables for every platform, since they may need them as much, such
+	// as GOPRIVATE or GOPROXY.
+	commandEnv := flagEnv.CommandEnviron(flagCleanEnv)
+
+	// Get the packages that are in the given paths. With -test, these are
+	// the packages with tests rather than the main packages, which are
+	// listed by import path already.
+	var mainDirs []string
+	importPaths := make(map[string]string)
+	switch {
+	case flagCheck:
+		// -check builds a program of its own rather than the packages.
+	case flagTest:
+		var untested []string
+		mainDirs, untested, err = GoTestDirs(packages, flagGoCmd, flagMod, commandEnv)
+		for _, path := range mainDirs {
+			importPaths[path] = path
+		}
+		for _, path := range untested {
+			fmt.Fprintf(out, "Skipping %s: no test files\n", path)
+		}
+		if err == nil && len(mainDirs) == 0 {
+			fmt.Fprintf(os.Stderr, "No packages with test files to build\n")
+			return 1
+		}
+		if outputTpl == DefaultOutputTpl {
+			outputTpl = DefaultTestOutputTpl
+		}
+	default:
+		var mains, others []GoPackage
+		mains, others, err = GoMainDirs(packages, flagGoCmd, flagMod, commandEnv)
+		for _, p := range mains {
+			mainDirs = append(mainDirs, p.Path)
+			importPaths[p.Path] = p.ImportPath
+		}
+		if err == nil && len(others) > 0 {
+			// Library packages are expected among the ones a "..." pattern
+			// matches, but one asked for by name is likely a mistake.
+			wildcard := false
+			for _, p := range packages {
+				wildcard = wildcard || strings.Contains(p, "...")
+			}
+
+			list := make([]string, 0, len(others))
+			for _, p := range others {
+				list = append(list, fmt.Sprintf("  %s (package %s)", p.ImportPath, p.Name))
+			}
+			switch {
+			case len(mainDirs) == 0:
+				fmt.Fprintf(os.Stderr, "No main packages to build, these aren't main packages:\n%s\n",
+					strings.Join(list, "\n"))
+				return 1
+			case wildcard:
+				if verbose {
+					fmt.Fprintf(out, "Skipping %d packages that aren't main packages\n", len(others))
+				}
+			case flagRequireMain:
+				fmt.Fprintf(os.Stderr, "These packages aren't main packages:\n%s\n",
+					strings.Join(list, "\n"))
+				return 1
+			default:
+				logAt(logger, LogWarn, "skipping these packages, they aren't main packages:\n%s",
+					strings.Join(list, "\n"))
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
+		return 1
+	}
+
+	// Determine the platforms we're building for, starting with the host
+	for _, pattern := range platformFlag.UnmatchedPatterns(supportedPlatforms) {
+		logAt(logger, LogWarn,
+			"-osarch pattern %s matches no supported platforms", pattern)
+	}
+	platforms := platformFlag.Platforms(supportedPlatforms)
+	SortPlatforms(platforms, goEnv.GoHostOS, goEnv.GoHostArch)
+	for _, platform := range flagEnv.Unmatched(platforms) {
+		logAt(logger, LogWarn, "-env platform %s isn't built", platform)
+	}
+	if len(platforms) == 0 {
+		fmt.Fprintln(os.Stderr, "No valid platforms to build for. If you specified a value")
+		fmt.Fprintln(os.Stderr, "for the 'os', 'arch', or 'osarch' flags, make sure you're")
+		fmt.Fprintln(os.Stderr, "using a valid value.")
+		return 1
+	}
+	for _, platform := range platforms {
+		if cmd := platformGoCmd(platform); cmd != flagGoCmd {
+			logAt(logger, LogDebug, "%s: building with %s", platform.String(), cmd)
+		}
+		for _, name := range envOverrideNames(os.Environ(), platform) {
+			logAt(logger, LogDebug, "%s: %s is set", platform.String(), name)
+		}
+	}
+
+	// The go commands of the platforms are checked like -gocmd, but only
+	// the ones that build one of the platforms, so that a go command that
+	// isn't installed only matters if it's needed.
+	for _, platform := range platforms {
+		cmd := platformGoCmd(platform)
+		if _, ok := toolchainVersions[cmd]; ok {
+			continue
+		}
+		if _, err := exec.LookPath(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "%s executable must be on the PATH to build for %s\n",
+				cmd, platform.String())
+			return 1
+		}
+		env, err := GoEnvironment(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading Go version of %s: %s\n", cmd, err)
+			return 1
+		}
+		if flagTrimpath && !GoVersionAtLeast(env.GoVersion, "1.13") {
+			fmt.Fprintf(os.Stderr,
+				"-trimpath requires Go 1.13 or later, but %s is %s\n", cmd, env.GoVersion)
+			return 1
+		}
+		if flagBuildVCS != "" && !GoVersionAtLeast(env.GoVersion, "1.18") {
+			fmt.Fprintf(os.Stderr,
+				"-buildvcs requires Go 1.18 or later, but %s is %s\n", cmd, env.GoVersion)
+			return 1
+		}
+		if flagOverlay != "" && !GoVersionAtLeast(env.GoVersion, "1.16") {
+			fmt.Fprintf(os.Stderr,
+				"-overlay requires Go 1.16 or later, but %s is %s\n", cmd, env.GoVersion)
+			return 1
+		}
+		if len(goVersions) > 0 {
+			if _, err := CheckGoToolchains(env.GoVersion, goVersions); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid -goversions for %s: %s\n", cmd, err)
+				return 1
+			}
+		}
+
+		toolchainVersions[cmd] = env.GoVersion
+	}
+
+	// The profiles to optimize with must be there before anything is
+	// built, and so must a go command that takes them.
+	platformPGO := func(platform Platform) string {
+		pgo := flagPGO
+		envOverride(&pgo, platform, "PGO")
+		if pgo != "" {
+			if abs, err := filepath.Abs(pgo); err == nil {
+				pgo = abs
+			}
+		}
+		return pgo
+	}
+	for _, platform := range platforms {
+		pgo := platformPGO(platform)
+		if pgo == "" {
+			continue
+		}
+		cmd := platformGoCmd(platform)
+		if v := toolchainVersions[cmd]; !GoVersionAtLeast(v, "1.21") {
+			fmt.Fprintf(os.Stderr,
+				"-pgo requires Go 1.21 or later, but %s is %s\n", cmd, v)
+			return 1
+		}
+		fi, err := os.Stat(pgo)
+		if err == nil && fi.IsDir() {
+			err = fmt.Errorf("%s is a directory", pgo)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the profile for %s: %s\n",
+				platform.String(), err)
+			return 1
+		}
+	}
+
+	// With -partial-ok, the platforms of -required-osarch must still build,
+	// so they must be among the platforms that are built.
+	requiredOSArch := strings.Fields(flagRequiredOSArch)
+	if len(requiredOSArch) > 0 && !flagPartialOK {
+		fmt.Fprintf(os.Stderr, "-required-osarch requires -partial-ok\n")
+		return 1
+	}
+	for _, required := range requiredOSArch {
+		found := false
+		for _, platform := range platforms {
+			if requiredMatches(required, platform) {
+				found = true
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr,
+				"-required-osarch %s isn't one of the platforms being built\n", required)
+			return 1
+		}
+	}
+
+	// A universal binary is made of the binaries for darwin/amd64 and
+	// darwin/arm64, so both must be built.
+	if flagDarwinUniversalOnly {
+		flagDarwinUniversal = true
+	}
+	if flagDarwinUniversal {
+		built := make(map[string]bool)
+		for _, platform := range platforms {
+			built[platform.String()] = true
+		}
+		if !built["darwin/amd64"] || !built["darwin/arm64"] {
+			fmt.Fprintf(os.Stderr,
+				"-darwin-universal requires both darwin/amd64 and darwin/arm64 to be built\n")
+			return 1
+		}
+	}
+
+	// The race detector only works on a few platforms. Rather than letting
+	// go build fail for the others, skip them or fail up front.
+	if flagRace {
+		supported := make([]Platform, 0, len(platforms))
+		for _, platform := range platforms {
+			if platform.SupportsRace() {
+				supported = append(supported, platform)
+				continue
+			}
+
+			if flagRaceStrict {
+				fmt.Fprintf(os.Stderr,
+					"-race is not supported on %s\n", platform.String())
+				return 1
+			}
+			logAt(logger, LogWarn,
+				"skipping %s: -race is not supported on this platform",
+				platform.String())
+		}
+
+		platforms = supported
+		if len(platforms) == 0 {
+			fmt.Fprintf(os.Stderr, "No platforms to build that support -race\n")
+			return 1
+		}
+	}
+
+	// Not every build mode works everywhere, so skip the platforms that
+	// don't support the one that was asked for.
+	if err := ValidBuildmode(flagBuildmode); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	if flagBuildmode != "" {
+		supported := make([]Platform, 0, len(platforms))
+		for _, platform := range platforms {
+			if platform.SupportsBuildmode(flagBuildmode) {
+				supported = append(supported, platform)
+				continue
+			}
+
+			logAt(logger, LogWarn,
+				"skipping %s: -buildmode=%s is not supported on this platform",
+				platform.String(), flagBuildmode)
+		}
+
+		platforms = supported
+		if len(platforms) == 0 {
+			fmt.Fprintf(os.Stderr,
+				"No platforms to build that support -buildmode=%s\n", flagBuildmode)
+			return 1
+		}
+	}
+
+	// Cgo may be enabled for all platforms or only some of them.
+	cgoSettings, err := resolveCgo(platforms, flagCgo, cgoOSArch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	// Platforms without cgo, such as WebAssembly, are built with it off
+	// even if it is enabled for them.
+	for _, platform := range platforms {
+		if cgoSettings[platform.String()].Enabled && !platform.SupportsCgo() {
+			logAt(logger, LogWarn,
+				"cgo is not supported on %s, building without it",
+				platform.String())
+		}
+	}
+
+	// Building for darwin with cgo from another OS needs the osxcross
+	// compilers. Without them every darwin build would fail with linker
+	// errors, so skip them all with a single warning instead.
+	var osxcrossDir string
+	if runtime.GOOS != "darwin" {
+		supported := make([]Platform, 0, len(platforms))
+		var skipped []string
+		for _, platform := range platforms {
+			if platform.OS != "darwin" || !cgoSettings[platform.String()].Enabled {
+				supported = append(supported, platform)
+				continue
+			}
+
+			if osxcrossDir == "" {
+				osxcrossDir = FindOsxcross(os.Getenv("OSXCROSS_ROOT"))
+			}
+			_, _, ok := osxcrossCC(osxcrossDir, platform)
+			if ok || envOverrideValue(platform, "CC") != "" {
+				supported = append(supported, platform)
+				continue
+			}
+
+			skipped = append(skipped, platform.String())
+		}
+
+		if len(skipped) > 0 {
+			logAt(logger, LogWarn,
+				"skipping %s: cgo builds for darwin need osxcross, set "+
+					"OSXCROSS_ROOT or put o64-clang and oa64-clang on the PATH",
+				strings.Join(skipped, ", "))
+		}
+
+		platforms = supported
+		if len(platforms) == 0 {
+			fmt.Fprintf(os.Stderr, "No platforms to build\n")
+			return 1
+		}
+	}
+
+	// UPX can't compress every platform. Those are built as usual, just
+	// not compressed.
+	if flagUPX {
+		if _, err := exec.LookPath("upx"); err != nil {
+			fmt.Fprintf(os.Stderr, "-upx requires upx to be on the PATH\n")
+			return 1
+		}
+
+		var unsupported []string
+		for _, platform := range platforms {
+			if !platform.UPXSupported() {
+				unsupported = append(unsupported, platform.String())
+			}
+		}
+		if len(unsupported) > 0 {
+			logAt(logger, LogWarn,
+				"UPX doesn't support %s, these won't be compressed",
+				strings.Join(unsupported, ", "))
+		}
+	}
+
+	// Only linux binaries are linked statically, the other platforms build
+	// as usual.
+	if flagStatic {
+		for _, platform := range platforms {
+			if platform.OS != "linux" {
+				logAt(logger, LogDebug, "%s: -static only applies to linux, ignoring it",
+					platform.String())
+			}
+		}
+	}
+
+	// codesign only exists on macOS. Elsewhere, the binaries can still be
+	// signed by a post-build hook that runs another tool.
+	if flagDarwinSign != "" {
+		if runtime.GOOS != "darwin" {
+			fmt.Fprintf(os.Stderr, "-darwin-sign requires running on macOS, where codesign is. "+
+				"On %s, sign the darwin binaries with -post-hook instead, such as with rcodesign\n",
+				runtime.GOOS)
+			return 1
+		}
+		if _, err := exec.LookPath("codesign"); err != nil {
+			fmt.Fprintf(os.Stderr, "-darwin-sign requires codesign to be on the PATH\n")
+			return 1
+		}
+	}
+
+	// The Windows resources are read once, and linked into the binaries
+	// of every windows platform.
+	var winRes *WinRes
+	if flagWinRes != "" || flagWinIcon != "" {
+		winRes, err = ReadWinRes(flagWinRes, flagWinIcon)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading Windows resources: %s\n", err)
+			return 1
+		}
+	}
+
+	// The output template may be set per-platform in the config file and
+	// the environment, in that order of precedence over -output.
+	platformOutputTpl := func(platform Platform) string {
+		tpl := outputTpl
+		if v := config.OutputTpl(platform); v != "" {
+			tpl = v
+		}
+		envOverride(&tpl, platform, "OUTPUT")
+		return tpl
+	}
+
+	// Make sure the templates are valid before starting any builds, so
+	// that a bad template is only reported once.
+	if _, err := ParseOutputTemplate(outputTpl); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing output template: %s\n", err)
+		return 1
+	}
+	for _, platform := range platforms {
+		if _, err := ParseOutputTemplate(platformOutputTpl(platform)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing output template for %s: %s\n",
+				platform.String(), err)
+			return 1
+		}
+	}
+	if _, err := ParseOutputTemplate(ldflags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing ldflags template: %s\n", err)
+		return 1
+	}
+
+	archiveSpec, err := ParseArchiveSpec(flagArchive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -archive: %s\n", err)
+		return 1
+	}
+
+	// Choosing the algorithms or asking for a checksum per file implies
+	// -checksum. There is one checksum file per algorithm, which goes with
+	// the binaries unless told otherwise.
+	if len(flagChecksumAlgos) > 0 || flagChecksumPerFile {
+		flagChecksum = true
+	}
+	if len(flagChecksumAlgos) == 0 {
+		flagChecksumAlgos = []string{"sha256"}
+	}
+	for _, algo := range flagChecksumAlgos {
+		if err := ValidChecksumAlgo(algo); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -checksum-algo: %s\n", err)
+			return 1
+		}
+	}
+	if flagChecksumFile != "" && len(flagChecksumAlgos) > 1 {
+		fmt.Fprintf(os.Stderr,
+			"-checksum-file can only be used with a single -checksum-algo\n")
+		return 1
+	}
+	checksumFiles := make([]string, len(flagChecksumAlgos))
+	for i, algo := range flagChecksumAlgos {
+		checksumFiles[i] = flagChecksumFile
+		if checksumFiles[i] == "" {
+			checksumFiles[i] = filepath.Join(outputDir, ChecksumFileName(algo))
+		}
+	}
+
+	if flagSignKey != "" {
+		if !flagChecksum {
+			fmt.Fprintf(os.Stderr, "-sign-key requires -checksum\n")
+			return 1
+		}
+		if err := CheckSigningKey(flagSignKey, flagGPGCmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return 1
+		}
+	}
+
+	var uploader Uploader
+	if flagUpload != "" {
+		uploadOpts.Token = os.Getenv("GITHUB_TOKEN")
+		uploadOpts.BaseDir = outputDir
+		uploadOpts.DryRunOutput = out
+		uploader, err = NewUploader(flagUpload, &uploadOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -upload: %s\n", err)
+			return 1
+		}
+	}
+
+	// Read the git information once, it is the same for every build.
+	gitInfo := ReadGitInfo(".")
+
+	// Stamp the variables that were asked for. Outside of a git repository
+	// there's no version or commit, so those are left alone.
+	var stamps []Stamp
+	for _, v := range flagStampVersion {
+		if gitInfo.Describe == "" {
+			logAt(logger, LogWarn, "not in a git repository, not stamping %s", v)
+			continue
+		}
+		stamps = append(stamps, Stamp{Var: v, Value: gitInfo.Describe})
+	}
+	for _, v := range flagStampCommit {
+		if gitInfo.SHA == "" {
+			logAt(logger, LogWarn, "not in a git repository, not stamping %s", v)
+			continue
+		}
+		stamps = append(stamps, Stamp{Var: v, Value: gitInfo.SHA})
+	}
+	if len(flagStampDate) > 0 {
+		date, err := BuildDate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 1
+		}
+		for _, v := range flagStampDate {
+			stamps = append(stamps, Stamp{Var: v, Value: date})
+		}
+	}
+
+	// Create the output directory up front so that every build can write
+	// into it.
+	if outputDir != "" && !flagDryRun && !flagVetOnly && !flagCheck {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output directory: %s\n", err)
+			return 1
+		}
+	}
+
+	// With -gocache-mode, the platforms may build with caches of their own
+	// rather than sharing one.
+	var goCacheBase string
+	if flagGoCacheMode == GoCachePerPlatform {
+		goCacheBase, err = GoCache(flagGoCmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading GOCACHE: %s\n", err)
+			return 1
+		}
+	}
+	if _, err := flagGoCacheMode.Dir(goCacheBase, Platform{}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	// The options every build starts from, and the settings that are
+	// applied to them for each platform.
+	mode := ModeBuild
+	if flagTest {
+		mode = ModeTest
+	}
+	if flagVetOnly {
+		mode = ModeVet
+	}
+	baseOpts := CompileOpts{
+		OutputTpl:     outputTpl,
+		OutputDir:     outputDir,
+		Ldflags:       ldflags,
+		Gcflags:       flagGcflags,
+		Asmflags:      flagAsmflags,
+		Tags:          tags,
+		Race:          flagRace,
+		Trimpath:      flagTrimpath,
+		Mod:           flagMod,
+		Buildmode:     flagBuildmode,
+		InstallSuffix: flagInstallSuffix,
+		AndroidAPI:    flagAndroidAPI,
+		Rebuild:       flagRebuild,
+		Strip:         flagStrip,
+		WindowsGUI:    flagWindowsGUI,
+		Static:        flagStatic,
+		Stamps:        stamps,
+		Mode:          mode,
+		Vet:           flagVet,
+		Reproducible:  flagReproducible,
+		BuildVCS:      buildVCS,
+		Overlay:       flagOverlay,
+		CleanEnv:      flagCleanEnv,
+		IgnoreGoflags: flagIgnoreGoflags,
+		Verbose:       verbose,
+		GoCmd:         flagGoCmd,
+		Git:           gitInfo,
+		Logger:        logger,
+		WinRes:        winRes,
+	}
+	configure := func(opts *CompileOpts) {
+		platform := opts.Platform
+		opts.ImportPath = importPaths[opts.PackagePath]
+		opts.OutputTpl = platformOutputTpl(platform)
+		opts.Cgo = cgoSettings[platform.String()].Enabled
+		opts.CgoSet = cgoSettings[platform.String()].Explicit
+		opts.GoCache, _ = flagGoCacheMode.Dir(goCacheBase, platform)
+		opts.GoCmd = platformGoCmd(platform)
+
+		// Determine if we have specific CFLAGS or LDFLAGS for this
+		// GOOS/GOARCH combo and override the defaults if so.
+		envOverrideFlags(&opts.Ldflags, platform, "LDFLAGS", flagEnvOverrideMode)
+		envOverrideFlags(&opts.Gcflags, platform, "GCFLAGS", flagEnvOverrideMode)
+		envOverrideFlags(&opts.Asmflags, platform, "ASMFLAGS", flagEnvOverrideMode)
+		envOverrideTags(&opts.Tags, platform, flagEnvOverrideMode)
+		envOverride(&opts.InstallSuffix, platform, "INSTALLSUFFIX")
+		opts.PGO = platformPGO(platform)
+		opts.Env = flagEnv.Environ(platform)
+		if cc, cxx, ok := osxcrossCC(osxcrossDir, platform); ok {
+			opts.CC, opts.CXX = cc, cxx
+		}
+
+		// The compilers of a platform are for its default libc, so the
+		// libc variants have their own, such as GOX_LINUX_ARM64_MUSL_CC.
+		libc := ""
+		if platform.Libc != "" {
+			libc = strings.ToUpper(platform.Libc) + "_"
+		}
+		envOverride(&opts.CC, platform, libc+"CC")
+		envOverride(&opts.CXX, platform, libc+"CXX")
+	}
+
+	// With -check, make sure that every platform can be built for, and
+	// stop there.
+	if flagCheck {
+		return mainCheck(out, outColors, errColors, BuildConfig{
+			Platforms:   platforms,
+			GoVersions:  goVersions,
+			Parallel:    parallel,
+			ParallelCgo: flagParallelCgo,
+			Opts:        baseOpts,
+			Configure:   configure,
+		})
+	}
+
+	// Flags in GOFLAGS that gox passes as well are dropped by go build,
+	// since the command line takes precedence, which makes binaries that
+	// aren't what either asked for.
+	conflicts, err := CheckGoflags(BuildConfig{
+		Packages:   mainDirs,
+		Platforms:  platforms,
+		GoVersions: goVersions,
+		Opts:       baseOpts,
+		Configure:  configure,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading GOFLAGS: %s\n", err)
+		return 1
+	}
+	if len(conflicts) > 0 {
+		msg := fmt.Sprintf("GOFLAGS has flags that go build drops, since gox "+
+			"passes them as well:\n  %s\n"+
+			"Use -ignore-goflags to build without GOFLAGS",
+			strings.Join(conflicts, "\n  "))
+		if flagStrictGoflags {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", msg)
+			return 1
+		}
+		logAt(logger, LogWarn, "%s", msg)
+	}
+
+	// Builds that write to the same path would silently overwrite each
+	// other, leaving one binary where two were expected.
+	if !flagForceOverwrite && !flagVetOnly {
+		err := CheckOutputCollisions(BuildConfig{
+			Packages:   mainDirs,
+			Platforms:  platforms,
+			GoVersions: goVersions,
+			Opts:       baseOpts,
+			Configure:  configure,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Use -force-overwrite to build anyway\n")
+			return 1
+		}
+	}
+
+	// With -clean, remove what earlier runs may have left behind first.
+	// This covers every platform this version of Go supports rather than
+	// just the ones being built, so that binaries for platforms that were
+	// dropped don't linger. With -dry-run, nothing is removed.
+	if flagClean {
+		var all []Platform
+		for _, platform := range supportedPlatforms {
+			all = append(all, platform)
+			all = append(all, platform.Variants()...)
+			if platform.OS == "linux" {
+				for _, libc := range Libcs {
+					variant := platform
+					variant.Libc = libc
+					all = append(all, variant)
+				}
+			}
+		}
+		files := CleanFiles(BuildConfig{
+			Packages:   mainDirs,
+			Platforms:  all,
+			GoVersions: goVersions,
+			Opts:       baseOpts,
+			Configure:  configure,
+		})
+		for _, file := range files {
+			for _, algo := range ChecksumAlgos {
+				files = append(files, file+"."+algo)
+			}
+		}
+		for _, algo := range ChecksumAlgos {
+			path := filepath.Join(outputDir, ChecksumFileName(algo))
+			files = append(files, path, path+".sig")
+		}
+		for _, path := range checksumFiles {
+			files = append(files, path, path+".sig")
+		}
+		if flagManifest != "" {
+			files = append(files, flagManifest)
+		}
+		files = append(files, flagStateFile)
+
+		root := outputDir
+		if root == "" {
+			root = "."
+		}
+		removed, err := Clean(files, root, flagDryRun)
+		verb := "Removed"
+		if flagDryRun {
+			verb = "Would remove"
+		}
+		for _, file := range removed {
+			fmt.Fprintf(out, "%s %s\n", verb, file)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error cleaning: %s\n", err)
+			return 1
+		}
+	}
+
+	// With -generate, run go generate once before any builds, since the
+	// generated code is the same for every platform.
+	if flagGenerate {
+		args := goGenerateArgs(mainDirs, tags, flagMod)
+		if flagDryRun {
+			parts := []string{shellQuote(flagGoCmd)}
+			for _, arg := range args {
+				parts = append(parts, shellQuote(arg))
+			}
+			fmt.Fprintf(out, "Would run %s\n", strings.Join(parts, " "))
+		} else {
+			var onLine func(string)
+			if verbose {
+				onLine = func(line string) {
+					fmt.Fprintf(out, "[generate] %s\n", line)
+				}
+			}
+			if err := GoGenerate(mainDirs, flagGoCmd, tags, flagMod, commandEnv, onLine); err != nil {
+				fmt.Fprintf(os.Stderr, "Error running go generate: %s\n", err)
+				return 1
+			}
+		}
+	}
+
+	// Every run records the outcome of each of its builds in the state
+	// file, so that -resume can build only those that failed or were never
+	// attempted. With -state, it also records what each build was built
+	// from; -rebuild starts that over, and a state file that can't be read
+	// just means that everything is built.
+	var state *BuildState
+	if !flagVetOnly {
+		state, err = LoadBuildState(flagStateFile)
+		if err != nil {
+			if flagResume {
+				fmt.Fprintf(os.Stderr, "Error resuming: %s\n", err)
+				return 1
+			}
+			if flagState && !flagRebuild {
+				logAt(logger, LogWarn, "building everything, %s", err)
+			}
+		}
+		if flagState && flagRebuild {
+			state.ForgetBuilds()
+		}
+		if !flagResume {
+			state.ForgetRun()
+		}
+	}
+	runFlags := func(opts *CompileOpts) string {
+		flags, err := BuildInputs(opts, "", toolchainVersion(opts.GoCmd))
+		if err != nil {
+			return ""
+		}
+		return flags
+	}
+
+	// With -resume, only the builds that didn't succeed in the last run
+	// are built. The builds that did are kept as they are, which only
+	// makes sense if they were built the same way.
+	var buildFilter func(opts *CompileOpts) bool
+	var resumedBuilt []Platform
+	if flagResume {
+		buildFilter = func(opts *CompileOpts) bool {
+			entry, ok := state.LastRun(opts)
+			return !ok || entry.Outcome != BuildSucceeded
+		}
+
+		var resumed, recorded int
+		var changed []string
+		all := BuildConfig{
+			Packages:   mainDirs,
+			Platforms:  platforms,
+			GoVersions: goVersions,
+			Opts:       baseOpts,
+			Configure:  configure,
+		}
+		for _, opts := range all.builds() {
+			entry, ok := state.LastRun(&opts)
+			if ok {
+				recorded++
+			}
+			if buildFilter(&opts) {
+				resumed++
+				continue
+			}
+			resumedBuilt = append(resumedBuilt, opts.Platform)
+
+			if entry.Flags != "" && entry.Flags != runFlags(&opts) {
+				changed = append(changed, buildKey(&opts))
+			}
+		}
+		if recorded == 0 {
+			logAt(logger, LogWarn, "%s has no record of these builds, building them all",
+				flagStateFile)
+		}
+		if len(changed) > 0 {
+			logAt(logger, LogWarn,
+				"the flags changed since the last run, its results may not be comparable with this one's:\n  %s",
+				strings.Join(changed, "\n  "))
+		}
+		if resumed == 0 {
+			fmt.Fprintf(out, "Nothing to resume, every build succeeded in the last run\n")
+			return 0
+		}
+	}
+
+	// With -dry-run, show what would be built and how, and stop there.
+	if flagDryRun {
+		return dryRun(out, outColors, errColors, BuildConfig{
+			Packages:   mainDirs,
+			Platforms:  platforms,
+			GoVersions: goVersions,
+			Filter:     buildFilter,
+			Opts:       baseOpts,
+			Configure:  configure,
+		})
+	}
+
+	// With -cgo-skip-missing, platforms that cgo is enabled for but that
+	// have no working C toolchain are skipped rather than failed.
+	var skipped []string
+	if flagCgoSkipMissing {
+		supported := make([]Platform, 0, len(platforms))
+		for _, platform := range platforms {
+			if cgoSettings[platform.String()].Enabled && platform.SupportsCgo() {
+				opts := baseOpts
+				opts.Platform = platform
+				configure(&opts)
+				if err := CheckCgoToolchain(&opts); err != nil {
+					if verbose {
+						fmt.Fprintf(os.Stderr, "%s has no working C toolchain: %s\n",
+							platform.String(), err)
+					}
+					skipped = append(skipped, platform.String())
+					continue
+				}
+			}
+
+			supported = append(supported, platform)
+		}
+
+		platforms = supported
+	}
+
+	// With -incremental, builds whose output is newer than the sources of
+	// their package are skipped, unless -rebuild forces them.
+	var modTimes map[string]time.Time
+	if flagIncremental && !flagRebuild && !flagVetOnly {
+		modTimes = make(map[string]time.Time, len(mainDirs))
+		for _, path := range mainDirs {
+			t, err := SourcesModTime(path, flagGoCmd, flagMod, tags, commandEnv)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading the sources of %s: %s\n", path, err)
+				return 1
+			}
+			modTimes[path] = t
+		}
+	}
+
+	// With -state, so are builds whose inputs are the same as recorded in
+	// the state file by the last run, and whose output is still what it
+	// wrote.
+	sourceHashes := make(map[string]string)
+	if flagState && !flagVetOnly {
+		for _, path := range mainDirs {
+			h, err := SourcesHash(path, flagGoCmd, flagMod, tags, commandEnv)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading the sources of %s: %s\n", path, err)
+				return 1
+			}
+			sourceHashes[path] = h
+		}
+	}
+	buildInputs := func(opts *CompileOpts) string {
+		inputs, err := BuildInputs(opts, sourceHashes[opts.PackagePath], toolchainVersion(opts.GoCmd))
+		if err != nil {
+			return ""
+		}
+		return inputs
+	}
+
+	var upToDate func(opts *CompileOpts) bool
+	useState := state != nil && flagState && !flagRebuild
+	if modTimes != nil || useState {
+		upToDate = func(opts *CompileOpts) bool {
+			if t, ok := modTimes[opts.PackagePath]; ok && OutputUpToDate(opts, t) {
+				return true
+			}
+			return useState && state.UpToDate(opts, buildInputs(opts))
+		}
+	}
+
+	tracker := newBuildTracker(BuildConfig{
+		Packages:   mainDirs,
+		Platforms:  platforms,
+		GoVersions: goVersions,
+		Filter:     buildFilter,
+		Opts:       baseOpts,
+		Configure:  configure,
+	})
+
+	// Show the progress of the run in place on a terminal. With -progress
+	// it is shown elsewhere too, as a line after each build.
+	var prog *progress
+	if live := isTerminal(out); !flagQuiet && (live || flagProgress) {
+		prog = newProgress(out, len(tracker.keys), live)
+		logger.Printf = prog.Printf
+	}
+	logf := func(w io.Writer, format string, args ...interface{}) {
+		if prog != nil {
+			prog.Printf(w, format, args...)
+			return
+		}
+		fmt.Fprintf(w, format, args...)
+	}
+
+	// With -x, print every go build command as it runs, like go build -x.
+	if flagX {
+		baseOpts.OnCommand = func(cmd *BuildCommand) {
+			logf(os.Stderr, "%s\n", cmd)
+		}
+	}
+
+	// Cancel the builds on Ctrl-C or SIGTERM, which kills the go build
+	// processes that are running and keeps new ones from starting.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			logf(os.Stderr, "\nReceived %s, cancelling builds...\n", sig)
+			close(interrupted)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// With -watch, build again every time the source changes until
+	// interrupted.
+	if flagWatch {
+		return mainWatch(ctx, out, outColors, BuildConfig{
+			Packages:    mainDirs,
+			Platforms:   platforms,
+			GoVersions:  goVersions,
+			Parallel:    parallel,
+			ParallelCgo: flagParallelCgo,
+			Opts:        baseOpts,
+			Configure:   configure,
+		}, flagGoCmd, flagMod, commandEnv)
+	}
+
+	// Build in parallel! There's no use in more parallel builds than
+	// there are builds.
+	buildParallel := parallel
+	if builds := len(tracker.keys); builds > 0 && parallel > builds {
+		buildParallel = builds
+		fmt.Fprintf(out, "Number of parallel builds: %d (-parallel=%s, but there are only %d builds)\n\n",
+			buildParallel, parallelFlag, builds)
+	} else {
+		fmt.Fprintf(out, "Number of parallel builds: %d\n\n", parallel)
+	}
+	start := time.Now()
+	resultCh := make(chan []Result, 1)
+	var buildErr error
+	if prog != nil {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					prog.Tick()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	// With -log-dir, every build also writes what it ran and printed to a
+	// log file of its own.
+	var buildLogs *BuildLogs
+	if flagLogDir != "" {
+		buildLogs, err = NewBuildLogs(flagLogDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating -log-dir: %s\n", err)
+			return 1
+		}
+	}
+	// The entries of the manifest are made before the binaries are
+	// archived, which may remove them.
+	var manifestLock sync.Mutex
+	manifestEntries := make(map[*CompileOpts]ManifestEntry)
+	if len(platforms) > 0 {
+		go func() {
+			results, err := Build(ctx, BuildConfig{
+				Packages:    mainDirs,
+				Platforms:   platforms,
+				GoVersions:  goVersions,
+				Filter:      buildFilter,
+				Parallel:    buildParallel,
+				ParallelCgo: flagParallelCgo,
+				Opts:        baseOpts,
+				Configure: func(opts *CompileOpts) {
+					configure(opts)
+
+					// With -verbose, the output of go build is shown as it
+					// runs, with the platform in front of each line since the
+					// builds run at the same time.
+					if verbose {
+						platform := opts.Platform.String()
+						opts.OnOutput = func(line string) {
+							logf(out, "[%s] %s\n", outColors.Platform(platform), line)
+						}
+					}
+					if buildLogs != nil {
+						buildLogs.Attach(opts)
+					}
+				},
+				FailFast: flagFailFast,
+				Retries:  flagRetries,
+				OnRetry: func(r *Result, err error) {
+					logf(os.Stderr, "%s", errColors.BuildLine(r.Platform,
+						"retrying %s (attempt %d of %d): %s", r.PackagePath,
+						r.Attempts+1, flagRetries+1, firstLine(err.Error())))
+				},
+				OnStart: func(opts *CompileOpts) {
+					tracker.Start(opts)
+					logf(out, "%s", outColors.BuildLine(opts.Platform, "%s", buildLabel(opts)))
+					if verbose && opts.GoCache != "" {
+						logf(out, "[%s] GOCACHE=%s\n",
+							outColors.Platform(opts.Platform.String()), opts.GoCache)
+					}
+					if prog != nil {
+						prog.Start()
+					}
+					if events != nil {
+						events.Write(NewBuildStartEvent(opts))
+					}
+				},
+				PreBuild: func(ctx context.Context) error {
+					if flagPreHook == "" {
+						return nil
+					}
+					err := RunHook(ctx, flagPreHook, nil, func(line string) {
+						logf(out, "[pre-hook] %s\n", line)
+					})
+					if err != nil {
+						return fmt.Errorf("pre-build hook failed: %s", err)
+					}
+					return nil
+				},
+				PostBuild: func(ctx context.Context, r *Result) error {
+					// A binary may still be dynamic, such as when a C
+					// library it links can't be linked statically, which
+					// is worth knowing but doesn't fail the build.
+					if flagStatic && r.Platform.OS == "linux" && r.Opts.Buildmode == "" {
+						if dynamic, err := IsDynamicELF(r.Output); err == nil && dynamic {
+							logAt(logger, LogWarn, "%s is dynamically linked despite -static",
+								r.Output)
+						}
+					}
+					if flagVerifyReproducible {
+						if err := VerifyReproducible(ctx, r.Opts, r.Output); err != nil {
+							return err
+						}
+					}
+					if flagUPX && r.Platform.UPXSupported() {
+						err := CompressUPX(ctx, "upx", r.Output, strings.Fields(flagUPXArgs))
+						if err != nil {
+							return fmt.Errorf("upx failed: %s", err)
+						}
+					}
+					if flagDarwinSign != "" && r.Platform.OS == "darwin" {
+						err := Codesign(ctx, "codesign", flagDarwinSign, r.Output)
+						if err != nil {
+							return fmt.Errorf("codesign failed: %s", err)
+						}
+					}
+					if flagPostHook != "" {
+						platform := r.Platform.String()
+						err := RunHook(ctx, flagPostHook, HookEnv(r), func(line string) {
+							logf(out, "[%s] %s\n", outColors.Platform(platform), line)
+						})
+						if err != nil {
+							return fmt.Errorf("post-build hook failed: %s", err)
+						}
+					}
+
+					// The binaries are archived here, so that archiving
+					// runs in parallel like the builds. Those that may be
+					// merged into a universal binary are archived after
+					// the merge, if they're kept.
+					if r.Opts.Mode == ModeVet || (flagDarwinUniversal && isUniversalPart(r.Platform)) {
+						return nil
+					}
+					if flagManifest != "" {
+						entry, err := NewManifestEntry(r, toolchainVersion)
+						if err != nil {
+							return fmt.Errorf("manifest error: %s", err)
+						}
+						manifestLock.Lock()
+						manifestEntries[r.Opts] = entry
+						manifestLock.Unlock()
+					}
+					files, err := packageOutput(r.Opts, archiveSpec, flagArchiveRmBinary)
+					if err != nil {
+						return fmt.Errorf("archive failed: %s", err)
+					}
+					r.Artifacts = files
+					return nil
+				},
+				UpToDate: upToDate,
+				OnFinish: func(r *Result) {
+					// Builds that are up to date never start, but they
+					// count as done.
+					if r.UpToDate {
+						tracker.Start(r.Opts)
+						logf(out, "%s", outColors.BuildLine(r.Platform, "%s is up to date", buildLabel(r.Opts)))
+						if prog != nil {
+							prog.Start()
+						}
+					}
+					tracker.Finish(r, ctx.Err() != nil)
+					if prog != nil {
+						prog.Finish()
+					}
+					if buildLogs != nil {
+						if err := buildLogs.Finish(r); err != nil {
+							logAt(logger, LogWarn, "error writing the log of %s: %s",
+								buildName(r.Opts), err)
+						}
+					}
+					if events != nil {
+						events.Write(NewBuildFinishEvent(r))
+					}
+				},
+			})
+			buildErr = err
+			resultCh <- results
+		}()
+	} else {
+		resultCh <- nil
+	}
+
+	var results []Result
+	select {
+	case results = <-resultCh:
+	case <-interrupted:
+		// The builds are killed, but don't wait forever for them to stop.
+		select {
+		case results = <-resultCh:
+		case <-time.After(buildCancelTimeout):
+			fmt.Fprintf(os.Stderr, "Timed out waiting for builds to stop\n")
+		}
+	}
+	if prog != nil {
+		prog.Done()
+	}
+
+	select {
+	case <-interrupted:
+		tracker.PrintSummary()
+		if state != nil {
+			for i := range results {
+				state.RecordOutcome(&results[i], runFlags(results[i].Opts))
+			}
+			if err := state.Write(flagStateFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the state file: %s\n", err)
+			}
+		}
+		if events != nil {
+			e := NewSummaryEvent(results, time.Since(start))
+			e.Summary.Interrupted = true
+			e.Summary.ExitCode = exitInterrupted
+			events.Write(e)
+		}
+		return exitInterrupted
+	default:
+	}
+
+	// The builds that failed are counted apart from the other errors, which
+	// always fail the run as a whole.
+	errors := make([]string, 0)
+	buildErrors := 0
+	artifacts := make([]Artifact, 0)
+	if buildErr != nil {
+		errors = append(errors, buildErr.Error())
+	}
+
+	// With -darwin-universal, the binaries for darwin/amd64 and
+	// darwin/arm64 of each package are merged into a universal binary,
+	// which is packaged like the others. With -darwin-universal-only, the
+	// binaries it's made of are removed, and not packaged.
+	var universals []*CompileOpts
+	var universalResults []Result
+	merged := make(map[*CompileOpts]bool)
+	if flagDarwinUniversal {
+		for _, b := range UniversalBuilds(results) {
+			b := b
+			opts := b.Opts()
+			if err := b.Built(); err != nil {
+				logAt(logger, LogWarn, "not creating the universal binary of %s: %s",
+					opts.PackagePath, err)
+				continue
+			}
+			output, err := b.Merge()
+			if err != nil {
+				errors = append(errors,
+					fmt.Sprintf("%s universal binary error: %s", buildName(opts), err))
+				continue
+			}
+			fmt.Fprint(out, outColors.BuildLine(opts.Platform, "%s -> %s", buildLabel(opts), output))
+			universals = append(universals, opts)
+			universalResults = append(universalResults, Result{
+				Platform:    opts.Platform,
+				PackagePath: opts.PackagePath,
+				GoVersion:   opts.GoVersion,
+				Output:      output,
+				Opts:        opts,
+			})
+
+			if flagDarwinUniversalOnly {
+				for _, r := range []*Result{b.AMD64, b.ARM64} {
+					merged[r.Opts] = true
+					if err := os.Remove(r.Output); err != nil {
+						errors = append(errors, fmt.Sprintf("%s error: %s", buildName(r.Opts), err))
+					}
+				}
+			}
+		}
+	}
+
+	// The builds that weren't archived yet, such as those that were up to
+	// date or kept for a universal binary, get their entries of the
+	// manifest now. The binaries merged into a universal binary with
+	// -darwin-universal-only are gone, the universal binary takes their
+	// place.
+	var manifest *Manifest
+	if flagManifest != "" {
+		manifest = &Manifest{}
+		manifestResults := append(append([]Result(nil), results...), universalResults...)
+		for i := range manifestResults {
+			if merged[manifestResults[i].Opts] {
+				continue
+			}
+			entry, ok := manifestEntries[manifestResults[i].Opts]
+			if !ok {
+				entry, err = NewManifestEntry(&manifestResults[i], toolchainVersion)
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("manifest error: %s", err))
+					manifest = nil
+					break
+				}
+			}
+			manifest.Builds = append(manifest.Builds, entry)
+		}
+
+		// A resumed run only built some of the builds, the manifest of the
+		// last run has the rest.
+		if manifest != nil && flagResume {
+			prev, err := ReadManifest(flagManifest)
+			switch {
+			case err == nil:
+				manifest.Merge(prev)
+			case !os.IsNotExist(err):
+				errors = append(errors, fmt.Sprintf("manifest error: %s", err))
+			}
+		}
+	}
+
+	var failFastSkipped []string
+	for _, r := range results {
+		if state != nil {
+			state.RecordOutcome(&r, runFlags(r.Opts))
+		}
+		if r.Err == ErrFailFastSkipped || r.Err == ErrFailFastKilled {
+			failFastSkipped = append(failFastSkipped,
+				fmt.Sprintf("%s: %s", buildName(r.Opts), r.Err))
+			continue
+		}
+		if state != nil && flagState {
+			if err := state.Record(&r, buildInputs(r.Opts)); err != nil {
+				errors = append(errors, fmt.Sprintf("state error: %s", err))
+			}
+		}
+		if r.Err != nil {
+			errors = append(errors,
+				fmt.Sprintf("%s error: %s", buildName(r.Opts), r.Err))
+			buildErrors++
+			continue
+		}
+		if r.Opts.Mode == ModeVet || merged[r.Opts] {
+			continue
+		}
+		if r.Artifacts != nil {
+			artifacts = append(artifacts, r.Artifacts...)
+			continue
+		}
+
+		// Builds that were up to date, or that were kept for a
+		// universal binary, are packaged now.
+		files, err := packageOutput(r.Opts, archiveSpec, flagArchiveRmBinary)
+		artifacts = append(artifacts, files...)
+		if err != nil {
+			errors = append(errors,
+				fmt.Sprintf("%s archive error: %s", buildName(r.Opts), err))
+		}
+	}
+	for _, opts := range universals {
+		files, err := packageOutput(opts, archiveSpec, flagArchiveRmBinary)
+		artifacts = append(artifacts, files...)
+		if err != nil {
+			errors = append(errors,
+				fmt.Sprintf("%s archive error: %s", buildName(opts), err))
+		}
+	}
+
+	if manifest != nil {
+		if err := manifest.Write(flagManifest); err != nil {
+			errors = append(errors, fmt.Sprintf("manifest error: %s", err))
+		}
+	}
+	if state != nil {
+		if err := state.Write(flagStateFile); err != nil {
+			errors = append(errors, fmt.Sprintf("state error: %s", err))
+		}
+	}
+
+	// With -checksum-per-file, each artifact gets a checksum file of its
+	// own for each algorithm, next to it and for the same platform.
+	var checksumArtifacts []Artifact
+	if flagChecksum && len(artifacts) > 0 {
+		if buildErrors > 0 {
+			logAt(logger, LogWarn,
+				"%d builds failed, %s only covers the successful builds",
+				buildErrors, strings.Join(checksumFiles, ", "))
+		}
+		for i, algo := range flagChecksumAlgos {
+			if err := WriteChecksums(checksumFiles[i], algo, artifactPaths(artifacts)); err != nil {
+				errors = append(errors, fmt.Sprintf("checksum error: %s", err))
+				continue
+			}
+			checksumArtifacts = append(checksumArtifacts, Artifact{Path: checksumFiles[i]})
+
+			if !flagChecksumPerFile {
+				continue
+			}
+			for _, a := range artifacts {
+				path, err := WriteFileChecksum(a.Path, algo)
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("checksum error: %s", err))
+					continue
+				}
+				checksumArtifacts = append(checksumArtifacts,
+					Artifact{Path: path, Platform: a.Platform})
+			}
+		}
+	}
+
+	if flagChecksum && len(errors) == 0 {
+		artifacts = append(artifacts, checksumArtifacts...)
+	}
+
+	// Only sign if everything succeeded, a signature vouches for a complete
+	// release.
+	if flagSignKey != "" && len(errors) == 0 {
+		for _, path := range checksumFiles {
+			sigPath, err := SignFile(path, flagSignKey, flagGPGCmd)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("sign error: %s", err))
+				continue
+			}
+			artifacts = append(artifacts, Artifact{Path: sigPath})
+		}
+	}
+
+	// Likewise, only publish complete releases. What was skipped is
+	// reported below, since with -partial-ok the run would exit with 0.
+	var releaseSkipped []string
+	if flagSignKey != "" && len(errors) > 0 {
+		releaseSkipped = append(releaseSkipped, "-sign-key")
+	}
+	if uploader != nil && len(errors) > 0 {
+		releaseSkipped = append(releaseSkipped, "-upload")
+	}
+	if uploader != nil && len(errors) == 0 {
+		fmt.Fprintf(out, "\nUploading %d artifacts\n", len(artifacts))
+		uploadErrs := UploadArtifacts(uploader, artifacts, parallel)
+		for _, a := range artifacts {
+			if err, ok := uploadErrs[a.Path]; ok {
+				errors = append(errors, fmt.Sprintf("%s upload error: %s", a.Path, err))
+			}
+		}
+	}
+
+	// Skipped platforms don't count as errors.
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "\n%d platforms skipped, no working C toolchain was found:\n", len(skipped))
+		for _, platform := range skipped {
+			fmt.Fprintf(out, "--> %s\n", platform)
+		}
 	}
 
-	// Determine what amount of parallelism we want Default to the current
-	// number of CPUs-1 is <= 0 is specified.
-	if parallel <= 0 {
-		cpus := runtime.NumCPU()
-		if cpus < 2 {
-			parallel = 1
-		} else {
-			parallel = cpus - 1
+	if flagTiming && len(results) > 0 {
+		fmt.Fprintf(out, "\n")
+		WriteTimingTable(out, results)
+	}
+	if flagReportSize && len(results) > 0 {
+		fmt.Fprintf(out, "\n")
+		WriteSizeTable(out, results)
+	}
+
+	// Every build gets a row of the summary, so that there's one place to
+	// look after a big run. With -json, the summary event takes its place.
+	if events == nil && len(results) > 0 {
+		fmt.Fprintf(out, "\n")
+		WriteSummaryTable(out, results)
+	}
+
+	// Only the builds that failed may make it a partial failure, anything
+	// else that went wrong fails the run.
+	code := buildsExitCode(results, flagPartialOK, requiredOSArch, resumedBuilt)
+	if len(errors) > buildErrors {
+		code = exitFailure
+	}
+
+	// A release that wasn't signed or uploaded isn't a success, even if
+	// -partial-ok allows the builds that failed.
+	if len(releaseSkipped) > 0 {
+		errors = append(errors, fmt.Sprintf("%s skipped, not every build succeeded",
+			strings.Join(releaseSkipped, " and ")))
+		if code == 0 {
+			code = exitPartialFailure
 		}
+	}
+
+	if events != nil {
+		e := NewSummaryEvent(results, time.Since(start))
+		e.Summary.Skipped = skipped
+		e.Summary.Artifacts = artifactPaths(artifacts)
+		e.Summary.Errors = errors
+		e.Summary.ExitCode = code
+		events.Write(e)
+	}
 
-		// Joyent containers report 48 cores via runtime.NumCPU(), and a
-		// default of 47 parallel builds causes a panic. Default to 3 on
-		// Solaris-derived operating systems unless overridden with the
-		// -parallel flag.
-		if runtime.GOOS == "solaris" {
-			parallel = 3
+	if len(errors) > 0 {
+		writeErrors(os.Stderr, errColors, errors)
+
+		// These weren't attempted, or were stopped, so they aren't
+		// failures of their own.
+		if len(failFastSkipped) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d builds not completed due to -fail-fast:\n",
+				len(failFastSkipped))
+			for _, skipped := range failFastSkipped {
+				fmt.Fprintf(os.Stderr, "--> %s\n", skipped)
+			}
 		}
 	}
 
-	if version {
-		printInfo()
-		os.Exit(0)
-		return 1
+	// The counts go with the errors, if there are any.
+	countsOut := out
+	if len(errors) > 0 {
+		countsOut = os.Stderr
+	}
+	fmt.Fprintf(countsOut, "\n%s\n", buildCounts(results, code, flagPartialOK))
+	if code != 0 {
+		return code
 	}
 
-	if buildToolchain {
-		return mainBuildToolchain(parallel, platformFlag, verbose)
+	// The artifacts are all that -quiet prints, so that they can be piped
+	// to other commands.
+	if flagQuiet {
+		for _, a := range artifacts {
+			fmt.Println(a.Path)
+		}
 	}
 
-	if _, err := exec.LookPath(flagGoCmd); err != nil {
-		fmt.Fprintf(os.Stderr, "%s executable must be on the PATH\n",
-			flagGoCmd)
+	return 0
+}
+
+// mainWatch builds the configuration every time the source of its
+// packages changes, printing whether each platform built, until ctx is
+// done. A run that is still going when the source changes is cancelled.
+func mainWatch(ctx context.Context, out io.Writer, c colors, cfg BuildConfig, goCmd, mod string,
+	env []string) int {
+	dirs, err := WatchDirs(cfg.Packages, goCmd, mod, env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading packages: %s\n", err)
 		return 1
 	}
 
-	goVersion, err := GoVersion()
+	fmt.Fprintf(out, "Watching %d directories for changes, press Ctrl-C to stop\n", len(dirs))
+	// The outputs may be written to the directories being watched, which
+	// mustn't cause another run.
+	err = Watch(ctx, dirs, CleanFiles(cfg), func(ctx context.Context) {
+		start := time.Now()
+		results, err := Build(ctx, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A platform passes if all of its packages built, otherwise the
+		// first error is shown.
+		failures := make(map[string]string)
+		for _, r := range results {
+			if _, ok := failures[r.Platform.String()]; !ok && r.Err != nil {
+				failures[r.Platform.String()] = fmt.Sprintf("%s: %s",
+					r.PackagePath, compactError(r.Err))
+			}
+		}
+
+		fmt.Fprintf(out, "\n[%s] built in %s\n", start.Format("15:04:05"),
+			formatDuration(time.Since(start)))
+		for _, platform := range cfg.Platforms {
+			if failure, ok := failures[platform.String()]; ok {
+				fmt.Fprint(out, c.BuildLine(platform, "%s", c.Failure("FAIL "+failure)))
+			} else {
+				fmt.Fprint(out, c.BuildLine(platform, "ok"))
+			}
+		}
+	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading Go version: %s", err)
+		fmt.Fprintf(os.Stderr, "Error watching for changes: %s\n", err)
 		return 1
 	}
 
-	if flagListOSArch {
-		return mainListOSArch(goVersion)
+	return 0
+}
+
+// compactError returns the gist of a build error in a single line: the
+// first error go build printed, or the first line of the error otherwise.
+func compactError(err error) string {
+	if execErr, ok := err.(*ExecError); ok {
+		for _, line := range strings.Split(execErr.Stderr, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				return line
+			}
+		}
 	}
 
-	// Determine the packages that we want to compile. Default to the
-	// current directory if none are specified.
-	packages := flags.Args()
-	if len(packages) == 0 {
-		packages = []string{"."}
+	return firstLine(err.Error())
+}
+
+// dryRun prints the output path and go build command of every build
+// without running them. Any build that would fail before running go build,
+// such as with a bad template, is reported as an error.
+func dryRun(out io.Writer, outColors, errColors colors, cfg BuildConfig) int {
+	var errors []string
+	for _, opts := range cfg.builds() {
+		opts := opts
+		platform, label := opts.Platform, buildLabel(&opts)
+
+		// The go vet command comes first, whether it runs before the
+		// build or on its own.
+		var vetCmd *BuildCommand
+		if opts.Vet || opts.Mode == ModeVet {
+			vet := opts
+			vet.Mode = ModeVet
+			cmd, err := NewBuildCommand(&vet)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("%s error: %s", buildName(&opts), err))
+				continue
+			}
+			vetCmd = cmd
+		}
+		if opts.Mode == ModeVet {
+			fmt.Fprint(out, outColors.BuildLine(platform, "%s", label))
+			fmt.Fprintf(out, "    %s\n", vetCmd)
+			continue
+		}
+
+		output, err := OutputPath(&opts)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s error: %s", buildName(&opts), err))
+			continue
+		}
+		cmd, err := NewBuildCommand(&opts)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s error: %s", buildName(&opts), err))
+			continue
+		}
+
+		fmt.Fprint(out, outColors.BuildLine(platform, "%s -> %s", label, output))
+		if vetCmd != nil {
+			fmt.Fprintf(out, "    %s\n", vetCmd)
+		}
+		fmt.Fprintf(out, "    %s\n", cmd)
+	}
+
+	if len(errors) > 0 {
+		writeErrors(os.Stderr, errColors, errors)
+		return 1
+	}
+
+	return 0
+}
+
+// mainCheck checks that every platform of the configuration can be built
+// for with CheckPlatforms, printing whether each can as it is checked.
+func mainCheck(out io.Writer, outColors, errColors colors, cfg BuildConfig) int {
+	var lock sync.Mutex
+	cfg.OnFinish = func(r *Result) {
+		lock.Lock()
+		defer lock.Unlock()
+		status := "ok"
+		if r.Err != nil {
+			status = outColors.Failure("failed")
+		}
+		if r.GoVersion != "" {
+			status += " with " + r.GoVersion
+		}
+		fmt.Fprint(out, outColors.BuildLine(r.Platform, "%s", status))
 	}
 
-	// Get the packages that are in the given paths
-	mainDirs, err := GoMainDirs(packages, flagGoCmd)
+	fmt.Fprintf(out, "Checking %d platforms\n\n", len(cfg.Platforms))
+	results, err := CheckPlatforms(context.Background(), cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading packages: %s", err)
+		fmt.Fprintf(os.Stderr, "Error checking platforms: %s\n", err)
 		return 1
 	}
 
-	// Determine the platforms we're building for
-	platforms := platformFlag.Platforms(SupportedPlatforms(goVersion))
-	if len(platforms) == 0 {
-		fmt.Println("No valid platforms to build for. If you specified a value")
-		fmt.Println("for the 'os', 'arch', or 'osarch' flags, make sure you're")
-		fmt.Println("using a valid value.")
+	var errors []string
+	for _, r := range results {
+		if r.Err != nil {
+			errors = append(errors, fmt.Sprintf("%s error: %s", buildName(r.Opts), r.Err))
+		}
+	}
+	if len(errors) > 0 {
+		writeErrors(os.Stderr, errColors, errors)
 		return 1
 	}
 
-	// Build in parallel!
-	fmt.Printf("Number of parallel builds: %d\n\n", parallel)
-	var errorLock sync.Mutex
-	var wg sync.WaitGroup
-	errors := make([]string, 0)
-	semaphore := make(chan int, parallel)
-	for _, platform := range platforms {
-		for _, path := range mainDirs {
-			// Start the goroutine that will do the actual build
-			wg.Add(1)
-			go func(path string, platform Platform) {
-				defer wg.Done()
-				semaphore <- 1
-				fmt.Printf("--> %15s: %s\n", platform.String(), path)
-
-				opts := &CompileOpts{
-					PackagePath: path,
-					Platform:    platform,
-					OutputTpl:   outputTpl,
-					Ldflags:     ldflags,
-					Gcflags:     flagGcflags,
-					Asmflags:    flagAsmflags,
-					Tags:        tags,
-					Cgo:         flagCgo,
-					Rebuild:     flagRebuild,
-					GoCmd:       flagGoCmd,
-				}
+	return 0
+}
 
-				// Determine if we have specific CFLAGS or LDFLAGS for this
-				// GOOS/GOARCH combo and override the defaults if so.
-				envOverride(&opts.Ldflags, platform, "LDFLAGS")
-				envOverride(&opts.Gcflags, platform, "GCFLAGS")
-				envOverride(&opts.Asmflags, platform, "ASMFLAGS")
-
-				if err := GoCrossCompile(opts); err != nil {
-					errorLock.Lock()
-					defer errorLock.Unlock()
-					errors = append(errors,
-						fmt.Sprintf("%s error: %s", platform.String(), err))
-				}
-				<-semaphore
-			}(path, platform)
+// firstLine returns the first line of s, for showing errors that include
+// the full output of a command in a single line.
+func firstLine(s string) string {
+	if idx := strings.Index(s, "\n"); idx >= 0 {
+		return s[:idx]
+	}
+
+	return s
+}
+
+// buildTracker tracks the state of every build of a run, to report what
+// happened to each of them if the run is interrupted.
+type buildTracker struct {
+	lock      sync.Mutex
+	keys      []string
+	started   map[string]bool
+	completed map[string]bool
+	failed    map[string]bool
+}
+
+func newBuildTracker(cfg BuildConfig) *buildTracker {
+	t := &buildTracker{
+		started:   make(map[string]bool),
+		completed: make(map[string]bool),
+		failed:    make(map[string]bool),
+	}
+	for _, opts := range cfg.builds() {
+		t.keys = append(t.keys, buildKey(&opts))
+	}
+
+	return t
+}
+
+func buildKey(opts *CompileOpts) string {
+	return fmt.Sprintf("%s: %s", buildName(opts), opts.PackagePath)
+}
+
+// buildLabel is how the build with the given options is shown after its
+// platform: its package and, if it switches to another version of Go,
+// that version.
+func buildLabel(opts *CompileOpts) string {
+	if opts.GoVersion != "" {
+		return fmt.Sprintf("%s (%s)", opts.PackagePath, opts.GoVersion)
+	}
+
+	return opts.PackagePath
+}
+
+// Start records that the build with the given options started.
+func (t *buildTracker) Start(opts *CompileOpts) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.started[buildKey(opts)] = true
+}
+
+// Finish records the result of a build. A build that failed after the
+// run was cancelled counts as cancelled rather than failed.
+func (t *buildTracker) Finish(r *Result, cancelled bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := buildKey(r.Opts)
+	switch {
+	case r.Err == nil:
+		t.completed[key] = true
+	case !cancelled:
+		t.failed[key] = true
+	}
+}
+
+// PrintSummary prints which builds completed, which failed, which were
+// cancelled while running and which never started.
+func (t *buildTracker) PrintSummary() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var completed, failed, cancelled, notStarted []string
+	for _, key := range t.keys {
+		switch {
+		case !t.started[key]:
+			notStarted = append(notStarted, key)
+		case t.completed[key]:
+			completed = append(completed, key)
+		case t.failed[key]:
+			failed = append(failed, key)
+		default:
+			// Cancelled, or still running when we gave up waiting.
+			cancelled = append(cancelled, key)
 		}
 	}
-	wg.Wait()
 
-	if len(errors) > 0 {
-		fmt.Fprintf(os.Stderr, "\n%d errors occurred:\n", len(errors))
-		for _, err := range errors {
-			fmt.Fprintf(os.Stderr, "--> %s\n", err)
+	fmt.Fprintf(os.Stderr, "\nBuilds interrupted:\n")
+	for _, group := range []struct {
+		name string
+		keys []string
+	}{
+		{"completed", completed},
+		{"failed", failed},
+		{"cancelled", cancelled},
+		{"not started", notStarted},
+	} {
+		if len(group.keys) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "\n%d %s:\n", len(group.keys), group.name)
+		for _, key := range group.keys {
+			fmt.Fprintf(os.Stderr, "--> %s\n", key)
 		}
-		return 1
 	}
+}
 
-	return 0
+// packageOutput archives the binary built with the given options if there
+// is an archive format for its platform, and returns the artifacts that
+// were produced.
+func packageOutput(opts *CompileOpts, spec ArchiveSpec, removeBinary bool) ([]Artifact, error) {
+	output, err := OutputPath(opts)
+	if err != nil {
+		return nil, err
+	}
+	binary := Artifact{Path: output, Platform: opts.Platform}
+
+	format := spec.Format(opts.Platform.OS)
+	if format == "" {
+		return []Artifact{binary}, nil
+	}
+
+	archivePath, err := ArchiveBinary(output, format)
+	if err != nil {
+		return []Artifact{binary}, err
+	}
+	archive := Artifact{Path: archivePath, Platform: opts.Platform}
+	if removeBinary {
+		if err := os.Remove(output); err != nil {
+			return []Artifact{binary, archive}, err
+		}
+
+		return []Artifact{archive}, nil
+	}
+
+	return []Artifact{binary, archive}, nil
 }
 
 func printUsage() {
-	fmt.Fprintf(os.Stderr, helpText)
+	fmt.Fprint(os.Stderr, helpText)
 }
 
 func printInfo() {
@@ -251,30 +2384,459 @@ const helpText = `Usage: gox [options] [packages]
   If no specific operating systems or architectures are specified, Gox
   will build for all pairs supported by your version of Go.
 
+  The platform gox runs on is built first, then the others in order of
+  name, so with "-fail-fast" a failure on your own platform stops the
+  run right away.
+
 Options:
 
+  -android-api=21     Android API level to build for with the NDK
   -arch=""            Space-separated list of architectures to build for
-  -build-toolchain    Build cross-compilation toolchain
+  -archive=""         Archive each binary after building. See below for more info
+  -archive-rm-binary  Remove each binary after it has been archived
+  -build-toolchain    Same as -warm-std, kept for compatibility
+  -buildmode=""       '-buildmode' value to pass to go build, such as pie
+                      or c-shared. Unsupported platforms are skipped
+  -buildvcs=""        '-buildvcs' value to pass to go build: true, false or
+                      auto. Use false to build from a tree without VCS
+                      info, such as an exported source tarball. Requires
+                      Go 1.18 or later
   -cgo                Sets CGO_ENABLED=1, requires proper C toolchain (advanced)
-  -gcflags=""         Additional '-gcflags' value to pass to go build
+  -cgo-osarch=""      Space-separated list of os/arch pairs to set
+                      CGO_ENABLED=1 for, and CGO_ENABLED=0 for the rest
+  -cgo-skip-missing   Skip platforms with cgo that have no working C toolchain
+  -check              Only check that every platform can be built for, by
+                      building a tiny program for each. See below
+  -checksum           Write a SHA256SUMS file covering every artifact
+  -checksum-algo=""   Space-separated list of checksum algorithms, sha256,
+                      sha512 or blake2b, with a checksum file for each.
+                      Implies -checksum. See below
+  -checksum-file=""   Path of the checksum file, defaults to SHA256SUMS
+                      in the output directory
+  -checksum-per-file  Also write the checksum of each artifact next to it,
+                      such as app.zip.sha256. Implies -checksum
+  -clean              Remove the outputs of earlier runs for every platform,
+                      and their archives and checksums, before building
+  -clean-env          Build with only PATH, HOME, the temp directories and
+                      the GO* variables of the environment. See below
+  -color              Color the output even if it isn't a terminal
+  -config=""          Config file to read, defaults to gox.{json,toml,yaml}
+  -darwin-sign=""     Codesign identity to sign the darwin binaries with, on
+                      macOS only. See below
+  -darwin-universal   Also merge the darwin/amd64 and darwin/arm64 binaries
+                      of each package into a universal binary. See below
+  -darwin-universal-only
+                      Same as -darwin-universal, but remove the binaries
+                      the universal binary is made of
+  -dry-run            Print the output path and go build command of every
+                      build without running them
+  -env=KEY=VALUE      Set a variable for the builds, or only those of a
+                      platform with "-env linux/arm64:KEY=VALUE". Can be
+                      given more than once. See "Environment" below
+  -env-override-mode="replace"
+                      Whether GOX_[OS]_[ARCH]_*FLAGS variables replace or
+                      append to the flags. See "Platform Overrides" below
+  -fail-fast          Start no more builds after a build fails. With
+                      -fail-fast=kill, running builds are killed as well
+  -force-overwrite    Build even if builds would write to the same output path
+  -generate           Run go generate for the packages before building
+  -gcflags=""         Additional '-gcflags' value to pass to go build, which
+                      may start with a package pattern, as in "all=-N -l"
+  -ignore-goflags     Build with GOFLAGS empty, so that go build only gets
+                      the flags of gox. See "Environment" below
+  -installsuffix=""   '-installsuffix' value to pass to go build
+  -json               Write build events to stdout as JSON. See below
   -ldflags=""         Additional '-ldflags' value to pass to go build
+  -log-dir=""         Also write the commands, variables and output of each
+                      build to <dir>/<goos>_<goarch>_<pkg>.log, where the
+                      slashes of the package path are underscores
+  -log-level="info"   Messages to print: debug, info, warn or error. See below
+  -mod=""             '-mod' value to pass to go build: mod, readonly or vendor
   -asmflags=""        Additional '-asmflags' value to pass to go build
+  -reproducible       Build byte-identical binaries: implies -trimpath and
+                      -buildvcs=false, leaves out the build ID, and dates
+                      archives to SOURCE_DATE_EPOCH or the last commit
+  -stamp-version=""   Set this variable, such as main.version, to the output
+                      of git describe --tags --always --dirty. May be
+                      given more than once
+  -stamp-commit=""    Set this variable to the git commit being built
+  -stamp-date=""      Set this variable to the build date, in RFC 3339,
+                      from SOURCE_DATE_EPOCH if it's set
+  -static             Build fully static binaries for linux. With cgo, this
+                      adds the netgo and osusergo tags and links with
+                      -extldflags=-static. See below
+  -strict-goflags     Fail, rather than warn, if GOFLAGS has flags that gox
+                      passes as well. See "Environment" below
+  -strip              Strip the symbol table and debug info, by adding
+                      "-s -w" to the ldflags of every platform
   -tags=""            Additional '-tags' value to pass to go build
+  -trimpath           Pass -trimpath to go build, requires Go 1.13 or later
+  -manifest=""        Write a JSON manifest of every build to this path
+  -no-color           Don't color the output, same as setting NO_COLOR
   -os=""              Space-separated list of operating systems to build for
   -osarch=""          Space-separated list of os/arch pairs to build for
-  -osarch-list        List supported os/arch pairs for your Go version
+  -osarch-file=""     File of os/arch pairs to build for or skip, one per
+                      line, added to "-osarch"
+  -osarch-list        List supported os/arch pairs for your Go version. With
+                      -json, as a JSON array with the os, arch, variant,
+                      default, primary and min_go_version of each
   -output="foo"       Output path template. See below for more info
-  -parallel=-1        Amount of parallelism, defaults to number of CPUs
-  -gocmd="go"         Build command, defaults to Go
+  -output-dir=""      Directory the output path is relative to
+  -overlay=""         Overlay JSON file to pass to go build as -overlay, to
+                      build with files replaced, such as generated code.
+                      Requires Go 1.16 or later
+  -parallel="auto"    Number of builds to run at once: a number, where 0 and
+                      1 build serially, a percentage of the CPUs such as
+                      "50%", or "auto" for one less than the number of CPUs
+  -parallel-cgo=N     Number of builds with cgo to run at once, on top of
+                      -parallel. Defaults to 1 with -cgo, 0 is no limit
+  -partial-ok         Exit with 0 when only some builds failed, as long as
+                      the platforms of -required-osarch built. See below
+  -pgo=""             CPU profile to optimize every build with, passed to go
+                      build as -pgo. Requires Go 1.21 or later. The profile
+                      of a platform can be set with GOX_[OS]_[ARCH]_PGO
+  -post-hook=""       Shell command to run after each successful build, with
+                      GOX_OUTPUT, GOX_OS, GOX_ARCH and GOX_PACKAGE set.
+                      The build fails if the command fails
+  -pre-hook=""        Shell command to run once before any builds start
+  -primary-only       Build the first-class ports of Go by default, rather
+                      than the default platforms. See below
+  -profile="default"  Config file profile to build with. See below
+  -progress           Show the progress of the builds even if the output
+                      isn't a terminal, as a line after each build
+  -quiet, -q          Only print errors, and the artifacts of a successful run
+  -gocache-mode="shared"
+                      Build cache the platforms build with: "shared" for
+                      go's default, "per-platform" for a cache per os/arch
+                      inside it, or "dir:<path>" for the cache in <path>
+  -gocmd="go"         Build command, defaults to Go. May be set per-platform,
+                      see below
+  -goversions=""      Space-separated list of Go versions to build every
+                      platform with, such as "go1.21.9 go1.22.3". See below
+  -gpg-cmd="gpg"      gpg command used by -sign-key, defaults to gpg
+  -race               Build with the race detector, requires cgo
+  -race-strict        Fail instead of skipping platforms -race doesn't support
+  -incremental        Skip the builds whose output is newer than the Go
+                      files of the package. See below
   -rebuild            Force rebuilding of package that were up to date
-  -verbose            Verbose mode
+  -report-size        Print the size of each binary, largest first
+  -require-main       Fail, rather than warn, when a package given by name
+                      isn't a main package
+  -required-osarch="" Space-separated list of os/arch pairs that must build
+                      for -partial-ok to exit with 0
+  -resume             Only build what failed or wasn't attempted in the last
+                      run, as recorded in -state-file. See below
+  -retries=0          Number of times to retry a failed build
+  -state              Skip the builds whose inputs and output are the same as
+                      in the last run, as recorded in -state-file. See below
+  -state-file=".gox-state.json"
+                      State file that every run writes, for -state and
+                      -resume
+  -sign-key=""        gpg key to sign the checksum file with, requires -checksum
+  -test               Build test binaries with go test -c instead, for the
+                      packages with test files. See below
+  -timing             Print how long each build took, slowest first
+  -upload=""          Upload the artifacts after a successful run. See below
+  -upload-repo=""     GitHub repository to upload to, as owner/name
+  -upload-tag=""      GitHub release tag to upload to
+  -upload-draft       Create the GitHub release as a draft
+  -upload-acl=""      Canned ACL for objects uploaded to S3
+  -upload-endpoint="" Custom S3 endpoint, such as a MinIO server
+  -upload-cache-control=""
+                      Cache-Control header for objects uploaded to GCS
+  -upload-dry-run     Print where artifacts would be uploaded, don't upload
+  -upx                Compress the binaries with upx, except for platforms
+                      upx doesn't support
+  -upx-args=""        Additional arguments to pass to upx, such as "--best"
+  -verify-reproducible
+                      Build every platform a second time, from scratch,
+                      and fail if the binaries differ. Implies -reproducible
+  -verbose            Verbose mode, shows the output of go build -v for
+                      each build as it runs
+  -vet                Run go vet for each platform before building it, and
+                      fail the platform if vet reports problems. See below
+  -vet-only           Only run go vet for each platform, building nothing
+  -warm-std           Build the standard library for each platform, and
+                      nothing else, to warm the build cache. See below
+  -watch              Build again every time the source of the packages
+                      changes, showing whether each platform built
+  -windows-gui        Build GUI binaries for windows, which start without a
+                      console window, by adding "-H windowsgui" to the
+                      ldflags of the windows platforms only
+  -winicon=""         Icon to link into the binaries for windows, a .ico file
+  -winres=""          versioninfo.json file of the VERSIONINFO resource to
+                      link into the binaries for windows. See below
+  -x                  Print the go build commands as they run, with the
+                      variables they are run with, to stderr
 
 Output path template:
 
   The output path for the compiled binaries is specified with the
   "-output" flag. The value is a string that is a Go text template.
   The default value is "{{.Dir}}_{{.OS}}_{{.Arch}}". The variables and
-  their values should be self-explanatory.
+  their values should be self-explanatory. If the platform has a variant,
+  such as "linux/mips/softfloat", it is added as "_{{.Variant}}" by
+  default, as is "_{{.Libc}}" for a libc, such as "linux/amd64@musl", and
+  "_{{.GoVersion}}" with "-goversions".
+
+  "{{.Dir}}" is the name of the directory of the package, which may be
+  the same for packages in different directories, such as "cmd/server"
+  and "tools/server". The full import path of the package is available as
+  "{{.ImportPath}}", and its last element as "{{.ImportBase}}". Slashes in
+  the import path make directories in the output path, unless they are
+  replaced:
+
+    {{replace .ImportPath "/" "_"}}_{{.OS}}_{{.Arch}}
+
+  The git commit being built is available as "{{.GitSHA}}" and
+  "{{.GitShortSHA}}", and "{{.GitTag}}" is the nearest tag as reported
+  by "git describe --tags". These are empty if the current directory
+  isn't a git repository. The same variables may also be used in
+  "-ldflags":
+
+    -ldflags="-X main.Version={{.GitTag}}"
+
+  The following functions may be used in the template: lower, upper,
+  title, trimspace and replace. For example:
+
+    {{.Dir}}-{{.OS | title}}-{{replace .Arch "amd64" "x86_64"}}
+
+  Binaries for Windows get a ".exe" extension and binaries for WebAssembly,
+  js/wasm and wasip1/wasm, get a ".wasm" extension, unless the rendered
+  path already ends in it. WebAssembly is always built without cgo.
+  The extension is also available as "{{.Exe}}" for full control over
+  where it goes; it is empty for other platforms.
+
+  With "-buildmode=c-shared" or "-buildmode=c-archive", the extension of
+  the library is added instead: ".so", ".dylib" or ".dll" for shared
+  libraries and ".a" for archives. It is available as "{{.Ext}}", which
+  is the same as "{{.Exe}}" for other build modes.
+
+  If "-output-dir" is set, the rendered output path is placed inside that
+  directory. Any directories in the output path are created as needed.
+
+  The template may be set per-platform with GOX_[OS]_[ARCH]_OUTPUT, or
+  with the "outputs" key of the config file, which maps os/arch patterns
+  to templates. The longest pattern that matches a platform is used:
+
+    {"outputs": {"darwin/*": "{{.Dir}}-macos-{{.Arch}}"}}
+
+  The variable takes precedence over the config file, and both take
+  precedence over "-output".
+
+Test binaries:
+
+  With "-test", gox builds the test binaries of the packages with
+  "go test -c" rather than building them with "go build", so that the
+  tests can be run on the platforms themselves. Every package with test
+  files is built, main or not, and packages without test files are
+  skipped. The default output template is
+  "{{.Dir}}_{{.OS}}_{{.Arch}}.test", and the other flags apply as usual.
+
+Incremental builds:
+
+  With "-incremental", a build is skipped, and reported as up to date, if
+  its output already exists and is newer than every Go file of the
+  package and of the packages it imports from the current directory.
+  Files that other platforms or tags build are included. Other changes
+  aren't noticed: different flags, "GOX_[OS]_[ARCH]_TAGS" that import
+  more packages, non-Go files such as embedded files or C sources, and
+  dependencies outside of the current directory. Use "-rebuild" to
+  build everything again.
+
+  "-state" doesn't depend on modification times, which makes it work in
+  CI where checkouts reset them. Each run records, in "-state-file", a
+  hash of the inputs of every build that succeeded: the contents of the
+  same Go files, go.mod and go.sum, the Go version, GOFLAGS, and the go
+  build command with its flags and platform. It records the SHA-256 of the
+  output as well. A build is skipped if its inputs hash the same as last
+  time and its output is still there, unchanged. "-rebuild" starts the
+  state over, and a state file that can't be read is ignored with a
+  warning.
+
+  Every run also records in "-state-file" whether each build succeeded,
+  failed, or wasn't attempted because of "-fail-fast" or an interrupt.
+  "-resume" builds only the builds of the platforms and packages given
+  that didn't succeed last time, and keeps the record of the others, so
+  that it can be repeated until everything is built. With "-manifest",
+  the builds of the resumed run replace theirs in the manifest of the
+  last run. A warning is printed if the builds that are kept were built
+  with different flags, since their results may not be comparable.
+
+Vet:
+
+  With "-vet", gox runs "go vet" for each platform right before building
+  it, with GOOS, GOARCH, cgo and "-tags" set the same way as for the
+  build, since the files that make up a package can differ per platform.
+  Problems vet reports fail the build of that platform. With "-vet-only",
+  vet runs for each platform and nothing is built, which makes a fast
+  check of the whole matrix, such as in CI. Vet runs "-parallel" at a
+  time like the builds do, and "-fail-fast", "-retries", "-x" and
+  "-dry-run" apply to it as well.
+
+Checking platforms:
+
+  With "-check", gox builds a tiny program for each platform, "-parallel"
+  at a time, into a temporary directory that is removed afterwards, and
+  prints whether each platform is ok. This makes sure before a long run
+  that Go supports every platform and has its standard library, and that
+  the C toolchain works for the platforms built with cgo, for which the
+  program uses cgo too. The packages are ignored and the output directory
+  is left alone, but "-cgo", "-tags", the flags, the config file and the
+  platform overrides apply as for a real build. gox exits with an error
+  if any platform fails.
+
+Warming the build cache:
+
+  With "-warm-std", gox builds the standard library for each platform,
+  "-parallel" at a time, and prints how long each took. The packages are
+  ignored and nothing else is built. Since the standard library then
+  comes from the build cache, the builds of later runs are faster, which
+  helps in CI where the cache is kept between jobs. "-cgo" and
+  "-gocache-mode" apply, so that the cache that is warmed is the one the
+  builds use. Before Go 1.20 the standard library is installed into
+  GOROOT instead, which has to be writable. Before Go 1.5, the toolchain
+  for each platform is built from the Go sources, one at a time.
+
+Archives:
+
+  The "-archive" flag packages each binary into an archive next to it
+  after it is built. The value is either a format, "zip" or "tar.gz",
+  which is used for every platform, or a space-separated list of os=format
+  pairs to choose a format per operating system:
+
+    -archive="tar.gz windows=zip"
+
+  Operating systems that have no format aren't archived.
+
+Checksums:
+
+  With "-checksum", a SHA256SUMS file covering every artifact is written
+  to the output directory, in the format of sha256sum. "-checksum-algo"
+  chooses the algorithms, and may be given more than once, with one file
+  for each: SHA256SUMS for sha256, SHA512SUMS for sha512 and B2SUMS for
+  blake2b, which is BLAKE2b-512 as b2sum makes it. "-checksum-file" names
+  the file when there is only one algorithm:
+
+    -checksum-algo="sha256 sha512"
+
+  With "-checksum-per-file", each artifact also gets a file of its own for
+  each algorithm, with its name and the algorithm as the extension, such
+  as "app_windows_amd64.zip.sha256". These are uploaded with the artifact
+  they are for. With "-sign-key", every checksum file that covers all the
+  artifacts is signed.
+
+Uploads:
+
+  With "-upload=github", the artifacts of a successful run, including any
+  archives, checksum file and signature, are uploaded as assets of the
+  GitHub release for "-upload-tag" in "-upload-repo". The release is
+  created if it doesn't exist. The API token is read from GITHUB_TOKEN.
+
+  With "-upload=s3://bucket/prefix/", the artifacts are uploaded to the
+  given S3 bucket. The object keys are the prefix followed by the path of
+  the artifact within "-output-dir". Credentials are read the same way
+  as the AWS CLI does: from the environment, the shared credentials file
+  or an instance role.
+
+  With "-upload=gs://bucket/prefix/", the artifacts are uploaded to the
+  given Google Cloud Storage bucket in the same way, using the
+  Application Default Credentials.
+
+  The prefix of S3 and GCS destinations is a template that may use
+  "{{.OS}}" and "{{.Arch}}" to organize the artifacts by platform. These
+  are empty for the checksum file and signature.
+
+    -upload="gs://bucket/releases/{{.OS}}/{{.Arch}}/"
+
+JSON output:
+
+  With "-json", gox writes one JSON object per line to stdout for each
+  event of the run, and everything else it prints goes to stderr. Every
+  event has a "type" and a "time":
+
+    {"type":"build-start","platform":"linux/amd64","package":"./cmd/foo",...}
+    {"type":"build-finish","platform":"linux/amd64","package":"./cmd/foo",
+     "output":"foo_linux_amd64","size":2015232,"duration_ms":1520,...}
+    {"type":"summary","summary":{"total":1,"succeeded":1,"failed":0,...}}
+
+  Failed builds have an "error" instead of an "output" and "size". The
+  summary is the last event, and also lists the artifacts and errors of
+  the run. The events are the Event type of the gox package.
+
+Log levels:
+
+  "-log-level" picks the messages that are printed. "info", the default,
+  prints the usual output, and "debug" adds the details of what gox does,
+  such as the go commands it runs and the GOX_[OS]_[ARCH]_* variables set
+  for each platform. "warn" prints only the warnings, such as platforms
+  that are skipped, and the errors, and "error" only the errors. Debug
+  messages start with "Debug: " and go to stdout, and warnings start
+  with "Warning: " and go to stderr. Errors are always printed.
+
+  Programs that use the gox package get the messages of the builds by
+  setting the Logger of CompileOpts to their own implementation of the
+  Logger interface.
+
+Summary and exit codes:
+
+  A run ends with a table of every build, sorted by platform, with
+  whether it was "ok", "up-to-date", "failed" or "skipped" because it
+  never ran, how long it took and its output. "-quiet" leaves it out, and
+  with "-json" the summary event takes its place.
+
+  gox exits with 0 if every build succeeded, 1 if every build failed or
+  something else went wrong, such as an invalid flag or a failed upload,
+  and 2 if some of the builds failed and the others succeeded. The last
+  line of the output counts the builds and gives the exit code, and so
+  does the "exit_code" of the summary with "-json". An interrupted run
+  exits with 130.
+
+  With "-partial-ok", a run where only some of the builds failed exits
+  with 0 instead, as long as every build of the platforms given to
+  "-required-osarch" succeeded:
+
+    -partial-ok -required-osarch="linux/amd64 darwin/arm64"
+
+  A required platform that ends up not being built, such as one that
+  "-cgo-skip-missing" skips, fails the run as well.
+
+  Checksums are still only signed, and artifacts only uploaded, if every
+  build succeeded. Otherwise they're skipped, and the run exits with 2
+  even with "-partial-ok".
+
+Config file:
+
+  Build settings may be stored in a "gox.json", "gox.toml" or "gox.yaml"
+  file in the current directory, or in the file given by the "-config"
+  flag. The format is detected by the file extension, and it is an error
+  for more than one config file to exist. The keys mirror the flags: os,
+  arch, osarch, ldflags, gcflags, asmflags, tags, output, parallel, cgo
+  and gocmd. The outputs key sets the output template per-platform, see
+  above, and the gocmds key the go command in the same way:
+
+    {"gocmds": {"linux/arm": "/opt/vendor-go/bin/go"}}
+
+  Unknown keys are an error.
+
+  The profiles key holds named sets of the same settings, one of which is
+  selected with "-profile", such as:
+
+    {
+      "profiles": {
+        "dev": {"osarch": "linux/amd64"},
+        "release": {"os": "linux darwin windows", "ldflags": "-s -w"}
+      }
+    }
+
+  The "default" profile is used if none is selected. Unless the config
+  file defines it, it changes nothing.
+
+  The same settings may be given as environment variables in the format
+  of GOX_[KEY], for example GOX_LDFLAGS. Settings are resolved in the
+  following order, with later sources taking precedence:
+
+    flag defaults < config file < profile < environment < command-line flags
 
 Platforms (OS/Arch):
 
@@ -285,24 +2847,247 @@ Platforms (OS/Arch):
   is made up of only negations, then the negations will come from the default
   list.
 
+  The supported platforms are the ones "go tool dist list" lists for the
+  go command, or a list built into gox for versions of Go that can't list
+  them. Run with "-osarch-list" to see them and which are defaults.
+
+  The "-os" list may also name groups of operating systems, which may be
+  negated as well, such as "-os=bsd" or "-os=!mobile":
+
+    unix     aix android darwin dragonfly freebsd illumos ios linux
+             netbsd openbsd solaris
+    bsd      dragonfly freebsd netbsd openbsd
+    desktop  linux darwin windows
+    mobile   android ios
+
   Additionally, the "-osarch" flag may be used to specify complete os/arch
   pairs that should be built or ignored. The syntax for this is what you would
   expect: "darwin/amd64" would be a valid osarch value. Multiple can be space
   separated. An os/arch pair can begin with "!" to not build for that platform.
+  An os/arch pair may be a pattern, with "*" for any OS or arch, such as
+  "linux/*" or "!*/386", which stands for every supported platform that
+  it matches. Negations take precedence, so "linux/* !linux/386" builds
+  every linux platform except linux/386.
+  The pairs may also be listed in a file given to "-osarch-file", one per
+  line, where blank lines and lines starting with "#" are skipped.
+
+  With "-primary-only", the platforms that are built when none are given,
+  or only negations, are the first-class ports of Go rather than the
+  default platforms: linux/386, linux/amd64, linux/arm, linux/arm64,
+  darwin/amd64, darwin/arm64, windows/386 and windows/amd64. Platforms
+  that are given explicitly are built as usual.
+
+  If none of "-os", "-arch" and "-osarch" are given, and GOOS or GOARCH
+  are set in the environment, only the platforms that match them are
+  built, like go build does.
 
   The "-osarch" flag has the highest precedent when determing whether to
   build for a platform. If it is included in the "-osarch" list, it will be
   built even if the specific os and arch is negated in "-os" and "-arch",
   respectively.
 
+  Some platforms may be built as a variant by adding it as a third
+  component. ARM platforms take a GOARM version, such as "linux/arm/v6",
+  MIPS platforms take a GOMIPS or GOMIPS64 floating point mode, such as
+  "linux/mipsle/softfloat", and amd64 platforms take a GOAMD64 level,
+  such as "linux/amd64/v3". A platform and its variants may be built in
+  the same run. The variants are listed by "-osarch-list".
+  A custom output path template must include "{{.Variant}}", or
+  "{{.ArmVersion}}" for ARM, so that the binaries for each variant don't
+  overwrite each other:
+
+    -osarch="linux/arm/v6 linux/arm/v7" -output="{{.Dir}}_{{.OS}}_{{.Arch}}{{.ArmVersion}}"
+
+  Linux platforms may be built against musl rather than glibc, such as
+  for Alpine, by adding "@musl", as in "linux/amd64@musl" or
+  "linux/arm/v7@musl". They are built with cgo, with musl-gcc as the C
+  compiler unless GOX_[OS]_[ARCH]_MUSL_CC is set, as it must be to cross
+  compile. The glibc and musl builds of a platform may be built in the
+  same run. The libc is "{{.Libc}}" in the output path template, and is
+  added as "_{{.Libc}}" by default:
+
+    -osarch="linux/amd64 linux/amd64@musl"
+
+Building with several versions of Go:
+
+  With "-goversions", every platform is built once with each of the
+  versions of Go given, which go switches to through GOTOOLCHAIN,
+  downloading them if they aren't in the module cache yet. This needs
+  Go 1.21 or later, both installed and in the list. The versions are
+  releases such as "go1.22.3", or release candidates such as "go1.23rc1".
+  The builds are listed by version, then platform.
+
+  The version is added to the default output path as "_{{.GoVersion}}",
+  after the variant. A custom output path template must include
+  "{{.GoVersion}}", so that the binaries for each version don't overwrite
+  each other:
+
+    -goversions="go1.21.9 go1.22.3" -output="dist/{{.GoVersion}}/{{.Dir}}_{{.OS}}_{{.Arch}}"
+
+  The manifest records the version each build used as its "toolchain".
+
+Android and iOS:
+
+  Building for Android with cgo uses the clang compilers of the Android
+  NDK, which are found through ANDROID_NDK_HOME. CC and CXX are set to
+  the compilers for the arch and the API level given by "-android-api".
+
+  Building for iOS always uses cgo, and requires macOS with Xcode and
+  the iOS SDK installed.
+
+  These are checked before each of these platforms is built, and the
+  platform fails if they are missing.
+
+macOS:
+
+  Building for darwin with "-cgo" from another OS uses osxcross. Its
+  compilers are looked for in the "target/bin" directory of OSXCROSS_ROOT
+  if it is set, or on the PATH otherwise, and are used as CC and CXX for
+  darwin/amd64 and darwin/arm64. If osxcross isn't found, the darwin
+  platforms are skipped.
+
+Static binaries:
+
+  With "-static", the binaries for linux are linked statically, so they
+  run anywhere, such as in a "scratch" container. Builds without cgo are
+  static already. Builds with cgo get the "netgo" and "osusergo" tags,
+  which make the net and os/user packages use their pure Go versions,
+  and "-static" is added to the "-extldflags" of the ldflags, after any
+  GOX_[OS]_[ARCH]_* overrides. The C libraries the package links must be
+  available as static libraries. A warning is printed for each binary
+  that ends up dynamically linked anyway. Other platforms are built as
+  usual.
+
+Universal binaries for macOS:
+
+  With "-darwin-universal", once the darwin/amd64 and darwin/arm64 builds
+  of a package have both succeeded, their binaries are merged into a
+  universal binary, which runs natively on both Intel and Apple silicon
+  Macs. It is written by gox itself, the same way "lipo -create" does, so
+  it works from any OS. Both platforms must be built. If either build
+  fails, the universal binary isn't made, with a warning.
+
+  The universal binary is named by the output template with "universal"
+  as the arch, such as "foo_darwin_universal", and is archived,
+  checksummed, uploaded and listed in "-manifest" like the other
+  binaries. With "-darwin-universal-only", the binaries it's made of are
+  removed once it's written, and only it is packaged and listed.
+
+Code signing for macOS:
+
+  With "-darwin-sign", each darwin binary is signed with "codesign" as
+  soon as it's built, with the identity given, such as "Developer ID
+  Application: Foo Inc (ABCDE12345)", and the hardened runtime, so that
+  it's ready to be notarized. Any signature already there, such as the
+  ad-hoc one Go gives darwin/arm64 binaries, is replaced. A binary that
+  fails to be signed fails its build. It's done after "-upx" and before
+  "-post-hook", and universal binaries are made of the signed binaries.
+
+  codesign only exists on macOS, so "-darwin-sign" is an error on other
+  systems. There, the binaries can be signed by "-post-hook" with a tool
+  such as rcodesign instead.
+
+Windows resources:
+
+  With "-winres", a VERSIONINFO resource is linked into the binaries for
+  windows, with the version and the strings, such as the CompanyName and
+  FileDescription, that Explorer shows for them. It is read from a
+  versioninfo.json file in the format of goversioninfo:
+
+    {
+      "FixedFileInfo": {"FileVersion": {"Major": 1, "Minor": 2}},
+      "StringFileInfo": {"ProductName": "Foo", "FileVersion": "1.2"},
+      "IconPath": "foo.ico"
+    }
+
+  "-winicon" links in an icon, a .ico file, which takes precedence over
+  the IconPath of the versioninfo.json file. The resources are written as
+  a .syso file in the directory of each package while its windows builds
+  run, and removed afterwards, so the packages must be in the main
+  module. Builds for the same package and arch wait for each other. Other
+  .syso files with resources in the package, such as from rsrc, conflict
+  with these.
+
 Platform Overrides:
 
-  The "-gcflags", "-ldflags" and "-asmflags" options can be overridden per-platform
-  by using environment variables. Gox will look for environment variables
-  in the following format and use those to override values if they exist:
+  The "-gcflags", "-ldflags", "-asmflags", "-tags" and "-installsuffix"
+  options can be overridden per-platform by using environment variables.
+  Gox will look for environment variables in the following format and use
+  those to override values if they exist:
 
     GOX_[OS]_[ARCH]_GCFLAGS
     GOX_[OS]_[ARCH]_LDFLAGS
     GOX_[OS]_[ARCH]_ASMFLAGS
+    GOX_[OS]_[ARCH]_TAGS
+    GOX_[OS]_[ARCH]_INSTALLSUFFIX
+
+  With "-env-override-mode=append", the GCFLAGS, LDFLAGS, ASMFLAGS and TAGS
+  variables are added after the value of the option instead of replacing
+  it. Whatever the mode, a variable with _APPEND at the end, such as
+  GOX_[OS]_[ARCH]_LDFLAGS_APPEND, is added after everything else. Tags
+  that are already set aren't added again.
+
+  The flags may start with a package pattern, as go build takes them,
+  such as "all=-N -l". Flags with a pattern are passed to go build as a
+  flag of their own after the others, rather than added to them, and go
+  build uses the last one that matches each package:
+
+    GOX_LINUX_AMD64_GCFLAGS_APPEND="all=-N -l"
+
+  Cgo can be enabled or disabled per-platform with GOX_[OS]_[ARCH]_CGO
+  set to 1 or 0, which takes precedence over "-cgo" and "-cgo-osarch".
+
+  The C compilers used with cgo can be set per-platform in the same way.
+  They are passed to go build as CC and CXX for that platform only:
+
+    GOX_[OS]_[ARCH]_CC
+    GOX_[OS]_[ARCH]_CXX
+
+  The musl builds of a platform, such as "linux/amd64@musl", use
+  GOX_[OS]_[ARCH]_MUSL_CC and GOX_[OS]_[ARCH]_MUSL_CXX instead.
+
+  The profile to optimize the build with, as "-pgo", may be set
+  per-platform with GOX_[OS]_[ARCH]_PGO, such as for a profile taken on
+  that arch.
+
+  The go command may be set per-platform with GOX_[OS]_[ARCH]_GOCMD, which
+  takes precedence over the gocmds key of the config file and "-gocmd".
+  The platforms that go command supports, for its own version of Go, are
+  the ones it may build, and it must be on the PATH if it builds any.
+
+Environment:
+
+  The go commands of the builds run with the environment of gox, and
+  "-env" sets variables on top of it, such as for cgo:
+
+    gox -env CGO_CFLAGS=-O2 -env linux/arm64:CC=aarch64-linux-gnu-gcc
+
+  Variables with a platform, as os/arch or the full name of the platform
+  such as "linux/arm/v7" or "linux/amd64@musl", are only set for the
+  builds of that platform. The go commands that aren't builds, such as
+  go list to find the packages and go generate, get the ones for every
+  platform, so that GOPRIVATE or GOPROXY may be set this way as well.
+  When a variable is set more than once, the last one wins, in this
+  order:
+
+    1. the environment of gox
+    2. "-env KEY=VALUE"
+    3. "-env os/arch:KEY=VALUE"
+    4. the variables gox sets itself, such as GOOS, GOARCH, GOARM,
+       CGO_ENABLED, and CC and CXX from GOX_[OS]_[ARCH]_CC
+
+  With "-clean-env", the builds don't inherit the environment of gox but
+  for PATH, HOME, the variables of the temp directory, those Windows needs
+  to run programs, such as SYSTEMROOT, and the variables that start with
+  GO, such as GOPATH and GOFLAGS. Together with "-env", this makes builds
+  that don't depend on what else happens to be set.
+
+  Flags in GOFLAGS, from the environment, "-env" or go env -w, that gox
+  passes to go build as well are dropped by go build, since the command
+  line takes precedence. Gox always passes "-gcflags", "-ldflags",
+  "-asmflags" and "-tags", and others such as "-mod" and "-trimpath" when
+  they're set, so GOFLAGS=-ldflags=-s has no effect. Gox warns about
+  these before building, or fails with "-strict-goflags". With
+  "-ignore-goflags", GOFLAGS is empty for the builds.
 
 `
@@ -0,0 +1,20 @@
+package gox
+
+import (
+	"context"
+)
+
+// Codesign signs the darwin binary at path in place with the codesign
+// command, with the given identity and the hardened runtime, which
+// notarization requires. A signature that's already there, such as the
+// ad-hoc one the Go linker gives darwin/arm64 binaries, is replaced.
+func Codesign(ctx context.Context, codesignCmd, identity, path string) error {
+	_, err := execGoContext(ctx, codesignCmd, nil, "", nil, codesignArgs(identity, path)...)
+	return err
+}
+
+// codesignArgs returns the arguments to codesign that sign the binary at
+// path with the identity.
+func codesignArgs(identity, path string) []string {
+	return []string{"--force", "--sign", identity, "--options", "runtime", path}
+}
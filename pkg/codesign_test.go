@@ -0,0 +1,52 @@
+package gox
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCodesign(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as the codesign command")
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	// The fake codesign records its arguments, and fails for binaries
+	// named "bad"
+	codesignCmd := filepath.Join(td, "codesign")
+	argsPath := filepath.Join(td, "args")
+	testWriteFile(t, codesignCmd, `#!/bin/sh
+echo "$@" > `+argsPath+`
+case "$6" in
+*bad) echo "$6: errSecInternalComponent" >&2; exit 1 ;;
+esac
+`)
+	if err := os.Chmod(codesignCmd, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	binary := filepath.Join(td, "app_darwin_arm64")
+	if err := Codesign(context.Background(), codesignCmd, "Developer ID Application: Foo", binary); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	args, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := "--force --sign Developer ID Application: Foo --options runtime " + binary + "\n"
+	if string(args) != expected {
+		t.Fatalf("bad: %q", args)
+	}
+
+	err = Codesign(context.Background(), codesignCmd, "Foo", filepath.Join(td, "bad"))
+	if err == nil || !strings.Contains(err.Error(), "errSecInternalComponent") {
+		t.Fatalf("bad: %v", err)
+	}
+}
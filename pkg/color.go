@@ -0,0 +1,69 @@
+package gox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	colorReset    = "\033[0m"
+	colorRed      = "\033[31m"
+	colorCyan     = "\033[36m"
+	colorPlatform = colorCyan
+	colorFailure  = colorRed
+)
+
+// colors formats the lines gox prints, with ANSI colors if enabled. All
+// colored output goes through it so that it looks the same everywhere.
+type colors struct {
+	enabled bool
+}
+
+// newColors returns the colors for output written to w. Colors are used
+// if forced with -color, and otherwise only if w is a terminal and
+// neither -no-color nor the NO_COLOR env var is set.
+func newColors(w io.Writer, force, disable bool) colors {
+	switch {
+	case disable:
+		return colors{}
+	case force:
+		return colors{enabled: true}
+	case os.Getenv("NO_COLOR") != "":
+		return colors{}
+	default:
+		return colors{enabled: isTerminal(w)}
+	}
+}
+
+// Platform colors the name of a platform.
+func (c colors) Platform(s string) string {
+	return c.wrap(colorPlatform, s)
+}
+
+// Failure colors the first line of a message about something that failed.
+// The rest of the message, such as the output of a command, is left as is.
+func (c colors) Failure(s string) string {
+	if idx := strings.Index(s, "\n"); idx >= 0 {
+		return c.wrap(colorFailure, s[:idx]) + s[idx:]
+	}
+
+	return c.wrap(colorFailure, s)
+}
+
+// BuildLine formats a line about the build of a platform, with the name
+// of the platform aligned so that the messages line up.
+func (c colors) BuildLine(platform Platform, format string, args ...interface{}) string {
+	return fmt.Sprintf("--> %s: %s\n",
+		c.Platform(fmt.Sprintf("%15s", platform.String())),
+		fmt.Sprintf(format, args...))
+}
+
+func (c colors) wrap(color, s string) string {
+	if !c.enabled {
+		return s
+	}
+
+	return color + s + colorReset
+}
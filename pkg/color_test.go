@@ -0,0 +1,52 @@
+package gox
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestNewColors(t *testing.T) {
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	os.Setenv("NO_COLOR", "")
+
+	var buf bytes.Buffer
+	cases := []struct {
+		Force, Disable bool
+		NoColor        string
+		Expected       bool
+	}{
+		{false, false, "", false},
+		{true, false, "", true},
+		{true, false, "1", true},
+		{true, true, "", false},
+		{false, false, "1", false},
+	}
+
+	for _, tc := range cases {
+		os.Setenv("NO_COLOR", tc.NoColor)
+		c := newColors(&buf, tc.Force, tc.Disable)
+		if c.enabled != tc.Expected {
+			t.Fatalf("bad: %#v", tc)
+		}
+	}
+}
+
+func TestColors(t *testing.T) {
+	p := Platform{OS: "linux", Arch: "amd64"}
+
+	line := colors{}.BuildLine(p, "%s", "./cmd/foo")
+	if line != "-->     linux/amd64: ./cmd/foo\n" {
+		t.Fatalf("bad: %q", line)
+	}
+
+	line = colors{enabled: true}.BuildLine(p, "%s", "./cmd/foo")
+	if line != "--> "+colorPlatform+"    linux/amd64"+colorReset+": ./cmd/foo\n" {
+		t.Fatalf("bad: %q", line)
+	}
+
+	msg := colors{enabled: true}.Failure("linux/amd64 error: exit status 1\nStderr: foo")
+	if msg != colorFailure+"linux/amd64 error: exit status 1"+colorReset+"\nStderr: foo" {
+		t.Fatalf("bad: %q", msg)
+	}
+}
@@ -0,0 +1,482 @@
+package gox
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigFiles are the names of the config files that are looked for in
+// the current directory if no config file is specified. The format of
+// each file is detected by its extension.
+var ConfigFiles = []string{"gox.json", "gox.toml", "gox.yaml", "gox.yml"}
+
+// Config is the set of build settings that can be read from a config file
+// or the environment. The keys mirror the command-line flags of the same
+// name.
+//
+// Settings are resolved with the following precedence, from lowest to
+// highest: flag defaults, config file, environment, command-line flags.
+type Config struct {
+	OS       configList      `json:"os" toml:"os" yaml:"os"`
+	Arch     configList      `json:"arch" toml:"arch" yaml:"arch"`
+	OSArch   configList      `json:"osarch" toml:"osarch" yaml:"osarch"`
+	Ldflags  string          `json:"ldflags" toml:"ldflags" yaml:"ldflags"`
+	Gcflags  string          `json:"gcflags" toml:"gcflags" yaml:"gcflags"`
+	Asmflags string          `json:"asmflags" toml:"asmflags" yaml:"asmflags"`
+	Tags     string          `json:"tags" toml:"tags" yaml:"tags"`
+	Output   string          `json:"output" toml:"output" yaml:"output"`
+	Parallel *configParallel `json:"parallel" toml:"parallel" yaml:"parallel"`
+	Cgo      *bool           `json:"cgo" toml:"cgo" yaml:"cgo"`
+	GoCmd    string          `json:"gocmd" toml:"gocmd" yaml:"gocmd"`
+
+	// Outputs maps platform patterns, such as "darwin/*", to the output
+	// template for the platforms they match. It has no flag.
+	Outputs map[string]string `json:"outputs" toml:"outputs" yaml:"outputs"`
+
+	// GoCmds maps platform patterns, like Outputs, to the go command to
+	// build the platforms they match with, instead of GoCmd. It has no
+	// flag.
+	GoCmds map[string]string `json:"gocmds" toml:"gocmds" yaml:"gocmds"`
+
+	// Profiles are named sets of settings, selected with -profile, that
+	// take precedence over the rest of the config file.
+	Profiles map[string]*Config `json:"profiles" toml:"profiles" yaml:"profiles"`
+}
+
+// DefaultProfile is the profile that is used if none is selected. Unless
+// the config file defines it, it changes nothing.
+const DefaultProfile = "default"
+
+// LoadConfig reads the config file at the given path. The format is
+// detected from the extension: ".json", ".toml", ".yaml" or ".yml". Keys
+// that are not known to gox result in an error rather than being ignored.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&c)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), &c)
+		if err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown key %q", undecoded[0].String())
+			}
+		}
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, &c)
+	default:
+		return nil, fmt.Errorf("unknown config format for %s: %q", path, ext)
+	}
+	if err == nil {
+		err = validPlatformPatterns(&c)
+	}
+	for name, profile := range c.Profiles {
+		if err != nil {
+			break
+		}
+		if profile == nil {
+			profile = new(Config)
+			c.Profiles[name] = profile
+		}
+		if len(profile.Profiles) > 0 {
+			err = fmt.Errorf("profile %q can't have profiles of its own", name)
+		} else {
+			err = validPlatformPatterns(profile)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %s", path, err)
+	}
+
+	return &c, nil
+}
+
+// FindConfig returns the path to the config file in the given directory,
+// or an empty string if there is none. It is an error for more than one
+// of ConfigFiles to exist, since it would be ambiguous which one to use.
+func FindConfig(dir string) (string, error) {
+	var found []string
+	for _, name := range ConfigFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf(
+			"multiple config files found, remove all but one or use -config: %s",
+			strings.Join(found, ", "))
+	}
+}
+
+// LoadDefaultConfig reads the config file in the current directory. If
+// there is no config file, an empty config is returned.
+func LoadDefaultConfig() (*Config, error) {
+	path, err := FindConfig(".")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return new(Config), nil
+	}
+
+	return LoadConfig(path)
+}
+
+// ConfigFromEnv builds a config from environment variables in the format
+// of GOX_{KEY}, such as GOX_LDFLAGS or GOX_OSARCH. The getenv function is
+// used to look up the variables, which is usually os.Getenv.
+func ConfigFromEnv(getenv func(string) string) (*Config, error) {
+	var c Config
+	c.OS = strings.Fields(getenv("GOX_OS"))
+	c.Arch = strings.Fields(getenv("GOX_ARCH"))
+	c.OSArch = strings.Fields(getenv("GOX_OSARCH"))
+	c.Ldflags = getenv("GOX_LDFLAGS")
+	c.Gcflags = getenv("GOX_GCFLAGS")
+	c.Asmflags = getenv("GOX_ASMFLAGS")
+	c.Tags = getenv("GOX_TAGS")
+	c.Output = getenv("GOX_OUTPUT")
+	c.GoCmd = getenv("GOX_GOCMD")
+	if v := getenv("GOX_PARALLEL"); v != "" {
+		var p configParallel
+		if err := p.set(v); err != nil {
+			return nil, fmt.Errorf("invalid GOX_PARALLEL: %s", err)
+		}
+		c.Parallel = &p
+	}
+	if v := getenv("GOX_CGO"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOX_CGO: %s", err)
+		}
+		c.Cgo = &b
+	}
+
+	return &c, nil
+}
+
+// Merge overrides the values in this config with any values that are
+// set in the other config.
+func (c *Config) Merge(other *Config) {
+	if len(other.OS) > 0 {
+		c.OS = other.OS
+	}
+	if len(other.Arch) > 0 {
+		c.Arch = other.Arch
+	}
+	if len(other.OSArch) > 0 {
+		c.OSArch = other.OSArch
+	}
+	if other.Ldflags != "" {
+		c.Ldflags = other.Ldflags
+	}
+	if other.Gcflags != "" {
+		c.Gcflags = other.Gcflags
+	}
+	if other.Asmflags != "" {
+		c.Asmflags = other.Asmflags
+	}
+	if other.Tags != "" {
+		c.Tags = other.Tags
+	}
+	if other.Output != "" {
+		c.Output = other.Output
+	}
+	if other.Parallel != nil {
+		c.Parallel = other.Parallel
+	}
+	if other.Cgo != nil {
+		c.Cgo = other.Cgo
+	}
+	if other.GoCmd != "" {
+		c.GoCmd = other.GoCmd
+	}
+	for pattern, tpl := range other.Outputs {
+		if c.Outputs == nil {
+			c.Outputs = make(map[string]string)
+		}
+		c.Outputs[pattern] = tpl
+	}
+	for pattern, cmd := range other.GoCmds {
+		if c.GoCmds == nil {
+			c.GoCmds = make(map[string]string)
+		}
+		c.GoCmds[pattern] = cmd
+	}
+}
+
+// Profile returns the settings of the profile with the given name. It's an
+// error if the config file doesn't define the profile, unless it is
+// DefaultProfile.
+func (c *Config) Profile(name string) (*Config, error) {
+	if profile, ok := c.Profiles[name]; ok {
+		return profile, nil
+	}
+	if name == DefaultProfile {
+		return new(Config), nil
+	}
+
+	names := []string{DefaultProfile}
+	for n := range c.Profiles {
+		if n != DefaultProfile {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names[1:])
+
+	return nil, fmt.Errorf("unknown profile %q, available profiles: %s",
+		name, strings.Join(names, ", "))
+}
+
+// validPlatformPatterns returns an error if any of the patterns of the
+// outputs and gocmds keys of the config is malformed.
+func validPlatformPatterns(c *Config) error {
+	keys := []string{"outputs", "gocmds"}
+	for i, patterns := range []map[string]string{c.Outputs, c.GoCmds} {
+		for pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid %s pattern %q", keys[i], pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+// OutputTpl returns the output template from Outputs for the platform, or
+// an empty string if no pattern matches it. Patterns are matched against
+// the platform as os/arch, and as os/arch/variant or os/arch@libc if it
+// has a variant or libc, and the longest pattern that matches wins.
+func (c *Config) OutputTpl(platform Platform) string {
+	return matchPlatform(c.Outputs, platform)
+}
+
+// PlatformGoCmd returns the go command from GoCmds to build the platform
+// with, or an empty string if no pattern matches it. Patterns are matched
+// as for OutputTpl.
+func (c *Config) PlatformGoCmd(platform Platform) string {
+	return matchPlatform(c.GoCmds, platform)
+}
+
+// matchPlatform returns the value of the longest of the patterns that
+// matches the platform, as os/arch or as its full name with its variant
+// and libc, or an empty string if none does.
+func matchPlatform(patterns map[string]string, platform Platform) string {
+	names := []string{platform.OS + "/" + platform.Arch}
+	if s := platform.String(); s != names[0] {
+		names = append(names, s)
+	}
+
+	var best, value string
+	for pattern, v := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+			if value == "" || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+				best, value = pattern, v
+			}
+		}
+	}
+
+	return value
+}
+
+// Apply sets the flags in the given flag set from the config. Flags that
+// were explicitly set on the command-line take precedence and are left
+// untouched.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	set := make(map[string]struct{})
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = struct{}{}
+	})
+
+	values := c.flagValues()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := set[name]; ok {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			continue
+		}
+
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid config value for %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// flagValues returns the config as a map of flag names to the value the
+// flag should be set to. Unset keys are omitted.
+func (c *Config) flagValues() map[string]string {
+	result := make(map[string]string)
+	setString := func(name, value string) {
+		if value != "" {
+			result[name] = value
+		}
+	}
+
+	setString("os", strings.Join(c.OS, " "))
+	setString("arch", strings.Join(c.Arch, " "))
+	setString("osarch", strings.Join(c.OSArch, " "))
+	setString("ldflags", c.Ldflags)
+	setString("gcflags", c.Gcflags)
+	setString("asmflags", c.Asmflags)
+	setString("tags", c.Tags)
+	setString("output", c.Output)
+	setString("gocmd", c.GoCmd)
+	if c.Parallel != nil {
+		result["parallel"] = string(*c.Parallel)
+	}
+	if c.Cgo != nil {
+		result["cgo"] = strconv.FormatBool(*c.Cgo)
+	}
+
+	return result
+}
+
+// configList is a list of values in a config file. It may be written
+// either as a list or as a single space-separated string, matching the
+// syntax of the command-line flags.
+type configList []string
+
+func (l *configList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	*l = strings.Fields(s)
+	return nil
+}
+
+func (l *configList) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		*l = strings.Fields(v)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, raw := range v {
+			s, ok := raw.(string)
+			if !ok {
+				return fmt.Errorf("expected a list of strings, got %T", raw)
+			}
+			list = append(list, s)
+		}
+		*l = list
+	default:
+		return fmt.Errorf("expected a string or list of strings, got %T", v)
+	}
+
+	return nil
+}
+
+func (l *configList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*l = list
+		return nil
+	}
+
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	*l = strings.Fields(s)
+	return nil
+}
+
+// configParallel is the parallel key of a config file, which takes the
+// same values as -parallel: a number, written as a number or a string,
+// "auto" or a percentage of the CPUs, such as "50%".
+type configParallel string
+
+func (p *configParallel) set(value string) error {
+	var v ParallelValue
+	if err := v.Set(value); err != nil {
+		return err
+	}
+
+	*p = configParallel(v)
+	return nil
+}
+
+func (p *configParallel) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		return p.set(strconv.Itoa(n))
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return p.set(s)
+}
+
+func (p *configParallel) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case int64:
+		return p.set(strconv.FormatInt(v, 10))
+	case string:
+		return p.set(v)
+	default:
+		return fmt.Errorf("expected a number or a string, got %T", v)
+	}
+}
+
+func (p *configParallel) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var n int
+	if err := unmarshal(&n); err == nil {
+		return p.set(strconv.Itoa(n))
+	}
+
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return p.set(s)
+}
@@ -0,0 +1,593 @@
+package gox
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cases := []struct {
+		Name string
+		Data string
+	}{
+		{
+			"gox.yaml",
+			`
+os: linux darwin
+arch:
+  - amd64
+  - arm64
+ldflags: -s -w
+output: "dist/{{.OS}}_{{.Arch}}"
+parallel: 2
+cgo: true
+`,
+		},
+		{
+			"gox.json",
+			`{
+  "os": "linux darwin",
+  "arch": ["amd64", "arm64"],
+  "ldflags": "-s -w",
+  "output": "dist/{{.OS}}_{{.Arch}}",
+  "parallel": 2,
+  "cgo": true
+}`,
+		},
+		{
+			"gox.toml",
+			`
+os = "linux darwin"
+arch = ["amd64", "arm64"]
+ldflags = "-s -w"
+output = "dist/{{.OS}}_{{.Arch}}"
+parallel = 2
+cgo = true
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		td := testTempDir(t)
+		defer os.RemoveAll(td)
+
+		path := filepath.Join(td, tc.Name)
+		testWriteFile(t, path, tc.Data)
+
+		c, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+
+		if !reflect.DeepEqual([]string(c.OS), []string{"linux", "darwin"}) {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.OS)
+		}
+		if !reflect.DeepEqual([]string(c.Arch), []string{"amd64", "arm64"}) {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.Arch)
+		}
+		if c.Ldflags != "-s -w" {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.Ldflags)
+		}
+		if c.Output != "dist/{{.OS}}_{{.Arch}}" {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.Output)
+		}
+		if c.Parallel == nil || *c.Parallel != "2" {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.Parallel)
+		}
+		if c.Cgo == nil || !*c.Cgo {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.Cgo)
+		}
+	}
+}
+
+func TestLoadConfig_parallel(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Data     string
+		Expected string
+		Err      bool
+	}{
+		{"gox.yaml", "parallel: auto\n", "auto", false},
+		{"gox.yaml", "parallel: \"50%\"\n", "50%", false},
+		{"gox.json", `{"parallel": "auto"}`, "auto", false},
+		{"gox.json", `{"parallel": "50%"}`, "50%", false},
+		{"gox.json", `{"parallel": "4"}`, "4", false},
+		{"gox.toml", `parallel = "auto"`, "auto", false},
+		{"gox.toml", `parallel = "50%"`, "50%", false},
+		{"gox.yaml", "parallel: lots\n", "", true},
+		{"gox.json", `{"parallel": "-5%"}`, "", true},
+		{"gox.toml", `parallel = true`, "", true},
+	}
+
+	for _, tc := range cases {
+		td := testTempDir(t)
+		defer os.RemoveAll(td)
+
+		path := filepath.Join(td, tc.Name)
+		testWriteFile(t, path, tc.Data)
+
+		c, err := LoadConfig(path)
+		if tc.Err {
+			if err == nil {
+				t.Fatalf("%s: should err", tc.Data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Data, err)
+		}
+		if c.Parallel == nil || string(*c.Parallel) != tc.Expected {
+			t.Fatalf("%s: bad: %#v", tc.Data, c.Parallel)
+		}
+	}
+}
+
+func TestLoadConfig_unknownKey(t *testing.T) {
+	cases := []struct {
+		Name string
+		Data string
+	}{
+		{"gox.yaml", "osarchs: linux/amd64\n"},
+		{"gox.json", `{"osarchs": "linux/amd64"}`},
+		{"gox.toml", `osarchs = "linux/amd64"`},
+	}
+
+	for _, tc := range cases {
+		td := testTempDir(t)
+		defer os.RemoveAll(td)
+
+		path := filepath.Join(td, tc.Name)
+		testWriteFile(t, path, tc.Data)
+
+		if _, err := LoadConfig(path); err == nil {
+			t.Fatalf("%s: should err", tc.Name)
+		}
+	}
+}
+
+func TestLoadConfig_unknownFormat(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "gox.ini")
+	testWriteFile(t, path, "os=linux")
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path, err := FindConfig(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != "" {
+		t.Fatalf("bad: %#v", path)
+	}
+
+	testWriteFile(t, filepath.Join(td, "gox.json"), "{}")
+	path, err = FindConfig(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if path != filepath.Join(td, "gox.json") {
+		t.Fatalf("bad: %#v", path)
+	}
+
+	testWriteFile(t, filepath.Join(td, "gox.yaml"), "")
+	_, err = FindConfig(td)
+	if err == nil {
+		t.Fatal("should err")
+	}
+	if !strings.Contains(err.Error(), "gox.json") ||
+		!strings.Contains(err.Error(), "gox.yaml") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"GOX_OSARCH":   "linux/amd64 darwin/arm64",
+		"GOX_LDFLAGS":  "-s -w",
+		"GOX_PARALLEL": "3",
+		"GOX_CGO":      "false",
+	}
+
+	c, err := ConfigFromEnv(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual([]string(c.OSArch), []string{"linux/amd64", "darwin/arm64"}) {
+		t.Fatalf("bad: %#v", c.OSArch)
+	}
+	if c.Ldflags != "-s -w" {
+		t.Fatalf("bad: %#v", c.Ldflags)
+	}
+	if c.Parallel == nil || *c.Parallel != "3" {
+		t.Fatalf("bad: %#v", c.Parallel)
+	}
+	if c.Cgo == nil || *c.Cgo {
+		t.Fatalf("bad: %#v", c.Cgo)
+	}
+
+	// GOX_PARALLEL takes the same values as -parallel.
+	for _, v := range []string{"auto", "50%"} {
+		env["GOX_PARALLEL"] = v
+		c, err := ConfigFromEnv(func(k string) string { return env[k] })
+		if err != nil {
+			t.Fatalf("%s: err: %s", v, err)
+		}
+		if c.Parallel == nil || string(*c.Parallel) != v {
+			t.Fatalf("%s: bad: %#v", v, c.Parallel)
+		}
+	}
+
+	for _, v := range []string{"lots", "0%"} {
+		env["GOX_PARALLEL"] = v
+		if _, err := ConfigFromEnv(func(k string) string { return env[k] }); err == nil {
+			t.Fatalf("%s: should err", v)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	var platformFlag PlatformFlag
+	var ldflags, output string
+	var parallel int
+	fs := flag.NewFlagSet("gox", flag.ContinueOnError)
+	fs.Var(platformFlag.OSFlagValue(), "os", "")
+	fs.StringVar(&ldflags, "ldflags", "", "")
+	fs.StringVar(&output, "output", "default", "")
+	fs.IntVar(&parallel, "parallel", -1, "")
+	if err := fs.Parse([]string{"-ldflags", "-X main.foo=cli"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := configParallel("4")
+	c := &Config{
+		OS:       configList{"linux", "windows"},
+		Ldflags:  "-X main.foo=config",
+		Parallel: &p,
+	}
+	if err := c.Apply(fs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(platformFlag.OS, []string{"linux", "windows"}) {
+		t.Fatalf("bad: %#v", platformFlag.OS)
+	}
+	if ldflags != "-X main.foo=cli" {
+		t.Fatalf("bad: %#v", ldflags)
+	}
+	if output != "default" {
+		t.Fatalf("bad: %#v", output)
+	}
+	if parallel != 4 {
+		t.Fatalf("bad: %#v", parallel)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	var ldflags, gcflags, tags, output string
+	fs := flag.NewFlagSet("gox", flag.ContinueOnError)
+	fs.StringVar(&ldflags, "ldflags", "default", "")
+	fs.StringVar(&gcflags, "gcflags", "default", "")
+	fs.StringVar(&tags, "tags", "default", "")
+	fs.StringVar(&output, "output", "default", "")
+	if err := fs.Parse([]string{"-output", "cli"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := &Config{
+		Gcflags: "config",
+		Tags:    "config",
+		Output:  "config",
+	}
+	env := &Config{
+		Tags:   "env",
+		Output: "env",
+	}
+	config.Merge(env)
+	if err := config.Apply(fs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if ldflags != "default" {
+		t.Fatalf("bad: %#v", ldflags)
+	}
+	if gcflags != "config" {
+		t.Fatalf("bad: %#v", gcflags)
+	}
+	if tags != "env" {
+		t.Fatalf("bad: %#v", tags)
+	}
+	if output != "cli" {
+		t.Fatalf("bad: %#v", output)
+	}
+}
+
+func testTempDir(t *testing.T) string {
+	td, err := ioutil.TempDir("", "gox")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return td
+}
+
+func testWriteFile(t *testing.T, path, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestLoadConfig_outputs(t *testing.T) {
+	cases := []struct {
+		Name string
+		Data string
+	}{
+		{"gox.yaml", "outputs:\n  darwin/*: \"{{.Dir}}-macos\"\n"},
+		{"gox.json", `{"outputs": {"darwin/*": "{{.Dir}}-macos"}}`},
+		{"gox.toml", "[outputs]\n\"darwin/*\" = \"{{.Dir}}-macos\"\n"},
+	}
+
+	for _, tc := range cases {
+		td := testTempDir(t)
+		defer os.RemoveAll(td)
+
+		path := filepath.Join(td, tc.Name)
+		testWriteFile(t, path, tc.Data)
+
+		c, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+		if c.Outputs["darwin/*"] != "{{.Dir}}-macos" {
+			t.Fatalf("%s: bad: %#v", tc.Name, c.Outputs)
+		}
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "gox.json")
+	testWriteFile(t, path, `{"outputs": {"darwin/[": "{{.Dir}}"}}`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("should err")
+	}
+	testWriteFile(t, path, `{"gocmds": {"linux/[": "go"}}`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestConfigOutputTpl(t *testing.T) {
+	c := &Config{Outputs: map[string]string{
+		"*/*":          "any",
+		"darwin/*":     "darwin",
+		"darwin/arm64": "darwin-arm64",
+		"linux/arm/v6": "armv6",
+	}}
+
+	cases := []struct {
+		Platform Platform
+		Expected string
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "any"},
+		{Platform{OS: "darwin", Arch: "amd64"}, "darwin"},
+		{Platform{OS: "darwin", Arch: "arm64"}, "darwin-arm64"},
+		{Platform{OS: "linux", Arch: "arm", Arm: "6"}, "armv6"},
+		{Platform{OS: "linux", Arch: "arm", Arm: "7"}, "any"},
+	}
+
+	for _, tc := range cases {
+		if actual := c.OutputTpl(tc.Platform); actual != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Platform.String(), actual)
+		}
+	}
+
+	if actual := new(Config).OutputTpl(Platform{OS: "linux", Arch: "amd64"}); actual != "" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
+
+func TestConfigPlatformGoCmd(t *testing.T) {
+	c := &Config{GoCmds: map[string]string{
+		"linux/*":   "go-linux",
+		"linux/arm": "go-arm",
+	}}
+	c.Merge(&Config{GoCmds: map[string]string{"linux/*": "go-patched"}})
+
+	cases := []struct {
+		Platform Platform
+		Expected string
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "go-patched"},
+		{Platform{OS: "linux", Arch: "arm", Arm: "7"}, "go-arm"},
+		{Platform{OS: "darwin", Arch: "arm64"}, ""},
+	}
+
+	for _, tc := range cases {
+		if actual := c.PlatformGoCmd(tc.Platform); actual != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Platform.String(), actual)
+		}
+	}
+}
+
+func TestCheckOutputCollisions_platformOutputs(t *testing.T) {
+	c := &Config{Outputs: map[string]string{"darwin/*": "{{.Dir}}-macos"}}
+	cfg := BuildConfig{
+		Packages: []string{"github.com/foo/app"},
+		Platforms: []Platform{
+			{OS: "darwin", Arch: "amd64"},
+			{OS: "darwin", Arch: "arm64"},
+			{OS: "linux", Arch: "amd64"},
+		},
+		Opts: CompileOpts{OutputTpl: DefaultOutputTpl},
+		Configure: func(opts *CompileOpts) {
+			if tpl := c.OutputTpl(opts.Platform); tpl != "" {
+				opts.OutputTpl = tpl
+			}
+		},
+	}
+
+	// Both darwin platforms are written to app-macos
+	err := CheckOutputCollisions(cfg)
+	if err == nil || !strings.Contains(err.Error(), "app-macos: darwin/amd64") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestLoadConfig_profiles(t *testing.T) {
+	cases := []struct {
+		Name string
+		Data string
+	}{
+		{
+			"gox.yaml",
+			`
+os: linux
+profiles:
+  ci:
+    osarch: linux/amd64 darwin/arm64
+  release:
+    os: linux darwin windows
+    ldflags: -s -w
+`,
+		},
+		{
+			"gox.json",
+			`{
+  "os": "linux",
+  "profiles": {
+    "ci": {"osarch": "linux/amd64 darwin/arm64"},
+    "release": {"os": "linux darwin windows", "ldflags": "-s -w"}
+  }
+}`,
+		},
+		{
+			"gox.toml",
+			`
+os = "linux"
+
+[profiles.ci]
+osarch = "linux/amd64 darwin/arm64"
+
+[profiles.release]
+os = "linux darwin windows"
+ldflags = "-s -w"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		td := testTempDir(t)
+		defer os.RemoveAll(td)
+
+		path := filepath.Join(td, tc.Name)
+		testWriteFile(t, path, tc.Data)
+
+		c, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+
+		profile, err := c.Profile("release")
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+		if profile.Ldflags != "-s -w" || len(profile.OS) != 3 {
+			t.Fatalf("%s: bad: %#v", tc.Name, profile)
+		}
+		profile, err = c.Profile("ci")
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+		if !reflect.DeepEqual([]string(profile.OSArch), []string{"linux/amd64", "darwin/arm64"}) {
+			t.Fatalf("%s: bad: %#v", tc.Name, profile)
+		}
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	path := filepath.Join(td, "gox.json")
+	testWriteFile(t, path, `{"profiles": {"ci": {"profiles": {"dev": {}}}}}`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("should err")
+	}
+	testWriteFile(t, path, `{"profiles": {"ci": {"osarchs": "linux/amd64"}}}`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	c := &Config{Profiles: map[string]*Config{
+		"release": {Ldflags: "-s -w"},
+		"ci":      {OS: []string{"linux"}},
+	}}
+
+	// The default profile changes nothing unless it's defined
+	profile, err := c.Profile(DefaultProfile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(profile, new(Config)) {
+		t.Fatalf("bad: %#v", profile)
+	}
+
+	_, err = c.Profile("relaese")
+	if err == nil {
+		t.Fatal("should err")
+	}
+	expected := `unknown profile "relaese", available profiles: default, ci, release`
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+
+	c.Profiles[DefaultProfile] = &Config{Tags: "dev"}
+	if profile, err := c.Profile(DefaultProfile); err != nil || profile.Tags != "dev" {
+		t.Fatalf("bad: %#v, %v", profile, err)
+	}
+}
+
+func TestConfigPrecedence_profile(t *testing.T) {
+	c := &Config{
+		Ldflags: "-X main.file=1",
+		Tags:    "file",
+		Profiles: map[string]*Config{
+			"release": {Ldflags: "-s -w", Tags: "release", Output: "dist/{{.OS}}"},
+		},
+	}
+	profile, err := c.Profile("release")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c.Merge(profile)
+	c.Merge(&Config{Tags: "env"})
+
+	var ldflags, tags, output string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&ldflags, "ldflags", "", "")
+	fs.StringVar(&tags, "tags", "", "")
+	fs.StringVar(&output, "output", "", "")
+	if err := fs.Parse([]string{"-output", "cli"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Apply(fs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if ldflags != "-s -w" || tags != "env" || output != "cli" {
+		t.Fatalf("bad: %q %q %q", ldflags, tags, output)
+	}
+}
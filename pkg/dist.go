@@ -0,0 +1,94 @@
+package gox
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// distPlatform is a platform as it is listed by go tool dist list -json.
+type distPlatform struct {
+	GOOS       string
+	GOARCH     string
+	FirstClass bool
+}
+
+// distPlatforms caches the output of go tool dist list for each go
+// command, since it doesn't change while gox runs.
+var distPlatforms = struct {
+	sync.Mutex
+	m map[string][]distPlatform
+}{m: make(map[string][]distPlatform)}
+
+// readDistPlatforms returns the platforms the given go command can build
+// for, from go tool dist list.
+func readDistPlatforms(GoCmd string) ([]distPlatform, error) {
+	distPlatforms.Lock()
+	defer distPlatforms.Unlock()
+	if list, ok := distPlatforms.m[GoCmd]; ok {
+		return list, nil
+	}
+
+	output, err := execGo(GoCmd, nil, "", "tool", "dist", "list", "-json")
+	if err != nil {
+		return nil, err
+	}
+	var list []distPlatform
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, err
+	}
+
+	distPlatforms.m[GoCmd] = list
+	return list, nil
+}
+
+// ListPlatforms returns the platforms that the given go command, of the
+// given version, can build for, as listed by go tool dist list. Which
+// platforms are defaults is taken from SupportedPlatforms, and which are
+// primary from both. If the go command can't list its platforms, such as
+// before Go 1.10, SupportedPlatforms is returned instead.
+func ListPlatforms(GoCmd, version string) []Platform {
+	static := SupportedPlatforms(version)
+	list, err := readDistPlatforms(GoCmd)
+	if err != nil || len(list) == 0 {
+		return static
+	}
+
+	known := make(map[string]Platform, len(static))
+	for _, p := range static {
+		known[p.String()] = p
+	}
+
+	result := make([]Platform, 0, len(list))
+	for _, d := range list {
+		p := Platform{OS: d.GOOS, Arch: d.GOARCH, Primary: d.FirstClass}
+		if k, ok := known[p.String()]; ok {
+			p.Default = k.Default
+			p.Primary = p.Primary || k.Primary
+		}
+		result = append(result, p)
+	}
+
+	return result
+}
+
+// ListPlatformsByGoCmd returns the platforms that can be built for when
+// each platform is built with the go command that goCmd returns for it:
+// those that ListPlatforms lists for that go command, with the version
+// that version returns for it. goCmds are every go command that goCmd may
+// return, and the platforms are in their order.
+func ListPlatformsByGoCmd(goCmds []string, goCmd func(Platform) string, version func(GoCmd string) string) []Platform {
+	var result []Platform
+	seen := make(map[string]bool)
+	for _, cmd := range goCmds {
+		for _, p := range ListPlatforms(cmd, version(cmd)) {
+			if goCmd(p) != cmd || seen[p.String()] {
+				continue
+			}
+
+			seen[p.String()] = true
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,87 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestListPlatforms(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as the go command")
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	goCmd := filepath.Join(td, "go")
+	testWriteFile(t, goCmd, `#!/bin/sh
+cat <<EOF
+[
+	{"GOOS": "linux", "GOARCH": "amd64", "CgoSupported": true, "FirstClass": true},
+	{"GOOS": "linux", "GOARCH": "loong64", "CgoSupported": true, "FirstClass": false},
+	{"GOOS": "plan9", "GOARCH": "386", "CgoSupported": false, "FirstClass": false}
+]
+EOF
+`)
+	if err := os.Chmod(goCmd, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Defaults come from the static list, and platforms it doesn't know
+	// about aren't defaults.
+	expected := []Platform{
+		{OS: "linux", Arch: "amd64", Default: true, Primary: true},
+		{OS: "linux", Arch: "loong64"},
+		{OS: "plan9", Arch: "386"},
+	}
+	platforms := ListPlatforms(goCmd, "go1.21.0")
+	if len(platforms) != len(expected) {
+		t.Fatalf("bad: %#v", platforms)
+	}
+	for i, p := range platforms {
+		if p != expected[i] {
+			t.Fatalf("bad: %#v", p)
+		}
+	}
+
+	// The list is cached
+	if err := os.Remove(goCmd); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(ListPlatforms(goCmd, "go1.21.0")) != len(expected) {
+		t.Fatal("should be cached")
+	}
+}
+
+func TestListPlatforms_fallback(t *testing.T) {
+	platforms := ListPlatforms("gox-no-such-go", "go1.5")
+	if len(platforms) != len(Platforms_1_5) {
+		t.Fatalf("bad: %#v", platforms)
+	}
+}
+
+func TestListPlatformsByGoCmd(t *testing.T) {
+	goCmd := func(p Platform) string {
+		if p.OS == "linux" && p.Arch == "s390x" {
+			return "gox-no-such-vendor-go"
+		}
+		return "gox-no-such-go"
+	}
+	version := func(GoCmd string) string {
+		if GoCmd == "gox-no-such-vendor-go" {
+			return "go1.21.0"
+		}
+		return "go1.5"
+	}
+
+	platforms := ListPlatformsByGoCmd(
+		[]string{"gox-no-such-go", "gox-no-such-vendor-go"}, goCmd, version)
+	if len(platforms) != len(Platforms_1_5)+1 {
+		t.Fatalf("bad: %#v", platforms)
+	}
+	if p := platforms[len(platforms)-1]; p.String() != "linux/s390x" {
+		t.Fatalf("bad: %#v", p)
+	}
+}
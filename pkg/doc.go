@@ -1,3 +1,4 @@
 // Gox pkg is a simple, no-frills tool for Go cross compilation that behaves a lot like standard go build.
 // Gox will parallelize builds for multiple platforms. Gox will also build the cross-compilation toolchain for you.
+// The builds can also be run from Go code with Build, which is what the gox command uses.
 package gox
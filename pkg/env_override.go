@@ -3,15 +3,177 @@ package gox
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 )
 
+// EnvOverrideMode is how the GOX_{OS}_{ARCH}_{KEY} variables for the
+// gcflags, ldflags and asmflags combine with the flags given to gox. It is
+// a flag.Value.
+type EnvOverrideMode string
+
+const (
+	// EnvOverrideReplace uses the variable instead of the flags given to
+	// gox.
+	EnvOverrideReplace EnvOverrideMode = "replace"
+
+	// EnvOverrideAppend adds the variable after the flags given to gox.
+	EnvOverrideAppend EnvOverrideMode = "append"
+)
+
+func (m *EnvOverrideMode) String() string {
+	return string(*m)
+}
+
+func (m *EnvOverrideMode) Set(value string) error {
+	switch EnvOverrideMode(value) {
+	case EnvOverrideReplace, EnvOverrideAppend:
+		*m = EnvOverrideMode(value)
+	default:
+		return fmt.Errorf("invalid env override mode %q, must be %s or %s",
+			value, EnvOverrideReplace, EnvOverrideAppend)
+	}
+
+	return nil
+}
+
 // envOverride overrides the given target based on if there is a
 // env var in the format of GOX_{OS}_{ARCH}_{KEY}.
 func envOverride(target *string, platform Platform, key string) {
+	if v := envOverrideValue(platform, key); v != "" {
+		*target = v
+	}
+}
+
+// envOverrideFlags overrides the given build flags with the env var
+// GOX_{OS}_{ARCH}_{KEY}, which replaces them or is added after them
+// depending on the mode. Then GOX_{OS}_{ARCH}_{KEY}_APPEND, if it's set,
+// is always added at the end.
+func envOverrideFlags(target *string, platform Platform, key string, mode EnvOverrideMode) {
+	envOverrideJoin(target, platform, key, mode, joinFlags)
+}
+
+// envOverrideTags overrides the given build tags with GOX_{OS}_{ARCH}_TAGS
+// and GOX_{OS}_{ARCH}_TAGS_APPEND like envOverrideFlags does for flags.
+// Appended tags that are already there aren't repeated.
+func envOverrideTags(target *string, platform Platform, mode EnvOverrideMode) {
+	envOverrideJoin(target, platform, "TAGS", mode, joinTags)
+}
+
+func envOverrideJoin(target *string, platform Platform, key string, mode EnvOverrideMode, join func(a, b string) string) {
+	if v := envOverrideValue(platform, key); v != "" {
+		if mode == EnvOverrideAppend {
+			*target = join(*target, v)
+		} else {
+			*target = v
+		}
+	}
+
+	if v := envOverrideValue(platform, key+"_APPEND"); v != "" {
+		*target = join(*target, v)
+	}
+}
+
+// joinFlags adds the flags of b after those of a. A value of b with a
+// package pattern, such as "all=-N -l", is added as a value of its own,
+// since a value only has one pattern, and the flags of a value without one
+// are added to every value of a.
+func joinFlags(a, b string) string {
+	result := a
+	for _, v := range flagValues(b) {
+		if p, _ := flagPattern(v); p != "" {
+			result = strings.TrimSpace(result + "\n" + v)
+			continue
+		}
+
+		result, _ = eachFlagValue(result, func(flags string) (string, error) {
+			return strings.TrimSpace(flags + " " + v), nil
+		})
+	}
+
+	return result
+}
+
+// joinTags joins two lists of build tags, leaving out the tags of b that
+// are in a. The tags are separated by commas if either list uses them,
+// which go build has accepted since Go 1.13, and by spaces otherwise.
+func joinTags(a, b string) string {
+	sep := " "
+	if strings.Contains(a, ",") || strings.Contains(b, ",") {
+		sep = ","
+	}
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+
+	tags := split(a)
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		seen[tag] = true
+	}
+	for _, tag := range split(b) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return strings.Join(tags, sep)
+}
+
+// envOverrideValue returns the value of the GOX_{OS}_{ARCH}_{KEY} env var
+// for the platform, or an empty string if it isn't set.
+func envOverrideValue(platform Platform, key string) string {
 	key = strings.ToUpper(fmt.Sprintf(
 		"GOX_%s_%s_%s", platform.OS, platform.Arch, key))
-	if v := os.Getenv(key); v != "" {
-		*target = v
+	return os.Getenv(key)
+}
+
+// envOverrideValues returns the values of the GOX_{OS}_{ARCH}_{KEY} env
+// vars of every platform in environ, which is in the format of
+// os.Environ, for the settings that must be known before the platforms
+// are.
+func envOverrideValues(environ []string, key string) []string {
+	var values []string
+	suffix := "_" + strings.ToUpper(key)
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+		name := parts[0]
+		if !strings.HasPrefix(name, "GOX_") || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		// The OS and the arch are between the prefix and the key, such as
+		// in GOX_LINUX_ARM_GOCMD, rather than GOX_GOCMD for every platform.
+		platform := strings.TrimSuffix(strings.TrimPrefix(name, "GOX_"), suffix)
+		if strings.Count(platform, "_") != 1 || strings.HasPrefix(platform, "_") || strings.HasSuffix(platform, "_") {
+			continue
+		}
+
+		values = append(values, parts[1])
 	}
+
+	return values
+}
+
+// envOverrideNames returns the names of the GOX_{OS}_{ARCH}_{KEY} env vars
+// that are set for the platform in environ, which is in the format of
+// os.Environ, sorted.
+func envOverrideNames(environ []string, platform Platform) []string {
+	var names []string
+	prefix := strings.ToUpper(fmt.Sprintf("GOX_%s_%s_", platform.OS, platform.Arch))
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && parts[1] != "" && strings.HasPrefix(parts[0], prefix) {
+			names = append(names, parts[0])
+		}
+	}
+
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,153 @@
+package gox
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEnvOverrideFlags(t *testing.T) {
+	platform := Platform{OS: "linux", Arch: "arm64"}
+	keys := []string{"GOX_LINUX_ARM64_LDFLAGS", "GOX_LINUX_ARM64_LDFLAGS_APPEND"}
+	for _, key := range keys {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+
+	cases := []struct {
+		Base     string
+		Env      string
+		Append   string
+		Mode     EnvOverrideMode
+		Expected string
+	}{
+		// Without variables the flags given to gox are used
+		{"-s -w", "", "", EnvOverrideReplace, "-s -w"},
+		{"-s -w", "", "", EnvOverrideAppend, "-s -w"},
+
+		// The variable replaces the flags, or comes after them
+		{"-s -w", "-X main.arch=arm64", "", "", "-X main.arch=arm64"},
+		{"-s -w", "-X main.arch=arm64", "", EnvOverrideReplace, "-X main.arch=arm64"},
+		{"-s -w", "-X main.arch=arm64", "", EnvOverrideAppend, "-s -w -X main.arch=arm64"},
+		{"", "-X main.arch=arm64", "", EnvOverrideAppend, "-X main.arch=arm64"},
+
+		// The _APPEND variable always comes last
+		{"-s -w", "", "-X main.v=1", EnvOverrideReplace, "-s -w -X main.v=1"},
+		{"", "", "-X main.v=1", EnvOverrideReplace, "-X main.v=1"},
+		{"-s -w", "-X main.arch=arm64", "-X main.v=1", EnvOverrideReplace, "-X main.arch=arm64 -X main.v=1"},
+		{"-s -w", "-X main.arch=arm64", "-X main.v=1", EnvOverrideAppend, "-s -w -X main.arch=arm64 -X main.v=1"},
+
+		// Flags with a package pattern are values of their own, and the
+		// flags without one are added to every value
+		{"", "all=-X main.arch=arm64", "", EnvOverrideAppend, "all=-X main.arch=arm64"},
+		{"-s -w", "all=-X main.arch=arm64", "", EnvOverrideReplace, "all=-X main.arch=arm64"},
+		{"-s -w", "all=-X main.arch=arm64", "", EnvOverrideAppend, "-s -w\nall=-X main.arch=arm64"},
+		{"all=-s -w", "", "-X main.v=1", EnvOverrideReplace, "all=-s -w -X main.v=1"},
+		{"-s\nall=-w", "", "-X main.v=1", EnvOverrideReplace, "-s -X main.v=1\nall=-w -X main.v=1"},
+	}
+
+	for i, tc := range cases {
+		os.Setenv(keys[0], tc.Env)
+		os.Setenv(keys[1], tc.Append)
+
+		actual := tc.Base
+		envOverrideFlags(&actual, platform, "LDFLAGS", tc.Mode)
+		if actual != tc.Expected {
+			t.Fatalf("%d: bad: %q", i, actual)
+		}
+	}
+}
+
+func TestEnvOverrideMode(t *testing.T) {
+	var m EnvOverrideMode
+	for _, v := range []string{"replace", "append"} {
+		if err := m.Set(v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(m) != v {
+			t.Fatalf("bad: %q", m)
+		}
+	}
+
+	if err := m.Set("prepend"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestEnvOverrideTags(t *testing.T) {
+	platform := Platform{OS: "windows", Arch: "amd64"}
+	keys := []string{"GOX_WINDOWS_AMD64_TAGS", "GOX_WINDOWS_AMD64_TAGS_APPEND"}
+	for _, key := range keys {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+
+	cases := []struct {
+		Base     string
+		Env      string
+		Append   string
+		Mode     EnvOverrideMode
+		Expected string
+	}{
+		{"netgo", "", "", EnvOverrideReplace, "netgo"},
+		{"netgo", "withsystray", "", EnvOverrideReplace, "withsystray"},
+		{"netgo", "withsystray", "", EnvOverrideAppend, "netgo withsystray"},
+		{"", "withsystray", "", EnvOverrideAppend, "withsystray"},
+
+		// Commas are kept, and tags aren't repeated
+		{"netgo,osusergo", "withsystray", "", EnvOverrideAppend, "netgo,osusergo,withsystray"},
+		{"netgo withsystray", "withsystray", "", EnvOverrideAppend, "netgo withsystray"},
+		{"netgo", "", "netgo,withsystray", EnvOverrideReplace, "netgo,withsystray"},
+		{"netgo", "osusergo", "withsystray", EnvOverrideReplace, "osusergo withsystray"},
+	}
+
+	for i, tc := range cases {
+		os.Setenv(keys[0], tc.Env)
+		os.Setenv(keys[1], tc.Append)
+
+		actual := tc.Base
+		envOverrideTags(&actual, platform, tc.Mode)
+		if actual != tc.Expected {
+			t.Fatalf("%d: bad: %q", i, actual)
+		}
+	}
+
+	// Other platforms keep the tags
+	actual := "netgo"
+	envOverrideTags(&actual, Platform{OS: "linux", Arch: "amd64"}, EnvOverrideAppend)
+	if actual != "netgo" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
+
+func TestEnvOverrideValues(t *testing.T) {
+	environ := []string{
+		"GOX_LINUX_ARM_GOCMD=/opt/go-arm/bin/go",
+		"GOX_GOCMD=go1.21",
+		"GOX_DARWIN_ARM64_GOCMD=",
+		"GOX_WINDOWS_AMD64_LDFLAGS=-s",
+		"GOX_JS_WASM_GOCMD=go-wasm",
+		"PATH=/usr/bin",
+	}
+
+	actual := envOverrideValues(environ, "GOCMD")
+	expected := []string{"/opt/go-arm/bin/go", "go-wasm"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestEnvOverrideNames(t *testing.T) {
+	environ := []string{
+		"GOX_LINUX_ARM_LDFLAGS=-s",
+		"GOX_LINUX_ARM64_LDFLAGS=-w",
+		"GOX_LINUX_ARM_CC=arm-linux-gnueabi-gcc",
+		"GOX_LINUX_ARM_TAGS=",
+		"GOX_LDFLAGS=-s",
+		"PATH=/usr/bin",
+	}
+
+	actual := envOverrideNames(environ, Platform{OS: "linux", Arch: "arm"})
+	expected := []string{"GOX_LINUX_ARM_CC", "GOX_LINUX_ARM_LDFLAGS"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
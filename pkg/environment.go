@@ -0,0 +1,85 @@
+package gox
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Environment is the environment of a go command, as reported by go env.
+type Environment struct {
+	// GoVersion is the version of Go, such as "go1.21.5". Before Go 1.16,
+	// which added GOVERSION, it is read by running a program that prints
+	// runtime.Version instead.
+	GoVersion string `json:"GOVERSION"`
+
+	// GoHostOS and GoHostArch are the platform the go command runs on.
+	GoHostOS   string `json:"GOHOSTOS"`
+	GoHostArch string `json:"GOHOSTARCH"`
+
+	GoPath string `json:"GOPATH"`
+	GoRoot string `json:"GOROOT"`
+
+	// GoFlags is GOFLAGS, from the environment or go env -w, which needs
+	// Go 1.9 or later to be read.
+	GoFlags string `json:"GOFLAGS"`
+}
+
+var (
+	environmentsLock sync.Mutex
+	environments     = make(map[string]*Environment)
+)
+
+// GoEnvironment returns the environment of the go command GoCmd. It is read
+// once, the first time it is asked for, and the same is returned for the
+// rest of the run.
+func GoEnvironment(GoCmd string) (*Environment, error) {
+	environmentsLock.Lock()
+	defer environmentsLock.Unlock()
+	if env, ok := environments[GoCmd]; ok {
+		return env, nil
+	}
+
+	env, err := readGoEnvironment(GoCmd)
+	if err != nil {
+		return nil, err
+	}
+	if env.GoVersion == "" {
+		env.GoVersion, err = goRunVersion(GoCmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	environments[GoCmd] = env
+	return env, nil
+}
+
+// readGoEnvironment reads the environment of the go command with a single
+// go env -json. Before Go 1.9, which added -json, the variables are read
+// one per line instead.
+func readGoEnvironment(GoCmd string) (*Environment, error) {
+	var env Environment
+	output, err := execGo(GoCmd, nil, "", "env", "-json")
+	if err == nil {
+		if err := json.Unmarshal([]byte(output), &env); err != nil {
+			return nil, fmt.Errorf("invalid output of go env -json: %s", err)
+		}
+		return &env, nil
+	}
+
+	output, err = execGo(GoCmd, nil, "", "env", "GOHOSTOS", "GOHOSTARCH", "GOPATH", "GOROOT")
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("unexpected output of go env: %q", output)
+	}
+	for i, v := range []*string{&env.GoHostOS, &env.GoHostArch, &env.GoPath, &env.GoRoot} {
+		*v = strings.TrimSpace(lines[i])
+	}
+
+	return &env, nil
+}
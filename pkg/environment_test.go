@@ -0,0 +1,37 @@
+package gox
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGoEnvironment(t *testing.T) {
+	env, err := GoEnvironment("go")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if env.GoHostOS != runtime.GOOS || env.GoHostArch != runtime.GOARCH {
+		t.Fatalf("bad: %#v", env)
+	}
+	if _, err := ParseGoVersion(env.GoVersion); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if env.GoRoot == "" {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	// The environment is only read once
+	again, err := GoEnvironment("go")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if again != env {
+		t.Fatalf("bad: %#v", again)
+	}
+}
+
+func TestGoEnvironment_missing(t *testing.T) {
+	if _, err := GoEnvironment("gox-no-such-go"); err == nil {
+		t.Fatal("should err")
+	}
+}
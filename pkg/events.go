@@ -0,0 +1,146 @@
+package gox
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventBuildStart is sent when a build starts.
+	EventBuildStart EventType = "build-start"
+
+	// EventBuildFinish is sent when a build that started is done, whether
+	// it succeeded or not.
+	EventBuildFinish EventType = "build-finish"
+
+	// EventSummary is sent once at the end of a run.
+	EventSummary EventType = "summary"
+)
+
+// Event is an event of a run, written as a line of JSON by the -json flag.
+// Which fields are set depends on the type of the event.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Platform and Package are the platform and import path of the build,
+	// for build events.
+	Platform string `json:"platform,omitempty"`
+	Package  string `json:"package,omitempty"`
+
+	// Output, Size, DurationMs and Error describe the outcome of a build,
+	// for build-finish events. Output and Size are only set if the build
+	// succeeded, and Error only if it failed.
+	Output     string `json:"output,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// Summary is set for summary events.
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Summary is the outcome of a whole run.
+type Summary struct {
+	Total      int   `json:"total"`
+	Succeeded  int   `json:"succeeded"`
+	Failed     int   `json:"failed"`
+	DurationMs int64 `json:"duration_ms"`
+
+	// Interrupted is true if the run was cancelled by a signal.
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// ExitCode is the exit code of the run.
+	ExitCode int `json:"exit_code"`
+
+	// Skipped are the platforms that weren't built, such as platforms
+	// without a C toolchain with -cgo-skip-missing.
+	Skipped []string `json:"skipped,omitempty"`
+
+	// Artifacts are the paths of the files the run produced, and Errors
+	// the errors it failed with.
+	Artifacts []string `json:"artifacts,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// NewBuildStartEvent returns the event for the start of the build with
+// the given options.
+func NewBuildStartEvent(opts *CompileOpts) Event {
+	return Event{
+		Type:     EventBuildStart,
+		Time:     time.Now(),
+		Platform: opts.Platform.String(),
+		Package:  opts.PackagePath,
+	}
+}
+
+// NewBuildFinishEvent returns the event for the end of the build of the
+// given result.
+func NewBuildFinishEvent(r *Result) Event {
+	e := Event{
+		Type:       EventBuildFinish,
+		Time:       time.Now(),
+		Platform:   r.Platform.String(),
+		Package:    r.PackagePath,
+		DurationMs: r.Duration.Nanoseconds() / int64(time.Millisecond),
+	}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+		return e
+	}
+
+	e.Output = r.Output
+	if fi, err := os.Stat(r.Output); err == nil {
+		e.Size = fi.Size()
+	}
+
+	return e
+}
+
+// EventWriter writes events to a writer, one JSON object per line. It is
+// safe to use from multiple goroutines.
+type EventWriter struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// NewEventWriter returns an EventWriter that writes to w.
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes the event as a line of JSON.
+func (w *EventWriter) Write(e Event) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.enc.Encode(e)
+}
+
+// NewSummaryEvent returns the summary event of a run that produced the
+// given results and took d. Failed counts every build that didn't
+// succeed, including the builds that never started.
+func NewSummaryEvent(results []Result, d time.Duration) Event {
+	summary := &Summary{
+		Total:      len(results),
+		DurationMs: d.Nanoseconds() / int64(time.Millisecond),
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	return Event{
+		Type:    EventSummary,
+		Time:    time.Now(),
+		Summary: summary,
+	}
+}
@@ -0,0 +1,90 @@
+package gox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewBuildFinishEvent(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "foo")
+	testWriteFile(t, output, "binary")
+
+	r := &Result{
+		Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+		PackagePath: "github.com/foo/app",
+		Output:      output,
+		Duration:    1500 * time.Millisecond,
+	}
+	e := NewBuildFinishEvent(r)
+	if e.Type != EventBuildFinish || e.Platform != "linux/arm/v6" ||
+		e.Package != r.PackagePath || e.Output != output ||
+		e.Size != 6 || e.DurationMs != 1500 || e.Error != "" {
+		t.Fatalf("bad: %#v", e)
+	}
+
+	r.Err = errors.New("exit status 2")
+	e = NewBuildFinishEvent(r)
+	if e.Error != "exit status 2" || e.Output != "" || e.Size != 0 {
+		t.Fatalf("bad: %#v", e)
+	}
+}
+
+func TestNewSummaryEvent(t *testing.T) {
+	results := []Result{
+		{},
+		{Err: errors.New("failed")},
+		{Err: ErrFailFastSkipped},
+	}
+	e := NewSummaryEvent(results, 2*time.Second)
+	expected := &Summary{
+		Total:      3,
+		Succeeded:  1,
+		Failed:     2,
+		DurationMs: 2000,
+	}
+	if e.Type != EventSummary || !reflect.DeepEqual(e.Summary, expected) {
+		t.Fatalf("bad: %#v", e.Summary)
+	}
+}
+
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewEventWriter(&buf)
+
+	events := []Event{
+		NewBuildStartEvent(&CompileOpts{
+			PackagePath: "github.com/foo/app",
+			Platform:    Platform{OS: "linux", Arch: "amd64"},
+		}),
+		NewSummaryEvent(nil, 0),
+	}
+	for _, e := range events {
+		if err := w.Write(e); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != len(events) {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	for i, line := range lines {
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if e.Type != events[i].Type || e.Platform != events[i].Platform ||
+			e.Package != events[i].Package {
+			t.Fatalf("bad: %#v", e)
+		}
+	}
+}
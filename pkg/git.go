@@ -0,0 +1,49 @@
+package gox
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+// GitInfo is information about the git commit that is being built. It is
+// available to the output and ldflags templates.
+type GitInfo struct {
+	SHA      string
+	ShortSHA string
+	Tag      string
+
+	// Describe is the output of git describe --tags --always --dirty,
+	// which is the tag, or the commit if there are no tags, of the working
+	// tree.
+	Describe string
+}
+
+// ReadGitInfo reads the commit and tag of the git repository that contains
+// the given directory. If the directory isn't in a git repository, or git
+// isn't installed, the fields are left empty rather than returning an error.
+func ReadGitInfo(dir string) GitInfo {
+	var info GitInfo
+	info.SHA = execGit(dir, "rev-parse", "HEAD")
+	info.ShortSHA = execGit(dir, "rev-parse", "--short", "HEAD")
+	if info.SHA != "" {
+		info.Tag = execGit(dir, "describe", "--tags")
+		info.Describe = execGit(dir, "describe", "--tags", "--always", "--dirty")
+	}
+
+	return info
+}
+
+// execGit runs git with the given arguments and returns the trimmed
+// output, or an empty string if the command failed.
+func execGit(dir string, args ...string) string {
+	var stdout bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(stdout.String())
+}
@@ -0,0 +1,16 @@
+package gox
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReadGitInfo_notRepo(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	info := ReadGitInfo(td)
+	if info != (GitInfo{}) {
+		t.Fatalf("bad: %#v", info)
+	}
+}
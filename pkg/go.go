@@ -2,88 +2,328 @@ package gox
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"text/template"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// DefaultOutputTpl is the default output path template. The variant and
+// libc of the platform and the version of Go are only added if there are
+// any, so that the variants of a platform, or its builds with different
+// versions of Go, don't overwrite each other.
+const DefaultOutputTpl = "{{.Dir}}_{{.OS}}_{{.Arch}}{{with .Variant}}_{{.}}{{end}}" +
+	"{{with .Libc}}_{{.}}{{end}}{{with .GoVersion}}_{{.}}{{end}}"
+
+// DefaultTestOutputTpl is the default output path template of test
+// binaries, built with ModeTest.
+const DefaultTestOutputTpl = DefaultOutputTpl + ".test"
+
+// CompileMode is what GoCrossCompile builds from a package.
+type CompileMode string
+
+const (
+	// ModeBuild builds the package with go build.
+	ModeBuild CompileMode = ""
+
+	// ModeTest builds the test binary of the package with go test -c.
+	ModeTest CompileMode = "test"
+
+	// ModeVet only checks the package with go vet, without building
+	// anything.
+	ModeVet CompileMode = "vet"
 )
 
 type OutputTemplateData struct {
-	Dir  string
-	OS   string
-	Arch string
+	Dir         string
+	ImportPath  string
+	ImportBase  string
+	OS          string
+	Arch        string
+	ArmVersion  string
+	Variant     string
+	Libc        string
+	GoVersion   string
+	Exe         string
+	Ext         string
+	GitSHA      string
+	GitShortSHA string
+	GitTag      string
 }
 
 type CompileOpts struct {
-	PackagePath string
-	Platform    Platform
-	OutputTpl   string
-	Ldflags     string
-	Gcflags     string
-	Asmflags    string
-	Tags        string
-	Cgo         bool
-	Rebuild     bool
-	GoCmd       string
+	PackagePath   string
+	ImportPath    string
+	Platform      Platform
+	OutputTpl     string
+	OutputDir     string
+	Ldflags       string
+	Gcflags       string
+	Asmflags      string
+	Tags          string
+	Cgo           bool
+	CgoSet        bool
+	Race          bool
+	Trimpath      bool
+	Mod           string
+	Buildmode     string
+	InstallSuffix string
+	AndroidAPI    int
+	CC            string
+	CXX           string
+	Rebuild       bool
+	Strip         bool
+	WindowsGUI    bool
+	Static        bool
+	Stamps        []Stamp
+	Mode          CompileMode
+	Vet           bool
+	GoCmd         string
+	Git           GitInfo
+
+	// OnCommand, if set, is called with the go build command right before
+	// it runs, such as to print it.
+	OnCommand func(cmd *BuildCommand)
+
+	// Verbose passes -v to go build. OnOutput, if set, is called with each
+	// line go build prints, on stdout or stderr, as it prints them.
+	Verbose  bool
+	OnOutput func(line string)
+
+	// Reproducible passes -trimpath and leaves the build ID out of the
+	// binary. BuildVCS, if set, is passed as -buildvcs, which needs Go
+	// 1.18 or later. It is one of BuildVCSModes.
+	Reproducible bool
+	BuildVCS     string
+
+	// PGO, if set, is the path of the CPU profile that the build is
+	// optimized with, passed as -pgo, which needs Go 1.21 or later.
+	PGO string
+
+	// Env are variables to set for the build, as KEY=VALUE, on top of the
+	// environment of gox but under the ones gox sets itself, such as GOOS
+	// and GOARCH. With CleanEnv, the environment of gox is left out but
+	// for the variables in CleanEnvVars and those that start with GO.
+	Env      []string
+	CleanEnv bool
+
+	// IgnoreGoflags sets GOFLAGS to empty for the go commands, so that the
+	// flags of gox are the only ones they get.
+	IgnoreGoflags bool
+
+	// Overlay, if set, is the path of the overlay file passed as
+	// -overlay, which needs Go 1.16 or later. See Overlay. It should be
+	// absolute, since the go commands may run in another directory.
+	Overlay string
+
+	// GoCache, if set, is the GOCACHE the build runs with. The directory
+	// is created before the build if it doesn't exist.
+	GoCache string
+
+	// GoVersion, if set, is the version of Go to build with, such as
+	// go1.22.3, which go switches to with GOTOOLCHAIN, downloading it if
+	// needed. See CheckGoToolchains.
+	GoVersion string
+
+	// Logger, if set, gets the messages of the build, such as the go
+	// commands it runs at LogDebug.
+	Logger Logger
+
+	// WinRes, if set, are the Windows resources linked into the binary
+	// when the platform is windows. See ReadWinRes.
+	WinRes *WinRes
 }
 
 // GoCrossCompile
 func GoCrossCompile(opts *CompileOpts) error {
-	env := append(os.Environ(),
-		"GOOS="+opts.Platform.OS,
-		"GOARCH="+opts.Platform.Arch)
-
-	// If we're building for our own platform, then enable cgo always. We
-	// respect the CGO_ENABLED flag if that is explicitly set on the platform.
-	if !opts.Cgo && os.Getenv("CGO_ENABLED") != "0" {
-		opts.Cgo = runtime.GOOS == opts.Platform.OS &&
-			runtime.GOARCH == opts.Platform.Arch
-	}
+	return GoCrossCompileContext(context.Background(), opts)
+}
 
-	// If cgo is enabled then set that env var
-	if opts.Cgo {
-		env = append(env, "CGO_ENABLED=1")
-	} else {
-		env = append(env, "CGO_ENABLED=0")
+// GoCrossCompileContext is GoCrossCompile with a context. If the context
+// is done before the build finishes, the go build process is killed.
+//
+// With Vet set, go vet checks the package for the platform first, and the
+// build fails without compiling anything if it reports problems.
+func GoCrossCompileContext(ctx context.Context, opts *CompileOpts) error {
+	if opts.Vet && opts.Mode != ModeVet {
+		vet := *opts
+		vet.Mode = ModeVet
+		if err := GoCrossCompileContext(ctx, &vet); err != nil {
+			return fmt.Errorf("go vet failed: %s", err)
+		}
 	}
 
-	var outputPath bytes.Buffer
-	tpl, err := template.New("output").Parse(opts.OutputTpl)
+	cmd, err := NewBuildCommand(opts)
 	if err != nil {
 		return err
 	}
-	tplData := OutputTemplateData{
-		Dir:  filepath.Base(opts.PackagePath),
-		OS:   opts.Platform.OS,
-		Arch: opts.Platform.Arch,
+
+	if opts.GoCache != "" {
+		if err := os.MkdirAll(opts.GoCache, 0755); err != nil {
+			return err
+		}
 	}
-	if err := tpl.Execute(&outputPath, &tplData); err != nil {
-		return err
+
+	// Create the directory the output goes in, since the template may
+	// render nested directories.
+	if cmd.Output != "" {
+		if err := os.MkdirAll(filepath.Dir(cmd.Output), 0755); err != nil {
+			return err
+		}
+	}
+
+	// The Windows resources are linked in from a .syso file that is only
+	// in the directory of the package while it builds.
+	if opts.WinRes != nil && opts.Platform.OS == "windows" && opts.Mode != ModeVet {
+		cleanup, err := writeWinResSyso(opts)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+
+	logAt(opts.Logger, LogDebug, "%s: running %s", opts.Platform.String(), cmd)
+	if opts.OnCommand != nil {
+		opts.OnCommand(cmd)
+	}
+	_, err = execGoContext(ctx, cmd.GoCmd, append(buildEnviron(opts), cmd.Env...),
+		cmd.Dir, opts.OnOutput, cmd.Args...)
+	return err
+}
+
+// BuildCommand is the go build command that GoCrossCompile runs for a
+// build.
+type BuildCommand struct {
+	GoCmd string
+	Args  []string
+
+	// Env are the variables set for the build on top of the environment
+	// of gox, such as GOOS and GOARCH.
+	Env []string
+
+	// Dir is the directory go build runs in, or empty for the current
+	// directory.
+	Dir string
+
+	// Output is the absolute path of the file the build writes, or empty
+	// with ModeVet, which doesn't write anything.
+	Output string
+}
+
+// NewBuildCommand returns the go build command for the given options,
+// without running it. The templates of the options are rendered and the
+// environment is checked the same way as for a real build, so the same
+// errors are returned.
+func NewBuildCommand(opts *CompileOpts) (*BuildCommand, error) {
+	env, err := goBuildEnvVars(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	if opts.Platform.OS == "windows" {
-		outputPath.WriteString(".exe")
+	if opts.Mode == ModeVet {
+		chdir, packagePath := buildPackagePath(opts.PackagePath)
+		return &BuildCommand{
+			GoCmd: opts.GoCmd,
+			Args:  goVetArgs(opts, packagePath),
+			Env:   env,
+			Dir:   chdir,
+		}, nil
 	}
 
 	// Determine the full path to the output so that we can change our
 	// working directory when executing go build.
-	outputPathReal := outputPath.String()
+	outputPathReal, err := OutputPath(opts)
+	if err != nil {
+		return nil, err
+	}
 	outputPathReal, err = filepath.Abs(outputPathReal)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	ldflags, err := buildLdflags(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Static linux builds without cgo are static already. With cgo, net
+	// and os/user are built in pure Go, and the C code is linked in
+	// statically.
+	if isStaticCgo(opts) {
+		o := *opts
+		o.Tags = joinTags(o.Tags, staticTags)
+		opts = &o
+	}
+
+	chdir, packagePath := buildPackagePath(opts.PackagePath)
+	return &BuildCommand{
+		GoCmd:  opts.GoCmd,
+		Args:   goBuildArgs(opts, ldflags, outputPathReal, packagePath),
+		Env:    env,
+		Dir:    chdir,
+		Output: outputPathReal,
+	}, nil
+}
+
+// isStaticCgo returns true if the build with the given options is a static
+// linux build with cgo, which needs flags of its own to be static.
+func isStaticCgo(opts *CompileOpts) bool {
+	return opts.Static && opts.Platform.OS == "linux" && UsesCgo(opts)
+}
+
+// buildLdflags returns the ldflags the build with the given options passes
+// to go build: its Ldflags, with the variables of the output template
+// replaced, and the flags gox adds for stamps, -strip, -reproducible and
+// such.
+func buildLdflags(opts *CompileOpts) (string, error) {
+	// The ldflags may reference the same variables as the output template,
+	// which is mostly useful for stamping the version into the binary.
+	ldflags, err := executeTemplate(opts.Ldflags, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// The flags gox adds go in every value of the ldflags, whatever
+	// package pattern it has.
+	static := isStaticCgo(opts)
+	return eachFlagValue(ldflags, func(ldflags string) (string, error) {
+		ldflags = stampLdflags(ldflags, opts.Stamps)
+		if opts.Strip {
+			ldflags = stripLdflags(ldflags)
+		}
+		if opts.WindowsGUI && opts.Platform.OS == "windows" {
+			ldflags = windowsGUILdflags(ldflags)
+		}
+		if static {
+			ldflags = staticLdflags(ldflags)
+		}
+		if opts.Reproducible {
+			return reproducibleLdflags(ldflags)
+		}
+		return ldflags, nil
+	})
+}
+
+// buildPackagePath returns the directory to run go build in and the
+// package path to pass it for the given package path.
+func buildPackagePath(path string) (chdir, packagePath string) {
 	// Go prefixes the import directory with '_' when it is outside
 	// the GOPATH.For this, we just drop it since we move to that
 	// directory to build.
-	chdir := ""
-	if opts.PackagePath[0] == '_' {
+	packagePath = path
+	if packagePath[0] == '_' {
 		if runtime.GOOS == "windows" {
 			// We have to replace weird paths like this:
 			//
@@ -94,78 +334,571 @@ func GoCrossCompile(opts *CompileOpts) error {
 			//   c:\Users
 			//
 			re := regexp.MustCompile("^/([a-zA-Z])_/")
-			chdir = re.ReplaceAllString(opts.PackagePath[1:], "$1:\\")
+			chdir = re.ReplaceAllString(packagePath[1:], "$1:\\")
 			chdir = strings.Replace(chdir, "/", "\\", -1)
 		} else {
-			chdir = opts.PackagePath[1:]
+			chdir = packagePath[1:]
 		}
 
-		opts.PackagePath = ""
+		packagePath = ""
+	}
+
+	return chdir, packagePath
+}
+
+// String returns the command as a shell command line, with the variables
+// of the build set in front of it, which can be copied to run it again.
+func (c *BuildCommand) String() string {
+	parts := make([]string, 0, len(c.Env)+len(c.Args)+1)
+	for _, v := range c.Env {
+		parts = append(parts, shellQuote(v))
+	}
+	parts = append(parts, shellQuote(c.GoCmd))
+	for _, arg := range c.Args {
+		parts = append(parts, shellQuote(arg))
 	}
 
+	line := strings.Join(parts, " ")
+	if c.Dir != "" {
+		line = "cd " + shellQuote(c.Dir) + " && " + line
+	}
+
+	return line
+}
+
+// shellQuote quotes s for a POSIX shell if it has any characters the
+// shell would interpret.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, shellSafeChars) == "" {
+		return s
+	}
+
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"0123456789_-+=/.,:@%"
+
+// stripLdflags adds the linker flags that strip the symbol table and the
+// DWARF debug info, -s and -w, to the end of ldflags, unless they're
+// already there.
+func stripLdflags(ldflags string) string {
+	present := make(map[string]bool)
+	for _, field := range strings.Fields(ldflags) {
+		present[field] = true
+	}
+
+	for _, flag := range []string{"-s", "-w"} {
+		if present[flag] {
+			continue
+		}
+		if ldflags != "" {
+			ldflags += " "
+		}
+		ldflags += flag
+	}
+
+	return ldflags
+}
+
+// windowsGUILdflags adds the linker flag that builds a GUI binary for
+// windows, which starts without a console window, -H windowsgui, to the
+// end of ldflags, unless it's already there.
+func windowsGUILdflags(ldflags string) string {
+	fields := strings.Fields(ldflags)
+	for i, field := range fields {
+		// The linker takes its flags with one dash or two.
+		if strings.HasPrefix(field, "--") {
+			field = field[1:]
+		}
+		if field == "-H=windowsgui" ||
+			(field == "-H" && i+1 < len(fields) && fields[i+1] == "windowsgui") {
+			return ldflags
+		}
+	}
+
+	if ldflags != "" {
+		ldflags += " "
+	}
+	return ldflags + "-H windowsgui"
+}
+
+// goBuildEnv returns the environment to run go build with for the given
+// options. It is built from scratch for every build, since builds for other
+// platforms may be running at the same time with a different environment.
+func goBuildEnv(opts *CompileOpts) ([]string, error) {
+	env, err := goBuildEnvVars(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buildEnviron(opts), env...), nil
+}
+
+// goBuildEnvVars returns the variables that goBuildEnv sets on top of the
+// environment of gox: the Env of the build, and then the ones gox sets,
+// which override them.
+func goBuildEnvVars(opts *CompileOpts) ([]string, error) {
+	env := append([]string(nil), opts.Env...)
+	env = append(env,
+		"GOOS="+opts.Platform.OS,
+		"GOARCH="+opts.Platform.Arch)
+	if opts.IgnoreGoflags {
+		env = append(env, "GOFLAGS=")
+	}
+	if opts.Platform.Arm != "" {
+		env = append(env, "GOARM="+opts.Platform.Arm)
+	}
+	if opts.Platform.Mips != "" {
+		if strings.HasPrefix(opts.Platform.Arch, "mips64") {
+			env = append(env, "GOMIPS64="+opts.Platform.Mips)
+		} else {
+			env = append(env, "GOMIPS="+opts.Platform.Mips)
+		}
+	}
+	if opts.Platform.Amd64 != "" {
+		env = append(env, "GOAMD64="+opts.Platform.Amd64)
+	}
+
+	// If cgo is enabled then set that env var.
+	cgo := UsesCgo(opts)
+	if cgo {
+		env = append(env, "CGO_ENABLED=1")
+	} else {
+		env = append(env, "CGO_ENABLED=0")
+	}
+
+	// Android and iOS need a C toolchain that go build can't point out
+	// clearly when it is missing, so check for it before building.
+	androidAPI := opts.AndroidAPI
+	if androidAPI == 0 {
+		androidAPI = DefaultAndroidAPI
+	}
+	// An explicit CC takes the place of the NDK compilers.
+	extraEnv, err := mobileEnv(opts.Platform, cgo && opts.CC == "", androidAPI)
+	if err != nil {
+		return nil, err
+	}
+	env = append(env, extraEnv...)
+
+	// The musl variants link against musl rather than the glibc of the
+	// system compiler, with musl-gcc unless another CC is given.
+	if cgo && opts.CC == "" && opts.Platform.Libc == "musl" {
+		env = append(env, "CC=musl-gcc")
+	}
+
+	// The C compilers differ for every platform, so they are only set
+	// for this build and not in the environment of gox itself.
+	if opts.CC != "" {
+		env = append(env, "CC="+opts.CC)
+	}
+	if opts.CXX != "" {
+		env = append(env, "CXX="+opts.CXX)
+	}
+	if opts.GoCache != "" {
+		env = append(env, "GOCACHE="+opts.GoCache)
+	}
+	if opts.GoVersion != "" {
+		env = append(env, "GOTOOLCHAIN="+opts.GoVersion)
+	}
+
+	return env, nil
+}
+
+// UsesCgo returns whether the build for the given options runs with cgo.
+func UsesCgo(opts *CompileOpts) bool {
+	// If we're building for our own platform, then enable cgo always. We
+	// respect the CGO_ENABLED flag if that is explicitly set on the platform,
+	// and the cgo setting if it was explicitly set for this build.
+	cgo := opts.Cgo
+	if !cgo && !opts.CgoSet && os.Getenv("CGO_ENABLED") != "0" {
+		cgo = runtime.GOOS == opts.Platform.OS &&
+			runtime.GOARCH == opts.Platform.Arch
+	}
+
+	// The race detector and the C build modes need cgo as well, as does
+	// iOS since it is always linked externally, and the libc variants,
+	// which would be no different from the usual build without it.
+	// Platforms without cgo support always build with it off.
+	cgo = cgo || opts.Race || buildmodeNeedsCgo(opts.Buildmode) ||
+		opts.Platform.OS == "ios" || opts.Platform.Libc != ""
+	return cgo && opts.Platform.SupportsCgo()
+}
+
+// goBuildArgs returns the arguments to `go` to build the package for the
+// given options. The ldflags must already be rendered.
+func goBuildArgs(opts *CompileOpts, ldflags, outputPath, packagePath string) []string {
 	args := []string{"build"}
+	if opts.Mode == ModeTest {
+		args = []string{"test", "-c"}
+	}
 	if opts.Rebuild {
 		args = append(args, "-a")
 	}
+
+	// For go test, -v is a flag of the test binary rather than one that
+	// lists the packages being built.
+	if opts.Verbose && opts.Mode != ModeTest {
+		args = append(args, "-v")
+	}
+	if opts.Race {
+		args = append(args, "-race")
+	}
+	if opts.Trimpath || opts.Reproducible {
+		args = append(args, "-trimpath")
+	}
+	if opts.BuildVCS != "" {
+		args = append(args, "-buildvcs="+opts.BuildVCS)
+	}
+	if opts.PGO != "" {
+		args = append(args, "-pgo="+opts.PGO)
+	}
+	if opts.Overlay != "" {
+		args = append(args, "-overlay="+opts.Overlay)
+	}
+	if opts.Mod != "" {
+		args = append(args, "-mod="+opts.Mod)
+	}
+	if opts.Buildmode != "" {
+		args = append(args, "-buildmode="+opts.Buildmode)
+	}
+	if opts.InstallSuffix != "" {
+		args = append(args, "-installsuffix", opts.InstallSuffix)
+	}
+	for _, v := range flagValues(opts.Gcflags) {
+		args = append(args, "-gcflags", v)
+	}
+	for _, v := range flagValues(ldflags) {
+		args = append(args, "-ldflags", v)
+	}
+	for _, v := range flagValues(opts.Asmflags) {
+		args = append(args, "-asmflags", v)
+	}
 	args = append(args,
-		"-gcflags", opts.Gcflags,
-		"-ldflags", opts.Ldflags,
-		"-asmflags", opts.Asmflags,
 		"-tags", opts.Tags,
-		"-o", outputPathReal,
-		opts.PackagePath)
+		"-o", outputPath,
+		packagePath)
+
+	return args
+}
 
-	_, err = execGo(opts.GoCmd, env, chdir, args...)
+// goVetArgs returns the arguments to `go` to vet the package for the given
+// options. Only the flags that decide which files make up the package are
+// passed, the rest only matter to the compiler and linker.
+func goVetArgs(opts *CompileOpts, packagePath string) []string {
+	args := []string{"vet"}
+	if opts.Mod != "" {
+		args = append(args, "-mod="+opts.Mod)
+	}
+	if opts.Overlay != "" {
+		args = append(args, "-overlay="+opts.Overlay)
+	}
+	args = append(args, "-tags", opts.Tags, packagePath)
+
+	return args
+}
+
+// outputTemplateFuncs are the functions available in the output template.
+var outputTemplateFuncs = template.FuncMap{
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"title":     strings.Title,
+	"trimspace": strings.TrimSpace,
+	"replace": func(s, old, new string) string {
+		return strings.Replace(s, old, new, -1)
+	},
+}
+
+// ParseOutputTemplate parses the output path template with the template
+// functions gox provides. This can be used to validate a template before
+// starting any builds.
+func ParseOutputTemplate(tpl string) (*template.Template, error) {
+	return template.New("output").Funcs(outputTemplateFuncs).Parse(tpl)
+}
+
+// OutputPath renders the output template for the given options and
+// returns the path the binary will be written to, prefixed with the
+// output directory if one is set.
+func OutputPath(opts *CompileOpts) (string, error) {
+	result, err := executeTemplate(opts.OutputTpl, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// Add the extension unless the template already did so itself. For
+	// the C build modes this is the extension of the library.
+	ext := buildmodeExt(opts.Buildmode, opts.Platform)
+	if !strings.HasSuffix(strings.ToLower(result), ext) {
+		result += ext
+	}
+
+	if opts.OutputDir != "" {
+		result = filepath.Join(opts.OutputDir, result)
+	}
+
+	return result, nil
+}
+
+// executeTemplate parses and renders the given template with the
+// template data for the given options.
+func executeTemplate(text string, opts *CompileOpts) (string, error) {
+	tpl, err := ParseOutputTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	tplData := OutputTemplateData{
+		Dir:         filepath.Base(opts.PackagePath),
+		ImportPath:  opts.ImportPath,
+		OS:          opts.Platform.OS,
+		Arch:        opts.Platform.Arch,
+		ArmVersion:  armVersion(opts.Platform),
+		Variant:     opts.Platform.Variant(),
+		Libc:        opts.Platform.Libc,
+		GoVersion:   opts.GoVersion,
+		Exe:         opts.Platform.ExeSuffix(),
+		Ext:         buildmodeExt(opts.Buildmode, opts.Platform),
+		GitSHA:      opts.Git.SHA,
+		GitShortSHA: opts.Git.ShortSHA,
+		GitTag:      opts.Git.Tag,
+	}
+
+	if opts.ImportPath != "" {
+		tplData.ImportBase = path.Base(opts.ImportPath)
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &tplData); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// armVersion returns the GOARM version of the platform as it is shown in
+// the output template, such as "v6", or nothing if it isn't set.
+func armVersion(p Platform) string {
+	if p.Arm == "" {
+		return ""
+	}
+
+	return "v" + p.Arm
+}
+
+// ModModes are the values accepted by the -mod build flag.
+var ModModes = []string{"mod", "readonly", "vendor"}
+
+// BuildVCSModes are the values that go build takes for -buildvcs.
+var BuildVCSModes = []string{"true", "false", "auto"}
+
+// ValidBuildVCS returns an error if the given -buildvcs value isn't one of
+// BuildVCSModes. An empty value is valid and leaves the flag unset.
+func ValidBuildVCS(buildVCS string) error {
+	if buildVCS == "" {
+		return nil
+	}
+	for _, m := range BuildVCSModes {
+		if m == buildVCS {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid -buildvcs value %q, must be one of: %s",
+		buildVCS, strings.Join(BuildVCSModes, ", "))
+}
+
+// ValidModMode returns an error if the given -mod value isn't one of
+// ModModes. An empty value is valid and leaves the flag unset.
+func ValidModMode(mod string) error {
+	if mod == "" {
+		return nil
+	}
+	for _, m := range ModModes {
+		if m == mod {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid -mod value %q, must be one of: %s",
+		mod, strings.Join(ModModes, ", "))
+}
+
+// GoPackage is a package as listed by GoMainDirs.
+type GoPackage struct {
+	// Path is what the package is built by, see GoMainDirs.
+	Path       string
+	ImportPath string
+	Name       string
+}
+
+// GoMainDirs returns the packages that are "main" packages, from the list
+// of packages given, and the packages that aren't. The list of packages
+// can include relative paths, the special "..." Go keyword, etc, and may
+// mix them. If mod is set, it is passed as the -mod flag so that packages
+// are resolved the same way they are built. Likewise, go list runs with
+// the environment env, or that of gox if it's nil.
+//
+// The Path of the packages is their absolute directory rather than their
+// import path, since go build takes directories the same way in module
+// mode and in GOPATH mode. In module mode, the packages outside of the
+// main module, such as those of dependencies, have their import path as
+// the Path instead, since go build only takes directories that are in the
+// main module.
+func GoMainDirs(packages []string, GoCmd string, mod string, env []string) ([]GoPackage, []GoPackage, error) {
+	gomod, err := GoModule(GoCmd, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format := "{{.Name}}|{{.Dir}}|{{.ImportPath}}"
+	if gomod != "" {
+		format += "|{{if .Module}}{{.Module.Main}}{{end}}"
+	}
+
+	args := make([]string, 0, len(packages)+4)
+	args = append(args, "list")
+	if mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	args = append(args, "-f", format)
+	args = append(args, packages...)
+
+	output, err := execGo(GoCmd, env, "", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var results, others []GoPackage
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "|")
+		if (gomod == "" && len(parts) != 3) || (gomod != "" && len(parts) != 4) {
+			log.Printf("Bad line reading packages: %s", line)
+			continue
+		}
+
+		pkg := GoPackage{Path: parts[1], ImportPath: parts[2], Name: parts[0]}
+		if gomod != "" && parts[3] != "true" {
+			pkg.Path = pkg.ImportPath
+		}
+		if pkg.Name == "main" {
+			results = append(results, pkg)
+		} else {
+			others = append(others, pkg)
+		}
+	}
+
+	return results, others, nil
+}
+
+// goGenerateArgs returns the arguments to `go` to run go generate for the
+// packages.
+func goGenerateArgs(packages []string, tags, mod string) []string {
+	args := []string{"generate"}
+	if mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+
+	return append(args, packages...)
+}
+
+// GoGenerate runs go generate for the packages, once for all platforms,
+// with the environment env, or that of gox if it's nil. If onLine is set,
+// it is called with each line go generate prints.
+func GoGenerate(packages []string, GoCmd, tags, mod string, env []string, onLine func(string)) error {
+	_, err := execGoContext(context.Background(), GoCmd, env, "", onLine,
+		goGenerateArgs(packages, tags, mod)...)
 	return err
 }
 
-// GoMainDirs returns the file paths to the packages that are "main"
-// packages, from the list of packages given. The list of packages can
-// include relative paths, the special "..." Go keyword, etc.
-func GoMainDirs(packages []string, GoCmd string) ([]string, error) {
-	args := make([]string, 0, len(packages)+3)
-	args = append(args, "list", "-f", "{{.Name}}|{{.ImportPath}}")
+// GoTestDirs splits the packages given, which may include patterns like
+// GoMainDirs, into the ones that have test files and the ones that don't.
+func GoTestDirs(packages []string, GoCmd string, mod string, env []string) ([]string, []string, error) {
+	args := []string{"list"}
+	if mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	args = append(args, "-f", "{{.ImportPath}}|{{len .TestGoFiles}}|{{len .XTestGoFiles}}")
 	args = append(args, packages...)
 
-	output, err := execGo(GoCmd, nil, "", args...)
+	output, err := execGo(GoCmd, env, "", args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	results := make([]string, 0, len(output))
+	var tested, untested []string
 	for _, line := range strings.Split(output, "\n") {
 		if line == "" {
 			continue
 		}
 
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) != 2 {
+		parts := strings.Split(line, "|")
+		if len(parts) != 3 {
 			log.Printf("Bad line reading packages: %s", line)
 			continue
 		}
 
-		if parts[0] == "main" {
-			results = append(results, parts[1])
+		if parts[1] == "0" && parts[2] == "0" {
+			untested = append(untested, parts[0])
+		} else {
+			tested = append(tested, parts[0])
 		}
 	}
 
-	return results, nil
+	return tested, untested, nil
+}
+
+// GoModule returns the path to the go.mod file of the main module if the
+// go command runs in module mode in the current directory, or an empty
+// string if it runs in GOPATH mode. It runs with the environment env, or
+// that of gox if it's nil, like the other go commands that list packages.
+func GoModule(GoCmd string, env []string) (string, error) {
+	output, err := execGo(GoCmd, env, "", "env", "GOMOD")
+	if err != nil {
+		return "", err
+	}
+
+	// Module mode outside of any module has no main module, and reports
+	// the null device as its go.mod.
+	gomod := strings.TrimSpace(output)
+	if gomod == os.DevNull {
+		return "", nil
+	}
+
+	return gomod, nil
 }
 
 // GoRoot returns the GOROOT value for the compiled `go` binary.
 func GoRoot() (string, error) {
-	output, err := execGo("go", nil, "", "env", "GOROOT")
+	env, err := GoEnvironment("go")
 	if err != nil {
 		return "", err
 	}
 
-	return strings.TrimSpace(output), nil
+	return env.GoRoot, nil
 }
 
 // GoVersion reads the version of `go` that is on the PATH. This is done
 // instead of `runtime.Version()` because it is possible to run gox against
-// another Go version.
+// another Go version. It is read with the rest of GoEnvironment.
 func GoVersion() (string, error) {
+	env, err := GoEnvironment("go")
+	if err != nil {
+		return "", err
+	}
+
+	return env.GoVersion, nil
+}
+
+// goRunVersion reads the version of Go by running a program that prints
+// it, for the versions of Go whose go env doesn't have GOVERSION.
+func goRunVersion(GoCmd string) (string, error) {
 	// NOTE: We use `go run` instead of `go version` because the output
 	// of `go version` might change whereas the source is guaranteed to run
 	// for some time thanks to Go's compatibility guarantee.
@@ -183,40 +916,226 @@ func GoVersion() (string, error) {
 	}
 
 	// Execute and read the version, which will be the only thing on stdout.
-	return execGo("go", nil, "", "run", sourcePath)
+	// The program runs here, so GOOS and GOARCH are cleared in case they
+	// are set to select the platforms to build for.
+	env := append(os.Environ(), "GOOS=", "GOARCH=")
+	return execGo(GoCmd, env, "", "run", sourcePath)
+}
+
+// goVersionRe matches the version number at the start of the versions Go
+// reports, such as go1.21.5, go1.22rc1, go1.21.5 X:nocoverageredesign or
+// devel go1.23-abc123 Tue Jan 2 15:04:05 2024 +0000, and of bare version
+// numbers such as 1.21.
+var goVersionRe = regexp.MustCompile(`^(?:devel )?(?:go)?(\d+(?:\.\d+){0,2})`)
+
+// ParseGoVersion returns the number of the given Go version, as returned by
+// GoVersion. Release candidates, betas and development builds have the
+// number of the release they lead up to, such as 1.22 for go1.22rc1, and
+// whatever follows the number, such as experiments, is ignored. It is an
+// error if there's no number, as for older development builds such as
+// devel +abc123.
+func ParseGoVersion(v string) (*version.Version, error) {
+	match := goVersionRe.FindStringSubmatch(strings.TrimSpace(v))
+	if match == nil {
+		return nil, fmt.Errorf("unknown Go version %q", v)
+	}
+
+	return version.NewVersion(match[1])
+}
+
+// GoVersionAtLeast returns true if the given Go version, as returned by
+// GoVersion, is at least min, such as "1.13". Versions that can't be
+// parsed, such as development builds, are assumed to be new enough.
+func GoVersionAtLeast(v, min string) bool {
+	current, err := ParseGoVersion(v)
+	if err != nil {
+		return true
+	}
+
+	return !current.LessThan(version.Must(version.NewVersion(min)))
 }
 
 // GoVersionParts parses the version numbers from the version itself
 // into major and minor: 1.5, 1.4, etc.
 func GoVersionParts() (result [2]int, err error) {
-	version, err := GoVersion()
+	v, err := GoVersion()
+	if err != nil {
+		return
+	}
+
+	current, err := ParseGoVersion(v)
 	if err != nil {
 		return
 	}
 
-	_, err = fmt.Sscanf(version, "go%d.%d", &result[0], &result[1])
+	segments := current.Segments()
+	result[0], result[1] = segments[0], segments[1]
 	return
 }
 
 func execGo(GoCmd string, env []string, dir string, args ...string) (string, error) {
-	var stderr, stdout bytes.Buffer
+	return execGoContext(context.Background(), GoCmd, env, dir, nil, args...)
+}
+
+// execGoContext runs the go command. If ctx is done before it exits, the
+// command is killed along with the processes it started, since killing
+// go build alone leaves the compilers it runs behind. If onLine is set, it
+// is called with each line the command prints as it runs.
+func execGoContext(ctx context.Context, GoCmd string, env []string, dir string,
+	onLine func(string), args ...string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var stdout bytes.Buffer
+	stderr := &headBuffer{max: maxStderr}
 	cmd := exec.Command(GoCmd, args...)
 	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stderr = stderr
+
+	// The pipes are copied from in goroutines by exec, so the lines are
+	// passed on as they come without the command ever blocking on a full
+	// pipe.
+	if onLine != nil {
+		lines := &lineWriter{fn: onLine}
+		defer lines.Flush()
+		cmd.Stdout = io.MultiWriter(&stdout, lines)
+		cmd.Stderr = io.MultiWriter(stderr, lines)
+	}
 	if env != nil {
 		cmd.Env = env
 	}
 	if dir != "" {
 		cmd.Dir = dir
 	}
-	if err := cmd.Run(); err != nil {
-		err = fmt.Errorf("%s\nStderr: %s", err, stderr.String())
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
 		return "", err
 	}
 
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessTree(cmd)
+		case <-done:
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+
+		return "", &ExecError{Err: err, Stderr: stderr.String()}
+	}
+
 	return stdout.String(), nil
 }
 
+// maxStderr is the most of the stderr of a go command that is kept for its
+// ExecError. The first errors are the ones that matter, and a link that
+// fails can print a lot more than that.
+const maxStderr = 64 << 10
+
+// ExecError is the error of a go command that failed, with everything it
+// printed to stderr, up to maxStderr bytes, past which a note says how
+// much was left out. The output of each build is kept apart this way, so
+// that the output of builds that fail at the same time isn't mixed up.
+type ExecError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *ExecError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s\nStderr: %s", e.Err, e.Stderr)
+}
+
+// headBuffer keeps the first max bytes written to it, and counts the rest,
+// which it drops. It may be written to from multiple goroutines.
+type headBuffer struct {
+	lock    sync.Mutex
+	max     int
+	buf     bytes.Buffer
+	dropped int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	n := len(p)
+	if room := b.max - b.buf.Len(); n > room {
+		b.dropped += n - room
+		p = p[:room]
+	}
+	b.buf.Write(p)
+
+	return n, nil
+}
+
+// String returns what was kept, ending at the last complete line if
+// anything was dropped, followed by a note of how much was.
+func (b *headBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	s := b.buf.String()
+	if b.dropped == 0 {
+		return s
+	}
+
+	dropped := b.dropped
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		dropped += len(s) - (i + 1)
+		s = s[:i+1]
+	}
+
+	return fmt.Sprintf("%s... %d more bytes not shown\n", s, dropped)
+}
+
+// lineWriter calls fn with each line written to it, without the newline.
+// It may be written to from multiple goroutines.
+type lineWriter struct {
+	lock sync.Mutex
+	fn   func(string)
+	buf  []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		w.fn(strings.TrimSuffix(string(w.buf[:idx]), "\r"))
+		w.buf = w.buf[idx+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush calls fn with what is left after the last newline, if anything.
+func (w *lineWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
+
 const versionSource = `package main
 
 import (
@@ -1,8 +1,18 @@
 package gox
 
 import (
+	"context"
+	"debug/pe"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strings"
 	"testing"
+
+	version "github.com/hashicorp/go-version"
 )
 
 func TestGoVersion(t *testing.T) {
@@ -32,3 +42,1265 @@ func TestGoVersion(t *testing.T) {
 		t.Fatalf("bad: %#v", v)
 	}
 }
+
+func TestOutputPath(t *testing.T) {
+	cases := []struct {
+		Opts     CompileOpts
+		Expected string
+	}{
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}_{{.OS}}_{{.Arch}}",
+			},
+			"app_linux_amd64",
+		},
+		{
+			CompileOpts{
+				PackagePath: "/src/app/cmd/server",
+				ImportPath:  "example.com/app/cmd/server",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   `{{replace .ImportPath "/" "_"}}_{{.OS}}`,
+			},
+			"example.com_app_cmd_server_linux",
+		},
+		{
+			CompileOpts{
+				PackagePath: "/src/app/tools/server",
+				ImportPath:  "example.com/app/tools/server",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.ImportPath}}/{{.ImportBase}}",
+			},
+			filepath.Join("example.com", "app", "tools", "server", "server"),
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}{{.ImportBase}}",
+			},
+			"app",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}_{{.OS}}_{{.Arch}}",
+				OutputDir:   "dist",
+			},
+			filepath.Join("dist", "app_linux_amd64"),
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+				OutputTpl:   DefaultOutputTpl,
+				GoVersion:   "go1.22.3",
+			},
+			"app_linux_arm_v6_go1.22.3",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "darwin", Arch: "arm64"},
+				OutputTpl:   "{{.OS}}/{{.Arch}}/{{.Dir}}",
+				OutputDir:   "/tmp/dist",
+			},
+			filepath.Join("/tmp/dist", "darwin", "arm64", "app"),
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "windows", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}_{{.OS}}_{{.Arch}}",
+			},
+			"app_windows_amd64.exe",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "windows", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}.exe",
+			},
+			"app.exe",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "windows", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}{{.Exe}}",
+			},
+			"app.exe",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}{{.Exe}}",
+			},
+			"app",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "js", Arch: "wasm"},
+				OutputTpl:   "{{.Dir}}_{{.OS}}_{{.Arch}}",
+			},
+			"app_js_wasm.wasm",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "js", Arch: "wasm"},
+				OutputTpl:   "{{.Dir}}{{.Exe}}",
+			},
+			"app.wasm",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+				OutputTpl:   "{{.Dir}}_{{.OS}}_{{.Arch}}{{.ArmVersion}}",
+			},
+			"app_linux_armv6",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "arm"},
+				OutputTpl:   "{{.Dir}}_{{.OS}}_{{.Arch}}{{.ArmVersion}}",
+			},
+			"app_linux_arm",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "mipsle", Mips: "softfloat"},
+				OutputTpl:   DefaultOutputTpl,
+			},
+			"app_linux_mipsle_softfloat",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "mipsle"},
+				OutputTpl:   DefaultOutputTpl,
+			},
+			"app_linux_mipsle",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "arm", Arm: "7", Libc: "musl"},
+				OutputTpl:   DefaultOutputTpl,
+			},
+			"app_linux_arm_v7_musl",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64", Amd64: "v3"},
+				OutputTpl:   DefaultOutputTpl,
+			},
+			"app_linux_amd64_v3",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64", Amd64: "v3"},
+				OutputTpl:   "{{.Dir}}-{{.Variant}}",
+			},
+			"app-v3",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   `{{.Dir}}-{{.OS | title}}-{{replace .Arch "amd64" "x86_64"}}`,
+			},
+			"app-Linux-x86_64",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/App",
+				Platform:    Platform{OS: "linux", Arch: "arm"},
+				OutputTpl:   `{{.Dir | lower}}_{{upper .OS}}_{{trimspace " arm "}}`,
+			},
+			"app_LINUX_arm",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}_{{.GitTag}}_{{.GitShortSHA}}_{{.OS}}_{{.Arch}}",
+				Git:         GitInfo{SHA: "abcdef123456", ShortSHA: "abcdef1", Tag: "v1.4.2"},
+			},
+			"app_v1.4.2_abcdef1_linux_amd64",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}{{.GitTag}}",
+			},
+			"app",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "amd64"},
+				OutputTpl:   "lib{{.Dir}}",
+				Buildmode:   "c-shared",
+			},
+			"libapp.so",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "windows", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}{{.Ext}}",
+				Buildmode:   "c-shared",
+			},
+			"app.dll",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "darwin", Arch: "arm64"},
+				OutputTpl:   "{{.Dir}}",
+				Buildmode:   "c-archive",
+			},
+			"app.a",
+		},
+		{
+			CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "windows", Arch: "amd64"},
+				OutputTpl:   "{{.Dir}}",
+				Buildmode:   "pie",
+			},
+			"app.exe",
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := OutputPath(&tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestParseOutputTemplate(t *testing.T) {
+	if _, err := ParseOutputTemplate("{{.Dir | lower}}"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ParseOutputTemplate("{{.Dir | nope}}"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestGoBuildEnv(t *testing.T) {
+	cases := []struct {
+		Opts     CompileOpts
+		Expected []string
+	}{
+		{
+			CompileOpts{Platform: Platform{OS: "js", Arch: "wasm"}},
+			[]string{"GOOS=js", "GOARCH=wasm", "CGO_ENABLED=0"},
+		},
+		{
+			CompileOpts{
+				Platform: Platform{OS: "linux", Arch: "arm", Arm: "7"},
+				Cgo:      true,
+				CC:       "arm-linux-gnueabihf-gcc",
+				CXX:      "arm-linux-gnueabihf-g++",
+			},
+			[]string{
+				"GOOS=linux", "GOARCH=arm", "GOARM=7", "CGO_ENABLED=1",
+				"CC=arm-linux-gnueabihf-gcc", "CXX=arm-linux-gnueabihf-g++",
+			},
+		},
+		{
+			CompileOpts{
+				Platform: Platform{OS: "linux", Arch: "mips64le", Mips: "softfloat"},
+			},
+			[]string{"GOOS=linux", "GOARCH=mips64le", "GOMIPS64=softfloat", "CGO_ENABLED=0"},
+		},
+		{
+			// An explicit CC doesn't need the NDK
+			CompileOpts{
+				Platform: Platform{OS: "android", Arch: "arm64"},
+				Cgo:      true,
+				CC:       "clang",
+			},
+			[]string{"GOOS=android", "GOARCH=arm64", "CGO_ENABLED=1", "CC=clang"},
+		},
+		{
+			// The musl variants always use cgo, with musl-gcc by default
+			CompileOpts{Platform: Platform{OS: "linux", Arch: "amd64", Libc: "musl"}},
+			[]string{"GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=1", "CC=musl-gcc"},
+		},
+		{
+			CompileOpts{
+				Platform: Platform{OS: "linux", Arch: "arm64", Libc: "musl"},
+				CC:       "aarch64-linux-musl-gcc",
+			},
+			[]string{"GOOS=linux", "GOARCH=arm64", "CGO_ENABLED=1", "CC=aarch64-linux-musl-gcc"},
+		},
+	}
+
+	for _, tc := range cases {
+		env, err := goBuildEnv(&tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Only compare what was added to the environment of gox.
+		env = env[len(os.Environ()):]
+		if !reflect.DeepEqual(env, tc.Expected) {
+			t.Fatalf("bad: %#v", env)
+		}
+	}
+}
+
+func TestGoBuildEnv_cgoSet(t *testing.T) {
+	host := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	// Cgo that was explicitly turned off stays off for the host platform
+	opts := &CompileOpts{Platform: host, CgoSet: true}
+	env, err := goBuildEnv(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if env[len(env)-1] != "CGO_ENABLED=0" {
+		t.Fatalf("bad: %#v", env)
+	}
+}
+
+func TestGoCrossCompileContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+		GoCmd:       "go",
+	}
+	err := GoCrossCompileContext(ctx, opts)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestGoBuildArgs(t *testing.T) {
+	cases := []struct {
+		Opts     CompileOpts
+		Expected []string
+	}{
+		{
+			CompileOpts{},
+			[]string{
+				"build",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{Trimpath: true, Rebuild: true},
+			[]string{
+				"build", "-a", "-trimpath",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{BuildVCS: "false", PGO: "/src/default.pgo"},
+			[]string{
+				"build", "-buildvcs=false", "-pgo=/src/default.pgo",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{Gcflags: "-N -l\nexample.com/...=-m", Asmflags: "all=-spectre=all"},
+			[]string{
+				"build",
+				"-gcflags", "-N -l", "-gcflags", "example.com/...=-m",
+				"-ldflags", "-s", "-asmflags", "all=-spectre=all", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{Overlay: "/src/overlay.json", Mod: "vendor"},
+			[]string{
+				"build", "-overlay=/src/overlay.json", "-mod=vendor",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{Mod: "vendor"},
+			[]string{
+				"build", "-mod=vendor",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{InstallSuffix: "netgo"},
+			[]string{
+				"build", "-installsuffix", "netgo",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{Race: true, Tags: "netgo"},
+			[]string{
+				"build", "-race",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "netgo",
+				"-o", "out", "pkg",
+			},
+		},
+		{
+			CompileOpts{Mode: ModeTest, Verbose: true, Tags: "integration"},
+			[]string{
+				"test", "-c",
+				"-gcflags", "", "-ldflags", "-s", "-asmflags", "", "-tags", "integration",
+				"-o", "out", "pkg",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		actual := goBuildArgs(&tc.Opts, "-s", "out", "pkg")
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestParseGoVersion(t *testing.T) {
+	cases := []struct {
+		Version  string
+		Expected string
+		Err      bool
+	}{
+		{"go1", "1", false},
+		{"go1.4.3", "1.4.3", false},
+		{"1.21", "1.21", false},
+		{"go1.21.5", "1.21.5", false},
+		{"go1.21.5\n", "1.21.5", false},
+		{"go1.22rc1", "1.22", false},
+		{"go1.21rc2", "1.21", false},
+		{"go1.20beta1", "1.20", false},
+		{"go1.21.5 X:nocoverageredesign", "1.21.5", false},
+		{"go1.22.0 X:boringcrypto", "1.22.0", false},
+		{"devel go1.23-abc123 Tue Jan 2 15:04:05 2024 +0000", "1.23", false},
+		{"devel +abc123 Tue Jan 2 15:04:05 2024 +0000", "", true},
+		{"weekly.2012-01-27", "", true},
+		{"", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParseGoVersion(tc.Version)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: err: %s", tc.Version, err)
+		}
+		if err != nil {
+			continue
+		}
+		if !actual.Equal(version.Must(version.NewVersion(tc.Expected))) {
+			t.Fatalf("%q: bad: %s", tc.Version, actual)
+		}
+	}
+}
+
+func TestGoVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		Version  string
+		Min      string
+		Expected bool
+	}{
+		{"go1.12.9", "1.13", false},
+		{"go1.13", "1.13", true},
+		{"go1.21.3", "1.13", true},
+		{"devel +abc123", "1.13", true},
+		{"go1.22rc1", "1.22", true},
+		{"go1.22rc1", "1.23", false},
+		{"devel go1.23-abc123 Tue Jan 2 15:04:05 2024 +0000", "1.23", true},
+		{"go1.21.5 X:nocoverageredesign", "1.21", true},
+	}
+
+	for _, tc := range cases {
+		if actual := GoVersionAtLeast(tc.Version, tc.Min); actual != tc.Expected {
+			t.Fatalf("%s: bad: %v", tc.Version, actual)
+		}
+	}
+}
+
+func TestValidModMode(t *testing.T) {
+	for _, mod := range []string{"", "mod", "readonly", "vendor"} {
+		if err := ValidModMode(mod); err != nil {
+			t.Fatalf("%s: err: %s", mod, err)
+		}
+	}
+
+	if err := ValidModMode("Vendor"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestValidBuildVCS(t *testing.T) {
+	for _, v := range []string{"", "true", "false", "auto"} {
+		if err := ValidBuildVCS(v); err != nil {
+			t.Fatalf("%s: err: %s", v, err)
+		}
+	}
+
+	if err := ValidBuildVCS("0"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestNewBuildCommand(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+		OutputTpl:   DefaultOutputTpl,
+		Ldflags:     "-X main.OS={{.OS}}",
+		CgoSet:      true,
+		GoCmd:       "go",
+	}
+	cmd, err := NewBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	output, err := filepath.Abs("app_linux_arm_v6")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cmd.Output != output {
+		t.Fatalf("bad: %#v", cmd)
+	}
+
+	expected := []string{"GOOS=linux", "GOARCH=arm", "GOARM=6", "CGO_ENABLED=0"}
+	if !reflect.DeepEqual(cmd.Env, expected) {
+		t.Fatalf("bad: %#v", cmd.Env)
+	}
+
+	expectedLine := "GOOS=linux GOARCH=arm GOARM=6 CGO_ENABLED=0 go build " +
+		"-gcflags '' -ldflags '-X main.OS=linux' -asmflags '' -tags '' " +
+		"-o " + output + " github.com/foo/app"
+	if cmd.String() != expectedLine {
+		t.Fatalf("bad: %s", cmd.String())
+	}
+
+	opts.Ldflags = "{{.Nope}}"
+	if _, err := NewBuildCommand(opts); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", "''"},
+		{"GOOS=linux", "GOOS=linux"},
+		{"-s -w", "'-s -w'"},
+		{"-X 'main.v=1'", `'-X '\''main.v=1'\'''`},
+		{"$HOME", "'$HOME'"},
+	}
+
+	for _, tc := range cases {
+		if actual := shellQuote(tc.Input); actual != tc.Expected {
+			t.Fatalf("bad: %s", actual)
+		}
+	}
+}
+
+func TestGoCrossCompile_onCommand(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	var called *BuildCommand
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+		GoCmd:       "gox-no-such-go",
+		OnCommand: func(cmd *BuildCommand) {
+			called = cmd
+		},
+	}
+	if err := GoCrossCompile(opts); err == nil {
+		t.Fatal("should err")
+	}
+	if called == nil || called.GoCmd != "gox-no-such-go" || called.Args[0] != "build" {
+		t.Fatalf("bad: %#v", called)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) {
+		lines = append(lines, line)
+	}}
+
+	for _, s := range []string{"crypto/", "tls\nnet\r\nos/", "exec"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	w.Flush()
+
+	expected := []string{"crypto/tls", "net", "os/exec"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("bad: %#v", lines)
+	}
+}
+
+func TestExecGo_error(t *testing.T) {
+	_, err := execGo("go", nil, "", "gox-no-such-command")
+	execErr, ok := err.(*ExecError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !strings.Contains(execErr.Stderr, "gox-no-such-command") {
+		t.Fatalf("bad: %#v", execErr)
+	}
+}
+
+func TestGoGenerateArgs(t *testing.T) {
+	actual := goGenerateArgs([]string{"github.com/foo/app"}, "foo bar", "vendor")
+	expected := []string{"generate", "-mod=vendor", "-tags", "foo bar", "github.com/foo/app"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestStripLdflags(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", "-s -w"},
+		{"-X main.Version=1.0", "-X main.Version=1.0 -s -w"},
+		{"-w -X main.Version=1.0", "-w -X main.Version=1.0 -s"},
+		{"-s -w", "-s -w"},
+	}
+
+	for _, tc := range cases {
+		if actual := stripLdflags(tc.Input); actual != tc.Expected {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+}
+
+func TestWindowsGUILdflags(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", "-H windowsgui"},
+		{"-s -w", "-s -w -H windowsgui"},
+		{"-H windowsgui -s", "-H windowsgui -s"},
+		{"-H=windowsgui", "-H=windowsgui"},
+		{"--H windowsgui", "--H windowsgui"},
+		{"-X main.H=windowsgui", "-X main.H=windowsgui -H windowsgui"},
+		{"-s -H", "-s -H -H windowsgui"},
+	}
+
+	for _, tc := range cases {
+		if actual := windowsGUILdflags(tc.Input); actual != tc.Expected {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+}
+
+func TestNewBuildCommand_windowsGUI(t *testing.T) {
+	key := "GOX_WINDOWS_AMD64_LDFLAGS"
+	defer os.Setenv(key, os.Getenv(key))
+	os.Setenv(key, "-X main.Env=1")
+
+	cases := []struct {
+		Platform Platform
+		Expected string
+	}{
+		// The env override replaces -ldflags before -H windowsgui is added
+		{Platform{OS: "windows", Arch: "amd64"}, "-X main.Env=1 -s -w -H windowsgui"},
+		{Platform{OS: "linux", Arch: "amd64"}, "-X main.OS=linux -s -w"},
+	}
+
+	for _, tc := range cases {
+		opts := &CompileOpts{
+			PackagePath: "github.com/foo/app",
+			Platform:    tc.Platform,
+			OutputTpl:   DefaultOutputTpl,
+			Ldflags:     "-X main.OS={{.OS}}",
+			Strip:       true,
+			WindowsGUI:  true,
+			CgoSet:      true,
+			GoCmd:       "go",
+		}
+		envOverride(&opts.Ldflags, tc.Platform, "LDFLAGS")
+
+		cmd, err := NewBuildCommand(opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var ldflags string
+		for i, arg := range cmd.Args {
+			if arg == "-ldflags" {
+				ldflags = cmd.Args[i+1]
+			}
+		}
+		if ldflags != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Platform.String(), ldflags)
+		}
+	}
+}
+
+func TestNewBuildCommand_strip(t *testing.T) {
+	platform := Platform{OS: "linux", Arch: "amd64"}
+	key := "GOX_LINUX_AMD64_LDFLAGS"
+	defer os.Setenv(key, os.Getenv(key))
+
+	cases := []struct {
+		Ldflags  string
+		Env      string
+		Expected string
+	}{
+		// -ldflags comes first, then -s -w
+		{"-X main.OS={{.OS}}", "", "-X main.OS=linux -s -w"},
+
+		// The env override replaces -ldflags before -s -w is added
+		{"-X main.OS={{.OS}}", "-X main.Env=1 -w", "-X main.Env=1 -w -s"},
+	}
+
+	for _, tc := range cases {
+		os.Setenv(key, tc.Env)
+		opts := &CompileOpts{
+			PackagePath: "github.com/foo/app",
+			Platform:    platform,
+			OutputTpl:   DefaultOutputTpl,
+			Ldflags:     tc.Ldflags,
+			Strip:       true,
+			CgoSet:      true,
+			GoCmd:       "go",
+		}
+		envOverride(&opts.Ldflags, platform, "LDFLAGS")
+
+		cmd, err := NewBuildCommand(opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var ldflags string
+		for i, arg := range cmd.Args {
+			if arg == "-ldflags" {
+				ldflags = cmd.Args[i+1]
+			}
+		}
+		if ldflags != tc.Expected {
+			t.Fatalf("bad: %q", ldflags)
+		}
+	}
+}
+
+func TestGoMainDirs(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	td, err := filepath.EvalSymlinks(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, dir := range []string{"cmd/a", "cmd/b/nested", "lib"} {
+		if err := os.MkdirAll(filepath.Join(td, dir), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	main := "package main\n\nfunc main() {}\n"
+	testWriteFile(t, filepath.Join(td, "go.mod"), "module example.com/app\n")
+	testWriteFile(t, filepath.Join(td, "main.go"), main)
+	testWriteFile(t, filepath.Join(td, "cmd", "a", "main.go"), main)
+	testWriteFile(t, filepath.Join(td, "cmd", "b", "nested", "main.go"), main)
+	testWriteFile(t, filepath.Join(td, "lib", "lib.go"), "package lib\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	root := GoPackage{Path: td, ImportPath: "example.com/app", Name: "main"}
+	a := GoPackage{
+		Path:       filepath.Join(td, "cmd", "a"),
+		ImportPath: "example.com/app/cmd/a",
+		Name:       "main",
+	}
+	nested := GoPackage{
+		Path:       filepath.Join(td, "cmd", "b", "nested"),
+		ImportPath: "example.com/app/cmd/b/nested",
+		Name:       "main",
+	}
+	lib := GoPackage{
+		Path:       filepath.Join(td, "lib"),
+		ImportPath: "example.com/app/lib",
+		Name:       "lib",
+	}
+	cases := []struct {
+		Packages []string
+		Main     []GoPackage
+		Others   []GoPackage
+	}{
+		{[]string{"./..."}, []GoPackage{root, a, nested}, []GoPackage{lib}},
+		{[]string{"./cmd/..."}, []GoPackage{a, nested}, nil},
+		{[]string{".", "./cmd/a"}, []GoPackage{root, a}, nil},
+		{[]string{"./lib", "./cmd/b/..."}, []GoPackage{nested}, []GoPackage{lib}},
+		{[]string{"./cmd/a", "./cmd/..."}, []GoPackage{a, nested}, nil},
+		{[]string{"example.com/app/cmd/a"}, []GoPackage{a}, nil},
+	}
+
+	for _, tc := range cases {
+		mains, others, err := GoMainDirs(tc.Packages, "go", "", nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(mains, tc.Main) {
+			t.Fatalf("bad: %#v %#v", tc.Packages, mains)
+		}
+		if !reflect.DeepEqual(others, tc.Others) {
+			t.Fatalf("bad: %#v %#v", tc.Packages, others)
+		}
+	}
+
+	if _, _, err := GoMainDirs([]string{"./nope"}, "go", "", nil); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestGoModule(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	td, err := filepath.EvalSymlinks(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(td, "app", "sub"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(td, "app", "go.mod"), "module example.com/app\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	cases := []struct {
+		Dir      string
+		Env      []string
+		Expected string
+	}{
+		{filepath.Join(td, "app"), nil, filepath.Join(td, "app", "go.mod")},
+		{filepath.Join(td, "app", "sub"), nil, filepath.Join(td, "app", "go.mod")},
+		{td, nil, ""},
+
+		// The environment given, such as from -env, is the one go runs in.
+		{filepath.Join(td, "app"), append(os.Environ(), "GO111MODULE=off"), ""},
+	}
+
+	for _, tc := range cases {
+		if err := os.Chdir(tc.Dir); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		actual, err := GoModule("go", tc.Env)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("bad: %s %s", tc.Dir, actual)
+		}
+	}
+}
+
+func TestGoMainDirs_module(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	td, err := filepath.EvalSymlinks(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A module with a main package in a subdirectory, and a dependency
+	// outside of it that has a main package too. GOPATH points nowhere,
+	// since module mode doesn't need it.
+	for _, dir := range []string{"app/tools/cmd/gen", "dep/cmd/tool"} {
+		if err := os.MkdirAll(filepath.Join(td, dir), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	main := "package main\n\nfunc main() {}\n"
+	testWriteFile(t, filepath.Join(td, "app", "go.mod"), `module example.com/app
+
+require example.com/dep v0.0.0
+
+replace example.com/dep => ../dep
+`)
+	testWriteFile(t, filepath.Join(td, "app", "tools", "cmd", "gen", "main.go"), main)
+	testWriteFile(t, filepath.Join(td, "dep", "go.mod"), "module example.com/dep\n")
+	testWriteFile(t, filepath.Join(td, "dep", "cmd", "tool", "main.go"), main)
+
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", filepath.Join(td, "nope"))
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join(td, "app", "tools")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	gen := filepath.Join(td, "app", "tools", "cmd", "gen")
+	cases := []struct {
+		Packages []string
+		Expected string
+	}{
+		{[]string{"./cmd/..."}, gen},
+		{[]string{"../..."}, gen},
+		{[]string{"example.com/app/tools/cmd/gen"}, gen},
+		{[]string{"example.com/dep/cmd/tool"}, "example.com/dep/cmd/tool"},
+	}
+
+	for _, tc := range cases {
+		mains, _, err := GoMainDirs(tc.Packages, "go", "", nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(mains) != 1 || mains[0].Path != tc.Expected {
+			t.Fatalf("bad: %#v %#v", tc.Packages, mains)
+		}
+	}
+}
+
+func TestGoTestDirs(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	testWriteFile(t, filepath.Join(td, "go.mod"), "module example.com/app\n")
+	testWriteFile(t, filepath.Join(td, "main.go"), "package main\n\nfunc main() {}\n")
+	if err := os.Mkdir(filepath.Join(td, "lib"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(td, "lib", "lib.go"), "package lib\n")
+	testWriteFile(t, filepath.Join(td, "lib", "lib_test.go"), "package lib_test\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	tested, untested, err := GoTestDirs([]string{"./..."}, "go", "", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(tested, []string{"example.com/app/lib"}) {
+		t.Fatalf("bad: %#v", tested)
+	}
+	if !reflect.DeepEqual(untested, []string{"example.com/app"}) {
+		t.Fatalf("bad: %#v", untested)
+	}
+}
+
+func TestNewBuildCommand_vet(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "windows", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		Ldflags:     "-X main.OS={{.OS}}",
+		Tags:        "netgo",
+		Mod:         "vendor",
+		CgoSet:      true,
+		Mode:        ModeVet,
+		GoCmd:       "go",
+	}
+	cmd, err := NewBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if cmd.Output != "" {
+		t.Fatalf("bad: %#v", cmd)
+	}
+
+	expected := "GOOS=windows GOARCH=amd64 CGO_ENABLED=0 go vet " +
+		"-mod=vendor -tags netgo github.com/foo/app"
+	if cmd.String() != expected {
+		t.Fatalf("bad: %s", cmd.String())
+	}
+}
+
+func TestGoCrossCompile_vet(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	// Vet runs first, and the build doesn't run once it fails.
+	var called [][]string
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+		Vet:         true,
+		GoCmd:       "gox-no-such-go",
+		OnCommand: func(cmd *BuildCommand) {
+			called = append(called, cmd.Args)
+		},
+	}
+	err := GoCrossCompile(opts)
+	if err == nil {
+		t.Fatal("should err")
+	}
+	if !strings.HasPrefix(err.Error(), "go vet failed: ") {
+		t.Fatalf("err: %s", err)
+	}
+	if len(called) != 1 || called[0][0] != "vet" {
+		t.Fatalf("bad: %#v", called)
+	}
+}
+
+func TestGoBuildEnv_goVersion(t *testing.T) {
+	opts := &CompileOpts{
+		Platform:  Platform{OS: "linux", Arch: "amd64"},
+		CgoSet:    true,
+		GoVersion: "go1.22.3",
+	}
+	env, err := goBuildEnvVars(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if env[len(env)-1] != "GOTOOLCHAIN=go1.22.3" {
+		t.Fatalf("bad: %#v", env)
+	}
+}
+
+func TestHeadBuffer(t *testing.T) {
+	b := &headBuffer{max: 16}
+	for _, s := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if n, err := b.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("bad: %d %s", n, err)
+		}
+	}
+
+	// The line that was cut off is dropped whole
+	expected := "first\nsecond\n... 13 more bytes not shown\n"
+	if actual := b.String(); actual != expected {
+		t.Fatalf("bad: %q", actual)
+	}
+
+	b = &headBuffer{max: 16}
+	b.Write([]byte("first\n"))
+	if actual := b.String(); actual != "first\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
+
+func TestGoCrossCompile_stderr(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Source   string
+		Expected string
+	}{
+		{
+			"compile",
+			"package main\n\nfunc main() { x }\n",
+			"undefined: x",
+		},
+		{
+			"link",
+			"package main\n\nimport _ \"unsafe\"\n\n//go:linkname missing main.goxMissing\nfunc missing()\n\nfunc main() { missing() }\n",
+			"main.goxMissing",
+		},
+	}
+
+	for _, tc := range cases {
+		td := testTempDir(t)
+		defer os.RemoveAll(td)
+		testWriteFile(t, filepath.Join(td, "go.mod"), "module app\n")
+		testWriteFile(t, filepath.Join(td, "main.go"), tc.Source)
+
+		err := GoCrossCompile(&CompileOpts{
+			PackagePath: filepath.Join(td, "main.go"),
+			Platform:    Platform{OS: "linux", Arch: "amd64"},
+			OutputTpl:   DefaultOutputTpl,
+			OutputDir:   td,
+			GoCmd:       "go",
+		})
+		execErr, ok := err.(*ExecError)
+		if !ok {
+			t.Fatalf("%s: bad: %#v", tc.Name, err)
+		}
+		if !strings.Contains(execErr.Stderr, tc.Expected) || !strings.Contains(err.Error(), tc.Expected) {
+			t.Fatalf("%s: bad: %s", tc.Name, err)
+		}
+	}
+}
+
+func TestGoCrossCompile_longStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as the go command")
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	// A link that fails with many undefined symbols, more than is kept
+	goCmd := filepath.Join(td, "go")
+	testWriteFile(t, goCmd, `#!/bin/sh
+echo "# app" >&2
+i=0
+while [ $i -lt 4000 ]; do
+	echo "main.main: relocation target main.missing$i not defined" >&2
+	i=$((i+1))
+done
+exit 2
+`)
+	if err := os.Chmod(goCmd, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := GoCrossCompile(&CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+		GoCmd:       goCmd,
+	})
+	execErr, ok := err.(*ExecError)
+	if !ok {
+		t.Fatalf("bad: %#v", err)
+	}
+	if len(execErr.Stderr) > maxStderr+100 {
+		t.Fatalf("bad: %d", len(execErr.Stderr))
+	}
+	if !strings.HasPrefix(execErr.Stderr, "# app\nmain.main: relocation target main.missing0 not defined\n") {
+		t.Fatalf("bad: %s", execErr.Stderr[:100])
+	}
+	if !regexp.MustCompile(`not defined\n\.\.\. \d+ more bytes not shown\n$`).MatchString(execErr.Stderr) {
+		t.Fatalf("bad: %s", execErr.Stderr[len(execErr.Stderr)-100:])
+	}
+}
+
+func TestGoCrossCompile_winRes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("builds the package by its _-prefixed directory")
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	testWriteFile(t, filepath.Join(td, "go.mod"), "module app\n")
+	testWriteFile(t, filepath.Join(td, "main.go"), "package main\n\nfunc main() {}\n")
+
+	vi := &VersionInfo{StringFileInfo: map[string]string{"ProductName": "App"}}
+	opts := &CompileOpts{
+		PackagePath: "_" + td,
+		Platform:    Platform{OS: "windows", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+		GoCmd:       "go",
+		WinRes:      &WinRes{VersionInfo: vi},
+	}
+	if err := GoCrossCompile(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := pe.Open(filepath.Join(td, filepath.Base(td)+"_windows_amd64.exe"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	if f.Section(".rsrc") == nil {
+		t.Fatal("should have resources")
+	}
+
+	// The .syso file is removed after the build
+	if _, err := os.Stat(filepath.Join(td, "gox_winres_windows_amd64.syso")); !os.IsNotExist(err) {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestGoCrossCompile_flagPatterns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("builds the package by its _-prefixed directory")
+	}
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	testWriteFile(t, filepath.Join(td, "go.mod"), "module app\n")
+	testWriteFile(t, filepath.Join(td, "main.go"), `package main
+
+import "fmt"
+
+var version = "unset"
+
+func add(a, b int) int { return a + b }
+
+func main() { fmt.Print(version, add(1, 2)) }
+`)
+
+	// The patterns must reach the compiler and the linker as they are,
+	// as values of their own, with the flags gox adds to the ldflags.
+	var output []string
+	opts := &CompileOpts{
+		PackagePath: "_" + td,
+		Platform:    Platform{OS: runtime.GOOS, Arch: runtime.GOARCH},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+		GoCmd:       "go",
+		Gcflags:     joinFlags("-N -l", "app=-m"),
+		Ldflags:     "all=-X main.version=patterned",
+		Strip:       true,
+		OnOutput:    func(line string) { output = append(output, line) },
+	}
+	if err := GoCrossCompile(opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// -m only prints what the compiler inlines if the value with the
+	// pattern, rather than the one with -l, was used for the package.
+	if !strings.Contains(strings.Join(output, "\n"), "can inline add") {
+		t.Fatalf("bad: %#v", output)
+	}
+
+	out, err := exec.Command(filepath.Join(td, filepath.Base(td)+"_"+runtime.GOOS+"_"+runtime.GOARCH)).Output()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(out) != "patterned3" {
+		t.Fatalf("bad: %q", out)
+	}
+}
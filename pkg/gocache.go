@@ -0,0 +1,74 @@
+package gox
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GoCacheMode is how the builds use the build cache of Go, GOCACHE. It is
+// a flag.Value.
+type GoCacheMode string
+
+const (
+	// GoCacheShared builds every platform with the same cache, the one go
+	// uses by default.
+	GoCacheShared GoCacheMode = "shared"
+
+	// GoCachePerPlatform builds each platform with a cache of its own, in
+	// a directory named after it inside the default cache.
+	GoCachePerPlatform GoCacheMode = "per-platform"
+
+	// goCacheDirPrefix starts the mode that builds every platform with
+	// the cache in the directory that follows it, such as "dir:/cache".
+	goCacheDirPrefix = "dir:"
+)
+
+func (m *GoCacheMode) String() string {
+	return string(*m)
+}
+
+func (m *GoCacheMode) Set(value string) error {
+	mode := GoCacheMode(value)
+	switch {
+	case mode == GoCacheShared, mode == GoCachePerPlatform:
+	case strings.HasPrefix(value, goCacheDirPrefix):
+		if strings.TrimPrefix(value, goCacheDirPrefix) == "" {
+			return fmt.Errorf("invalid gocache mode %q, the directory is missing", value)
+		}
+	default:
+		return fmt.Errorf("invalid gocache mode %q, must be %s, %s or %s<path>",
+			value, GoCacheShared, GoCachePerPlatform, goCacheDirPrefix)
+	}
+
+	*m = mode
+	return nil
+}
+
+// Dir returns the GOCACHE to build the platform with, given the default
+// cache of go, or an empty string to leave GOCACHE alone.
+func (m GoCacheMode) Dir(base string, platform Platform) (string, error) {
+	switch {
+	case m == GoCachePerPlatform:
+		if base == "" || base == "off" {
+			return "", fmt.Errorf("-gocache-mode=%s needs a build cache, but GOCACHE is %q",
+				m, base)
+		}
+		return filepath.Join(base, platform.OS+"_"+platform.Arch), nil
+	case strings.HasPrefix(string(m), goCacheDirPrefix):
+		return filepath.Abs(strings.TrimPrefix(string(m), goCacheDirPrefix))
+	default:
+		return "", nil
+	}
+}
+
+// GoCache returns the build cache go uses by default, as reported by
+// go env GOCACHE.
+func GoCache(GoCmd string) (string, error) {
+	output, err := execGo(GoCmd, nil, "", "env", "GOCACHE")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,65 @@
+package gox
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGoCacheMode(t *testing.T) {
+	abs, err := filepath.Abs("cache")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	platform := Platform{OS: "linux", Arch: "arm", Arm: "7"}
+	cases := []struct {
+		Value    string
+		Base     string
+		Expected string
+		SetErr   bool
+		DirErr   bool
+	}{
+		{"shared", "/cache", "", false, false},
+		{"per-platform", "/cache", filepath.Join("/cache", "linux_arm"), false, false},
+		{"per-platform", "off", "", false, true},
+		{"per-platform", "", "", false, true},
+		{"dir:/ci/cache", "", filepath.Join("/ci/cache"), false, false},
+		{"dir:cache", "", abs, false, false},
+		{"dir:", "", "", true, false},
+		{"private", "", "", true, false},
+	}
+
+	for _, tc := range cases {
+		var mode GoCacheMode
+		err := mode.Set(tc.Value)
+		if (err != nil) != tc.SetErr {
+			t.Fatalf("%s: err: %s", tc.Value, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		actual, err := mode.Dir(tc.Base, platform)
+		if (err != nil) != tc.DirErr {
+			t.Fatalf("%s: err: %s", tc.Value, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %s", tc.Value, actual)
+		}
+	}
+}
+
+func TestGoBuildEnv_goCache(t *testing.T) {
+	opts := &CompileOpts{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		CgoSet:   true,
+		GoCache:  "/cache/linux_amd64",
+	}
+	env, err := goBuildEnvVars(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if env[len(env)-1] != "GOCACHE=/cache/linux_amd64" {
+		t.Fatalf("bad: %#v", env)
+	}
+}
@@ -0,0 +1,113 @@
+package gox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// goBuildValueFlags are the flags gox passes to go build with their value
+// as the next argument.
+var goBuildValueFlags = map[string]bool{
+	"gcflags":       true,
+	"ldflags":       true,
+	"asmflags":      true,
+	"tags":          true,
+	"installsuffix": true,
+	"o":             true,
+}
+
+// goflagName returns the name of the flag arg, such as "ldflags" for
+// -ldflags=-s or --ldflags, or "" if it isn't a flag.
+func goflagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+
+	return name
+}
+
+// GoflagsConflicts returns the flags of goflags, a value of GOFLAGS, that
+// are also in args, the arguments gox passes to the go command. Flags on
+// the command line take precedence over GOFLAGS, so the ones in GOFLAGS
+// are silently dropped, such as -ldflags, which gox always passes.
+func GoflagsConflicts(goflags string, args []string) []string {
+	passed := make(map[string]bool)
+	for i := 0; i < len(args); i++ {
+		name := goflagName(args[i])
+		if name == "" {
+			continue
+		}
+		passed[name] = true
+		if goBuildValueFlags[name] && !strings.Contains(args[i], "=") {
+			i++
+		}
+	}
+
+	var conflicts []string
+	for _, field := range strings.Fields(goflags) {
+		if passed[goflagName(field)] {
+			conflicts = append(conflicts, field)
+		}
+	}
+
+	return conflicts
+}
+
+// buildGoflags returns the value of GOFLAGS that the go command of the
+// build runs with: the last one the build sets, such as with -env or
+// CompileOpts.IgnoreGoflags, or else the one its go command reports,
+// which may come from go env -w.
+func buildGoflags(cmd *BuildCommand) (string, error) {
+	for i := len(cmd.Env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(cmd.Env[i], "GOFLAGS=") {
+			return strings.TrimPrefix(cmd.Env[i], "GOFLAGS="), nil
+		}
+	}
+
+	env, err := GoEnvironment(cmd.GoCmd)
+	if err != nil {
+		return "", err
+	}
+	return env.GoFlags, nil
+}
+
+// CheckGoflags returns the flags of GOFLAGS that conflict with the flags
+// the builds of the configuration pass to go build, as GoflagsConflicts
+// finds them, each with the builds it conflicts with. Builds whose
+// command can't be made are left to fail on their own.
+func CheckGoflags(cfg BuildConfig) ([]string, error) {
+	builds := make(map[string][]string)
+	var fields []string
+	for _, opts := range cfg.builds() {
+		cmd, err := NewBuildCommand(&opts)
+		if err != nil {
+			continue
+		}
+		goflags, err := buildGoflags(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, field := range GoflagsConflicts(goflags, cmd.Args) {
+			name := buildName(&opts)
+			if _, ok := builds[field]; !ok {
+				fields = append(fields, field)
+			}
+			if list := builds[field]; len(list) == 0 || list[len(list)-1] != name {
+				builds[field] = append(list, name)
+			}
+		}
+	}
+
+	conflicts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		conflicts = append(conflicts, fmt.Sprintf("%s (%s)",
+			field, strings.Join(builds[field], ", ")))
+	}
+
+	return conflicts, nil
+}
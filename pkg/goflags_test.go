@@ -0,0 +1,83 @@
+package gox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGoflagsConflicts(t *testing.T) {
+	args := []string{
+		"build", "-trimpath", "-mod=vendor",
+		"-gcflags", "", "-ldflags", "-s -w", "-ldflags", "app=-X=a.b=c",
+		"-tags", "netgo", "-o", "/tmp/out", "app",
+	}
+
+	cases := []struct {
+		Goflags  string
+		Expected []string
+	}{
+		{"", nil},
+		{"-ldflags=-X=a.b=c", []string{"-ldflags=-X=a.b=c"}},
+		{"--ldflags=-s", []string{"--ldflags=-s"}},
+		{"-mod=mod -tags=foo", []string{"-mod=mod", "-tags=foo"}},
+		{"-trimpath=false -buildvcs=false", []string{"-trimpath=false"}},
+		{"-race -v", nil},
+
+		// The values of the flags aren't flags of their own.
+		{"-s -w -X=a.b=c", nil},
+		{"-o=x", []string{"-o=x"}},
+	}
+
+	for _, tc := range cases {
+		actual := GoflagsConflicts(tc.Goflags, args)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", tc.Goflags, actual)
+		}
+	}
+}
+
+func TestCheckGoflags(t *testing.T) {
+	var env EnvFlag
+	for _, v := range []string{
+		"GOFLAGS=-mod=mod",
+		"linux/arm64:GOFLAGS=-ldflags=-s -mod=mod",
+	} {
+		if err := env.Set(v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	cfg := BuildConfig{
+		Packages: []string{"app"},
+		Platforms: []Platform{
+			{OS: "linux", Arch: "amd64"},
+			{OS: "linux", Arch: "arm64"},
+		},
+		Opts: CompileOpts{Mod: "vendor", OutputTpl: "out_{{.OS}}_{{.Arch}}"},
+		Configure: func(opts *CompileOpts) {
+			opts.Env = env.Environ(opts.Platform)
+		},
+	}
+
+	actual, err := CheckGoflags(cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{
+		"-mod=mod (linux/amd64, linux/arm64)",
+		"-ldflags=-s (linux/arm64)",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// With IgnoreGoflags, GOFLAGS is empty whatever else sets it.
+	cfg.Opts.IgnoreGoflags = true
+	actual, err = CheckGoflags(cfg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
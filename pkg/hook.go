@@ -0,0 +1,33 @@
+package gox
+
+import (
+	"context"
+	"os"
+	"runtime"
+)
+
+// RunHook runs the shell command, with sh on Unix and cmd on Windows. The
+// variables in env are set on top of the environment of gox. If onLine is
+// set, it is called with each line the command prints. If ctx is done
+// before the command exits, it is killed.
+func RunHook(ctx context.Context, command string, env []string, onLine func(string)) error {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	_, err := execGoContext(ctx, shell, append(os.Environ(), env...), "", onLine,
+		flag, command)
+	return err
+}
+
+// HookEnv returns the variables that describe the build of the result to
+// a hook: GOX_OUTPUT, GOX_OS, GOX_ARCH and GOX_PACKAGE.
+func HookEnv(r *Result) []string {
+	return []string{
+		"GOX_OUTPUT=" + r.Output,
+		"GOX_OS=" + r.Platform.OS,
+		"GOX_ARCH=" + r.Platform.Arch,
+		"GOX_PACKAGE=" + r.PackagePath,
+	}
+}
@@ -0,0 +1,36 @@
+package gox
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+
+	r := &Result{
+		Platform:    Platform{OS: "linux", Arch: "arm64"},
+		PackagePath: "github.com/foo/app",
+		Output:      "app_linux_arm64",
+	}
+
+	var lines []string
+	err := RunHook(context.Background(), `echo "$GOX_OS/$GOX_ARCH $GOX_OUTPUT"`,
+		HookEnv(r), func(line string) {
+			lines = append(lines, line)
+		})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(lines, []string{"linux/arm64 app_linux_arm64"}) {
+		t.Fatalf("bad: %#v", lines)
+	}
+
+	if err := RunHook(context.Background(), "exit 3", nil, nil); err == nil {
+		t.Fatal("should err")
+	}
+}
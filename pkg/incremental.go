@@ -0,0 +1,88 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SourcesModTime returns the newest modification time of the source files
+// of the given package, as listed by sourceFiles.
+func SourcesModTime(pkg string, GoCmd, mod, tags string, env []string) (time.Time, error) {
+	files, err := sourceFiles(pkg, GoCmd, mod, tags, env)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var newest time.Time
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+
+	return newest, nil
+}
+
+// sourceFiles returns the paths to the Go files of the given package and
+// of the packages it imports that are inside the current directory, the
+// same packages WatchDirs watches. Files that the build constraints leave
+// out on this platform are included, since they may be built for others.
+// go list runs with the environment env, or that of gox if it's nil.
+func sourceFiles(pkg string, GoCmd, mod, tags string, env []string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"list", "-deps"}
+	if mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	args = append(args, "-f", "{{if not .Standard}}{{$dir := .Dir}}"+
+		"{{range .GoFiles}}{{$dir}}|{{.}}\n{{end}}"+
+		"{{range .CgoFiles}}{{$dir}}|{{.}}\n{{end}}"+
+		"{{range .IgnoredGoFiles}}{{$dir}}|{{.}}\n{{end}}{{end}}")
+	args = append(args, pkg)
+
+	output, err := execGo(GoCmd, env, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] != wd && !insideDir(wd, parts[0]) {
+			continue
+		}
+
+		files = append(files, filepath.Join(parts[0], parts[1]))
+	}
+
+	return files, nil
+}
+
+// OutputUpToDate returns true if the output of the build for the given
+// options exists and is newer than sources, the time returned by
+// SourcesModTime for its package.
+func OutputUpToDate(opts *CompileOpts, sources time.Time) bool {
+	output, err := OutputPath(opts)
+	if err != nil {
+		return false
+	}
+
+	fi, err := os.Stat(output)
+	return err == nil && fi.ModTime().After(sources)
+}
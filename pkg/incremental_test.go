@@ -0,0 +1,106 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourcesModTime(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	td, err := filepath.EvalSymlinks(td)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(td, "lib"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	files := map[string]string{
+		"go.mod":           "module example.com/app\n",
+		"main.go":          "package main\n\nimport _ \"example.com/app/lib\"\n\nfunc main() {}\n",
+		"lib/lib.go":       "package lib\n",
+		"lib/lib_plan9.go": "package lib\n",
+		"lib/lib_extra.go": "//go:build extra\n\npackage lib\n",
+		"lib/lib_test.go":  "package lib\n",
+		"unused/unused.go": "package unused\n",
+		"lib/notes.txt":    "",
+	}
+	if err := os.Mkdir(filepath.Join(td, "unused"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for name, data := range files {
+		path := filepath.Join(td, filepath.FromSlash(name))
+		testWriteFile(t, path, data)
+		if err := os.Chtimes(path, base, base); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(td); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the Go files the package builds from, on any platform, count.
+	cases := []struct {
+		File    string
+		Changed bool
+	}{
+		{"main.go", true},
+		{"lib/lib.go", true},
+		{"lib/lib_plan9.go", true},
+		{"lib/lib_extra.go", true},
+		{"lib/lib_test.go", false},
+		{"lib/notes.txt", false},
+		{"unused/unused.go", false},
+	}
+
+	for i, tc := range cases {
+		mtime := base.Add(time.Duration(i+1) * time.Minute)
+		if err := os.Chtimes(filepath.Join(td, filepath.FromSlash(tc.File)), mtime, mtime); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		actual, err := SourcesModTime(".", "go", "", "", nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual.Equal(mtime) != tc.Changed {
+			t.Fatalf("%s: bad: %s", tc.File, actual)
+		}
+	}
+}
+
+func TestOutputUpToDate(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+	}
+	sources := time.Now().Add(-time.Hour)
+	if OutputUpToDate(opts, sources) {
+		t.Fatal("missing output should not be up to date")
+	}
+
+	output := filepath.Join(td, "app_linux_amd64")
+	testWriteFile(t, output, "")
+	if !OutputUpToDate(opts, sources) {
+		t.Fatal("should be up to date")
+	}
+
+	if OutputUpToDate(opts, time.Now().Add(time.Hour)) {
+		t.Fatal("should not be up to date")
+	}
+}
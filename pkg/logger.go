@@ -0,0 +1,110 @@
+package gox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// LogLevel is how much a message of gox matters. A logger only lets the
+// messages of its level and above through. It is a flag.Value.
+type LogLevel int
+
+const (
+	// LogDebug is for the details of what gox does, such as the go
+	// commands it runs and the variables that override the flags of a
+	// platform.
+	LogDebug LogLevel = iota
+
+	// LogInfo is for the usual output, such as the builds as they start.
+	LogInfo
+
+	// LogWarn is for what may not be what was meant but doesn't fail the
+	// run, such as platforms that are skipped.
+	LogWarn
+
+	// LogError is for what fails the run.
+	LogError
+)
+
+// logLevelNames are the names of the levels, as -log-level takes them.
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l *LogLevel) String() string {
+	if *l < LogDebug || *l > LogError {
+		return fmt.Sprintf("LogLevel(%d)", int(*l))
+	}
+
+	return logLevelNames[*l]
+}
+
+func (l *LogLevel) Set(value string) error {
+	for i, name := range logLevelNames {
+		if value == name {
+			*l = LogLevel(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid log level %q, must be one of %s",
+		value, strings.Join(logLevelNames, ", "))
+}
+
+// Logger is where gox sends its messages. Set one as CompileOpts.Logger to
+// get the messages of the builds, such as to send them to the logger of
+// your own program.
+type Logger interface {
+	// Log logs the message, which has no newline at the end but may have
+	// more than one line, at the given level.
+	Log(level LogLevel, msg string)
+}
+
+// logAt logs a message to l, which may be nil to log nothing.
+func logAt(l Logger, level LogLevel, format string, args ...interface{}) {
+	if l != nil {
+		l.Log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// ConsoleLogger is the Logger of the gox command. Debug and info messages
+// go to Out, and warnings and errors to Err, with "Warning: " and
+// "Debug: " in front of warnings and debug messages. Messages below Level
+// are dropped, except errors, which always go to Err. It is safe to use
+// from multiple goroutines at once.
+type ConsoleLogger struct {
+	Out   io.Writer
+	Err   io.Writer
+	Level LogLevel
+
+	// Printf, if set, writes the messages instead of fmt.Fprintf, such as
+	// to keep them from getting mixed up with a progress line.
+	Printf func(w io.Writer, format string, args ...interface{})
+
+	lock sync.Mutex
+}
+
+func (l *ConsoleLogger) Log(level LogLevel, msg string) {
+	if level < l.Level && level < LogError {
+		return
+	}
+
+	w := l.Out
+	switch level {
+	case LogDebug:
+		msg = "Debug: " + msg
+	case LogWarn:
+		w = l.Err
+		msg = "Warning: " + msg
+	case LogError:
+		w = l.Err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.Printf != nil {
+		l.Printf(w, "%s\n", msg)
+		return
+	}
+	fmt.Fprintf(w, "%s\n", msg)
+}
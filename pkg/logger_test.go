@@ -0,0 +1,87 @@
+package gox
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+)
+
+func TestLogLevel_flag(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected LogLevel
+		Err      bool
+	}{
+		{"debug", LogDebug, false},
+		{"info", LogInfo, false},
+		{"warn", LogWarn, false},
+		{"error", LogError, false},
+		{"", LogInfo, true},
+		{"warning", LogInfo, true},
+	}
+
+	for _, tc := range cases {
+		level := LogInfo
+		var v flag.Value = &level
+		err := v.Set(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if level != tc.Expected {
+			t.Fatalf("%s: bad: %s", tc.Input, v)
+		}
+		if !tc.Err && v.String() != tc.Input {
+			t.Fatalf("%s: bad: %s", tc.Input, v)
+		}
+	}
+}
+
+func TestConsoleLogger(t *testing.T) {
+	cases := []struct {
+		Level LogLevel
+		Out   string
+		Err   string
+	}{
+		{
+			LogDebug,
+			"Debug: d\ni\n",
+			"Warning: w\ne\n",
+		},
+		{
+			LogInfo,
+			"i\n",
+			"Warning: w\ne\n",
+		},
+		{
+			LogWarn,
+			"",
+			"Warning: w\ne\n",
+		},
+		{
+			// Errors are always logged
+			LogError + 1,
+			"",
+			"e\n",
+		},
+	}
+
+	for _, tc := range cases {
+		var out, errOut bytes.Buffer
+		var l Logger = &ConsoleLogger{Out: &out, Err: &errOut, Level: tc.Level}
+		l.Log(LogDebug, "d")
+		l.Log(LogInfo, "i")
+		l.Log(LogWarn, "w")
+		l.Log(LogError, "e")
+		if out.String() != tc.Out {
+			t.Fatalf("%s: bad: %q", &tc.Level, out.String())
+		}
+		if errOut.String() != tc.Err {
+			t.Fatalf("%s: bad: %q", &tc.Level, errOut.String())
+		}
+	}
+}
+
+func TestLogAt_nil(t *testing.T) {
+	// A nil logger logs nothing
+	logAt(nil, LogError, "%s", "e")
+}
@@ -1,19 +1,69 @@
 package gox
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 )
 
-func mainListOSArch(version string) int {
-	fmt.Printf(
-		"Supported OS/Arch combinations for %s are shown below. The \"default\"\n"+
-			"boolean means that if you don't specify an OS/Arch, it will be\n"+
-			"included by default. If it isn't a default OS/Arch, you must explicitly\n"+
-			"specify that OS/Arch combo for Gox to use it.\n\n",
-		version)
-	for _, p := range SupportedPlatforms(version) {
-		fmt.Printf("%s\t(default: %v)\n", p.String(), p.Default)
+// osArchListEntry is a platform in the JSON output of -osarch-list.
+type osArchListEntry struct {
+	OS           string `json:"os"`
+	Arch         string `json:"arch"`
+	Variant      string `json:"variant,omitempty"`
+	Default      bool   `json:"default"`
+	Primary      bool   `json:"primary"`
+	MinGoVersion string `json:"min_go_version"`
+}
+
+// mainListOSArch lists the supported platforms, for the given version of
+// Go, in the given format, "text" for humans or "json" for tools.
+func mainListOSArch(supported []Platform, version, format string) int {
+	if err := writeOSArchList(os.Stdout, supported, version, format); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
 	}
 
 	return 0
 }
+
+func writeOSArchList(w io.Writer, supported []Platform, version, format string) error {
+	var platforms []Platform
+	for _, p := range supported {
+		platforms = append(platforms, p)
+		platforms = append(platforms, p.Variants()...)
+	}
+
+	switch format {
+	case "text":
+		fmt.Fprintf(w,
+			"Supported OS/Arch combinations for %s are shown below. The \"default\"\n"+
+				"boolean means that if you don't specify an OS/Arch, it will be\n"+
+				"included by default. If it isn't a default OS/Arch, you must explicitly\n"+
+				"specify that OS/Arch combo for Gox to use it.\n\n",
+			version)
+		for _, p := range platforms {
+			fmt.Fprintf(w, "%s\t(default: %v)\n", p.String(), p.Default)
+		}
+		return nil
+	case "json":
+		entries := make([]osArchListEntry, 0, len(platforms))
+		for _, p := range platforms {
+			entries = append(entries, osArchListEntry{
+				OS:           p.OS,
+				Arch:         p.Arch,
+				Variant:      p.Variant(),
+				Default:      p.Default,
+				Primary:      p.Primary,
+				MinGoVersion: MinGoVersion(p),
+			})
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	default:
+		return fmt.Errorf("unknown -osarch-list format %q", format)
+	}
+}
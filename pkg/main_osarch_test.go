@@ -0,0 +1,50 @@
+package gox
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteOSArchList(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeOSArchList(&buf, Platforms_1_21, "go1.21.0", "text"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(buf.String(), "\nlinux/amd64\t(default: true)\n") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeOSArchList(&buf, Platforms_1_21, "go1.21.0", "json"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var entries []osArchListEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	found := make(map[string]osArchListEntry)
+	for _, e := range entries {
+		name := e.OS + "/" + e.Arch
+		if e.Variant != "" {
+			name += "/" + e.Variant
+		}
+		found[name] = e
+	}
+	expected := map[string]osArchListEntry{
+		"linux/amd64":    {OS: "linux", Arch: "amd64", Default: true, Primary: true, MinGoVersion: "1.0"},
+		"linux/amd64/v3": {OS: "linux", Arch: "amd64", Variant: "v3", Primary: true, MinGoVersion: "1.18"},
+		"js/wasm":        {OS: "js", Arch: "wasm", MinGoVersion: "1.11"},
+	}
+	for name, e := range expected {
+		if found[name] != e {
+			t.Fatalf("%s: bad: %#v", name, found[name])
+		}
+	}
+
+	if err := writeOSArchList(&buf, Platforms_1_21, "go1.21.0", "xml"); err == nil {
+		t.Fatal("should err")
+	}
+}
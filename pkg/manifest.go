@@ -0,0 +1,154 @@
+package gox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Manifest describes every build of a run, for tools that package the
+// outputs.
+type Manifest struct {
+	Builds []ManifestEntry `json:"builds"`
+}
+
+// ManifestEntry describes the build of a package for a platform. Output,
+// SHA256 and Size are only set if the build succeeded, and Error only if
+// it failed. Toolchain is only set if the build switched to another
+// version of Go, which is its GoVersion then.
+type ManifestEntry struct {
+	Package   string `json:"package"`
+	OS        string `json:"goos"`
+	Arch      string `json:"goarch"`
+	Variant   string `json:"variant,omitempty"`
+	Libc      string `json:"libc,omitempty"`
+	Output    string `json:"output,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	GoVersion string `json:"go_version"`
+	Toolchain string `json:"toolchain,omitempty"`
+	Ldflags   string `json:"ldflags,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewManifest returns the manifest of the given results of Build, with an
+// entry for each as NewManifestEntry makes it.
+func NewManifest(results []Result, goVersion func(GoCmd string) string) (*Manifest, error) {
+	m := &Manifest{Builds: make([]ManifestEntry, 0, len(results))}
+	for i := range results {
+		entry, err := NewManifestEntry(&results[i], goVersion)
+		if err != nil {
+			return nil, err
+		}
+		m.Builds = append(m.Builds, entry)
+	}
+
+	return m, nil
+}
+
+// NewManifestEntry returns the entry of the manifest for the result of a
+// build. The version of Go of the build is the one goVersion returns for
+// its go command. The output of a successful build is read to hash it, so
+// it must still exist.
+func NewManifestEntry(r *Result, goVersion func(GoCmd string) string) (ManifestEntry, error) {
+	var goCmd string
+	if r.Opts != nil {
+		goCmd = r.Opts.GoCmd
+	}
+	entry := ManifestEntry{
+		Package:   r.PackagePath,
+		OS:        r.Platform.OS,
+		Arch:      r.Platform.Arch,
+		Variant:   r.Platform.Variant(),
+		Libc:      r.Platform.Libc,
+		GoVersion: goVersion(goCmd),
+	}
+	if r.GoVersion != "" {
+		entry.GoVersion = r.GoVersion
+		entry.Toolchain = r.GoVersion
+	}
+	if r.Opts != nil {
+		ldflags, err := buildLdflags(r.Opts)
+		if err != nil {
+			return entry, err
+		}
+		entry.Ldflags = ldflags
+	}
+
+	if r.Err != nil {
+		entry.Error = r.Err.Error()
+		return entry, nil
+	}
+
+	sum, err := sha256File(r.Output)
+	if err != nil {
+		return entry, err
+	}
+	fi, err := os.Stat(r.Output)
+	if err != nil {
+		return entry, err
+	}
+	entry.Output = r.Output
+	entry.SHA256 = sum
+	entry.Size = fi.Size()
+
+	return entry, nil
+}
+
+// Write writes the manifest to path as indented JSON.
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadManifest reads the manifest at path, as written by Write.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %s", path, err)
+	}
+
+	return &m, nil
+}
+
+// Merge merges the builds of an earlier manifest into m, for a run that
+// only built some of them again. The builds of prev that m has too are
+// replaced by those of m in their place, and the builds only m has come
+// after them.
+func (m *Manifest) Merge(prev *Manifest) {
+	key := func(e ManifestEntry) string {
+		return e.Package + " " + e.OS + "/" + e.Arch + "/" + e.Variant + "@" + e.Libc + " " + e.Toolchain
+	}
+
+	current := make(map[string]int, len(m.Builds))
+	for i, entry := range m.Builds {
+		current[key(entry)] = i
+	}
+
+	builds := make([]ManifestEntry, 0, len(prev.Builds)+len(m.Builds))
+	merged := make(map[int]bool)
+	for _, entry := range prev.Builds {
+		if i, ok := current[key(entry)]; ok {
+			entry = m.Builds[i]
+			merged[i] = true
+		}
+		builds = append(builds, entry)
+	}
+	for i, entry := range m.Builds {
+		if !merged[i] {
+			builds = append(builds, entry)
+		}
+	}
+
+	m.Builds = builds
+}
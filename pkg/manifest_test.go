@@ -0,0 +1,133 @@
+package gox
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewManifest(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "foo_linux_arm_v6")
+	testWriteFile(t, output, "hello")
+
+	results := []Result{
+		{
+			Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+			PackagePath: "github.com/foo/app",
+			Output:      output,
+			Opts: &CompileOpts{
+				PackagePath: "github.com/foo/app",
+				Platform:    Platform{OS: "linux", Arch: "arm", Arm: "6"},
+				Ldflags:     "-X main.OS={{.OS}}",
+				Strip:       true,
+			},
+		},
+		{
+			Platform:    Platform{OS: "windows", Arch: "amd64"},
+			PackagePath: "github.com/foo/app",
+			Err:         errors.New("exit status 2"),
+		},
+	}
+
+	m, err := NewManifest(results, func(string) string { return "1.21.0" })
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []ManifestEntry{
+		{
+			Package:   "github.com/foo/app",
+			OS:        "linux",
+			Arch:      "arm",
+			Variant:   "v6",
+			Output:    output,
+			SHA256:    "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			Size:      5,
+			GoVersion: "1.21.0",
+			Ldflags:   "-X main.OS=linux -s -w",
+		},
+		{
+			Package:   "github.com/foo/app",
+			OS:        "windows",
+			Arch:      "amd64",
+			GoVersion: "1.21.0",
+			Error:     "exit status 2",
+		},
+	}
+	if !reflect.DeepEqual(m.Builds, expected) {
+		t.Fatalf("bad: %#v", m.Builds)
+	}
+
+	path := filepath.Join(td, "gox-manifest.json")
+	if err := m.Write(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var actual Manifest
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual.Builds, expected) {
+		t.Fatalf("bad: %#v", actual.Builds)
+	}
+}
+
+func TestManifest_Merge(t *testing.T) {
+	prev := &Manifest{Builds: []ManifestEntry{
+		{Package: "app", OS: "linux", Arch: "amd64", Output: "app_linux_amd64"},
+		{Package: "app", OS: "linux", Arch: "arm", Variant: "v6", Error: "exit status 2"},
+		{Package: "app", OS: "windows", Arch: "amd64", Error: "exit status 2"},
+		{Package: "app", OS: "windows", Arch: "amd64", Toolchain: "go1.22.3", Error: "exit status 2"},
+	}}
+	m := &Manifest{Builds: []ManifestEntry{
+		{Package: "app", OS: "darwin", Arch: "arm64", Output: "app_darwin_arm64"},
+		{Package: "app", OS: "windows", Arch: "amd64", Output: "app_windows_amd64.exe"},
+	}}
+	m.Merge(prev)
+
+	expected := []ManifestEntry{
+		{Package: "app", OS: "linux", Arch: "amd64", Output: "app_linux_amd64"},
+		{Package: "app", OS: "linux", Arch: "arm", Variant: "v6", Error: "exit status 2"},
+		{Package: "app", OS: "windows", Arch: "amd64", Output: "app_windows_amd64.exe"},
+		{Package: "app", OS: "windows", Arch: "amd64", Toolchain: "go1.22.3", Error: "exit status 2"},
+		{Package: "app", OS: "darwin", Arch: "arm64", Output: "app_darwin_arm64"},
+	}
+	if !reflect.DeepEqual(m.Builds, expected) {
+		t.Fatalf("bad: %#v", m.Builds)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	m := &Manifest{Builds: []ManifestEntry{
+		{Package: "app", OS: "linux", Arch: "amd64", GoVersion: "1.21.0"},
+	}}
+	path := filepath.Join(td, "gox-manifest.json")
+	if err := m.Write(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	actual, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual, m) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	testWriteFile(t, path, "{nope")
+	if _, err := ReadManifest(path); err == nil {
+		t.Fatal("should err")
+	}
+}
@@ -0,0 +1,93 @@
+package gox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// DefaultAndroidAPI is the Android API level that the NDK compilers
+// target if no other level is given.
+const DefaultAndroidAPI = 21
+
+// androidTargets are the target triples that the NDK clang compilers are
+// named with for each Android arch.
+var androidTargets = map[string]string{
+	"386":   "i686-linux-android",
+	"amd64": "x86_64-linux-android",
+	"arm":   "armv7a-linux-androideabi",
+	"arm64": "aarch64-linux-android",
+}
+
+// mobileEnv checks that the toolchain needed to build for Android or iOS
+// is available, and returns the environment to build with. Without these
+// checks a missing toolchain shows up as a wall of linker errors. Other
+// platforms need nothing and get no environment.
+func mobileEnv(p Platform, cgo bool, androidAPI int) ([]string, error) {
+	switch p.OS {
+	case "android":
+		if !cgo {
+			return nil, nil
+		}
+
+		return androidNDKEnv(p, os.Getenv("ANDROID_NDK_HOME"), androidAPI)
+	case "ios":
+		return nil, checkXcode()
+	default:
+		return nil, nil
+	}
+}
+
+// androidNDKEnv returns CC and CXX set to the clang compilers of the NDK
+// at ndk for the arch and API level of the platform.
+func androidNDKEnv(p Platform, ndk string, api int) ([]string, error) {
+	if ndk == "" {
+		return nil, fmt.Errorf(
+			"ANDROID_NDK_HOME must be set to the path of the Android NDK " +
+				"to build for Android with cgo")
+	}
+
+	target, ok := androidTargets[p.Arch]
+	if !ok {
+		return nil, fmt.Errorf("the Android NDK has no compiler for %s", p.Arch)
+	}
+
+	// The NDK only ships x86_64 host binaries, which also run on arm64
+	// Macs through Rosetta.
+	bin := filepath.Join(ndk, "toolchains", "llvm", "prebuilt",
+		runtime.GOOS+"-x86_64", "bin")
+	cc := filepath.Join(bin, fmt.Sprintf("%s%d-clang", target, api))
+	cxx := cc + "++"
+	if runtime.GOOS == "windows" {
+		cc += ".cmd"
+		cxx += ".cmd"
+	}
+
+	if _, err := os.Stat(cc); err != nil {
+		return nil, fmt.Errorf(
+			"no clang for Android API level %d found in the NDK at %s. "+
+				"Check ANDROID_NDK_HOME, or set -android-api to a level "+
+				"the NDK supports", api, ndk)
+	}
+
+	return []string{"CC=" + cc, "CXX=" + cxx}, nil
+}
+
+// checkXcode checks that Xcode and the iOS SDK are installed, which
+// only works on macOS.
+func checkXcode() error {
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("building for iOS requires macOS with Xcode installed")
+	}
+
+	cmd := exec.Command("xcrun", "--sdk", "iphoneos", "--show-sdk-path")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf(
+			"building for iOS requires Xcode with the iOS SDK, "+
+				"install it or run xcode-select: %s\n%s", err, output)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMobileEnv(t *testing.T) {
+	env, err := mobileEnv(Platform{OS: "linux", Arch: "arm64"}, true, 21)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(env) > 0 {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	// Android without cgo needs no NDK
+	env, err = mobileEnv(Platform{OS: "android", Arch: "arm64"}, false, 21)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(env) > 0 {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	if runtime.GOOS != "darwin" {
+		_, err = mobileEnv(Platform{OS: "ios", Arch: "arm64"}, true, 21)
+		if err == nil || !strings.Contains(err.Error(), "macOS") {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+}
+
+func TestAndroidNDKEnv(t *testing.T) {
+	p := Platform{OS: "android", Arch: "arm64"}
+
+	if _, err := androidNDKEnv(p, "", 21); err == nil {
+		t.Fatal("should err")
+	}
+
+	ndk := testTempDir(t)
+	defer os.RemoveAll(ndk)
+
+	if _, err := androidNDKEnv(p, ndk, 21); err == nil {
+		t.Fatal("should err")
+	}
+
+	cc := filepath.Join(ndk, "toolchains", "llvm", "prebuilt",
+		runtime.GOOS+"-x86_64", "bin", "aarch64-linux-android24-clang")
+	if runtime.GOOS == "windows" {
+		cc += ".cmd"
+	}
+	if err := os.MkdirAll(filepath.Dir(cc), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, cc, "")
+
+	if _, err := androidNDKEnv(p, ndk, 21); err == nil {
+		t.Fatal("should err")
+	}
+
+	env, err := androidNDKEnv(p, ndk, 24)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(env) != 2 || env[0] != "CC="+cc || !strings.HasPrefix(env[1], "CXX=") {
+		t.Fatalf("bad: %#v", env)
+	}
+}
@@ -0,0 +1,58 @@
+package gox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// osxcrossCompilers are the names of the osxcross clang wrappers for each
+// darwin arch. The C++ compilers have "++" appended.
+var osxcrossCompilers = map[string]string{
+	"386":   "o32-clang",
+	"amd64": "o64-clang",
+	"arm64": "oa64-clang",
+}
+
+// FindOsxcross returns the directory that holds the osxcross compilers,
+// which are needed to build for darwin with cgo from other operating
+// systems. The "target/bin" directory of root is used if root is set,
+// usually from OSXCROSS_ROOT, otherwise the compilers are looked for on
+// the PATH. An empty string is returned if osxcross can't be found.
+func FindOsxcross(root string) string {
+	if root != "" {
+		dir := filepath.Join(root, "target", "bin")
+		for _, name := range osxcrossCompilers {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return dir
+			}
+		}
+
+		return ""
+	}
+
+	for _, name := range osxcrossCompilers {
+		if path, err := exec.LookPath(name); err == nil {
+			return filepath.Dir(path)
+		}
+	}
+
+	return ""
+}
+
+// osxcrossCC returns the C and C++ compilers in the osxcross directory dir
+// for the given platform. The returned bool is false if osxcross has no
+// compiler for it.
+func osxcrossCC(dir string, p Platform) (string, string, bool) {
+	name, ok := osxcrossCompilers[p.Arch]
+	if !ok || p.OS != "darwin" || dir == "" {
+		return "", "", false
+	}
+
+	cc := filepath.Join(dir, name)
+	if _, err := os.Stat(cc); err != nil {
+		return "", "", false
+	}
+
+	return cc, cc + "++", true
+}
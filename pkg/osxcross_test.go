@@ -0,0 +1,55 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindOsxcross(t *testing.T) {
+	root := testTempDir(t)
+	defer os.RemoveAll(root)
+
+	if dir := FindOsxcross(root); dir != "" {
+		t.Fatalf("bad: %s", dir)
+	}
+
+	bin := filepath.Join(root, "target", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testWriteFile(t, filepath.Join(bin, "o64-clang"), "")
+
+	if dir := FindOsxcross(root); dir != bin {
+		t.Fatalf("bad: %s", dir)
+	}
+}
+
+func TestOsxcrossCC(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	testWriteFile(t, filepath.Join(dir, "o64-clang"), "")
+
+	cc, cxx, ok := osxcrossCC(dir, Platform{OS: "darwin", Arch: "amd64"})
+	if !ok {
+		t.Fatal("should be ok")
+	}
+	if cc != filepath.Join(dir, "o64-clang") || cxx != cc+"++" {
+		t.Fatalf("bad: %s %s", cc, cxx)
+	}
+
+	// No compiler for the arch
+	if _, _, ok := osxcrossCC(dir, Platform{OS: "darwin", Arch: "arm64"}); ok {
+		t.Fatal("should not be ok")
+	}
+
+	// Not darwin
+	if _, _, ok := osxcrossCC(dir, Platform{OS: "linux", Arch: "amd64"}); ok {
+		t.Fatal("should not be ok")
+	}
+
+	// Not found
+	if _, _, ok := osxcrossCC("", Platform{OS: "darwin", Arch: "amd64"}); ok {
+		t.Fatal("should not be ok")
+	}
+}
@@ -0,0 +1,86 @@
+package gox
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Overlay is the JSON file that go build takes with -overlay, which
+// replaces the files in Replace with the files they map to, or removes
+// them if they map to an empty path. Relative paths are relative to the
+// current directory.
+type Overlay struct {
+	Replace map[string]string
+}
+
+// ReadOverlay reads the overlay file at path, and checks that the files it
+// replaces others with exist.
+func ReadOverlay(path string) (*Overlay, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var o Overlay
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return nil, fmt.Errorf("invalid overlay %s: %s", path, err)
+	}
+
+	for _, from := range o.files() {
+		to := o.Replace[from]
+		if to == "" {
+			continue
+		}
+		fi, err := os.Stat(to)
+		if err == nil && fi.IsDir() {
+			err = fmt.Errorf("%s is a directory", to)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: replacement of %s: %s", path, from, err)
+		}
+	}
+
+	return &o, nil
+}
+
+// files returns the files that the overlay replaces, sorted.
+func (o *Overlay) files() []string {
+	files := make([]string, 0, len(o.Replace))
+	for from := range o.Replace {
+		files = append(files, from)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// overlayHash returns a hash of the overlay file at path and of the
+// contents of the files it replaces others with, which change the build
+// as much as the sources do.
+func overlayHash(path string) (string, error) {
+	o, err := ReadOverlay(path)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, from := range o.files() {
+		sum := ""
+		if to := o.Replace[from]; to != "" {
+			if sum, err = sha256File(to); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(h, "%s %s\n", sum, from)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
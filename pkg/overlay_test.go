@@ -0,0 +1,62 @@
+package gox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOverlay(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	gen := filepath.Join(td, "gen.go")
+	testWriteFile(t, gen, "package main")
+
+	cases := []struct {
+		Content string
+		Err     bool
+	}{
+		{`{"Replace": {"main_gen.go": "` + filepath.ToSlash(gen) + `"}}`, false},
+		{`{"Replace": {"old.go": ""}}`, false},
+		{`{"Replace": {"main_gen.go": "` + filepath.ToSlash(filepath.Join(td, "nope.go")) + `"}}`, true},
+		{`{"Replace": {"main_gen.go": "` + filepath.ToSlash(td) + `"}}`, true},
+		{`{"Replace": ["main_gen.go"]}`, true},
+		{`{"Files": {}}`, true},
+		{`not json`, true},
+	}
+
+	path := filepath.Join(td, "overlay.json")
+	for _, tc := range cases {
+		testWriteFile(t, path, tc.Content)
+		_, err := ReadOverlay(path)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Content, err)
+		}
+	}
+}
+
+func TestOverlayHash(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	gen := filepath.Join(td, "gen.go")
+	testWriteFile(t, gen, "package main")
+	path := filepath.Join(td, "overlay.json")
+	testWriteFile(t, path, `{"Replace": {"main_gen.go": "`+filepath.ToSlash(gen)+`"}}`)
+
+	before, err := overlayHash(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The overlay is the same but what it replaces the file with isn't.
+	testWriteFile(t, gen, "package main // changed")
+	after, err := overlayHash(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if after == before {
+		t.Fatalf("bad: %s", after)
+	}
+}
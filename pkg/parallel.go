@@ -0,0 +1,83 @@
+package gox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParallelAuto is the value of the -parallel flag that picks the number of
+// builds to run at once from the number of CPUs.
+const ParallelAuto = "auto"
+
+// ParallelValue is the value of the -parallel flag, which is a number of
+// builds, ParallelAuto, or a percentage of the CPUs such as "50%". Zero and
+// one both build serially, and negative numbers are the same as
+// ParallelAuto. It is a flag.Value.
+type ParallelValue string
+
+func (v *ParallelValue) String() string {
+	return string(*v)
+}
+
+func (v *ParallelValue) Set(value string) error {
+	if _, err := ParallelValue(value).Parallel(1, ""); err != nil {
+		return err
+	}
+
+	*v = ParallelValue(value)
+	return nil
+}
+
+// Parallel returns the number of builds to run at once for the value, on a
+// machine with the given number of CPUs that runs goos. It is always at
+// least one.
+func (v ParallelValue) Parallel(cpus int, goos string) (int, error) {
+	s := string(v)
+	if s == "" || s == ParallelAuto {
+		return parallelAuto(cpus, goos), nil
+	}
+
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || percent <= 0 {
+			return 0, fmt.Errorf("invalid parallel percentage %q", s)
+		}
+
+		n := cpus * percent / 100
+		if n < 1 {
+			n = 1
+		}
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid parallel value %q, must be a number, %s or a percentage",
+			s, ParallelAuto)
+	}
+	if n < 0 {
+		return parallelAuto(cpus, goos), nil
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	return n, nil
+}
+
+// parallelAuto returns the number of builds to run at once by default,
+// which leaves a CPU free for everything else.
+func parallelAuto(cpus int, goos string) int {
+	// Joyent containers report 48 cores via runtime.NumCPU(), and a
+	// default of 47 parallel builds causes a panic. Default to 3 on
+	// Solaris-derived operating systems.
+	if goos == "solaris" {
+		return 3
+	}
+
+	if cpus < 2 {
+		return 1
+	}
+	return cpus - 1
+}
@@ -0,0 +1,53 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestParallelValue(t *testing.T) {
+	cases := []struct {
+		Value    string
+		CPUs     int
+		GOOS     string
+		Expected int
+		Err      bool
+	}{
+		{"", 8, "linux", 7, false},
+		{"auto", 8, "linux", 7, false},
+		{"auto", 1, "linux", 1, false},
+		{"auto", 48, "solaris", 3, false},
+		{"-1", 8, "linux", 7, false},
+		{"0", 8, "linux", 1, false},
+		{"1", 8, "linux", 1, false},
+		{"12", 8, "linux", 12, false},
+		{"12", 48, "solaris", 12, false},
+		{"50%", 8, "linux", 4, false},
+		{"50%", 48, "solaris", 24, false},
+		{"10%", 4, "linux", 1, false},
+		{"200%", 4, "linux", 8, false},
+		{"0%", 4, "linux", 0, true},
+		{"half%", 4, "linux", 0, true},
+		{"many", 4, "linux", 0, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := ParallelValue(tc.Value).Parallel(tc.CPUs, tc.GOOS)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Value, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %d", tc.Value, actual)
+		}
+	}
+
+	var v ParallelValue
+	if err := v.Set("many"); err == nil {
+		t.Fatal("should err")
+	}
+	if err := v.Set("50%"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if v.String() != "50%" {
+		t.Fatalf("bad: %s", v)
+	}
+}
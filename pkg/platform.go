@@ -2,7 +2,7 @@ package gox
 
 import (
 	"fmt"
-	"log"
+	"sort"
 	"strings"
 
 	version "github.com/hashicorp/go-version"
@@ -13,82 +13,283 @@ type Platform struct {
 	OS   string
 	Arch string
 
+	// Arm is the GOARM version to build with, such as "6", and is only set
+	// for the arm arch. If it is empty, Go's default for the OS is used.
+	Arm string
+
+	// Mips is the GOMIPS or GOMIPS64 floating point mode to build with,
+	// "hardfloat" or "softfloat", and is only set for the MIPS arches.
+	Mips string
+
+	// Amd64 is the GOAMD64 microarchitecture level to build with, such as
+	// "v3", and is only set for the amd64 arch.
+	Amd64 string
+
+	// Libc is the C library that cgo links against, "musl", and is only
+	// set for linux platforms. If it is empty, the C compiler's own libc,
+	// usually glibc, is used.
+	Libc string
+
 	// Default, if true, will be included as a default build target
 	// if no OS/arch is specified. We try to only set as a default popular
 	// targets or targets that are generally useful. For example, Android
 	// is not a default because it is quite rare that you're cross-compiling
 	// something to Android AND something like Linux.
 	Default bool
+
+	// Primary is true for the first-class ports of Go, which the Go project
+	// fully supports. With -primary-only, only the primary platforms are
+	// built by default.
+	Primary bool
 }
 
 func (p *Platform) String() string {
-	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
+	s := p.OS + "/" + p.Arch
+	if v := p.Variant(); v != "" {
+		s += "/" + v
+	}
+	if p.Libc != "" {
+		s += "@" + p.Libc
+	}
+
+	return s
+}
+
+// Variant returns the variant of the platform as it is given in the third
+// component of an os/arch/variant platform, such as "v6" for ARMv6. It is
+// empty if the platform is built with Go's defaults.
+func (p *Platform) Variant() string {
+	switch {
+	case p.Arm != "":
+		return "v" + p.Arm
+	case p.Mips != "":
+		return p.Mips
+	case p.Amd64 != "":
+		return p.Amd64
+	default:
+		return ""
+	}
+}
+
+// ArmVersions are the GOARM versions that arm platforms can be built
+// with, given as the "v6" in "linux/arm/v6".
+var ArmVersions = []string{"5", "6", "7"}
+
+// MipsFloats are the GOMIPS and GOMIPS64 floating point modes that the
+// MIPS platforms can be built with, as in "linux/mips/softfloat".
+var MipsFloats = []string{"hardfloat", "softfloat"}
+
+// Amd64Levels are the GOAMD64 microarchitecture levels that amd64
+// platforms can be built with, as in "linux/amd64/v3".
+var Amd64Levels = []string{"v1", "v2", "v3", "v4"}
+
+// Libcs are the C libraries other than the default one that linux
+// platforms can be built against, as in "linux/amd64@musl".
+var Libcs = []string{"musl"}
+
+// variantNames returns the variants that the given arch can be built
+// as, in the format of the third component of an os/arch/variant.
+func variantNames(arch string) []string {
+	switch arch {
+	case "arm":
+		names := make([]string, len(ArmVersions))
+		for i, v := range ArmVersions {
+			names[i] = "v" + v
+		}
+		return names
+	case "mips", "mipsle", "mips64", "mips64le":
+		return MipsFloats
+	case "amd64":
+		return Amd64Levels
+	default:
+		return nil
+	}
+}
+
+// Variants returns the variants of this platform that can be built by
+// adding a third component to the os/arch, such as "linux/arm/v6".
+func (p *Platform) Variants() []Platform {
+	if p.Variant() != "" {
+		return nil
+	}
+
+	names := variantNames(p.Arch)
+	result := make([]Platform, 0, len(names))
+	for _, name := range names {
+		variant := *p
+		variant.Default = false
+		if err := variant.setVariant(name); err != nil {
+			panic(err)
+		}
+		result = append(result, variant)
+	}
+
+	return result
+}
+
+// setVariant sets the variant of the platform from the third component of
+// an os/arch/variant platform, such as the "v6" of "linux/arm/v6".
+func (p *Platform) setVariant(variant string) error {
+	names := variantNames(p.Arch)
+	if len(names) == 0 {
+		return fmt.Errorf(
+			"Invalid platform syntax: %s/%s has no variants", p.OS, p.Arch)
+	}
+
+	for _, name := range names {
+		if variant != name {
+			continue
+		}
+
+		switch p.Arch {
+		case "arm":
+			p.Arm = strings.TrimPrefix(variant, "v")
+		case "amd64":
+			p.Amd64 = variant
+		default:
+			p.Mips = variant
+		}
+		return nil
+	}
+
+	return fmt.Errorf(
+		"Invalid variant %q for %s/%s, must be one of: %s",
+		variant, p.OS, p.Arch, strings.Join(names, ", "))
+}
+
+// setLibc sets the C library of the platform from what comes after the
+// "@" of a platform, such as the "musl" of "linux/amd64@musl". Patterns,
+// such as "linux/*@musl", may have one too.
+func (p *Platform) setLibc(libc string) error {
+	if p.OS != "linux" && !isOSArchPattern(p) {
+		return fmt.Errorf(
+			"Invalid platform syntax: only linux has libc variants, not %s/%s",
+			p.OS, p.Arch)
+	}
+
+	for _, name := range Libcs {
+		if libc == name {
+			p.Libc = libc
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Invalid libc %q for %s/%s, must be one of: %s",
+		libc, p.OS, p.Arch, strings.Join(Libcs, ", "))
+}
+
+// sameOSArch returns true if both platforms have the same OS and arch,
+// regardless of their variant.
+func (p *Platform) sameOSArch(other *Platform) bool {
+	return p.OS == other.OS && p.Arch == other.Arch
+}
+
+// ExeSuffix returns the file extension that binaries built for this
+// platform should have, such as ".exe" for Windows. It is empty for
+// platforms that don't use an extension.
+func (p *Platform) ExeSuffix() string {
+	switch {
+	case p.OS == "windows":
+		return ".exe"
+	case p.Arch == "wasm":
+		return ".wasm"
+	default:
+		return ""
+	}
+}
+
+// SupportsCgo returns true if cgo can be enabled when building for this
+// platform. WebAssembly has no C toolchain to link against.
+func (p *Platform) SupportsCgo() bool {
+	return p.Arch != "wasm"
+}
+
+// racePlatforms are the platforms that the race detector supports.
+var racePlatforms = map[string]struct{}{
+	"darwin/amd64":  {},
+	"darwin/arm64":  {},
+	"freebsd/amd64": {},
+	"linux/amd64":   {},
+	"linux/arm64":   {},
+	"linux/ppc64le": {},
+	"linux/s390x":   {},
+	"netbsd/amd64":  {},
+	"windows/amd64": {},
+}
+
+// SupportsRace returns true if the race detector is supported when
+// building for this platform.
+func (p *Platform) SupportsRace() bool {
+	_, ok := racePlatforms[p.OS+"/"+p.Arch]
+	return ok
 }
 
 var (
 	Platforms_1_0 = []Platform{
-		{"darwin", "386", true},
-		{"darwin", "amd64", true},
-		{"linux", "386", true},
-		{"linux", "amd64", true},
-		{"linux", "arm", true},
-		{"freebsd", "386", true},
-		{"freebsd", "amd64", true},
-		{"openbsd", "386", true},
-		{"openbsd", "amd64", true},
-		{"windows", "386", true},
-		{"windows", "amd64", true},
+		{OS: "darwin", Arch: "386", Default: true},
+		{OS: "darwin", Arch: "amd64", Default: true, Primary: true},
+		{OS: "linux", Arch: "386", Default: true, Primary: true},
+		{OS: "linux", Arch: "amd64", Default: true, Primary: true},
+		{OS: "linux", Arch: "arm", Default: true, Primary: true},
+		{OS: "freebsd", Arch: "386", Default: true},
+		{OS: "freebsd", Arch: "amd64", Default: true},
+		{OS: "openbsd", Arch: "386", Default: true},
+		{OS: "openbsd", Arch: "amd64", Default: true},
+		{OS: "windows", Arch: "386", Default: true, Primary: true},
+		{OS: "windows", Arch: "amd64", Default: true, Primary: true},
 	}
 
 	Platforms_1_1 = append(Platforms_1_0, []Platform{
-		{"freebsd", "arm", true},
-		{"netbsd", "386", true},
-		{"netbsd", "amd64", true},
-		{"netbsd", "arm", true},
-		{"plan9", "386", false},
+		{OS: "freebsd", Arch: "arm", Default: true},
+		{OS: "netbsd", Arch: "386", Default: true},
+		{OS: "netbsd", Arch: "amd64", Default: true},
+		{OS: "netbsd", Arch: "arm", Default: true},
+		{OS: "plan9", Arch: "386", Default: false},
 	}...)
 
 	Platforms_1_3 = append(Platforms_1_1, []Platform{
-		{"dragonfly", "386", false},
-		{"dragonfly", "amd64", false},
-		{"nacl", "amd64", false},
-		{"nacl", "amd64p32", false},
-		{"nacl", "arm", false},
-		{"solaris", "amd64", false},
+		{OS: "dragonfly", Arch: "386", Default: false},
+		{OS: "dragonfly", Arch: "amd64", Default: false},
+		{OS: "nacl", Arch: "amd64", Default: false},
+		{OS: "nacl", Arch: "amd64p32", Default: false},
+		{OS: "nacl", Arch: "arm", Default: false},
+		{OS: "solaris", Arch: "amd64", Default: false},
 	}...)
 
 	Platforms_1_4 = append(Platforms_1_3, []Platform{
-		{"android", "arm", false},
-		{"plan9", "amd64", false},
+		{OS: "android", Arch: "arm", Default: false},
+		{OS: "plan9", Arch: "amd64", Default: false},
 	}...)
 
 	Platforms_1_5 = append(Platforms_1_4, []Platform{
-		{"darwin", "arm", false},
-		{"darwin", "arm64", false},
-		{"linux", "arm64", false},
-		{"linux", "ppc64", false},
-		{"linux", "ppc64le", false},
+		{OS: "darwin", Arch: "arm", Default: false},
+		{OS: "darwin", Arch: "arm64", Default: false, Primary: true},
+		{OS: "linux", Arch: "arm64", Default: false, Primary: true},
+		{OS: "linux", Arch: "ppc64", Default: false},
+		{OS: "linux", Arch: "ppc64le", Default: false},
 	}...)
 
-	Platforms_1_6 = append(Platforms_1_5, []Platform{
-		{"android", "386", false},
-		{"linux", "mips64", false},
-		{"linux", "mips64le", false},
+	// Platforms_1_7 is also appended to Platforms_1_5, so the capacity is
+	// limited to keep the two from sharing the same backing array.
+	Platforms_1_6 = append(Platforms_1_5[:len(Platforms_1_5):len(Platforms_1_5)], []Platform{
+		{OS: "android", Arch: "386", Default: false},
+		{OS: "linux", Arch: "mips64", Default: false},
+		{OS: "linux", Arch: "mips64le", Default: false},
 	}...)
 
 	Platforms_1_7 = append(Platforms_1_5, []Platform{
 		// While not fully supported s390x is generally useful
-		{"linux", "s390x", true},
-		{"plan9", "arm", false},
+		{OS: "linux", Arch: "s390x", Default: true},
+		{OS: "plan9", Arch: "arm", Default: false},
 		// Add the 1.6 Platforms, but reflect full support for mips64 and mips64le
-		{"android", "386", false},
-		{"linux", "mips64", true},
-		{"linux", "mips64le", true},
+		{OS: "android", Arch: "386", Default: false},
+		{OS: "linux", Arch: "mips64", Default: true},
+		{OS: "linux", Arch: "mips64le", Default: true},
 	}...)
 
 	Platforms_1_8 = append(Platforms_1_7, []Platform{
-		{"linux", "mips", true},
-		{"linux", "mipsle", true},
+		{OS: "linux", Arch: "mips", Default: true},
+		{OS: "linux", Arch: "mipsle", Default: true},
 	}...)
 
 	// no new platforms in 1.9
@@ -97,24 +298,30 @@ var (
 	// no new platforms in 1.10
 	Platforms_1_10 = Platforms_1_9
 
-	PlatformsLatest = Platforms_1_10
+	// WebAssembly is never a default, it has to be asked for explicitly.
+	Platforms_1_11 = append(Platforms_1_10, []Platform{
+		{OS: "android", Arch: "arm64", Default: false},
+		{OS: "js", Arch: "wasm", Default: false},
+	}...)
+
+	Platforms_1_16 = append(Platforms_1_11, []Platform{
+		{OS: "ios", Arch: "arm64", Default: false},
+	}...)
+
+	Platforms_1_21 = append(Platforms_1_16, []Platform{
+		{OS: "wasip1", Arch: "wasm", Default: false},
+	}...)
+
+	PlatformsLatest = Platforms_1_21
 )
 
 // SupportedPlatforms returns the full list of supported platforms for
 // the version of Go that is
 func SupportedPlatforms(v string) []Platform {
-	// Use latest if we get an unexpected version string
-	if !strings.HasPrefix(v, "go") {
-		return PlatformsLatest
-	}
-	// go-version only cares about version numbers
-	v = v[2:]
-
-	current, err := version.NewVersion(v)
+	// Use latest if we get an unexpected version string, such as from
+	// a development build.
+	current, err := ParseGoVersion(v)
 	if err != nil {
-		log.Printf("Unable to parse current go version: %s\n%s", v, err.Error())
-
-		// Default to latest
 		return PlatformsLatest
 	}
 
@@ -132,6 +339,9 @@ func SupportedPlatforms(v string) []Platform {
 		{">= 1.8, < 1.9", Platforms_1_8},
 		{">= 1.9, < 1.10", Platforms_1_9},
 		{">=1.10, < 1.11", Platforms_1_10},
+		{">= 1.11, < 1.16", Platforms_1_11},
+		{">= 1.16, < 1.21", Platforms_1_16},
+		{">= 1.21", Platforms_1_21},
 	}
 
 	for _, p := range platforms {
@@ -147,3 +357,77 @@ func SupportedPlatforms(v string) []Platform {
 	// Assume latest
 	return Platforms_1_9
 }
+
+// platformsSince are the versions of Go that added platforms, oldest
+// first, with the platforms that version supports.
+var platformsSince = []struct {
+	version string
+	plat    []Platform
+}{
+	{"1.0", Platforms_1_0},
+	{"1.1", Platforms_1_1},
+	{"1.3", Platforms_1_3},
+	{"1.4", Platforms_1_4},
+	{"1.5", Platforms_1_5},
+	{"1.6", Platforms_1_6},
+	{"1.7", Platforms_1_7},
+	{"1.8", Platforms_1_8},
+	{"1.11", Platforms_1_11},
+	{"1.16", Platforms_1_16},
+	{"1.21", Platforms_1_21},
+}
+
+// MinGoVersion returns the oldest version of Go that can build for the
+// platform, such as "1.5", or an empty string if no version of Go that gox
+// knows of can. A variant may need a newer version of Go than its
+// platform, for the setting it is built with.
+func MinGoVersion(p Platform) string {
+	min := ""
+	for _, s := range platformsSince {
+		for _, supported := range s.plat {
+			if supported.sameOSArch(&p) {
+				min = s.version
+				break
+			}
+		}
+		if min != "" {
+			break
+		}
+	}
+	if min == "" {
+		return ""
+	}
+
+	// GOMIPS was added in Go 1.10, GOMIPS64 in 1.11 and GOAMD64 in 1.18.
+	variantMin := ""
+	switch {
+	case p.Mips != "" && strings.HasPrefix(p.Arch, "mips64"):
+		variantMin = "1.11"
+	case p.Mips != "":
+		variantMin = "1.10"
+	case p.Amd64 != "":
+		variantMin = "1.18"
+	}
+	if variantMin != "" && !GoVersionAtLeast(min, variantMin) {
+		min = variantMin
+	}
+
+	return min
+}
+
+// SortPlatforms sorts the platforms by name, except that the platforms
+// with the given OS and architecture, normally those of the host, come
+// first. Builds start in the order of the platforms, so failures on the
+// host show up right away.
+func SortPlatforms(platforms []Platform, goos, goarch string) {
+	sort.SliceStable(platforms, func(i, j int) bool {
+		a, b := &platforms[i], &platforms[j]
+		aHost := a.OS == goos && a.Arch == goarch
+		bHost := b.OS == goos && b.Arch == goarch
+		if aHost != bHost {
+			return aHost
+		}
+
+		return a.String() < b.String()
+	})
+}
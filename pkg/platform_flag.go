@@ -3,15 +3,121 @@ package gox
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"path"
 	"strings"
 )
 
+// OSGroups are the aliases that may be used in the OS list of a
+// PlatformFlag for several operating systems at once. Like an OS, a group
+// may be negated with "!".
+var OSGroups = map[string][]string{
+	"unix": {
+		"aix", "android", "darwin", "dragonfly", "freebsd", "illumos",
+		"ios", "linux", "netbsd", "openbsd", "solaris",
+	},
+	"bsd":     {"dragonfly", "freebsd", "netbsd", "openbsd"},
+	"desktop": {"linux", "darwin", "windows"},
+	"mobile":  {"android", "ios"},
+}
+
+// expandOSGroups returns the list of operating systems with the groups in
+// OSGroups replaced by the operating systems in them, negated if the group
+// is, leaving out duplicates.
+func expandOSGroups(list []string) []string {
+	result := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	add := func(v string) {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+
+	for _, v := range list {
+		prefix, name := "", v
+		if strings.HasPrefix(v, "!") {
+			prefix, name = "!", v[1:]
+		}
+
+		group, ok := OSGroups[name]
+		if !ok {
+			add(v)
+			continue
+		}
+		for _, os := range group {
+			add(prefix + os)
+		}
+	}
+
+	return result
+}
+
+// isOSArchPattern returns true if the os/arch pair is a pattern, such as
+// "linux/*", rather than a single platform.
+func isOSArchPattern(p *Platform) bool {
+	return strings.ContainsAny(p.OS+p.Arch, "*?[")
+}
+
+// expandOSArchPatterns returns the list of os/arch pairs with the patterns
+// in it, such as "linux/*" or "!*/386", replaced by the supported
+// platforms they match, negated if the pattern is. Patterns match the
+// platforms as os/arch, like path.Match. The patterns that match nothing
+// are returned as well.
+func expandOSArchPatterns(list []Platform, supported []Platform) ([]Platform, []string) {
+	result := make([]Platform, 0, len(list))
+	var unmatched []string
+	for _, v := range list {
+		if !isOSArchPattern(&v) {
+			result = append(result, v)
+			continue
+		}
+
+		prefix, pattern := "", v.OS+"/"+v.Arch
+		if strings.HasPrefix(pattern, "!") {
+			prefix, pattern = "!", pattern[1:]
+		}
+
+		matched := false
+		for _, platform := range supported {
+			if ok, _ := path.Match(pattern, platform.OS+"/"+platform.Arch); !ok {
+				continue
+			}
+
+			// A libc variant only matches the platforms that have one.
+			if v.Libc != "" && platform.OS != "linux" {
+				continue
+			}
+
+			matched = true
+			add := Platform{OS: prefix + platform.OS, Arch: platform.Arch, Libc: v.Libc}
+			(*appendPlatformValue)(&result).appendIfMissing(&add)
+		}
+		if !matched {
+			unmatched = append(unmatched, prefix+pattern)
+		}
+	}
+
+	return result, unmatched
+}
+
+// UnmatchedPatterns returns the patterns in the os/arch pairs of the flag
+// that match none of the supported platforms, which is usually a typo.
+func (p *PlatformFlag) UnmatchedPatterns(supported []Platform) []string {
+	_, unmatched := expandOSArchPatterns(p.OSArch, supported)
+	return unmatched
+}
+
 // PlatformFlag is a flag.Value (and flag.Getter) implementation that
 // is used to track the os/arch flags on the command-line.
 type PlatformFlag struct {
 	OS     []string
 	Arch   []string
 	OSArch []Platform
+
+	// PrimaryOnly makes the platforms that are built if none are given
+	// the primary platforms, rather than the default ones.
+	PrimaryOnly bool
 }
 
 // Platforms returns the list of platforms that were set by this flag.
@@ -21,6 +127,9 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	// is much easier to understand this method if you pair this with the
 	// table of test cases it has.
 
+	osList := expandOSGroups(p.OS)
+	osArchList, _ := expandOSArchPatterns(p.OSArch, supported)
+
 	// Build a list of OS and archs NOT to build
 	ignoreArch := make(map[string]struct{})
 	includeArch := make(map[string]struct{})
@@ -35,18 +144,20 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 			includeArch[v] = struct{}{}
 		}
 	}
-	for _, v := range p.OS {
+	for _, v := range osList {
 		if v[0] == '!' {
 			ignoreOS[v[1:]] = struct{}{}
 		} else {
 			includeOS[v] = struct{}{}
 		}
 	}
-	for _, v := range p.OSArch {
+	for _, v := range osArchList {
 		if v.OS[0] == '!' {
 			v = Platform{
 				OS:   v.OS[1:],
 				Arch: v.Arch,
+				Arm:  v.Arm,
+				Libc: v.Libc,
 			}
 
 			ignoreOSArch[v.String()] = v
@@ -59,19 +170,23 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	// based only on the configured OS/arch pairs.
 	var prefilter []Platform = nil
 	if len(includeOSArch) > 0 {
-		prefilter = make([]Platform, 0, len(p.Arch)*len(p.OS)+len(includeOSArch))
-		for _, v := range includeOSArch {
-			prefilter = append(prefilter, v)
+		// Keep the order the pairs were given in rather than the
+		// random order of the map.
+		prefilter = make([]Platform, 0, len(p.Arch)*len(osList)+len(includeOSArch))
+		for _, v := range osArchList {
+			if v.OS[0] != '!' {
+				prefilter = append(prefilter, v)
+			}
 		}
 	}
 
 	if len(includeOS) > 0 && len(includeArch) > 0 {
 		// Build up the list of prefiltered by what is specified
 		if prefilter == nil {
-			prefilter = make([]Platform, 0, len(p.Arch)*len(p.OS))
+			prefilter = make([]Platform, 0, len(p.Arch)*len(osList))
 		}
 
-		for _, os := range p.OS {
+		for _, os := range osList {
 			if _, ok := includeOS[os]; !ok {
 				continue
 			}
@@ -90,10 +205,10 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	} else if len(includeOS) > 0 {
 		// Build up the list of prefiltered by what is specified
 		if prefilter == nil {
-			prefilter = make([]Platform, 0, len(p.Arch)*len(p.OS))
+			prefilter = make([]Platform, 0, len(p.Arch)*len(osList))
 		}
 
-		for _, os := range p.OS {
+		for _, os := range osList {
 			for _, platform := range supported {
 				if platform.OS == os {
 					prefilter = append(prefilter, platform)
@@ -103,12 +218,13 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	}
 
 	if prefilter != nil {
-		// Remove any that aren't supported
+		// Remove any that aren't supported. Variants are supported if
+		// the os/arch they are a variant of is.
 		result := make([]Platform, 0, len(prefilter))
 		for _, pending := range prefilter {
 			found := false
 			for _, platform := range supported {
-				if pending.String() == platform.String() {
+				if pending.sameOSArch(&platform) {
 					found = true
 					break
 				}
@@ -117,6 +233,7 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 			if found {
 				add := pending
 				add.Default = false
+				add.Primary = false
 				result = append(result, add)
 			}
 		}
@@ -127,9 +244,10 @@ func (p *PlatformFlag) Platforms(supported []Platform) []Platform {
 	if prefilter == nil {
 		prefilter = make([]Platform, 0, len(supported))
 		for _, v := range supported {
-			if v.Default {
+			if (v.Default && !p.PrimaryOnly) || (v.Primary && p.PrimaryOnly) {
 				add := v
 				add.Default = false
+				add.Primary = false
 				prefilter = append(prefilter, add)
 			}
 		}
@@ -200,9 +318,56 @@ func (p *PlatformFlag) OSArchFlagValue() flag.Value {
 	return (*appendPlatformValue)(&p.OSArch)
 }
 
+// DefaultFromEnv sets the OS and arch of the flag from the GOOS and GOARCH
+// environment variables, looked up with getenv, like go build uses them.
+// It does nothing if any platforms were given, which take precedence. It
+// returns true if the environment was used.
+func (p *PlatformFlag) DefaultFromEnv(getenv func(string) string) bool {
+	if len(p.OS) > 0 || len(p.Arch) > 0 || len(p.OSArch) > 0 {
+		return false
+	}
+
+	goos, goarch := getenv("GOOS"), getenv("GOARCH")
+	if goos != "" {
+		p.OS = []string{strings.ToLower(goos)}
+	}
+	if goarch != "" {
+		p.Arch = []string{strings.ToLower(goarch)}
+	}
+
+	return goos != "" || goarch != ""
+}
+
+// ReadOSArchFile adds the os/arch pairs listed in the file at the given
+// path to the pairs of the flag, as if they were given to -osarch. Each
+// line of the file has a pair, with the same syntax as -osarch. Blank
+// lines and comments, which start with "#", are skipped.
+func (p *PlatformFlag) ReadOSArchFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	value := (*appendPlatformValue)(&p.OSArch)
+	for i, line := range strings.Split(string(data), "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		for _, v := range strings.Fields(line) {
+			if err := value.Set(v); err != nil {
+				return fmt.Errorf("%s:%d: %s", path, i+1, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 // appendPlatformValue is a flag.Value that appends a full platform (os/arch)
 // to a list where the values from space-separated lines. This is used to
-// satisfy the -osarch flag.
+// satisfy the -osarch flag. A platform may have a variant as a third
+// component, such as "linux/arm/v6", and a libc after an "@", such as
+// "linux/amd64@musl".
 type appendPlatformValue []Platform
 
 func (s *appendPlatformValue) String() string {
@@ -215,8 +380,13 @@ func (s *appendPlatformValue) Set(value string) error {
 	}
 
 	for _, v := range strings.Split(value, " ") {
+		libc := ""
+		if i := strings.LastIndex(v, "@"); i >= 0 {
+			v, libc = v[:i], v[i+1:]
+		}
+
 		parts := strings.Split(v, "/")
-		if len(parts) != 2 {
+		if len(parts) != 2 && len(parts) != 3 {
 			return fmt.Errorf(
 				"Invalid platform syntax: %s should be os/arch", v)
 		}
@@ -225,6 +395,16 @@ func (s *appendPlatformValue) Set(value string) error {
 			OS:   strings.ToLower(parts[0]),
 			Arch: strings.ToLower(parts[1]),
 		}
+		if len(parts) == 3 {
+			if err := platform.setVariant(strings.ToLower(parts[2])); err != nil {
+				return err
+			}
+		}
+		if libc != "" {
+			if err := platform.setLibc(strings.ToLower(libc)); err != nil {
+				return err
+			}
+		}
 
 		s.appendIfMissing(&platform)
 	}
@@ -2,7 +2,10 @@ package gox
 
 import (
 	"flag"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -20,13 +23,13 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{"baz"},
 			[]Platform{},
 			[]Platform{
-				{"foo", "baz", true},
-				{"bar", "baz", true},
-				{"boo", "bop", true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "baz", Default: true},
+				{OS: "boo", Arch: "bop", Default: true},
 			},
 			[]Platform{
-				{"foo", "baz", false},
-				{"bar", "baz", false},
+				{OS: "foo", Arch: "baz", Default: false},
+				{OS: "bar", Arch: "baz", Default: false},
 			},
 		},
 
@@ -36,12 +39,12 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{},
 			[]Platform{},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "bar", true},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: true},
 			},
 			[]Platform{
-				{"bar", "bar", false},
+				{OS: "bar", Arch: "bar", Default: false},
 			},
 		},
 
@@ -51,13 +54,13 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{},
 			[]Platform{},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "bar", true},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: true},
 			},
 			[]Platform{
-				{"foo", "bar", false},
-				{"foo", "baz", false},
+				{OS: "foo", Arch: "bar", Default: false},
+				{OS: "foo", Arch: "baz", Default: false},
 			},
 		},
 
@@ -67,13 +70,13 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{"baz"},
 			[]Platform{},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "baz", true},
-				{"baz", "bar", true},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "baz", Default: true},
+				{OS: "baz", Arch: "bar", Default: true},
 			},
 			[]Platform{
-				{"bar", "baz", false},
+				{OS: "bar", Arch: "baz", Default: false},
 			},
 		},
 
@@ -83,11 +86,11 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{"baz"},
 			[]Platform{},
 			[]Platform{
-				{"foo", "baz", true},
-				{"bar", "what", true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "what", Default: true},
 			},
 			[]Platform{
-				{"foo", "baz", false},
+				{OS: "foo", Arch: "baz", Default: false},
 			},
 		},
 
@@ -96,15 +99,15 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{},
 			[]string{},
 			[]Platform{
-				{"foo", "baz", true},
-				{"foo", "bar", true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "foo", Arch: "bar", Default: true},
 			},
 			[]Platform{
-				{"foo", "baz", true},
-				{"bar", "what", true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "what", Default: true},
 			},
 			[]Platform{
-				{"foo", "baz", false},
+				{OS: "foo", Arch: "baz", Default: false},
 			},
 		},
 
@@ -113,14 +116,14 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{},
 			[]string{},
 			[]Platform{
-				{"!foo", "baz", true},
+				{OS: "!foo", Arch: "baz", Default: true},
 			},
 			[]Platform{
-				{"foo", "baz", true},
-				{"bar", "what", true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "what", Default: true},
 			},
 			[]Platform{
-				{"bar", "what", false},
+				{OS: "bar", Arch: "what", Default: false},
 			},
 		},
 
@@ -129,17 +132,17 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{"foo", "bar"},
 			[]string{"bar"},
 			[]Platform{
-				{"foo", "baz", true},
-				{"!bar", "bar", true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "!bar", Arch: "bar", Default: true},
 			},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "bar", true},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: true},
 			},
 			[]Platform{
-				{"foo", "baz", false},
-				{"foo", "bar", false},
+				{OS: "foo", Arch: "baz", Default: false},
+				{OS: "foo", Arch: "bar", Default: false},
 			},
 		},
 
@@ -149,13 +152,13 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{},
 			[]Platform{},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "bar", false},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: false},
 			},
 			[]Platform{
-				{"foo", "bar", false},
-				{"foo", "baz", false},
+				{OS: "foo", Arch: "bar", Default: false},
+				{OS: "foo", Arch: "baz", Default: false},
 			},
 		},
 
@@ -165,12 +168,12 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{},
 			[]Platform{},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "bar", false},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: false},
 			},
 			[]Platform{
-				{"bar", "bar", false},
+				{OS: "bar", Arch: "bar", Default: false},
 			},
 		},
 
@@ -180,12 +183,182 @@ func TestPlatformFlagPlatforms(t *testing.T) {
 			[]string{"bar"},
 			[]Platform{},
 			[]Platform{
-				{"foo", "bar", true},
-				{"foo", "baz", true},
-				{"bar", "bar", false},
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: false},
 			},
 			[]Platform{
-				{"bar", "bar", false},
+				{OS: "bar", Arch: "bar", Default: false},
+			},
+		},
+
+		// Variants of a supported os/arch
+		{
+			[]string{},
+			[]string{},
+			[]Platform{
+				{OS: "foo", Arch: "arm", Arm: "6"},
+				{OS: "foo", Arch: "arm", Arm: "7"},
+				{OS: "bar", Arch: "arm", Arm: "7"},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "arm", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "arm", Arm: "6", Default: false},
+				{OS: "foo", Arch: "arm", Arm: "7", Default: false},
+			},
+		},
+
+		// A platform along with its variant
+		{
+			[]string{},
+			[]string{},
+			[]Platform{
+				{OS: "foo", Arch: "amd64"},
+				{OS: "foo", Arch: "amd64", Amd64: "v3"},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "amd64", Default: true},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "amd64", Default: false},
+				{OS: "foo", Arch: "amd64", Amd64: "v3", Default: false},
+			},
+		},
+
+		// Patterns of os/arch pairs
+		{
+			[]string{},
+			[]string{},
+			[]Platform{{OS: "foo", Arch: "*"}},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: false},
+				{OS: "bar", Arch: "bar", Default: true},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: false},
+				{OS: "foo", Arch: "baz", Default: false},
+			},
+		},
+
+		// Patterns with a libc only match linux
+		{
+			[]string{},
+			[]string{},
+			[]Platform{{OS: "*", Arch: "amd64", Libc: "musl"}},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: true},
+				{OS: "darwin", Arch: "amd64", Default: true},
+			},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Libc: "musl", Default: false},
+			},
+		},
+
+		// Negated patterns of os/arch pairs
+		{
+			[]string{},
+			[]string{},
+			[]Platform{{OS: "!*", Arch: "bar"}},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+				{OS: "bar", Arch: "bar", Default: true},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "baz", Default: false},
+			},
+		},
+
+		// A negated pair takes precedence over a pattern
+		{
+			[]string{},
+			[]string{},
+			[]Platform{{OS: "foo", Arch: "*"}, {OS: "!foo", Arch: "bar"}},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "foo", Arch: "baz", Default: true},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "baz", Default: false},
+			},
+		},
+
+		// A negated pattern takes precedence over a pair
+		{
+			[]string{},
+			[]string{},
+			[]Platform{{OS: "foo", Arch: "bar"}, {OS: "bar", Arch: "bar"}, {OS: "!foo", Arch: "*"}},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "bar", Arch: "bar", Default: true},
+			},
+			[]Platform{
+				{OS: "bar", Arch: "bar", Default: false},
+			},
+		},
+
+		// Patterns are built even if -os skips them, like pairs
+		{
+			[]string{"!foo"},
+			[]string{},
+			[]Platform{{OS: "foo", Arch: "*"}},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: true},
+				{OS: "bar", Arch: "bar", Default: true},
+			},
+			[]Platform{
+				{OS: "foo", Arch: "bar", Default: false},
+			},
+		},
+
+		// Groups of operating systems
+		{
+			[]string{"mobile"},
+			[]string{},
+			[]Platform{},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: true},
+				{OS: "android", Arch: "arm64", Default: false},
+				{OS: "ios", Arch: "arm64", Default: false},
+			},
+			[]Platform{
+				{OS: "android", Arch: "arm64", Default: false},
+				{OS: "ios", Arch: "arm64", Default: false},
+			},
+		},
+
+		// Negated groups of operating systems
+		{
+			[]string{"!mobile"},
+			[]string{},
+			[]Platform{},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: true},
+				{OS: "android", Arch: "arm64", Default: true},
+				{OS: "ios", Arch: "arm64", Default: true},
+			},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: false},
+			},
+		},
+
+		// Groups with an arch, and without the OSes negated after it
+		{
+			[]string{"desktop", "!darwin"},
+			[]string{"amd64"},
+			[]Platform{},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: true},
+				{OS: "darwin", Arch: "amd64", Default: true},
+				{OS: "windows", Arch: "amd64", Default: true},
+			},
+			[]Platform{
+				{OS: "linux", Arch: "amd64", Default: false},
+				{OS: "windows", Arch: "amd64", Default: false},
 			},
 		},
 	}
@@ -224,7 +397,7 @@ func TestPlatformFlagOSArchFlagValue(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	expected := []Platform{{"foo", "bar", false}}
+	expected := []Platform{{OS: "foo", Arch: "bar", Default: false}}
 	if !reflect.DeepEqual(f.OSArch, expected) {
 		t.Fatalf("bad: %#v", f.OSArch)
 	}
@@ -266,13 +439,56 @@ func TestAppendPlatformValue(t *testing.T) {
 		t.Fatal("should err")
 	}
 
+	if err := value.Set("linux/amd64/v5"); err == nil {
+		t.Fatal("should err")
+	}
+
+	if err := value.Set("linux/mips/v6"); err == nil {
+		t.Fatal("should err")
+	}
+
+	if err := value.Set("darwin/amd64@musl"); err == nil {
+		t.Fatal("should err")
+	}
+
+	if err := value.Set("linux/amd64@uclibc"); err == nil {
+		t.Fatal("should err")
+	}
+
 	if err := value.Set("windows/arm windows/386"); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	expected := []Platform{
-		{"windows", "arm", false},
-		{"windows", "386", false},
+		{OS: "windows", Arch: "arm", Default: false},
+		{OS: "windows", Arch: "386", Default: false},
+	}
+	if !reflect.DeepEqual([]Platform(value), expected) {
+		t.Fatalf("bad: %#v", value)
+	}
+
+	if err := value.Set("linux/arm/v6 linux/ARM/V7 linux/arm/v6 linux/mips64/softfloat linux/amd64/v3"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected = append(expected,
+		Platform{OS: "linux", Arch: "arm", Arm: "6"},
+		Platform{OS: "linux", Arch: "arm", Arm: "7"},
+		Platform{OS: "linux", Arch: "mips64", Mips: "softfloat"},
+		Platform{OS: "linux", Arch: "amd64", Amd64: "v3"})
+	if !reflect.DeepEqual([]Platform(value), expected) {
+		t.Fatalf("bad: %#v", value)
+	}
+
+	if err := value.Set("linux/amd64@musl linux/arm/v7@MUSL linux/amd64@musl"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected = append(expected,
+		Platform{OS: "linux", Arch: "amd64", Libc: "musl"},
+		Platform{OS: "linux", Arch: "arm", Arm: "7", Libc: "musl"})
+	if value[len(value)-1].String() != "linux/arm/v7@musl" {
+		t.Fatalf("bad: %s", value[len(value)-1].String())
 	}
 	if !reflect.DeepEqual([]Platform(value), expected) {
 		t.Fatalf("bad: %#v", value)
@@ -321,3 +537,172 @@ func TestAppendStringValue(t *testing.T) {
 		t.Fatalf("bad: %#v", value)
 	}
 }
+
+func TestExpandOSGroups(t *testing.T) {
+	cases := []struct {
+		Input    []string
+		Expected []string
+	}{
+		{[]string{"linux"}, []string{"linux"}},
+		{[]string{"bsd"}, []string{"dragonfly", "freebsd", "netbsd", "openbsd"}},
+		{[]string{"!mobile", "linux"}, []string{"!android", "!ios", "linux"}},
+		{[]string{"linux", "desktop"}, []string{"linux", "darwin", "windows"}},
+	}
+
+	for _, tc := range cases {
+		if actual := expandOSGroups(tc.Input); !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestPlatformFlagReadOSArchFile(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "targets.txt")
+	testWriteFile(t, path, `
+# Release targets
+linux/amd64
+linux/arm/v7   # Raspberry Pi
+
+!windows/386
+darwin/arm64
+`)
+
+	f := PlatformFlag{OSArch: []Platform{{OS: "darwin", Arch: "arm64"}}}
+	if err := f.ReadOSArchFile(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []Platform{
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm", Arm: "7"},
+		{OS: "!windows", Arch: "386"},
+	}
+	if !reflect.DeepEqual(f.OSArch, expected) {
+		t.Fatalf("bad: %#v", f.OSArch)
+	}
+
+	testWriteFile(t, path, "linux/amd64\nlinux\n")
+	err := f.ReadOSArchFile(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+":2: ") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	if err := f.ReadOSArchFile(filepath.Join(td, "missing.txt")); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestPlatformFlagUnmatchedPatterns(t *testing.T) {
+	var f PlatformFlag
+	if err := f.OSArchFlagValue().Set("linux/* linxu/* !*/mips linux/amd64"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	supported := []Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "386"},
+	}
+	actual := f.UnmatchedPatterns(supported)
+	expected := []string{"linxu/*", "!*/mips"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestPlatformFlagPlatforms_primaryOnly(t *testing.T) {
+	supported := []Platform{
+		{OS: "linux", Arch: "amd64", Default: true, Primary: true},
+		{OS: "linux", Arch: "arm64", Default: false, Primary: true},
+		{OS: "linux", Arch: "mips", Default: true},
+		{OS: "plan9", Arch: "386", Default: false},
+	}
+
+	cases := []struct {
+		OS     []string
+		OSArch []Platform
+		Result []Platform
+	}{
+		// The primary platforms instead of the default ones
+		{
+			nil,
+			nil,
+			[]Platform{{OS: "linux", Arch: "amd64"}, {OS: "linux", Arch: "arm64"}},
+		},
+
+		// Negations are taken from the primary platforms
+		{
+			[]string{"!linux"},
+			nil,
+			[]Platform{},
+		},
+
+		// Explicit platforms are built as usual
+		{
+			[]string{"plan9"},
+			nil,
+			[]Platform{{OS: "plan9", Arch: "386"}},
+		},
+		{
+			nil,
+			[]Platform{{OS: "linux", Arch: "mips"}},
+			[]Platform{{OS: "linux", Arch: "mips"}},
+		},
+	}
+
+	for _, tc := range cases {
+		f := PlatformFlag{OS: tc.OS, OSArch: tc.OSArch, PrimaryOnly: true}
+		result := f.Platforms(supported)
+		if !reflect.DeepEqual(result, tc.Result) {
+			t.Errorf("input: %#v\nresult: %#v", f, result)
+		}
+	}
+}
+
+func TestPlatformFlagDefaultFromEnv(t *testing.T) {
+	env := map[string]string{"GOOS": "linux", "GOARCH": "arm64"}
+	getenv := func(k string) string { return env[k] }
+
+	var f PlatformFlag
+	if !f.DefaultFromEnv(getenv) {
+		t.Fatal("should use the environment")
+	}
+	if !reflect.DeepEqual(f.OS, []string{"linux"}) || !reflect.DeepEqual(f.Arch, []string{"arm64"}) {
+		t.Fatalf("bad: %#v", f)
+	}
+	supported := []Platform{
+		{OS: "linux", Arch: "amd64", Default: true},
+		{OS: "linux", Arch: "arm64", Default: false},
+		{OS: "darwin", Arch: "arm64", Default: true},
+	}
+	expected := []Platform{{OS: "linux", Arch: "arm64"}}
+	if actual := f.Platforms(supported); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Only GOOS
+	delete(env, "GOARCH")
+	f = PlatformFlag{}
+	if !f.DefaultFromEnv(getenv) || len(f.Arch) != 0 {
+		t.Fatalf("bad: %#v", f)
+	}
+
+	// Flags win over the environment
+	f = PlatformFlag{Arch: []string{"amd64"}}
+	if f.DefaultFromEnv(getenv) || len(f.OS) != 0 {
+		t.Fatalf("bad: %#v", f)
+	}
+	f = PlatformFlag{OSArch: []Platform{{OS: "darwin", Arch: "arm64"}}}
+	if f.DefaultFromEnv(getenv) || len(f.OS) != 0 {
+		t.Fatalf("bad: %#v", f)
+	}
+
+	// Nothing set
+	f = PlatformFlag{}
+	if f.DefaultFromEnv(func(string) string { return "" }) {
+		t.Fatal("should not use the environment")
+	}
+}
@@ -2,6 +2,7 @@ package gox
 
 import (
 	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -63,11 +64,50 @@ func TestSupportedPlatforms(t *testing.T) {
 		t.Fatalf("bad: %#v", ps)
 	}
 
+	ps = SupportedPlatforms("go1.11")
+	if !reflect.DeepEqual(ps, Platforms_1_11) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.16")
+	if !reflect.DeepEqual(ps, Platforms_1_16) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.20")
+	if !reflect.DeepEqual(ps, Platforms_1_16) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.21")
+	if !reflect.DeepEqual(ps, Platforms_1_21) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	ps = SupportedPlatforms("go1.24.1")
+	if !reflect.DeepEqual(ps, Platforms_1_21) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
+	// Release candidates and development builds
+	ps = SupportedPlatforms("go1.16rc1")
+	if !reflect.DeepEqual(ps, Platforms_1_16) {
+		t.Fatalf("bad: %#v", ps)
+	}
+	ps = SupportedPlatforms("devel go1.20-abc123 Tue Jan 2 15:04:05 2024 +0000")
+	if !reflect.DeepEqual(ps, Platforms_1_16) {
+		t.Fatalf("bad: %#v", ps)
+	}
+
 	// Unknown
 	ps = SupportedPlatforms("foo")
 	if !reflect.DeepEqual(ps, PlatformsLatest) {
 		t.Fatalf("bad: %#v", ps)
 	}
+	ps = SupportedPlatforms("devel +abc123")
+	if !reflect.DeepEqual(ps, PlatformsLatest) {
+		t.Fatalf("bad: %#v", ps)
+	}
 }
 
 func TestMIPS(t *testing.T) {
@@ -86,3 +126,155 @@ func TestMIPS(t *testing.T) {
 	}
 
 }
+
+func TestWasm(t *testing.T) {
+	for _, v := range []string{"go1.10", "go1.11", "go1.21"} {
+		var js, wasip1 bool
+		for _, p := range SupportedPlatforms(v) {
+			if p.Arch != "wasm" {
+				continue
+			}
+			if p.Default {
+				t.Fatalf("%s: %s should not be default", v, p.String())
+			}
+
+			js = js || p.OS == "js"
+			wasip1 = wasip1 || p.OS == "wasip1"
+		}
+
+		if js != (v != "go1.10") {
+			t.Fatalf("%s: bad js/wasm: %v", v, js)
+		}
+		if wasip1 != (v == "go1.21") {
+			t.Fatalf("%s: bad wasip1/wasm: %v", v, wasip1)
+		}
+	}
+}
+
+func TestPlatformSupportsRace(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Expected bool
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, true},
+		{Platform{OS: "darwin", Arch: "arm64"}, true},
+		{Platform{OS: "linux", Arch: "386"}, false},
+		{Platform{OS: "windows", Arch: "arm"}, false},
+	}
+
+	for _, tc := range cases {
+		if actual := tc.Platform.SupportsRace(); actual != tc.Expected {
+			t.Fatalf("%s: bad: %v", tc.Platform.String(), actual)
+		}
+	}
+}
+
+func TestPlatformVariants(t *testing.T) {
+	p := Platform{OS: "linux", Arch: "arm", Default: true}
+	variants := p.Variants()
+
+	expected := []string{"linux/arm/v5", "linux/arm/v6", "linux/arm/v7"}
+	if len(variants) != len(expected) {
+		t.Fatalf("bad: %#v", variants)
+	}
+	for i, v := range variants {
+		if v.String() != expected[i] || v.Default {
+			t.Fatalf("bad: %#v", v)
+		}
+	}
+
+	p = Platform{OS: "linux", Arch: "mipsle"}
+	variants = p.Variants()
+	expected = []string{"linux/mipsle/hardfloat", "linux/mipsle/softfloat"}
+	if len(variants) != len(expected) {
+		t.Fatalf("bad: %#v", variants)
+	}
+	for i, v := range variants {
+		if v.String() != expected[i] || v.Mips == "" {
+			t.Fatalf("bad: %#v", v)
+		}
+	}
+
+	p = Platform{OS: "linux", Arch: "amd64"}
+	if variants := p.Variants(); len(variants) != len(Amd64Levels) {
+		t.Fatalf("bad: %#v", variants)
+	}
+
+	p = Platform{OS: "linux", Arch: "386"}
+	if variants := p.Variants(); len(variants) > 0 {
+		t.Fatalf("bad: %#v", variants)
+	}
+}
+
+func TestMinGoVersion(t *testing.T) {
+	cases := []struct {
+		Input    Platform
+		Expected string
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, "1.0"},
+		{Platform{OS: "linux", Arch: "arm64"}, "1.5"},
+		{Platform{OS: "linux", Arch: "s390x"}, "1.7"},
+		{Platform{OS: "ios", Arch: "arm64"}, "1.16"},
+		{Platform{OS: "linux", Arch: "arm", Arm: "6"}, "1.0"},
+		{Platform{OS: "linux", Arch: "mips", Mips: "softfloat"}, "1.10"},
+		{Platform{OS: "linux", Arch: "mips64", Mips: "softfloat"}, "1.11"},
+		{Platform{OS: "linux", Arch: "amd64", Amd64: "v3"}, "1.18"},
+		{Platform{OS: "wasip1", Arch: "wasm"}, "1.21"},
+		{Platform{OS: "foo", Arch: "bar"}, ""},
+	}
+
+	for _, tc := range cases {
+		if actual := MinGoVersion(tc.Input); actual != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Input.String(), actual)
+		}
+	}
+}
+
+func TestPlatformsLatest_primary(t *testing.T) {
+	var primary []string
+	for _, p := range PlatformsLatest {
+		if p.Primary {
+			primary = append(primary, p.String())
+		}
+	}
+	sort.Strings(primary)
+
+	expected := []string{
+		"darwin/amd64", "darwin/arm64",
+		"linux/386", "linux/amd64", "linux/arm", "linux/arm64",
+		"windows/386", "windows/amd64",
+	}
+	if !reflect.DeepEqual(primary, expected) {
+		t.Fatalf("bad: %#v", primary)
+	}
+}
+
+func TestSortPlatforms(t *testing.T) {
+	platforms := []Platform{
+		{OS: "windows", Arch: "amd64"},
+		{OS: "plan9", Arch: "386"},
+		{OS: "linux", Arch: "arm", Arm: "7"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64", Amd64: "v3"},
+		{OS: "linux", Arch: "arm", Arm: "6"},
+		{OS: "linux", Arch: "amd64"},
+	}
+	SortPlatforms(platforms, "linux", "amd64")
+
+	var actual []string
+	for _, p := range platforms {
+		actual = append(actual, p.String())
+	}
+	expected := []string{
+		"linux/amd64",
+		"linux/amd64/v3",
+		"darwin/arm64",
+		"linux/arm/v6",
+		"linux/arm/v7",
+		"plan9/386",
+		"windows/amd64",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,27 @@
+package gox
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a process group of its own, so
+// that a Ctrl-C in the console is only handled by gox.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// killProcessTree kills the started command along with every process it
+// started, such as the compilers that go build runs. Windows has no process
+// groups to signal, so taskkill walks the tree instead.
+func killProcessTree(cmd *exec.Cmd) error {
+	kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := kill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+
+	return nil
+}
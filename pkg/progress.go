@@ -0,0 +1,118 @@
+package gox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// clearLine moves the cursor to the start of the line and clears it.
+const clearLine = "\r\033[K"
+
+// progress shows how many builds of a run are done. If live, the status is
+// a line at the bottom of the terminal that is updated in place, with the
+// other output of the run printed above it. Otherwise the status is printed
+// as a line of its own each time a build finishes, which reads well in
+// logs. It is safe to use from multiple goroutines.
+type progress struct {
+	lock sync.Mutex
+	w    io.Writer
+	live bool
+
+	total     int
+	completed int
+	running   int
+	start     time.Time
+
+	// shown is true while the live status line is on the screen.
+	shown bool
+}
+
+func newProgress(w io.Writer, total int, live bool) *progress {
+	return &progress{
+		w:     w,
+		live:  live,
+		total: total,
+		start: time.Now(),
+	}
+}
+
+// isTerminal returns true if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Start records that a build started.
+func (p *progress) Start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.running++
+	p.redraw()
+}
+
+// Finish records that a build is done.
+func (p *progress) Finish() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.running--
+	p.completed++
+	if p.live {
+		p.redraw()
+	} else {
+		fmt.Fprintf(p.w, "%s\n", p.status())
+	}
+}
+
+// Printf prints a line to w without garbling the live status line.
+func (p *progress) Printf(w io.Writer, format string, args ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.clear()
+	fmt.Fprintf(w, format, args...)
+	p.redraw()
+}
+
+// Tick redraws the live status line to update the elapsed time.
+func (p *progress) Tick() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.redraw()
+}
+
+// Done removes the live status line, for when the run is over.
+func (p *progress) Done() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.clear()
+	p.live = false
+}
+
+func (p *progress) status() string {
+	elapsed := time.Since(p.start) / time.Second * time.Second
+	return fmt.Sprintf("%d/%d builds complete, %d running, elapsed %s",
+		p.completed, p.total, p.running, elapsed)
+}
+
+func (p *progress) redraw() {
+	if !p.live {
+		return
+	}
+
+	fmt.Fprintf(p.w, "%s%s", clearLine, p.status())
+	p.shown = true
+}
+
+func (p *progress) clear() {
+	if p.shown {
+		fmt.Fprint(p.w, clearLine)
+		p.shown = false
+	}
+}
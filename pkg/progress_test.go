@@ -0,0 +1,45 @@
+package gox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf, 3, false)
+	p.Start()
+	p.Start()
+	p.Printf(&buf, "--> %s\n", "linux/amd64")
+	p.Finish()
+
+	expected := "--> linux/amd64\n1/3 builds complete, 1 running, elapsed 0s\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestProgress_live(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf, 2, true)
+	p.Start()
+	p.Printf(&buf, "--> %s\n", "linux/amd64")
+	p.Finish()
+	p.Done()
+
+	expected := clearLine + "0/2 builds complete, 1 running, elapsed 0s" +
+		clearLine + "--> linux/amd64\n" +
+		clearLine + "0/2 builds complete, 1 running, elapsed 0s" +
+		clearLine + "1/2 builds complete, 0 running, elapsed 0s" +
+		clearLine
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	// Nothing is drawn once the run is done
+	p.Tick()
+	if strings.HasSuffix(buf.String(), "elapsed 0s") {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
@@ -0,0 +1,210 @@
+package gox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// The exit codes of a run that failed. exitPartialFailure is for a run
+// where only some of the builds failed, and exitFailure for any other.
+const (
+	exitFailure        = 1
+	exitPartialFailure = 2
+)
+
+// buildsExitCode returns the exit code of a run whose builds ended with the
+// given results, and which failed for no other reason: 0 if every build
+// succeeded, exitFailure if every build failed, and exitPartialFailure if
+// some of them did. With partialOK, a run where only some builds failed
+// exits with 0 as long as every build of the required platforms, given as
+// os/arch or os/arch/variant, succeeded. A required platform without a
+// build that succeeded, such as one that was skipped, counts as failed,
+// unless it is one of the platforms in builtBefore, whose builds succeeded
+// in the run that -resume continues.
+func buildsExitCode(results []Result, partialOK bool, required []string, builtBefore []Platform) int {
+	var succeeded, failed int
+	requiredBuilt := make(map[string]bool)
+	requiredFailed := false
+	for _, r := range results {
+		for _, p := range required {
+			if !requiredMatches(p, r.Platform) {
+				continue
+			}
+			if r.Err == nil {
+				requiredBuilt[p] = true
+			} else {
+				requiredFailed = true
+			}
+		}
+
+		if r.Err == nil {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	for _, platform := range builtBefore {
+		for _, p := range required {
+			if requiredMatches(p, platform) {
+				requiredBuilt[p] = true
+			}
+		}
+	}
+	for _, p := range required {
+		requiredFailed = requiredFailed || !requiredBuilt[p]
+	}
+
+	switch {
+	case failed == 0 && !requiredFailed:
+		return 0
+	case succeeded == 0:
+		return exitFailure
+	case partialOK && !requiredFailed:
+		return 0
+	default:
+		return exitPartialFailure
+	}
+}
+
+// requiredMatches returns true if the platform is the required platform p,
+// given as os/arch or os/arch/variant.
+func requiredMatches(p string, platform Platform) bool {
+	return p == platform.String() || p == platform.OS+"/"+platform.Arch
+}
+
+// buildCounts returns the line that ends the output of a run, which
+// counts its builds and says what it exits with, so that the logs of a
+// run match its exit code.
+func buildCounts(results []Result, code int, partialOK bool) string {
+	var succeeded int
+	for _, r := range results {
+		if r.Err == nil {
+			succeeded++
+		}
+	}
+	failed := len(results) - succeeded
+
+	line := fmt.Sprintf("%d of %d builds succeeded, %d failed, exiting with %d",
+		succeeded, len(results), failed, code)
+	if partialOK && failed > 0 && code == 0 {
+		line += " because of -partial-ok"
+	}
+
+	return line
+}
+
+// writeErrors writes the errors of a run to w. Each error is a block of its
+// own, with the first line, which names the platform, colored and the
+// rest, usually everything go build printed, indented below it in full.
+// The blocks of more than one line are set apart by an empty line.
+func writeErrors(w io.Writer, c colors, errs []string) {
+	fmt.Fprintf(w, "\n%s\n", c.Failure(fmt.Sprintf("%d errors occurred:", len(errs))))
+	for i, err := range errs {
+		lines := strings.Split(strings.TrimRight(err, "\n"), "\n")
+		fmt.Fprintf(w, "--> %s\n", c.Failure(lines[0]))
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "    %s\n", strings.TrimRight(line, "\r"))
+		}
+		if len(lines) > 1 && i < len(errs)-1 {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// WriteSizeTable writes a table of the size of the output of each build
+// to w, largest first, followed by the total. Builds that failed, or whose
+// output is gone, are marked as such at the end of the table.
+func WriteSizeTable(w io.Writer, results []Result) error {
+	type row struct {
+		r    Result
+		size int64
+		note string
+	}
+
+	rows := make([]row, 0, len(results))
+	var total int64
+	for _, r := range results {
+		row := row{r: r, size: -1}
+		if r.Err != nil {
+			row.note = "failed"
+		} else if fi, err := os.Stat(r.Output); err != nil {
+			row.note = "missing"
+		} else {
+			row.size = fi.Size()
+			total += row.size
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].size > rows[j].size
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "PLATFORM\tPACKAGE\tOUTPUT\tSIZE\n")
+	for _, row := range rows {
+		size := row.note
+		if row.size >= 0 {
+			size = formatSize(row.size)
+		}
+		output := row.r.Output
+		if output == "" {
+			output = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row.r.Platform.String(),
+			row.r.PackagePath, output, size)
+	}
+	fmt.Fprintf(tw, "Total\t\t\t%s\n", formatSize(total))
+
+	return tw.Flush()
+}
+
+// WriteSummaryTable writes a table of every build of a run to w, with
+// whether it succeeded, how long it took and what it wrote, sorted by
+// platform, then package, then version of Go. A build is "ok" if it
+// succeeded, "up-to-date" if it was skipped because its output was, and
+// "skipped" if it never ran, such as with fail-fast.
+func WriteSummaryTable(w io.Writer, results []Result) error {
+	sorted := make([]Result, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Platform.String() != b.Platform.String() {
+			return a.Platform.String() < b.Platform.String()
+		}
+		if a.PackagePath != b.PackagePath {
+			return a.PackagePath < b.PackagePath
+		}
+		return a.GoVersion < b.GoVersion
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "PLATFORM\tPACKAGE\tSTATUS\tDURATION\tOUTPUT\n")
+	for _, r := range sorted {
+		status, duration, output := "ok", formatDuration(r.Duration), r.Output
+		switch {
+		case r.Err != nil && r.Attempts == 0:
+			status, duration = "skipped", "-"
+		case r.Err != nil:
+			status = "failed"
+		case r.UpToDate:
+			status, duration = "up-to-date", "-"
+		}
+		if r.Err != nil || output == "" {
+			output = "-"
+		}
+		platform := r.Platform.String()
+		if r.GoVersion != "" {
+			platform += " " + r.GoVersion
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", platform, r.PackagePath,
+			status, duration, output)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,190 @@
+package gox
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	writeErrors(&buf, colors{}, []string{
+		"linux/amd64 error: exit status 2\nStderr: # app\n./main.go:3:2: undefined: x\n",
+		"checksum error: no such file",
+	})
+
+	expected := `
+2 errors occurred:
+--> linux/amd64 error: exit status 2
+    Stderr: # app
+    ./main.go:3:2: undefined: x
+
+--> checksum error: no such file
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestWriteErrors_long(t *testing.T) {
+	lines := []string{"linux/amd64 error: exit status 2"}
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+
+	var buf bytes.Buffer
+	writeErrors(&buf, colors{}, []string{strings.Join(lines, "\n")})
+
+	// Everything go build printed is there
+	output := buf.String()
+	if !strings.Contains(output, "--> linux/amd64 error: exit status 2\n    line 0\n") {
+		t.Fatalf("bad: %s", output)
+	}
+	if !strings.HasSuffix(output, "    line 498\n    line 499\n") {
+		t.Fatalf("bad: %s", output)
+	}
+}
+
+func TestWriteSizeTable(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	small := filepath.Join(td, "app_linux_amd64")
+	large := filepath.Join(td, "app_windows_amd64.exe")
+	testWriteFile(t, small, "small")
+	testWriteFile(t, large, strings.Repeat("x", 2048))
+
+	results := []Result{
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, PackagePath: "app", Output: small},
+		{Platform: Platform{OS: "darwin", Arch: "arm64"}, PackagePath: "app", Err: errors.New("failed")},
+		{Platform: Platform{OS: "windows", Arch: "amd64"}, PackagePath: "app", Output: large},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSizeTable(&buf, results); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("bad: %s", buf.String())
+	}
+	for i, expected := range []string{"windows/amd64", "linux/amd64", "darwin/arm64", "Total"} {
+		if !strings.HasPrefix(lines[i+1], expected) {
+			t.Fatalf("bad: %s", buf.String())
+		}
+	}
+	if !strings.HasSuffix(lines[1], "2.0 KB") || !strings.HasSuffix(lines[3], "failed") ||
+		!strings.HasSuffix(lines[4], "2.0 KB") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestBuildsExitCode(t *testing.T) {
+	linux := Result{Platform: Platform{OS: "linux", Arch: "amd64"}}
+	arm := Result{Platform: Platform{OS: "linux", Arch: "arm", Arm: "6"}}
+	armv7 := Result{Platform: Platform{OS: "linux", Arch: "arm", Arm: "7"}}
+	failed := func(r Result) Result {
+		r.Err = errors.New("exit status 2")
+		return r
+	}
+
+	cases := []struct {
+		Results   []Result
+		PartialOK bool
+		Required  []string
+		Expected  int
+	}{
+		{[]Result{linux, arm}, false, nil, 0},
+		{[]Result{failed(linux), failed(arm)}, false, nil, exitFailure},
+		{[]Result{linux, failed(arm)}, false, nil, exitPartialFailure},
+		{[]Result{linux, failed(arm)}, true, nil, 0},
+		{[]Result{failed(linux), failed(arm)}, true, nil, exitFailure},
+		{[]Result{linux, failed(arm)}, true, []string{"linux/amd64"}, 0},
+		{[]Result{linux, failed(arm)}, true, []string{"linux/arm"}, exitPartialFailure},
+		{[]Result{linux, failed(arm)}, true, []string{"linux/arm/v6"}, exitPartialFailure},
+		{[]Result{linux, failed(arm), armv7}, true, []string{"linux/arm/v7"}, 0},
+		{nil, false, nil, 0},
+
+		// A required platform that wasn't built, such as one that was
+		// skipped, didn't succeed.
+		{[]Result{linux, failed(arm)}, true, []string{"linux/arm/v7"}, exitPartialFailure},
+		{[]Result{linux, failed(arm)}, true, []string{"darwin/arm64"}, exitPartialFailure},
+		{[]Result{linux, arm}, true, []string{"darwin/arm64"}, exitPartialFailure},
+	}
+
+	for i, tc := range cases {
+		actual := buildsExitCode(tc.Results, tc.PartialOK, tc.Required, nil)
+		if actual != tc.Expected {
+			t.Fatalf("%d: bad: %d", i, actual)
+		}
+	}
+
+	// With -resume, the platforms that were built by the last run don't
+	// have results of their own.
+	before := []Platform{{OS: "darwin", Arch: "arm64"}}
+	actual := buildsExitCode([]Result{linux, failed(arm)}, true, []string{"darwin/arm64"}, before)
+	if actual != 0 {
+		t.Fatalf("bad: %d", actual)
+	}
+}
+
+func TestBuildCounts(t *testing.T) {
+	results := []Result{
+		{Platform: Platform{OS: "linux", Arch: "amd64"}},
+		{Platform: Platform{OS: "linux", Arch: "arm"}, Err: errors.New("exit status 2")},
+		{Platform: Platform{OS: "windows", Arch: "amd64"}, Err: ErrFailFastSkipped},
+	}
+
+	cases := []struct {
+		Code      int
+		PartialOK bool
+		Expected  string
+	}{
+		{exitPartialFailure, false, "1 of 3 builds succeeded, 2 failed, exiting with 2"},
+		{0, true, "1 of 3 builds succeeded, 2 failed, exiting with 0 because of -partial-ok"},
+		{exitFailure, true, "1 of 3 builds succeeded, 2 failed, exiting with 1"},
+	}
+
+	for _, tc := range cases {
+		if actual := buildCounts(results, tc.Code, tc.PartialOK); actual != tc.Expected {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+}
+
+func TestWriteSummaryTable(t *testing.T) {
+	results := []Result{
+		{Platform: Platform{OS: "windows", Arch: "amd64"}, PackagePath: "app",
+			Output: "app_windows_amd64.exe", Attempts: 1, Duration: 1500 * time.Millisecond},
+		{Platform: Platform{OS: "linux", Arch: "arm"}, PackagePath: "app",
+			Attempts: 2, Duration: 2 * time.Second, Err: errors.New("exit status 2")},
+		{Platform: Platform{OS: "darwin", Arch: "arm64"}, PackagePath: "app",
+			Err: ErrFailFastSkipped},
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, PackagePath: "tool",
+			Output: "tool_linux_amd64", UpToDate: true},
+		{Platform: Platform{OS: "linux", Arch: "amd64"}, PackagePath: "app",
+			Output: "app_linux_amd64", Attempts: 1, Duration: 1234 * time.Millisecond},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSummaryTable(&buf, results); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `PLATFORM       PACKAGE  STATUS      DURATION  OUTPUT
+darwin/arm64   app      skipped     -         -
+linux/amd64    app      ok          1.23s     app_linux_amd64
+linux/amd64    tool     up-to-date  -         tool_linux_amd64
+linux/arm      app      failed      2s        -
+windows/amd64  app      ok          1.5s      app_windows_amd64.exe
+`
+	if buf.String() != expected {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
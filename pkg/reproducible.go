@@ -0,0 +1,100 @@
+package gox
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reproducibleLdflags adds -buildid= to the end of ldflags, which leaves
+// the build ID out of the binary. It's an error if ldflags already sets a
+// build ID of its own.
+func reproducibleLdflags(ldflags string) (string, error) {
+	for _, field := range strings.Fields(ldflags) {
+		if field == "-buildid=" {
+			return ldflags, nil
+		}
+		if strings.HasPrefix(field, "-buildid") {
+			return "", fmt.Errorf("%s in the ldflags conflicts with reproducible builds", field)
+		}
+	}
+
+	if ldflags != "" {
+		ldflags += " "
+	}
+	return ldflags + "-buildid=", nil
+}
+
+// CheckReproducibleGoflags returns an error if the given value of GOFLAGS
+// has flags that make builds that aren't reproducible.
+func CheckReproducibleGoflags(goflags string) error {
+	for _, field := range strings.Fields(goflags) {
+		switch field {
+		case "-buildvcs", "-buildvcs=true", "-buildvcs=auto", "-trimpath=false":
+			return fmt.Errorf("%s in GOFLAGS conflicts with reproducible builds", field)
+		}
+	}
+
+	return nil
+}
+
+// SourceDateEpoch returns the time in the SOURCE_DATE_EPOCH environment
+// variable, which is the number of seconds since the Unix epoch that
+// timestamps should be set to so that builds are reproducible. The
+// returned bool is false if the variable isn't set.
+func SourceDateEpoch() (time.Time, bool, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", v)
+	}
+
+	return time.Unix(sec, 0).UTC(), true, nil
+}
+
+// VerifyReproducible builds the package for the given options a second
+// time, from scratch, and returns an error if the result differs from the
+// output of the first build at the given path.
+func VerifyReproducible(ctx context.Context, opts *CompileOpts, output string) error {
+	td, err := ioutil.TempDir("", "gox-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	// Rebuild every package so that nothing comes from the build cache,
+	// which would make the second build identical to the first anyway.
+	again := *opts
+	again.OutputDir = td
+	again.Rebuild = true
+	if err := GoCrossCompileContext(ctx, &again); err != nil {
+		return err
+	}
+	againOutput, err := OutputPath(&again)
+	if err != nil {
+		return err
+	}
+
+	expected, err := sha256File(output)
+	if err != nil {
+		return err
+	}
+	actual, err := sha256File(againOutput)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("build isn't reproducible: the first build has SHA-256 %s, the second %s",
+			expected, actual)
+	}
+
+	return nil
+}
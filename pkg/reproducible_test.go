@@ -0,0 +1,128 @@
+package gox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReproducibleLdflags(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+		Err      bool
+	}{
+		{"", "-buildid=", false},
+		{"-s -w", "-s -w -buildid=", false},
+		{"-buildid= -s", "-buildid= -s", false},
+		{"-buildid=abc", "", true},
+	}
+
+	for _, tc := range cases {
+		actual, err := reproducibleLdflags(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Input, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+}
+
+func TestCheckReproducibleGoflags(t *testing.T) {
+	cases := []struct {
+		Input string
+		Err   bool
+	}{
+		{"", false},
+		{"-mod=vendor -buildvcs=false", false},
+		{"-buildvcs=true", true},
+		{"-mod=vendor -buildvcs", true},
+		{"-trimpath=false", true},
+	}
+
+	for _, tc := range cases {
+		if err := CheckReproducibleGoflags(tc.Input); (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Input, err)
+		}
+	}
+}
+
+func TestNewBuildCommand_reproducible(t *testing.T) {
+	opts := &CompileOpts{
+		PackagePath:  "github.com/foo/app",
+		Platform:     Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:    DefaultOutputTpl,
+		Ldflags:      "-X main.Version=1.0",
+		Strip:        true,
+		Reproducible: true,
+		BuildVCS:     "false",
+		GoCmd:        "go",
+	}
+
+	cmd, err := NewBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	args := make(map[string]bool)
+	for i, arg := range cmd.Args {
+		args[arg] = true
+		if arg == "-ldflags" && cmd.Args[i+1] != "-X main.Version=1.0 -s -w -buildid=" {
+			t.Fatalf("bad: %q", cmd.Args[i+1])
+		}
+	}
+	if !args["-trimpath"] || !args["-buildvcs=false"] {
+		t.Fatalf("bad: %#v", cmd.Args)
+	}
+
+	opts.Ldflags = "-buildid=foo"
+	if _, err := NewBuildCommand(opts); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestArchiveBinary_sourceDateEpoch(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "app_linux_amd64")
+	testWriteFile(t, path, "binary")
+
+	for _, format := range ArchiveFormats {
+		archivePath, err := ArchiveBinary(path, format)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		first, err := ioutil.ReadFile(archivePath)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// The time of the binary doesn't matter
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := ArchiveBinary(path, format); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		second, err := ioutil.ReadFile(archivePath)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !bytes.Equal(first, second) {
+			t.Fatalf("%s: archives differ", format)
+		}
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := ArchiveBinary(path, ArchiveZip); err == nil {
+		t.Fatal("should err")
+	}
+}
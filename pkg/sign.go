@@ -0,0 +1,63 @@
+package gox
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// CheckSigningKey verifies that gpg is on the PATH and that the secret
+// key with the given ID is available to it, so that problems are found
+// before any builds are started.
+func CheckSigningKey(key, gpgCmd string) error {
+	if _, err := exec.LookPath(gpgCmd); err != nil {
+		return fmt.Errorf("%s executable must be on the PATH to sign", gpgCmd)
+	}
+
+	if _, err := execGPG(gpgCmd, "--list-secret-keys", key); err != nil {
+		return fmt.Errorf("signing key %q is not available: %s", key, err)
+	}
+
+	return nil
+}
+
+// SignFile writes a detached, ASCII-armored signature of the file at path
+// using the given gpg key. The signature is written to path with ".sig"
+// appended, and that path is returned.
+func SignFile(path, key, gpgCmd string) (string, error) {
+	sigPath := path + ".sig"
+	_, err := execGPG(gpgCmd,
+		"--batch", "--yes",
+		"--armor", "--detach-sign",
+		"--local-user", key,
+		"--output", sigPath,
+		path)
+	if err != nil {
+		return "", fmt.Errorf("error signing %s: %s", path, err)
+	}
+
+	return sigPath, nil
+}
+
+// SignArtifacts writes a checksum file to checksumPath covering the given
+// artifacts and signs it with the given gpg key. The path to the signature
+// is returned.
+func SignArtifacts(checksumPath string, artifacts []string, key, gpgCmd string) (string, error) {
+	if err := WriteChecksums(checksumPath, "sha256", artifacts); err != nil {
+		return "", err
+	}
+
+	return SignFile(checksumPath, key, gpgCmd)
+}
+
+func execGPG(gpgCmd string, args ...string) (string, error) {
+	var stderr, stdout bytes.Buffer
+	cmd := exec.Command(gpgCmd, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s\nStderr: %s", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,11 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestCheckSigningKey_noGPG(t *testing.T) {
+	if err := CheckSigningKey("ABCDEF", "gox-no-such-gpg"); err == nil {
+		t.Fatal("should err")
+	}
+}
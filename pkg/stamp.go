@@ -0,0 +1,70 @@
+package gox
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stamp is a string variable, given as importpath.name, that is set to a
+// value in every binary with the -X linker flag.
+type Stamp struct {
+	Var   string
+	Value string
+}
+
+// stampLdflags adds a -X flag for each of the stamps to the end of
+// ldflags. Values with spaces or quotes are quoted the way go build
+// splits its flags.
+func stampLdflags(ldflags string, stamps []Stamp) string {
+	for _, s := range stamps {
+		arg := s.Var + "=" + s.Value
+		if strings.ContainsAny(arg, " \t\n'\"") {
+			if strings.Contains(arg, "'") {
+				arg = `"` + arg + `"`
+			} else {
+				arg = "'" + arg + "'"
+			}
+		}
+
+		if ldflags != "" {
+			ldflags += " "
+		}
+		ldflags += "-X " + arg
+	}
+
+	return ldflags
+}
+
+// BuildDate returns the date to stamp binaries with, which is the time in
+// SOURCE_DATE_EPOCH if it's set and the current time otherwise, in UTC
+// as RFC 3339.
+func BuildDate() (string, error) {
+	t, ok, err := SourceDateEpoch()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		t = time.Now().UTC()
+	}
+
+	return t.Format(time.RFC3339), nil
+}
+
+// stampVarsValue is a flag.Value that appends the variables given to one
+// of the -stamp flags, which may be repeated to stamp several variables.
+type stampVarsValue []string
+
+func (s *stampVarsValue) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stampVarsValue) Set(value string) error {
+	idx := strings.LastIndex(value, ".")
+	if idx <= 0 || idx == len(value)-1 || strings.ContainsAny(value, " \t=") {
+		return fmt.Errorf("invalid variable %q, should be importpath.name", value)
+	}
+
+	*s = append(*s, value)
+	return nil
+}
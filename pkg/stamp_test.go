@@ -0,0 +1,95 @@
+package gox
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStampLdflags(t *testing.T) {
+	cases := []struct {
+		Ldflags  string
+		Stamps   []Stamp
+		Expected string
+	}{
+		{"", nil, ""},
+		{
+			"",
+			[]Stamp{{"main.version", "v1.0.0"}},
+			"-X main.version=v1.0.0",
+		},
+		{
+			"-s -w",
+			[]Stamp{{"main.version", "v1.0.0-dirty"}, {"example.com/app/info.commit", "abc123"}},
+			"-s -w -X main.version=v1.0.0-dirty -X example.com/app/info.commit=abc123",
+		},
+		{
+			"",
+			[]Stamp{{"main.name", "my app"}, {"main.quote", "it's"}},
+			`-X 'main.name=my app' -X "main.quote=it's"`,
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := stampLdflags(tc.Ldflags, tc.Stamps); actual != tc.Expected {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+}
+
+func TestStampVarsValue(t *testing.T) {
+	var v stampVarsValue
+	for _, name := range []string{"main.version", "example.com/app/info.version"} {
+		if err := v.Set(name); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if len(v) != 2 {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	for _, name := range []string{"version", ".version", "main.", "main.version=1"} {
+		if err := v.Set(name); err == nil {
+			t.Fatalf("%s: should err", name)
+		}
+	}
+}
+
+func TestBuildDate(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+
+	date, err := BuildDate()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if date != "2017-07-14T02:40:00Z" {
+		t.Fatalf("bad: %s", date)
+	}
+}
+
+func TestNewBuildCommand_stamps(t *testing.T) {
+	key := "GOX_LINUX_AMD64_LDFLAGS"
+	defer os.Setenv(key, os.Getenv(key))
+	os.Setenv(key, "-X main.os=linux")
+
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		Ldflags:     "-X main.os=any",
+		Stamps:      []Stamp{{"main.version", "v1.0.0"}},
+		Strip:       true,
+		GoCmd:       "go",
+	}
+	envOverride(&opts.Ldflags, opts.Platform, "LDFLAGS")
+
+	cmd, err := NewBuildCommand(opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i, arg := range cmd.Args {
+		if arg == "-ldflags" && cmd.Args[i+1] != "-X main.os=linux -X main.version=v1.0.0 -s -w" {
+			t.Fatalf("bad: %q", cmd.Args[i+1])
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package gox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultStateFile is the default path of the state file, which records
+// the builds of the last run.
+const DefaultStateFile = ".gox-state.json"
+
+// BuildState is the state file, which records what each build of the
+// last run was built from and what it wrote, so that the builds whose
+// inputs are the same as last time can be skipped, and the outcome of each
+// build of the last run, so that the run can be resumed. It is safe to use
+// from multiple goroutines at once.
+type BuildState struct {
+	lock   sync.Mutex
+	builds map[string]BuildStateEntry
+	run    map[string]RunStateEntry
+}
+
+// BuildStateEntry is the state of a build.
+type BuildStateEntry struct {
+	// Inputs is the hash of the inputs of the build, as returned by
+	// BuildInputs.
+	Inputs string `json:"inputs"`
+
+	// Output is the path of the file the build wrote, and SHA256 its
+	// SHA-256 hash.
+	Output string `json:"output"`
+	SHA256 string `json:"sha256"`
+}
+
+// BuildOutcome is what happened to a build in a run.
+type BuildOutcome string
+
+const (
+	// BuildSucceeded is the outcome of a build that succeeded or was up
+	// to date.
+	BuildSucceeded BuildOutcome = "succeeded"
+
+	// BuildFailed is the outcome of a build that ran and failed.
+	BuildFailed BuildOutcome = "failed"
+
+	// BuildNotAttempted is the outcome of a build that never ran.
+	BuildNotAttempted BuildOutcome = "not-attempted"
+)
+
+// RunStateEntry is the outcome of a build in the last run.
+type RunStateEntry struct {
+	Outcome BuildOutcome `json:"outcome"`
+
+	// Flags is a hash of how the build was configured, as returned by
+	// BuildInputs without the sources, to tell whether a later run builds
+	// it the same way.
+	Flags string `json:"flags"`
+}
+
+// stateFile is the format of the state file.
+type stateFile struct {
+	Builds  map[string]BuildStateEntry `json:"builds"`
+	LastRun map[string]RunStateEntry   `json:"last_run,omitempty"`
+}
+
+// NewBuildState returns an empty state.
+func NewBuildState() *BuildState {
+	return &BuildState{
+		builds: make(map[string]BuildStateEntry),
+		run:    make(map[string]RunStateEntry),
+	}
+}
+
+// LoadBuildState reads the state file at path. A missing file is an empty
+// state. A file that can't be read is an error, but the returned state is
+// still usable as an empty one so that everything is built.
+func LoadBuildState(path string) (*BuildState, error) {
+	s := NewBuildState()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return s, fmt.Errorf("invalid state file %s: %s", path, err)
+	}
+	for key, entry := range f.Builds {
+		s.builds[key] = entry
+	}
+	for key, entry := range f.LastRun {
+		s.run[key] = entry
+	}
+
+	return s, nil
+}
+
+// Write writes the state to the file at path.
+func (s *BuildState) Write(path string) error {
+	s.lock.Lock()
+	data, err := json.MarshalIndent(stateFile{Builds: s.builds, LastRun: s.run}, "", "  ")
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// UpToDate returns true if the build for the given options was built from
+// the given inputs last time, and its output is still what it wrote.
+func (s *BuildState) UpToDate(opts *CompileOpts, inputs string) bool {
+	s.lock.Lock()
+	entry, ok := s.builds[stateKey(opts.Platform, opts.GoVersion, opts.PackagePath)]
+	s.lock.Unlock()
+	if !ok || entry.Inputs != inputs {
+		return false
+	}
+
+	output, err := OutputPath(opts)
+	if err != nil || output != entry.Output {
+		return false
+	}
+	sum, err := sha256File(output)
+	return err == nil && sum == entry.SHA256
+}
+
+// Record records the result of a build that was built from the given
+// inputs. Failed builds are forgotten, so that they're built next time.
+func (s *BuildState) Record(r *Result, inputs string) error {
+	key := stateKey(r.Platform, r.GoVersion, r.PackagePath)
+	if r.Err != nil {
+		s.lock.Lock()
+		delete(s.builds, key)
+		s.lock.Unlock()
+		return nil
+	}
+
+	sum, err := sha256File(r.Output)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.builds[key] = BuildStateEntry{Inputs: inputs, Output: r.Output, SHA256: sum}
+	return nil
+}
+
+// ForgetBuilds forgets what every build was built from, so that none of
+// them is up to date.
+func (s *BuildState) ForgetBuilds() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.builds = make(map[string]BuildStateEntry)
+}
+
+// ForgetRun forgets the outcomes of the last run, for a run that doesn't
+// resume it.
+func (s *BuildState) ForgetRun() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.run = make(map[string]RunStateEntry)
+}
+
+// RecordOutcome records the outcome of a build of this run, which was
+// configured as flags says. A build that never got to run go build, such
+// as one that fail-fast or an interrupt kept from starting, wasn't
+// attempted.
+func (s *BuildState) RecordOutcome(r *Result, flags string) {
+	outcome := BuildSucceeded
+	switch {
+	case r.Err == nil:
+	case r.Attempts == 0:
+		outcome = BuildNotAttempted
+	default:
+		outcome = BuildFailed
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.run[stateKey(r.Platform, r.GoVersion, r.PackagePath)] = RunStateEntry{Outcome: outcome, Flags: flags}
+}
+
+// LastRun returns the outcome of the build with the given options in the
+// last run, or false if it wasn't part of that run.
+func (s *BuildState) LastRun(opts *CompileOpts) (RunStateEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, ok := s.run[stateKey(opts.Platform, opts.GoVersion, opts.PackagePath)]
+	return entry, ok
+}
+
+// stateKey is the key of the build of the package for the platform, with
+// the given version of Go, in the state file.
+func stateKey(platform Platform, goVersion, path string) string {
+	if goVersion != "" {
+		return platform.String() + " " + goVersion + " " + path
+	}
+
+	return platform.String() + " " + path
+}
+
+// SourcesHash returns a hash of the contents of the source files of the
+// given package, as listed by sourceFiles, and of the go.mod and go.sum
+// files of the module in the current directory, if there are any.
+func SourcesHash(pkg string, GoCmd, mod, tags string, env []string) (string, error) {
+	files, err := sourceFiles(pkg, GoCmd, mod, tags, env)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if path, err := filepath.Abs(name); err == nil {
+			if _, err := os.Stat(path); err == nil {
+				files = append(files, path)
+			}
+		}
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		sum, err := sha256File(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", sum, file)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BuildInputs returns a hash of the inputs of the build for the given
+// options: the hash of its sources, as returned by SourcesHash, the
+// version of Go, GOFLAGS, the go build command it runs, which has the
+// platform and the flags, the Windows resources of windows builds, the
+// profile of builds with PGO, and the files of the overlay.
+// The options that don't change the output, such as Verbose and GoCache,
+// are left out.
+func BuildInputs(opts *CompileOpts, sources, goVersion string) (string, error) {
+	o := *opts
+	o.Rebuild = false
+	o.Verbose = false
+	o.GoCache = ""
+	cmd, err := NewBuildCommand(&o)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", sources, goVersion, os.Getenv("GOFLAGS"), cmd)
+	if opts.WinRes != nil && opts.Platform.OS == "windows" {
+		syso, err := opts.WinRes.Syso(opts.Platform.Arch)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x\n", sha256.Sum256(syso))
+	}
+	if opts.PGO != "" {
+		sum, err := sha256File(opts.PGO)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\n", sum)
+	}
+	if opts.Overlay != "" {
+		sum, err := overlayHash(opts.Overlay)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\n", sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,222 @@
+package gox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildState(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	opts := &CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		OutputDir:   td,
+	}
+	output := filepath.Join(td, "app_linux_amd64")
+	testWriteFile(t, output, "binary")
+
+	// A missing state file is an empty state
+	path := filepath.Join(td, DefaultStateFile)
+	state, err := LoadBuildState(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if state.UpToDate(opts, "inputs") {
+		t.Fatal("should not be up to date")
+	}
+
+	r := &Result{Platform: opts.Platform, PackagePath: opts.PackagePath, Output: output, Opts: opts}
+	if err := state.Record(r, "inputs"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := state.Write(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err = LoadBuildState(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !state.UpToDate(opts, "inputs") {
+		t.Fatal("should be up to date")
+	}
+	if state.UpToDate(opts, "other inputs") {
+		t.Fatal("should not be up to date with other inputs")
+	}
+
+	// The output must still be what the build wrote
+	testWriteFile(t, output, "changed")
+	if state.UpToDate(opts, "inputs") {
+		t.Fatal("should not be up to date with a changed output")
+	}
+	testWriteFile(t, output, "binary")
+
+	// Failed builds are forgotten
+	r.Err = errors.New("failed")
+	if err := state.Record(r, "inputs"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if state.UpToDate(opts, "inputs") {
+		t.Fatal("should not be up to date after failing")
+	}
+}
+
+func TestBuildState_lastRun(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	darwin := Platform{OS: "darwin", Arch: "arm64"}
+	windows := Platform{OS: "windows", Arch: "amd64"}
+
+	state := NewBuildState()
+	state.RecordOutcome(&Result{Platform: linux, PackagePath: "app", Attempts: 1}, "flags")
+	state.RecordOutcome(&Result{Platform: darwin, PackagePath: "app", Attempts: 2,
+		Err: errors.New("exit status 2")}, "flags")
+	state.RecordOutcome(&Result{Platform: windows, PackagePath: "app",
+		Err: ErrFailFastSkipped}, "flags")
+	state.RecordOutcome(&Result{Platform: darwin, PackagePath: "app", GoVersion: "go1.22.3",
+		Attempts: 1}, "flags")
+
+	path := filepath.Join(td, DefaultStateFile)
+	if err := state.Write(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err := LoadBuildState(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Platform  Platform
+		Path      string
+		GoVersion string
+		Outcome   BuildOutcome
+		OK        bool
+	}{
+		{linux, "app", "", BuildSucceeded, true},
+		{darwin, "app", "", BuildFailed, true},
+		{darwin, "app", "go1.22.3", BuildSucceeded, true},
+		{windows, "app", "", BuildNotAttempted, true},
+		{linux, "other", "", "", false},
+		{linux, "app", "go1.22.3", "", false},
+	}
+	for _, tc := range cases {
+		opts := &CompileOpts{Platform: tc.Platform, PackagePath: tc.Path, GoVersion: tc.GoVersion}
+		entry, ok := state.LastRun(opts)
+		if ok != tc.OK || entry.Outcome != tc.Outcome {
+			t.Fatalf("bad: %s %s %s: %#v", tc.Platform.String(), tc.GoVersion, tc.Path, entry)
+		}
+		if ok && entry.Flags != "flags" {
+			t.Fatalf("bad: %#v", entry)
+		}
+	}
+
+	// A resumed run only replaces the outcomes of what it built
+	state.RecordOutcome(&Result{Platform: darwin, PackagePath: "app", Attempts: 1}, "flags")
+	if entry, _ := state.LastRun(&CompileOpts{Platform: darwin, PackagePath: "app"}); entry.Outcome != BuildSucceeded {
+		t.Fatalf("bad: %#v", entry)
+	}
+	if entry, _ := state.LastRun(&CompileOpts{Platform: windows, PackagePath: "app"}); entry.Outcome != BuildNotAttempted {
+		t.Fatalf("bad: %#v", entry)
+	}
+
+	state.ForgetRun()
+	if _, ok := state.LastRun(&CompileOpts{Platform: linux, PackagePath: "app"}); ok {
+		t.Fatal("should forget the last run")
+	}
+}
+
+func TestLoadBuildState_corrupt(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, DefaultStateFile)
+	testWriteFile(t, path, "{nope")
+	state, err := LoadBuildState(path)
+	if err == nil {
+		t.Fatal("should err")
+	}
+	if state == nil || state.UpToDate(&CompileOpts{PackagePath: "app"}, "") {
+		t.Fatalf("bad: %#v", state)
+	}
+}
+
+func TestBuildInputs(t *testing.T) {
+	opts := CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		CgoSet:      true,
+		GoCmd:       "go",
+	}
+	expected, err := BuildInputs(&opts, "sources", "go1.21.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Change func(opts *CompileOpts) (string, string)
+		Same   bool
+	}{
+		{func(o *CompileOpts) (string, string) { o.Verbose = true; return "sources", "go1.21.0" }, true},
+		{func(o *CompileOpts) (string, string) { o.Rebuild = true; return "sources", "go1.21.0" }, true},
+		{func(o *CompileOpts) (string, string) { o.GoCache = "/cache"; return "sources", "go1.21.0" }, true},
+		{func(o *CompileOpts) (string, string) { o.Ldflags = "-s"; return "sources", "go1.21.0" }, false},
+		{func(o *CompileOpts) (string, string) { o.Platform.Arch = "arm64"; return "sources", "go1.21.0" }, false},
+		{func(o *CompileOpts) (string, string) { return "changed", "go1.21.0" }, false},
+		{func(o *CompileOpts) (string, string) { return "sources", "go1.22.0" }, false},
+	}
+
+	for i, tc := range cases {
+		o := opts
+		sources, goVersion := tc.Change(&o)
+		actual, err := BuildInputs(&o, sources, goVersion)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if (actual == expected) != tc.Same {
+			t.Fatalf("%d: bad: %s", i, actual)
+		}
+	}
+}
+
+func TestBuildInputs_pgo(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	profile := filepath.Join(td, "default.pgo")
+	testWriteFile(t, profile, "foo")
+
+	opts := CompileOpts{
+		PackagePath: "github.com/foo/app",
+		Platform:    Platform{OS: "linux", Arch: "amd64"},
+		OutputTpl:   DefaultOutputTpl,
+		GoCmd:       "go",
+		PGO:         profile,
+	}
+	before, err := BuildInputs(&opts, "sources", "go1.21.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The same path with another profile in it is another build.
+	testWriteFile(t, profile, "bar")
+	after, err := BuildInputs(&opts, "sources", "go1.21.0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if after == before {
+		t.Fatalf("bad: %s", after)
+	}
+
+	os.Remove(profile)
+	if _, err := BuildInputs(&opts, "sources", "go1.21.0"); err == nil {
+		t.Fatal("should err")
+	}
+}
@@ -0,0 +1,64 @@
+package gox
+
+import (
+	"debug/elf"
+	"regexp"
+	"strings"
+)
+
+// staticTags are the build tags that make net and os/user use their pure
+// Go implementations rather than the C library, which can't be linked
+// statically in full.
+const staticTags = "netgo osusergo"
+
+// extldflagsRe matches -extldflags and its value in ldflags, which may be
+// quoted the way go build splits its flags.
+var extldflagsRe = regexp.MustCompile(`-?-extldflags(?:=|\s+)('[^']*'|"[^"]*"|\S+)`)
+
+// staticLdflags makes the external linker link the binary statically, by
+// adding -static to the -extldflags of ldflags, or adding -extldflags
+// -static to the end of ldflags if it has none. ldflags is returned as it
+// is if -static is already there.
+func staticLdflags(ldflags string) string {
+	loc := extldflagsRe.FindStringSubmatchIndex(ldflags)
+	if loc == nil {
+		if ldflags != "" {
+			ldflags += " "
+		}
+		return ldflags + "-extldflags=-static"
+	}
+
+	unquoted := ldflags[loc[2]:loc[3]]
+	if len(unquoted) >= 2 && (unquoted[0] == '\'' || unquoted[0] == '"') {
+		unquoted = unquoted[1 : len(unquoted)-1]
+	}
+	for _, field := range strings.Fields(unquoted) {
+		if field == "-static" {
+			return ldflags
+		}
+	}
+
+	quote := "'"
+	if strings.Contains(unquoted, "'") {
+		quote = `"`
+	}
+	return ldflags[:loc[2]] + quote + unquoted + " -static" + quote + ldflags[loc[3]:]
+}
+
+// IsDynamicELF returns true if the ELF binary at path is dynamically
+// linked, which is when it asks for a dynamic linker to load it.
+func IsDynamicELF(path string) (bool, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
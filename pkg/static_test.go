@@ -0,0 +1,137 @@
+package gox
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticLdflags(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", "-extldflags=-static"},
+		{"-s -w", "-s -w -extldflags=-static"},
+		{"-extldflags=-static -s", "-extldflags=-static -s"},
+		{"-extldflags '-static -lfoo'", "-extldflags '-static -lfoo'"},
+		{"-extldflags '-lfoo' -s", "-extldflags '-lfoo -static' -s"},
+		{`-extldflags "-lfoo" -s`, `-extldflags '-lfoo -static' -s`},
+		{"--extldflags=-lfoo", "--extldflags='-lfoo -static'"},
+		{`-extldflags "-Wl,-rpath,'$ORIGIN'"`, `-extldflags "-Wl,-rpath,'$ORIGIN' -static"`},
+	}
+
+	for _, tc := range cases {
+		if actual := staticLdflags(tc.Input); actual != tc.Expected {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+}
+
+func TestNewBuildCommand_static(t *testing.T) {
+	cases := []struct {
+		Platform Platform
+		Cgo      bool
+		Ldflags  string
+		Tags     string
+	}{
+		// Builds with cgo link statically
+		{Platform{OS: "linux", Arch: "amd64"}, true, "-s -extldflags=-static", "foo netgo osusergo"},
+
+		// Builds without cgo are static already
+		{Platform{OS: "linux", Arch: "amd64"}, false, "-s", "foo"},
+
+		// Other platforms are left alone
+		{Platform{OS: "darwin", Arch: "arm64"}, true, "-s", "foo"},
+	}
+
+	for _, tc := range cases {
+		opts := &CompileOpts{
+			PackagePath: "github.com/foo/app",
+			Platform:    tc.Platform,
+			OutputTpl:   DefaultOutputTpl,
+			Ldflags:     "-s",
+			Tags:        "foo",
+			Static:      true,
+			Cgo:         tc.Cgo,
+			CgoSet:      true,
+			GoCmd:       "go",
+		}
+
+		cmd, err := NewBuildCommand(opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var ldflags, tags string
+		for i, arg := range cmd.Args {
+			switch arg {
+			case "-ldflags":
+				ldflags = cmd.Args[i+1]
+			case "-tags":
+				tags = cmd.Args[i+1]
+			}
+		}
+		if ldflags != tc.Ldflags || tags != tc.Tags {
+			t.Fatalf("%s: bad: %q %q", tc.Platform.String(), ldflags, tags)
+		}
+		if opts.Tags != "foo" {
+			t.Fatalf("bad: %q", opts.Tags)
+		}
+	}
+}
+
+// testELF writes an ELF binary for linux/amd64 with the given program
+// headers, and nothing else, to path.
+func testELF(t *testing.T, path string, progs ...elf.ProgType) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, elf.Header64{
+		Ident: [elf.EI_NIDENT]byte{
+			0x7f, 'E', 'L', 'F',
+			byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT),
+		},
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     uint16(len(progs)),
+	})
+	for _, p := range progs {
+		binary.Write(&b, binary.LittleEndian, elf.Prog64{Type: uint32(p)})
+	}
+	testWriteFile(t, path, b.String())
+}
+
+func TestIsDynamicELF(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	cases := []struct {
+		Progs    []elf.ProgType
+		Expected bool
+	}{
+		{[]elf.ProgType{elf.PT_LOAD}, false},
+		{[]elf.ProgType{elf.PT_PHDR, elf.PT_INTERP, elf.PT_LOAD, elf.PT_DYNAMIC}, true},
+	}
+
+	for i, tc := range cases {
+		path := filepath.Join(td, "app")
+		testELF(t, path, tc.Progs...)
+		actual, err := IsDynamicELF(path)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%d: bad: %t", i, actual)
+		}
+	}
+
+	testWriteFile(t, filepath.Join(td, "app"), "not a binary")
+	if _, err := IsDynamicELF(filepath.Join(td, "app")); err == nil {
+		t.Fatal("should err")
+	}
+}
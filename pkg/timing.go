@@ -0,0 +1,65 @@
+package gox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteTimingTable writes a table of how long each build took and how big
+// its output is to w, slowest first, followed by the totals.
+func WriteTimingTable(w io.Writer, results []Result) error {
+	sorted := make([]Result, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Duration > sorted[j].Duration
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "PLATFORM\tPACKAGE\tDURATION\tSIZE\n")
+
+	var total time.Duration
+	var totalSize int64
+	for _, r := range sorted {
+		size := "-"
+		if r.Err == nil {
+			if fi, err := os.Stat(r.Output); err == nil {
+				size = formatSize(fi.Size())
+				totalSize += fi.Size()
+			}
+		}
+		total += r.Duration
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Platform.String(), r.PackagePath,
+			formatDuration(r.Duration), size)
+	}
+	fmt.Fprintf(tw, "Total\t\t%s\t%s\n", formatDuration(total), formatSize(totalSize))
+
+	return tw.Flush()
+}
+
+// formatDuration formats d rounded to hundredths of a second.
+func formatDuration(d time.Duration) string {
+	const precision = 10 * time.Millisecond
+	return (d / precision * precision).String()
+}
+
+// formatSize formats a number of bytes in the largest unit that keeps it
+// at least 1.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
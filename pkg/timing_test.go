@@ -0,0 +1,67 @@
+package gox
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteTimingTable(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	output := filepath.Join(td, "foo_linux_amd64")
+	testWriteFile(t, output, "binary")
+
+	results := []Result{
+		{
+			Platform:    Platform{OS: "linux", Arch: "amd64"},
+			PackagePath: "./cmd/foo",
+			Output:      output,
+			Duration:    1500 * time.Millisecond,
+		},
+		{
+			Platform:    Platform{OS: "darwin", Arch: "arm64"},
+			PackagePath: "./cmd/foo",
+			Duration:    12345 * time.Millisecond,
+			Err:         errors.New("failed"),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTimingTable(&buf, results); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `PLATFORM      PACKAGE    DURATION  SIZE
+darwin/arm64  ./cmd/foo  12.34s    -
+linux/amd64   ./cmd/foo  1.5s      6 B
+Total                    13.84s    6 B
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := []struct {
+		Input    int64
+		Expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GB"},
+	}
+
+	for _, tc := range cases {
+		if actual := formatSize(tc.Input); actual != tc.Expected {
+			t.Fatalf("bad: %d: %s", tc.Input, actual)
+		}
+	}
+}
@@ -2,64 +2,61 @@ package gox
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	iochan "github.com/sniperkit/iochan/pkg"
 )
 
-// The "main" method for when the toolchain build is requested.
-func mainBuildToolchain(parallel int, platformFlag PlatformFlag, verbose bool) int {
-	if _, err := exec.LookPath("go"); err != nil {
-		fmt.Fprintf(os.Stderr, "You must have Go already built for your native platform\n")
-		fmt.Fprintf(os.Stderr, "and the `go` binary on the PATH to build toolchains.\n")
+// The "main" method for when the toolchain build is requested. Go 1.5 and
+// later cross-compile out of the box, so rather than building a toolchain
+// the standard library is built for each platform with warmStdArgs, which
+// fills the build cache so that the builds that follow are fast. Before Go
+// 1.5 the toolchain for each platform is built with make.bash. Everything
+// is printed through logger.
+func mainBuildToolchain(parallel int, platformFlag PlatformFlag, GoCmd string,
+	cgo bool, goCacheMode GoCacheMode, verbose bool, logger Logger) int {
+	if _, err := exec.LookPath(GoCmd); err != nil {
+		logAt(logger, LogError, "You must have Go already built for your native platform\n"+
+			"and the `%s` binary on the PATH to build toolchains.", GoCmd)
 		return 1
 	}
 
-	// If we're version 1.5 or greater, then we don't need to do this anymore!
-	versionParts, err := GoVersionParts()
+	// The version and GOROOT are those of the go command that builds, which
+	// may not be the go on the PATH.
+	env, err := GoEnvironment(GoCmd)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading Go version: %s", err)
-		return 1
-	}
-	if versionParts[0] >= 1 && versionParts[1] >= 5 {
-		fmt.Fprintf(
-			os.Stderr,
-			"-build-toolchain is no longer required for Go 1.5 or later.\n"+
-				"You can start using Gox immediately!\n")
+		logAt(logger, LogError, "error reading Go version: %s", err)
 		return 1
 	}
+	version, root := env.GoVersion, env.GoRoot
 
-	version, err := GoVersion()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading Go version: %s", err)
-		return 1
-	}
+	// Determine the platforms we're building the toolchain for.
+	platforms := platformFlag.Platforms(ListPlatforms(GoCmd, version))
 
-	root, err := GoRoot()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error finding GOROOT: %s\n", err)
-		return 1
+	if warmStdArgs(version) != nil {
+		return mainWarmStd(parallel, platforms, version, GoCmd, cgo, goCacheMode, verbose, logger)
 	}
 
 	if verbose {
-		fmt.Println("Verbose mode enabled. Output from building each toolchain will be")
-		fmt.Println("outputted to stdout as they are built.\n ")
+		logAt(logger, LogInfo, "Verbose mode enabled. Output from building each toolchain will be\n"+
+			"outputted to stdout as they are built.\n ")
 	}
 
-	// Determine the platforms we're building the toolchain for.
-	platforms := platformFlag.Platforms(SupportedPlatforms(version))
-
 	// The toolchain build can't be parallelized.
 	if parallel > 1 {
-		fmt.Println("The toolchain build can't be parallelized because compiling a single")
-		fmt.Println("Go source directory can only be done for one platform at a time. Therefore,")
-		fmt.Println("the toolchain for each platform will be built one at a time.\n ")
+		logAt(logger, LogInfo, "The toolchain build can't be parallelized because compiling a single\n"+
+			"Go source directory can only be done for one platform at a time. Therefore,\n"+
+			"the toolchain for each platform will be built one at a time.\n ")
 	}
 	parallel = 1
 
@@ -70,7 +67,7 @@ func mainBuildToolchain(parallel int, platformFlag PlatformFlag, verbose bool) i
 	for _, platform := range platforms {
 		wg.Add(1)
 		go func(platform Platform) {
-			err := buildToolchain(&wg, semaphore, root, platform, verbose)
+			err := buildToolchain(&wg, semaphore, root, platform, verbose, logger)
 			if err != nil {
 				errorLock.Lock()
 				defer errorLock.Unlock()
@@ -80,10 +77,80 @@ func mainBuildToolchain(parallel int, platformFlag PlatformFlag, verbose bool) i
 	}
 	wg.Wait()
 
+	return printToolchainErrors(errs, logger)
+}
+
+// mainWarmStd builds the standard library for every platform, parallel at
+// a time, and prints how long each took.
+func mainWarmStd(parallel int, platforms []Platform, goVersion, GoCmd string,
+	cgo bool, goCacheMode GoCacheMode, verbose bool, logger Logger) int {
+	var goCacheBase string
+	if goCacheMode == GoCachePerPlatform {
+		var err error
+		goCacheBase, err = GoCache(GoCmd)
+		if err != nil {
+			logAt(logger, LogError, "Error reading GOCACHE: %s", err)
+			return 1
+		}
+	}
+	if _, err := goCacheMode.Dir(goCacheBase, Platform{}); err != nil {
+		logAt(logger, LogError, "%s", err)
+		return 1
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, 0)
+	semaphore := make(chan int, parallel)
+	for _, platform := range platforms {
+		wg.Add(1)
+		go func(platform Platform) {
+			defer wg.Done()
+			semaphore <- 1
+			defer func() { <-semaphore }()
+
+			opts := &CompileOpts{
+				Platform: platform,
+				Cgo:      cgo,
+				GoCmd:    GoCmd,
+				Logger:   logger,
+			}
+			opts.GoCache, _ = goCacheMode.Dir(goCacheBase, platform)
+			if verbose {
+				opts.OnOutput = func(line string) {
+					lock.Lock()
+					defer lock.Unlock()
+					logAt(logger, LogInfo, "[%s] %s", platform.String(), line)
+				}
+			}
+
+			start := time.Now()
+			err := WarmStd(context.Background(), opts, goVersion)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				logAt(logger, LogInfo, "--> %15s: failed after %s", platform.String(),
+					formatDuration(time.Since(start)))
+				errs = append(errs, fmt.Errorf("%s: %s", platform.String(), err))
+				return
+			}
+			logAt(logger, LogInfo, "--> %15s: std built in %s", platform.String(),
+				formatDuration(time.Since(start)))
+		}(platform)
+	}
+	wg.Wait()
+
+	return printToolchainErrors(errs, logger)
+}
+
+// printToolchainErrors logs the errors of building the toolchains, and
+// returns the exit status.
+func printToolchainErrors(errs []error, logger Logger) int {
 	if len(errs) > 0 {
-		fmt.Fprintf(os.Stderr, "\n%d errors occurred:\n", len(errs))
+		logAt(logger, LogError, "\n%d errors occurred:", len(errs))
 		for _, err := range errs {
-			fmt.Fprintf(os.Stderr, "%s\n", err)
+			logAt(logger, LogError, "%s", err)
 		}
 		return 1
 	}
@@ -91,11 +158,51 @@ func mainBuildToolchain(parallel int, platformFlag PlatformFlag, verbose bool) i
 	return 0
 }
 
-func buildToolchain(wg *sync.WaitGroup, semaphore chan int, root string, platform Platform, verbose bool) error {
+// WarmStd builds the standard library for the platform of the given
+// options with the given version of Go, as returned by GoVersion, so that
+// the builds for that platform that follow find it already built. The
+// platform, cgo, GOCACHE and the go command of the options are used,
+// OnOutput, if set, is called with each line go prints, and the command is
+// logged to Logger, if set.
+func WarmStd(ctx context.Context, opts *CompileOpts, goVersion string) error {
+	args := warmStdArgs(goVersion)
+	if args == nil {
+		return fmt.Errorf("Go %s can't build the standard library for other platforms, "+
+			"its toolchain has to be built instead", goVersion)
+	}
+
+	env, err := goBuildEnv(opts)
+	if err != nil {
+		return err
+	}
+	logAt(opts.Logger, LogDebug, "%s: running %s %s", opts.Platform.String(),
+		opts.GoCmd, strings.Join(args, " "))
+	_, err = execGoContext(ctx, opts.GoCmd, env, "", opts.OnOutput, args...)
+	return err
+}
+
+// warmStdArgs returns the arguments to go that build the standard library
+// for the platform in the environment with the given version of Go. Before
+// Go 1.20 the standard library is installed into GOROOT, where go build
+// looks for it, and since Go 1.20 it is built into the build cache. Before
+// Go 1.5 there's no way to do it, nil is returned, and the toolchain of
+// each platform has to be built instead.
+func warmStdArgs(goVersion string) []string {
+	switch {
+	case !GoVersionAtLeast(goVersion, "1.5"):
+		return nil
+	case !GoVersionAtLeast(goVersion, "1.20"):
+		return []string{"install", "std"}
+	default:
+		return []string{"build", "std"}
+	}
+}
+
+func buildToolchain(wg *sync.WaitGroup, semaphore chan int, root string, platform Platform, verbose bool, logger Logger) error {
 	defer wg.Done()
 	semaphore <- 1
 	defer func() { <-semaphore }()
-	fmt.Printf("--> Toolchain: %s\n", platform.String())
+	logAt(logger, LogInfo, "--> Toolchain: %s", platform.String())
 
 	scriptName := "make.bash"
 	if runtime.GOOS == "windows" {
@@ -126,7 +233,7 @@ func buildToolchain(wg *sync.WaitGroup, semaphore chan int, root string, platfor
 		go func() {
 			defer close(doneCh)
 			for line := range iochan.DelimReader(r, '\n') {
-				fmt.Printf("%s: %s", platform.String(), line)
+				logAt(logger, LogInfo, "%s: %s", platform.String(), strings.TrimSuffix(line, "\n"))
 			}
 		}()
 		defer func() {
@@ -146,3 +253,44 @@ func buildToolchain(wg *sync.WaitGroup, semaphore chan int, root string, platfor
 
 	return nil
 }
+
+// goToolchainRe matches the versions of Go that GOTOOLCHAIN can switch to,
+// releases and release candidates such as go1.22.3 and go1.23rc1.
+var goToolchainRe = regexp.MustCompile(`^go\d+\.\d+(?:\.\d+|rc\d+)$`)
+
+// CheckGoToolchains checks that the go command, whose version is the given
+// installed one, can switch to each of the given versions of Go with
+// GOTOOLCHAIN, and returns them as GOTOOLCHAIN takes them, with the "go"
+// prefix. Switching needs Go 1.21 or later on both ends, since older
+// versions of Go can't be downloaded that way.
+func CheckGoToolchains(installed string, versions []string) ([]string, error) {
+	if !GoVersionAtLeast(installed, "1.21") {
+		return nil, fmt.Errorf(
+			"building with other versions of Go needs Go 1.21 or later, but %s is installed",
+			installed)
+	}
+
+	result := make([]string, 0, len(versions))
+	seen := make(map[string]bool)
+	for _, v := range versions {
+		if !strings.HasPrefix(v, "go") {
+			v = "go" + v
+		}
+		if !goToolchainRe.MatchString(v) {
+			return nil, fmt.Errorf(
+				"invalid Go version %q, must be a release such as go1.22.3 or go1.23rc1", v)
+		}
+		if !GoVersionAtLeast(v, "1.21") {
+			return nil, fmt.Errorf(
+				"can't build with %s, only Go 1.21 and later can be switched to with GOTOOLCHAIN", v)
+		}
+		if seen[v] {
+			return nil, fmt.Errorf("Go version %s is given more than once", v)
+		}
+
+		seen[v] = true
+		result = append(result, v)
+	}
+
+	return result, nil
+}
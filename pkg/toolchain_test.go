@@ -0,0 +1,68 @@
+package gox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWarmStdArgs(t *testing.T) {
+	cases := []struct {
+		Version  string
+		Expected []string
+	}{
+		{"go1.4.3", nil},
+		{"go1.5", []string{"install", "std"}},
+		{"go1.19.13", []string{"install", "std"}},
+		{"go1.20", []string{"build", "std"}},
+		{"go1.22.1", []string{"build", "std"}},
+		{"devel +abcdef", []string{"build", "std"}},
+	}
+
+	for _, tc := range cases {
+		actual := warmStdArgs(tc.Version)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("bad: %s: %#v", tc.Version, actual)
+		}
+	}
+}
+
+func TestCheckGoToolchains(t *testing.T) {
+	cases := []struct {
+		Installed string
+		Versions  []string
+		Expected  []string
+		Err       bool
+	}{
+		{"go1.22.3", []string{"go1.21.9", "1.22.3", "go1.23rc1"}, []string{"go1.21.9", "go1.22.3", "go1.23rc1"}, false},
+		{"go1.22.3", nil, []string{}, false},
+		{"go1.20.14", []string{"go1.22.3"}, nil, true},
+		{"go1.22.3", []string{"go1.20.14"}, nil, true},
+		{"go1.22.3", []string{"go1.22"}, nil, true},
+		{"go1.22.3", []string{"latest"}, nil, true},
+		{"go1.22.3", []string{"go1.22.3", "1.22.3"}, nil, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := CheckGoToolchains(tc.Installed, tc.Versions)
+		if (err != nil) != tc.Err {
+			t.Fatalf("err: %s: %#v: %s", tc.Installed, tc.Versions, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("bad: %#v: %#v", tc.Versions, actual)
+		}
+	}
+}
+
+func TestWarmStd_errors(t *testing.T) {
+	opts := &CompileOpts{
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+		GoCmd:    "gox-no-such-go",
+	}
+	if err := WarmStd(context.Background(), opts, "go1.4.3"); err == nil {
+		t.Fatal("should err")
+	}
+	if err := WarmStd(context.Background(), opts, "go1.22.1"); err == nil {
+		t.Fatal("should err")
+	}
+}
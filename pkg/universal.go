@@ -0,0 +1,167 @@
+package gox
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+// UniversalPlatform is the platform of the universal binaries for macOS,
+// which have the binaries for darwin/amd64 and darwin/arm64 in one file.
+var UniversalPlatform = Platform{OS: "darwin", Arch: "universal"}
+
+// UniversalBuild is a pair of builds of a package, for darwin/amd64 and
+// darwin/arm64, that are merged into a universal binary. See
+// UniversalBuilds.
+type UniversalBuild struct {
+	AMD64, ARM64 *Result
+}
+
+// UniversalBuilds returns the pairs of the results of the builds for
+// darwin/amd64 and darwin/arm64 of each package and version of Go, the
+// builds that make up universal binaries. Builds for variants, such as
+// darwin/amd64/v3, aren't merged. A pair is only missing a result if one
+// of the builds didn't run, such as with -resume.
+func UniversalBuilds(results []Result) []UniversalBuild {
+	var builds []UniversalBuild
+	index := make(map[[2]string]int)
+	for i := range results {
+		r := &results[i]
+		if !isUniversalPart(r.Platform) {
+			continue
+		}
+
+		key := [2]string{r.PackagePath, r.GoVersion}
+		j, ok := index[key]
+		if !ok {
+			j = len(builds)
+			index[key] = j
+			builds = append(builds, UniversalBuild{})
+		}
+		if r.Platform.Arch == "amd64" {
+			builds[j].AMD64 = r
+		} else {
+			builds[j].ARM64 = r
+		}
+	}
+
+	return builds
+}
+
+// isUniversalPart returns true if the builds for the platform are merged
+// into universal binaries, which only darwin/amd64 and darwin/arm64 are.
+func isUniversalPart(p Platform) bool {
+	return p.OS == "darwin" && p.Variant() == "" && (p.Arch == "amd64" || p.Arch == "arm64")
+}
+
+// Opts returns the options of the universal binary of the builds, which
+// are those of the darwin/arm64 build with UniversalPlatform as the
+// platform, so that the output template renders its path with "universal"
+// as the arch.
+func (b *UniversalBuild) Opts() *CompileOpts {
+	var opts CompileOpts
+	switch {
+	case b.ARM64 != nil:
+		opts = *b.ARM64.Opts
+	case b.AMD64 != nil:
+		opts = *b.AMD64.Opts
+	}
+	opts.Platform = UniversalPlatform
+
+	return &opts
+}
+
+// Built returns an error that says which build didn't succeed, if either
+// didn't, in which case there's no universal binary to make.
+func (b *UniversalBuild) Built() error {
+	for _, r := range []struct {
+		Platform string
+		Result   *Result
+	}{{"darwin/amd64", b.AMD64}, {"darwin/arm64", b.ARM64}} {
+		switch {
+		case r.Result == nil:
+			return fmt.Errorf("%s wasn't built", r.Platform)
+		case r.Result.Err != nil:
+			return fmt.Errorf("%s failed", r.Platform)
+		}
+	}
+
+	return nil
+}
+
+// Merge writes the universal binary of the builds to the output path of
+// Opts, and returns the path. An error is returned, without writing
+// anything, if either build didn't succeed.
+func (b *UniversalBuild) Merge() (string, error) {
+	if err := b.Built(); err != nil {
+		return "", err
+	}
+
+	output, err := OutputPath(b.Opts())
+	if err != nil {
+		return "", err
+	}
+	if output == b.AMD64.Output || output == b.ARM64.Output {
+		return "", fmt.Errorf("the output path of the universal binary is " +
+			"the same as the binaries it's made of, the output template " +
+			"must include {{.Arch}}")
+	}
+
+	return output, WriteUniversalBinary(output, []string{b.AMD64.Output, b.ARM64.Output})
+}
+
+// WriteUniversalBinary writes a universal binary for macOS to path, with
+// the Mach-O binaries at the given paths in it, like lipo -create does. The
+// binaries must be for different archs.
+func WriteUniversalBinary(path string, binaries []string) error {
+	const headerSize, archSize = 8, 20
+	type fatArch struct {
+		Cpu, SubCpu, Offset, Size, Align uint32
+	}
+
+	var archs []fatArch
+	var contents [][]byte
+	seen := make(map[macho.Cpu]bool)
+	offset := uint64(headerSize + archSize*len(binaries))
+	for _, bin := range binaries {
+		data, err := ioutil.ReadFile(bin)
+		if err != nil {
+			return err
+		}
+		f, err := macho.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %s", bin, err)
+		}
+		if seen[f.Cpu] {
+			return fmt.Errorf("%s: more than one binary for %s", bin, f.Cpu)
+		}
+		seen[f.Cpu] = true
+
+		// Each binary starts at a page boundary, which is 16KB on arm64
+		// and 4KB on the others, as lipo aligns them.
+		align := uint32(12)
+		if f.Cpu == macho.CpuArm64 {
+			align = 14
+		}
+		offset = (offset + 1<<align - 1) &^ (1<<align - 1)
+		if offset+uint64(len(data)) > 1<<32-1 {
+			return fmt.Errorf("%s: universal binaries are limited to 4GB", bin)
+		}
+		archs = append(archs, fatArch{
+			uint32(f.Cpu), f.SubCpu, uint32(offset), uint32(len(data)), align})
+		contents = append(contents, data)
+		offset += uint64(len(data))
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{macho.MagicFat, uint32(len(archs))})
+	binary.Write(&b, binary.BigEndian, archs)
+	for i, data := range contents {
+		b.Write(make([]byte, int(archs[i].Offset)-b.Len()))
+		b.Write(data)
+	}
+
+	return ioutil.WriteFile(path, b.Bytes(), 0755)
+}
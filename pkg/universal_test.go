@@ -0,0 +1,153 @@
+package gox
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMachO writes a Mach-O binary for the given CPU, with no load
+// commands, to path.
+func testMachO(t *testing.T, path string, cpu macho.Cpu) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   cpu,
+		Type:  macho.TypeExec,
+	})
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // reserved
+	b.WriteString("code")
+	testWriteFile(t, path, b.String())
+}
+
+func TestWriteUniversalBinary(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	amd64 := filepath.Join(td, "app_darwin_amd64")
+	arm64 := filepath.Join(td, "app_darwin_arm64")
+	testMachO(t, amd64, macho.CpuAmd64)
+	testMachO(t, arm64, macho.CpuArm64)
+
+	path := filepath.Join(td, "app_darwin_universal")
+	if err := WriteUniversalBinary(path, []string{amd64, arm64}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	f, err := macho.OpenFat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(f.Arches) != 2 {
+		t.Fatalf("bad: %#v", f.Arches)
+	}
+
+	// Each binary is aligned to a page and kept as it is
+	for i, expected := range []struct {
+		Cpu    macho.Cpu
+		Path   string
+		Offset uint32
+	}{
+		{macho.CpuAmd64, amd64, 1 << 12},
+		{macho.CpuArm64, arm64, 1 << 14},
+	} {
+		arch := f.Arches[i]
+		if arch.Cpu != expected.Cpu || arch.Offset != expected.Offset {
+			t.Fatalf("bad: %#v", arch.FatArchHeader)
+		}
+		data, err := ioutil.ReadFile(expected.Path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		actual := raw[arch.Offset : arch.Offset+arch.Size]
+		if !bytes.Equal(actual, data) {
+			t.Fatalf("bad: %q", actual)
+		}
+	}
+
+	// Two binaries for the same arch can't be merged
+	if err := WriteUniversalBinary(path, []string{amd64, amd64}); err == nil {
+		t.Fatal("should err")
+	}
+
+	// Nor can something that isn't a binary
+	testWriteFile(t, amd64, "not a binary")
+	if err := WriteUniversalBinary(path, []string{amd64, arm64}); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestUniversalBuilds(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	result := func(platform Platform, pkg string, err error) Result {
+		opts := &CompileOpts{
+			PackagePath: pkg,
+			Platform:    platform,
+			OutputTpl:   DefaultOutputTpl,
+			OutputDir:   td,
+		}
+		output, _ := OutputPath(opts)
+		return Result{Platform: platform, PackagePath: pkg, Output: output, Err: err, Opts: opts}
+	}
+	amd64 := Platform{OS: "darwin", Arch: "amd64"}
+	arm64 := Platform{OS: "darwin", Arch: "arm64"}
+	results := []Result{
+		result(amd64, "app", nil),
+		result(Platform{OS: "linux", Arch: "amd64"}, "app", nil),
+		result(arm64, "app", nil),
+		result(Platform{OS: "darwin", Arch: "amd64", Amd64: "v3"}, "app", nil),
+		result(amd64, "tool", nil),
+		result(arm64, "tool", errors.New("failed")),
+	}
+	testMachO(t, results[0].Output, macho.CpuAmd64)
+	testMachO(t, results[2].Output, macho.CpuArm64)
+
+	builds := UniversalBuilds(results)
+	if len(builds) != 2 {
+		t.Fatalf("bad: %#v", builds)
+	}
+	if builds[0].AMD64 != &results[0] || builds[0].ARM64 != &results[2] {
+		t.Fatalf("bad: %#v", builds[0])
+	}
+	if builds[1].AMD64 != &results[4] || builds[1].ARM64 != &results[5] {
+		t.Fatalf("bad: %#v", builds[1])
+	}
+
+	output, err := builds[0].Merge()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if output != filepath.Join(td, "app_darwin_universal") {
+		t.Fatalf("bad: %s", output)
+	}
+	if _, err := macho.OpenFat(output); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Nothing is merged when a build failed
+	if err := builds[1].Built(); err == nil || err.Error() != "darwin/arm64 failed" {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := builds[1].Merge(); err == nil {
+		t.Fatal("should err")
+	}
+
+	// Nor when the output template doesn't tell the archs apart
+	builds[0].ARM64.Opts.OutputTpl = "{{.Dir}}_{{.OS}}"
+	builds[0].ARM64.Output = filepath.Join(td, "app_darwin")
+	if _, err := builds[0].Merge(); err == nil {
+		t.Fatal("should err")
+	}
+}
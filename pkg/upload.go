@@ -0,0 +1,211 @@
+package gox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Uploader publishes build artifacts to a remote destination. Upload may
+// be called concurrently. Location returns the URL that Upload writes the
+// artifact to, without uploading anything.
+type Uploader interface {
+	Upload(a Artifact) error
+	Location(a Artifact) (string, error)
+}
+
+// UploadOpts are the options for creating an Uploader.
+type UploadOpts struct {
+	// Repo, Tag and Draft are the "owner/name" repository, release tag and
+	// whether a created release is a draft for GitHub uploads. Token is
+	// the GitHub API token.
+	Repo  string
+	Tag   string
+	Draft bool
+	Token string
+
+	// ACL is the canned ACL of uploaded objects, and Endpoint is a custom
+	// endpoint for S3 compatible services.
+	ACL      string
+	Endpoint string
+
+	// CacheControl is the Cache-Control header of objects uploaded to GCS.
+	CacheControl string
+
+	// BaseDir is the directory that artifacts are named relative to when
+	// the destination has a directory structure, usually the output dir.
+	BaseDir string
+
+	// DryRun, if true, prints where each artifact would be uploaded to
+	// instead of uploading it. It prints to DryRunOutput, or to stdout if
+	// that isn't set.
+	DryRun       bool
+	DryRunOutput io.Writer
+}
+
+// NewUploader returns the Uploader for the given destination, which is
+// either "github" or a URL in the format of "s3://bucket/prefix/" or
+// "gs://bucket/prefix/". The prefix of bucket URLs is a template that may
+// use "{{.OS}}" and "{{.Arch}}" to organize artifacts by platform.
+func NewUploader(dest string, opts *UploadOpts) (Uploader, error) {
+	var u Uploader
+	var err error
+	switch {
+	case dest == "github":
+		u, err = newGitHubUploader(opts)
+	case strings.HasPrefix(dest, "s3://"):
+		u, err = newS3Uploader(dest, opts)
+	case strings.HasPrefix(dest, "gs://"):
+		u, err = newGCSUploader(dest, opts)
+	default:
+		return nil, fmt.Errorf("unknown upload destination %q", dest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		out := opts.DryRunOutput
+		if out == nil {
+			out = os.Stdout
+		}
+		u = &dryRunUploader{Uploader: u, out: out}
+	}
+
+	return u, nil
+}
+
+// UploadArtifacts uploads each of the given artifacts with at most
+// parallel uploads running at once. An error is returned for each artifact
+// that failed to upload, keyed by its path.
+func UploadArtifacts(u Uploader, artifacts []Artifact, parallel int) map[string]error {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var errorLock sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	semaphore := make(chan int, parallel)
+	for _, a := range artifacts {
+		wg.Add(1)
+		go func(a Artifact) {
+			defer wg.Done()
+			semaphore <- 1
+			defer func() { <-semaphore }()
+
+			if err := u.Upload(a); err != nil {
+				errorLock.Lock()
+				defer errorLock.Unlock()
+				errs[a.Path] = err
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// dryRunUploader prints the location of each artifact instead of
+// uploading it.
+type dryRunUploader struct {
+	Uploader
+	out io.Writer
+}
+
+func (u *dryRunUploader) Upload(a Artifact) error {
+	location, err := u.Location(a)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(u.out, "--> %s: %s\n", a.Path, location)
+	return nil
+}
+
+// parseBucketURL splits a destination such as "gs://bucket/prefix/" into
+// the bucket and the prefix, which is validated as a template.
+func parseBucketURL(dest, scheme string) (string, string, error) {
+	rest := strings.TrimPrefix(dest, scheme+"://")
+	bucket, prefix := rest, ""
+	if idx := strings.Index(rest, "/"); idx >= 0 {
+		bucket, prefix = rest[:idx], rest[idx+1:]
+	}
+	if bucket == "" {
+		return "", "", fmt.Errorf(
+			"destination must be in the format %s://bucket/prefix/", scheme)
+	}
+
+	if _, err := ParseOutputTemplate(prefix); err != nil {
+		return "", "", fmt.Errorf("error parsing upload prefix: %s", err)
+	}
+
+	return bucket, prefix, nil
+}
+
+// objectName returns the name of an artifact in a bucket. The prefix is
+// rendered as a template with the platform of the artifact, and the name
+// of the artifact relative to baseDir is appended to it.
+func objectName(prefix, baseDir string, a Artifact) (string, error) {
+	tpl, err := ParseOutputTemplate(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	data := struct{ OS, Arch string }{a.Platform.OS, a.Platform.Arch}
+	if err := tpl.Execute(&buf, &data); err != nil {
+		return "", err
+	}
+
+	// Joining also collapses the empty segments that run-wide artifacts,
+	// which have no platform, leave behind.
+	return strings.TrimPrefix(
+		path.Join(buf.String(), artifactName(baseDir, a.Path)), "/"), nil
+}
+
+// artifactName returns the name of an artifact at the destination, which
+// is its path relative to baseDir. Artifacts outside of baseDir are named
+// by their file name alone.
+func artifactName(baseDir, file string) string {
+	if baseDir == "" {
+		baseDir = "."
+	}
+
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return filepath.Base(file)
+	}
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Base(file)
+	}
+
+	rel, err := filepath.Rel(absBase, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(file)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// contentType returns the MIME type to upload an artifact with.
+func contentType(file string) string {
+	switch {
+	case strings.HasSuffix(file, ".zip"):
+		return "application/zip"
+	case strings.HasSuffix(file, ".tar.gz"):
+		return "application/gzip"
+	case strings.HasSuffix(file, ".sig"):
+		return "application/pgp-signature"
+	case isChecksumFile(file):
+		return "text/plain"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,79 @@
+package gox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+)
+
+// gcsUploader uploads artifacts to a Google Cloud Storage bucket.
+type gcsUploader struct {
+	bucket       string
+	prefix       string
+	cacheControl string
+	baseDir      string
+	client       *storage.Client
+}
+
+// newGCSUploader returns an uploader for a destination in the format of
+// "gs://bucket/prefix/". Credentials come from the Application Default
+// Credentials. No client is created for dry runs, so that they work
+// without credentials.
+func newGCSUploader(dest string, opts *UploadOpts) (*gcsUploader, error) {
+	bucket, prefix, err := parseBucketURL(dest, "gs")
+	if err != nil {
+		return nil, err
+	}
+
+	u := &gcsUploader{
+		bucket:       bucket,
+		prefix:       prefix,
+		cacheControl: opts.CacheControl,
+		baseDir:      opts.BaseDir,
+	}
+	if !opts.DryRun {
+		u.client, err = storage.NewClient(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("error creating GCS client: %s", err)
+		}
+	}
+
+	return u, nil
+}
+
+func (u *gcsUploader) Location(a Artifact) (string, error) {
+	name, err := objectName(u.prefix, u.baseDir, a)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("gs://%s/%s", u.bucket, name), nil
+}
+
+func (u *gcsUploader) Upload(a Artifact) error {
+	name, err := objectName(u.prefix, u.baseDir, a)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := u.client.Bucket(u.bucket).Object(name).NewWriter(context.Background())
+	w.ContentType = contentType(a.Path)
+	if u.cacheControl != "" {
+		w.CacheControl = u.cacheControl
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
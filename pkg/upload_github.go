@@ -0,0 +1,201 @@
+package gox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// githubUploadRetries is the number of times an upload to GitHub is tried
+// before giving up, as long as GitHub responds with a server error. The
+// wait between tries grows by githubRetryWait each time.
+const githubUploadRetries = 3
+
+var githubRetryWait = time.Second
+
+// githubUploader uploads artifacts as assets of a GitHub release, creating
+// the release if it doesn't exist yet.
+type githubUploader struct {
+	apiURL string
+	repo   string
+	tag    string
+	draft  bool
+	token  string
+	client *http.Client
+
+	releaseLock sync.Mutex
+	uploadURL   string
+}
+
+type githubRelease struct {
+	UploadURL string `json:"upload_url"`
+}
+
+func newGitHubUploader(opts *UploadOpts) (*githubUploader, error) {
+	if strings.Count(opts.Repo, "/") != 1 {
+		return nil, fmt.Errorf("-upload-repo must be in the format owner/name")
+	}
+	if opts.Tag == "" {
+		return nil, fmt.Errorf("-upload-tag is required to upload to GitHub")
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("GITHUB_TOKEN must be set to upload to GitHub")
+	}
+
+	return &githubUploader{
+		apiURL: "https://api.github.com",
+		repo:   opts.Repo,
+		tag:    opts.Tag,
+		draft:  opts.Draft,
+		token:  opts.Token,
+		client: http.DefaultClient,
+	}, nil
+}
+
+func (u *githubUploader) Location(a Artifact) (string, error) {
+	return fmt.Sprintf("https://github.com/%s/releases/download/%s/%s",
+		u.repo, u.tag, filepath.Base(a.Path)), nil
+}
+
+func (u *githubUploader) Upload(a Artifact) error {
+	uploadURL, err := u.release()
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	q.Set("name", filepath.Base(a.Path))
+	uploadURL = uploadURL + "?" + q.Encode()
+
+	var lastErr error
+	for attempt := 1; attempt <= githubUploadRetries; attempt++ {
+		var retry bool
+		retry, lastErr = u.uploadOnce(uploadURL, a.Path)
+		if lastErr == nil || !retry {
+			break
+		}
+
+		time.Sleep(time.Duration(attempt) * githubRetryWait)
+	}
+
+	return lastErr
+}
+
+// uploadOnce uploads the file at path to uploadURL. If the upload failed,
+// the returned bool is true if it may succeed when tried again.
+func (u *githubUploader) uploadOnce(uploadURL, path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType(path))
+
+	resp, err := u.do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return resp.StatusCode >= 500, githubError(resp)
+	}
+
+	return false, nil
+}
+
+// release returns the asset upload URL of the release for the tag,
+// creating the release if necessary. The release is only looked up once.
+func (u *githubUploader) release() (string, error) {
+	u.releaseLock.Lock()
+	defer u.releaseLock.Unlock()
+
+	if u.uploadURL != "" {
+		return u.uploadURL, nil
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf(
+		"%s/repos/%s/releases/tags/%s", u.apiURL, u.repo, url.PathEscape(u.tag)), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := u.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		resp, err = u.createRelease()
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			return "", githubError(resp)
+		}
+	default:
+		return "", githubError(resp)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("error reading GitHub release: %s", err)
+	}
+
+	// The upload URL is a URI template, such as ".../assets{?name,label}".
+	uploadURL := release.UploadURL
+	if idx := strings.Index(uploadURL, "{"); idx >= 0 {
+		uploadURL = uploadURL[:idx]
+	}
+
+	u.uploadURL = uploadURL
+	return u.uploadURL, nil
+}
+
+func (u *githubUploader) createRelease() (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"tag_name": u.tag,
+		"name":     u.tag,
+		"draft":    u.draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf(
+		"%s/repos/%s/releases", u.apiURL, u.repo), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return u.do(req)
+}
+
+func (u *githubUploader) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "token "+u.token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	return u.client.Do(req)
+}
+
+// githubError returns an error describing a failed GitHub API response.
+func githubError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("GitHub API %s %s: %s\n%s",
+		resp.Request.Method, resp.Request.URL.Path, resp.Status, body)
+}
@@ -0,0 +1,107 @@
+package gox
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestGitHubUploader(t *testing.T) {
+	githubRetryWait = 0
+
+	var lock sync.Mutex
+	var failed bool
+	uploads := make(map[string]string)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repos/foo/bar/releases/tags/v1.0.0":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "POST" && r.URL.Path == "/repos/foo/bar/releases":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"upload_url": "` + server.URL + `/upload/1/assets{?name,label}"}`))
+		case r.Method == "POST" && r.URL.Path == "/upload/1/assets":
+			// Fail the first upload to exercise the retry.
+			if !failed {
+				failed = true
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			data, _ := ioutil.ReadAll(r.Body)
+			uploads[r.URL.Query().Get("name")] = string(data)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	u, err := newGitHubUploader(&UploadOpts{
+		Repo:  "foo/bar",
+		Tag:   "v1.0.0",
+		Token: "secret",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	u.apiURL = server.URL
+
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+	artifacts := []Artifact{
+		{Path: filepath.Join(td, "app_linux_amd64")},
+		{Path: filepath.Join(td, "app_windows_amd64.exe")},
+	}
+	for _, a := range artifacts {
+		testWriteFile(t, a.Path, filepath.Base(a.Path))
+	}
+
+	errs := UploadArtifacts(u, artifacts, 2)
+	if len(errs) > 0 {
+		t.Fatalf("err: %#v", errs)
+	}
+
+	for _, a := range artifacts {
+		if uploads[filepath.Base(a.Path)] != filepath.Base(a.Path) {
+			t.Fatalf("bad: %#v", uploads)
+		}
+	}
+}
+
+func TestNewUploader_github(t *testing.T) {
+	cases := []struct {
+		Opts UploadOpts
+		Err  bool
+	}{
+		{UploadOpts{Repo: "foo/bar", Tag: "v1", Token: "t"}, false},
+		{UploadOpts{Repo: "foo", Tag: "v1", Token: "t"}, true},
+		{UploadOpts{Repo: "foo/bar", Token: "t"}, true},
+		{UploadOpts{Repo: "foo/bar", Tag: "v1"}, true},
+	}
+
+	for _, tc := range cases {
+		_, err := NewUploader("github", &tc.Opts)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%#v: err: %v", tc.Opts, err)
+		}
+	}
+
+	if _, err := NewUploader("ftp", &UploadOpts{}); err == nil {
+		t.Fatal("should err")
+	}
+}
@@ -0,0 +1,87 @@
+package gox
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3Uploader uploads artifacts to an S3 bucket, or any service with an
+// S3 compatible API such as MinIO.
+type s3Uploader struct {
+	bucket   string
+	prefix   string
+	acl      string
+	baseDir  string
+	uploader *s3manager.Uploader
+}
+
+// newS3Uploader returns an uploader for a destination in the format of
+// "s3://bucket/prefix/". Credentials come from the standard AWS chain:
+// the environment, the shared credentials file or an instance role.
+func newS3Uploader(dest string, opts *UploadOpts) (*s3Uploader, error) {
+	bucket, prefix, err := parseBucketURL(dest, "s3")
+	if err != nil {
+		return nil, err
+	}
+
+	config := aws.NewConfig()
+	if opts.Endpoint != "" {
+		config = config.
+			WithEndpoint(opts.Endpoint).
+			WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Uploader{
+		bucket:   bucket,
+		prefix:   prefix,
+		acl:      opts.ACL,
+		baseDir:  opts.BaseDir,
+		uploader: s3manager.NewUploader(sess),
+	}, nil
+}
+
+func (u *s3Uploader) Location(a Artifact) (string, error) {
+	key, err := objectName(u.prefix, u.baseDir, a)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", u.bucket, key), nil
+}
+
+func (u *s3Uploader) Upload(a Artifact) error {
+	key, err := objectName(u.prefix, u.baseDir, a)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(u.bucket),
+		Key:         aws.String(key),
+		Body:        f,
+		ContentType: aws.String(contentType(a.Path)),
+	}
+	if u.acl != "" {
+		input.ACL = aws.String(u.acl)
+	}
+
+	_, err = u.uploader.Upload(input)
+	return err
+}
@@ -0,0 +1,111 @@
+package gox
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactName(t *testing.T) {
+	cases := []struct {
+		BaseDir  string
+		Path     string
+		Expected string
+	}{
+		{"", "app_linux_amd64", "app_linux_amd64"},
+		{"dist", filepath.Join("dist", "app_linux_amd64.zip"), "app_linux_amd64.zip"},
+		{"dist", filepath.Join("dist", "linux", "amd64", "app"), "linux/amd64/app"},
+		{"dist", filepath.Join("other", "app"), "app"},
+	}
+
+	for _, tc := range cases {
+		actual := artifactName(tc.BaseDir, tc.Path)
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %#v", tc.Path, actual)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	cases := map[string]string{
+		"app_linux_amd64.zip":    "application/zip",
+		"app_linux_amd64.tar.gz": "application/gzip",
+		"SHA256SUMS":             "text/plain",
+		"B2SUMS":                 "text/plain",
+		"app_linux_amd64.sha512": "text/plain",
+		"SHA256SUMS.sig":         "application/pgp-signature",
+		"app_linux_amd64":        "application/octet-stream",
+	}
+
+	for path, expected := range cases {
+		if actual := contentType(path); actual != expected {
+			t.Fatalf("%s: bad: %#v", path, actual)
+		}
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	linux := Platform{OS: "linux", Arch: "amd64"}
+	cases := []struct {
+		Prefix   string
+		Artifact Artifact
+		Expected string
+	}{
+		{"", Artifact{Path: filepath.Join("dist", "app.zip")}, "app.zip"},
+		{"releases/", Artifact{Path: filepath.Join("dist", "app.zip")}, "releases/app.zip"},
+		{
+			"releases/{{.OS}}/{{.Arch}}/",
+			Artifact{Path: filepath.Join("dist", "app.zip"), Platform: linux},
+			"releases/linux/amd64/app.zip",
+		},
+		{
+			"releases/{{.OS}}/{{.Arch}}/",
+			Artifact{Path: filepath.Join("dist", ChecksumFile)},
+			"releases/SHA256SUMS",
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := objectName(tc.Prefix, "dist", tc.Artifact)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %#v", tc.Prefix, actual)
+		}
+	}
+}
+
+func TestParseBucketURL(t *testing.T) {
+	bucket, prefix, err := parseBucketURL("gs://foo/bar/{{.OS}}/", "gs")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bucket != "foo" || prefix != "bar/{{.OS}}/" {
+		t.Fatalf("bad: %#v %#v", bucket, prefix)
+	}
+
+	if _, _, err := parseBucketURL("gs:///bar", "gs"); err == nil {
+		t.Fatal("should err")
+	}
+	if _, _, err := parseBucketURL("gs://foo/{{.Nope", "gs"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestNewUploader_gcsDryRun(t *testing.T) {
+	u, err := NewUploader("gs://foo/{{.OS}}/", &UploadOpts{DryRun: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	location, err := u.Location(Artifact{
+		Path:     "app",
+		Platform: Platform{OS: "linux", Arch: "amd64"},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if location != "gs://foo/linux/app" {
+		t.Fatalf("bad: %#v", location)
+	}
+}
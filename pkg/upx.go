@@ -0,0 +1,32 @@
+package gox
+
+import (
+	"context"
+)
+
+// UPXSupported returns true if UPX can compress binaries for the platform.
+// It can't compress darwin/arm64 or iOS binaries, nor WebAssembly.
+func (p *Platform) UPXSupported() bool {
+	switch {
+	case p.Arch == "wasm":
+		return false
+	case p.OS == "ios":
+		return false
+	case p.OS == "darwin" && p.Arch == "arm64":
+		return false
+	}
+
+	return true
+}
+
+// CompressUPX compresses the binary at path in place with the upx command,
+// passing it the extra args, such as "--best".
+func CompressUPX(ctx context.Context, upxCmd, path string, args []string) error {
+	upxArgs := make([]string, 0, len(args)+2)
+	upxArgs = append(upxArgs, "-q")
+	upxArgs = append(upxArgs, args...)
+	upxArgs = append(upxArgs, path)
+
+	_, err := execGoContext(ctx, upxCmd, nil, "", nil, upxArgs...)
+	return err
+}
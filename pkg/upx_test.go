@@ -0,0 +1,26 @@
+package gox
+
+import (
+	"testing"
+)
+
+func TestPlatformUPXSupported(t *testing.T) {
+	cases := []struct {
+		Input    Platform
+		Expected bool
+	}{
+		{Platform{OS: "linux", Arch: "amd64"}, true},
+		{Platform{OS: "windows", Arch: "386"}, true},
+		{Platform{OS: "darwin", Arch: "amd64"}, true},
+		{Platform{OS: "darwin", Arch: "arm64"}, false},
+		{Platform{OS: "ios", Arch: "arm64"}, false},
+		{Platform{OS: "js", Arch: "wasm"}, false},
+		{Platform{OS: "wasip1", Arch: "wasm"}, false},
+	}
+
+	for _, tc := range cases {
+		if actual := tc.Input.UPXSupported(); actual != tc.Expected {
+			t.Fatalf("bad: %s", tc.Input.String())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package gox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchDebounce is how long Watch waits for changes to stop before it
+// runs again, so that saving many files at once causes a single run.
+const WatchDebounce = 300 * time.Millisecond
+
+// WatchDirs returns the directories of the given packages and of the
+// packages they import that are inside the current directory, which are
+// the directories to watch for changes to the packages. Vendored packages
+// are left out. go list runs with the environment env, or that of gox if
+// it's nil.
+func WatchDirs(packages []string, GoCmd string, mod string, env []string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"list", "-deps"}
+	if mod != "" {
+		args = append(args, "-mod="+mod)
+	}
+	args = append(args, "-f", "{{if not .Standard}}{{.Dir}}{{end}}")
+	args = append(args, packages...)
+
+	output, err := execGo(GoCmd, env, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, dir := range strings.Split(output, "\n") {
+		if dir == "" || ignoreWatchPath(dir) {
+			continue
+		}
+		if dir != wd && !insideDir(wd, dir) {
+			continue
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
+
+// ignoreWatchPath returns true for paths that changes are ignored in: the
+// vendor and .git directories, hidden and backup files that editors
+// write, and the .syso files of the Windows resources that builds write.
+func ignoreWatchPath(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == "vendor" || part == ".git" {
+			return true
+		}
+	}
+
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, ".") || strings.HasSuffix(base, "~") ||
+		strings.HasPrefix(base, winresSysoPrefix+"_")
+}
+
+// trimGoTmp returns the path of the output that go build writes the
+// temporary file at path for, which is the path itself for other files.
+func trimGoTmp(path string) string {
+	if idx := strings.LastIndex(path, "-go-tmp-"); idx > 0 {
+		return path[:idx]
+	}
+
+	return path
+}
+
+// Watch calls run once, and again every time something changes in the
+// given directories, until ctx is done. If something changes while run is
+// running, the context passed to it is cancelled and run is called again
+// once it returns. Changes to the given files to ignore, usually the files
+// run writes, don't cause a run.
+func Watch(ctx context.Context, dirs []string, ignore []string, run func(ctx context.Context)) error {
+	ignored := make(map[string]bool, len(ignore))
+	for _, path := range ignore {
+		if abs, err := filepath.Abs(path); err == nil {
+			ignored[abs] = true
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	// start runs in the background, cancelling and waiting for the run
+	// that is still going, if any.
+	var cancelRun context.CancelFunc
+	var done chan struct{}
+	stop := func() {
+		if cancelRun != nil {
+			cancelRun()
+			<-done
+		}
+	}
+	start := func() {
+		stop()
+
+		var runCtx context.Context
+		runCtx, cancelRun = context.WithCancel(ctx)
+		done = make(chan struct{})
+		go func(ctx context.Context, done chan struct{}) {
+			defer close(done)
+			run(ctx)
+		}(runCtx, done)
+	}
+	defer stop()
+
+	start()
+	debounce := time.NewTimer(WatchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || ignoreWatchPath(event.Name) {
+				continue
+			}
+			if abs, err := filepath.Abs(event.Name); err == nil && ignored[trimGoTmp(abs)] {
+				continue
+			}
+
+			debounce.Reset(WatchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-debounce.C:
+			start()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
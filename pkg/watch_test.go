@@ -0,0 +1,83 @@
+package gox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIgnoreWatchPath(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected bool
+	}{
+		{"/src/app/main.go", false},
+		{"/src/app/vendor/github.com/foo/bar", true},
+		{"/src/app/.git/index", true},
+		{"/src/app/.main.go.swp", true},
+		{"/src/app/main.go~", true},
+		{"/src/app/gox_winres_windows_amd64.syso", true},
+		{"/src/app/rsrc_windows_amd64.syso", false},
+	}
+
+	for _, tc := range cases {
+		if actual := ignoreWatchPath(tc.Input); actual != tc.Expected {
+			t.Fatalf("bad: %s", tc.Input)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		ignore := []string{filepath.Join(td, "app_linux_amd64")}
+		errCh <- Watch(ctx, []string{td}, ignore, func(ctx context.Context) {
+			runs <- struct{}{}
+		})
+	}()
+
+	wait := func() {
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a run")
+		}
+	}
+
+	// The first run is right away
+	wait()
+
+	// Changes to ignored files don't cause a run
+	testWriteFile(t, filepath.Join(td, ".main.go.swp"), "")
+	testWriteFile(t, filepath.Join(td, "app_linux_amd64"), "")
+	testWriteFile(t, filepath.Join(td, "app_linux_amd64-go-tmp-umask"), "")
+	select {
+	case <-runs:
+		t.Fatal("should not run")
+	case <-time.After(2 * WatchDebounce):
+	}
+
+	// Changes in quick succession cause a single run
+	testWriteFile(t, filepath.Join(td, "main.go"), "package main")
+	testWriteFile(t, filepath.Join(td, "other.go"), "package main")
+	wait()
+	select {
+	case <-runs:
+		t.Fatal("should run once")
+	case <-time.After(2 * WatchDebounce):
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -0,0 +1,534 @@
+package gox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf16"
+)
+
+// WinRes are the Windows resources linked into the binaries for windows:
+// a VERSIONINFO resource, an icon, or both. See ReadWinRes.
+type WinRes struct {
+	VersionInfo *VersionInfo
+
+	// Icon is the contents of a .ico file, or nil for no icon.
+	Icon []byte
+}
+
+// VersionInfo is a VERSIONINFO resource, as read from a versioninfo.json
+// file in the format of goversioninfo. The flags of FixedFileInfo are hex
+// numbers, and default to those of an application for Windows NT.
+// StringFileInfo holds the strings of the resource, such as
+// "CompanyName" and "FileDescription", and empty strings are left out.
+type VersionInfo struct {
+	FixedFileInfo struct {
+		FileVersion    FileVersion
+		ProductVersion FileVersion
+		FileFlagsMask  string
+		FileFlags      string
+		FileOS         string
+		FileType       string
+		FileSubType    string
+	}
+	StringFileInfo map[string]string
+	VarFileInfo    struct {
+		Translation struct {
+			LangID    string
+			CharsetID string
+		}
+	}
+
+	// IconPath is the icon to link in, relative to the file, if none is
+	// given otherwise.
+	IconPath string
+}
+
+// FileVersion is a version of a VERSIONINFO resource, such as 1.2.3.0.
+type FileVersion struct {
+	Major, Minor, Patch, Build uint16
+}
+
+// ReadWinRes reads the resources for windows from versionInfoPath, a
+// versioninfo.json file, and iconPath, a .ico file. Either may be empty.
+// Without iconPath, the IconPath of the versioninfo.json file is used, if
+// it has one.
+func ReadWinRes(versionInfoPath, iconPath string) (*WinRes, error) {
+	var res WinRes
+	if versionInfoPath != "" {
+		data, err := ioutil.ReadFile(versionInfoPath)
+		if err != nil {
+			return nil, err
+		}
+
+		var vi VersionInfo
+		if err := json.Unmarshal(data, &vi); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %s", versionInfoPath, err)
+		}
+		if _, err := vi.encode(); err != nil {
+			return nil, fmt.Errorf("%s: %s", versionInfoPath, err)
+		}
+		res.VersionInfo = &vi
+
+		if iconPath == "" && vi.IconPath != "" {
+			iconPath = vi.IconPath
+			if !filepath.IsAbs(iconPath) {
+				iconPath = filepath.Join(filepath.Dir(versionInfoPath), iconPath)
+			}
+		}
+	}
+
+	if iconPath != "" {
+		data, err := ioutil.ReadFile(iconPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := parseIcon(data); err != nil {
+			return nil, fmt.Errorf("%s: %s", iconPath, err)
+		}
+		res.Icon = data
+	}
+
+	return &res, nil
+}
+
+// The types of the resources, RT_ICON, RT_GROUP_ICON and RT_VERSION.
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+	rtVersion   = 16
+)
+
+// winresMachines are the COFF machine of each arch of windows, and the
+// type of the relocations of the resource section for it, which are
+// relative to the image base.
+var winresMachines = map[string]struct {
+	Machine, Reloc uint16
+	Is32           bool
+}{
+	"386":   {0x14c, 0x07, true},
+	"amd64": {0x8664, 0x03, false},
+	"arm":   {0x1c4, 0x02, true},
+	"arm64": {0xaa64, 0x02, false},
+}
+
+// winresource is a resource of the resource section.
+type winresource struct {
+	Type, ID uint16
+	Data     []byte
+}
+
+// Syso returns the resources as a COFF object for the given arch of
+// windows, which go build links into the binary when it is a .syso file
+// of the package.
+func (r *WinRes) Syso(arch string) ([]byte, error) {
+	machine, ok := winresMachines[arch]
+	if !ok {
+		return nil, fmt.Errorf("windows/%s doesn't support Windows resources", arch)
+	}
+
+	var resources []winresource
+	lang := uint16(0x0409)
+	if r.VersionInfo != nil {
+		data, err := r.VersionInfo.encode()
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, winresource{rtVersion, 1, data})
+		lang, _, _ = r.VersionInfo.translation()
+	}
+	if r.Icon != nil {
+		group, images, err := parseIcon(r.Icon)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, winresource{rtGroupIcon, 1, group})
+		for i, image := range images {
+			resources = append(resources, winresource{rtIcon, uint16(i + 1), image})
+		}
+	}
+	section, relocs := resourceSection(resources, lang)
+
+	// The object has the resource section, its relocations, and a symbol
+	// for the section that the relocations are against.
+	const headerSize, sectionHeaderSize, relocSize = 20, 40, 10
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	characteristics := uint16(0x0004) // IMAGE_FILE_LINE_NUMS_STRIPPED
+	if machine.Is32 {
+		characteristics |= 0x0100 // IMAGE_FILE_32BIT_MACHINE
+	}
+	relocsAt := headerSize + sectionHeaderSize + len(section)
+	symbolsAt := relocsAt + relocSize*len(relocs)
+	binary.Write(&b, le, struct {
+		Machine              uint16
+		NumberOfSections     uint16
+		TimeDateStamp        uint32
+		PointerToSymbolTable uint32
+		NumberOfSymbols      uint32
+		SizeOfOptionalHeader uint16
+		Characteristics      uint16
+	}{machine.Machine, 1, 0, uint32(symbolsAt), 1, 0, characteristics})
+	binary.Write(&b, le, struct {
+		Name                 [8]byte
+		VirtualSize          uint32
+		VirtualAddress       uint32
+		SizeOfRawData        uint32
+		PointerToRawData     uint32
+		PointerToRelocations uint32
+		PointerToLineNumbers uint32
+		NumberOfRelocations  uint16
+		NumberOfLineNumbers  uint16
+		Characteristics      uint32
+	}{
+		Name:                 [8]byte{'.', 'r', 's', 'r', 'c'},
+		SizeOfRawData:        uint32(len(section)),
+		PointerToRawData:     headerSize + sectionHeaderSize,
+		PointerToRelocations: uint32(relocsAt),
+		NumberOfRelocations:  uint16(len(relocs)),
+		// IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+		Characteristics: 0x40000040,
+	})
+	b.Write(section)
+	for _, offset := range relocs {
+		binary.Write(&b, le, struct {
+			VirtualAddress   uint32
+			SymbolTableIndex uint32
+			Type             uint16
+		}{offset, 0, machine.Reloc})
+	}
+	binary.Write(&b, le, struct {
+		Name               [8]byte
+		Value              uint32
+		SectionNumber      int16
+		Type               uint16
+		StorageClass       uint8
+		NumberOfAuxSymbols uint8
+	}{
+		Name:          [8]byte{'.', 'r', 's', 'r', 'c'},
+		SectionNumber: 1,
+		StorageClass:  3, // IMAGE_SYM_CLASS_STATIC
+	})
+
+	// The string table is empty, which is just its size.
+	binary.Write(&b, le, uint32(4))
+	return b.Bytes(), nil
+}
+
+// resourceSection returns the contents of the resource section with the
+// given resources, all in the given language, and the offsets of the
+// addresses in it that need relocations. The section is the tree of
+// directories, by type, then ID, then language, that leads to an entry
+// for each resource with the address and size of its data.
+func resourceSection(resources []winresource, lang uint16) ([]byte, []uint32) {
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := resources[i], resources[j]
+		return a.Type < b.Type || (a.Type == b.Type && a.ID < b.ID)
+	})
+	var types []uint16
+	count := make(map[uint16]int)
+	for _, r := range resources {
+		if count[r.Type] == 0 {
+			types = append(types, r.Type)
+		}
+		count[r.Type]++
+	}
+
+	// Lay out the directories, then the data entries, then the data, each
+	// of which is aligned to 8 bytes.
+	const dirSize, entrySize, dataEntrySize = 16, 8, 16
+	offset := dirSize + entrySize*len(types)
+	typeDirs := make(map[uint16]int)
+	for _, t := range types {
+		typeDirs[t] = offset
+		offset += dirSize + entrySize*count[t]
+	}
+	langDirs := make([]int, len(resources))
+	for i := range resources {
+		langDirs[i] = offset
+		offset += dirSize + entrySize
+	}
+	dataEntries := make([]int, len(resources))
+	for i := range resources {
+		dataEntries[i] = offset
+		offset += dataEntrySize
+	}
+	data := make([]int, len(resources))
+	for i, r := range resources {
+		offset = (offset + 7) &^ 7
+		data[i] = offset
+		offset += len(r.Data)
+	}
+
+	section := make([]byte, (offset+7)&^7)
+	le := binary.LittleEndian
+	dir := func(at, entries int) {
+		le.PutUint16(section[at+14:], uint16(entries))
+	}
+	entry := func(at int, id uint16, offset int, subdir bool) {
+		le.PutUint32(section[at:], uint32(id))
+		if subdir {
+			offset |= 0x80000000
+		}
+		le.PutUint32(section[at+4:], uint32(offset))
+	}
+
+	dir(0, len(types))
+	for i, t := range types {
+		entry(dirSize+entrySize*i, t, typeDirs[t], true)
+		dir(typeDirs[t], count[t])
+	}
+	var relocs []uint32
+	n := 0
+	for i, r := range resources {
+		if i > 0 && r.Type != resources[i-1].Type {
+			n = 0
+		}
+		entry(typeDirs[r.Type]+dirSize+entrySize*n, r.ID, langDirs[i], true)
+		n++
+
+		dir(langDirs[i], 1)
+		entry(langDirs[i]+dirSize, lang, dataEntries[i], false)
+
+		le.PutUint32(section[dataEntries[i]:], uint32(data[i]))
+		le.PutUint32(section[dataEntries[i]+4:], uint32(len(r.Data)))
+		relocs = append(relocs, uint32(dataEntries[i]))
+		copy(section[data[i]:], r.Data)
+	}
+
+	return section, relocs
+}
+
+// translation returns the language and the code page of the strings, the
+// Translation of VarFileInfo, which default to US English and Unicode.
+func (vi *VersionInfo) translation() (lang, charset uint16, err error) {
+	t := vi.VarFileInfo.Translation
+	l, err := parseHexField("LangID", t.LangID, 0x0409)
+	if err != nil {
+		return 0, 0, err
+	}
+	c, err := parseHexField("CharsetID", t.CharsetID, 0x04b0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint16(l), uint16(c), nil
+}
+
+// encode returns the VERSIONINFO resource, or an error if a field is
+// invalid.
+func (vi *VersionInfo) encode() ([]byte, error) {
+	lang, charset, err := vi.translation()
+	if err != nil {
+		return nil, err
+	}
+
+	fixed := vi.FixedFileInfo
+	flags := make([]uint32, 5)
+	for i, f := range []struct {
+		Name, Value string
+		Default     uint32
+	}{
+		{"FileFlagsMask", fixed.FileFlagsMask, 0x3f},
+		{"FileFlags", fixed.FileFlags, 0},
+		{"FileOS", fixed.FileOS, 0x40004}, // VOS_NT_WINDOWS32
+		{"FileType", fixed.FileType, 1},   // VFT_APP
+		{"FileSubType", fixed.FileSubType, 0},
+	} {
+		if flags[i], err = parseHexField(f.Name, f.Value, f.Default); err != nil {
+			return nil, err
+		}
+	}
+
+	var value bytes.Buffer
+	binary.Write(&value, binary.LittleEndian, []uint32{
+		0xfeef04bd, // signature
+		0x00010000, // version of the structure
+		uint32(fixed.FileVersion.Major)<<16 | uint32(fixed.FileVersion.Minor),
+		uint32(fixed.FileVersion.Patch)<<16 | uint32(fixed.FileVersion.Build),
+		uint32(fixed.ProductVersion.Major)<<16 | uint32(fixed.ProductVersion.Minor),
+		uint32(fixed.ProductVersion.Patch)<<16 | uint32(fixed.ProductVersion.Build),
+		flags[0], flags[1], flags[2], flags[3], flags[4],
+		0, 0, // date
+	})
+
+	var children [][]byte
+	var keys []string
+	for k, v := range vi.StringFileInfo {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		var strings [][]byte
+		for _, k := range keys {
+			v := utf16z(vi.StringFileInfo[k])
+			strings = append(strings, versionNode(k, 1, v, uint16(len(v)/2)))
+		}
+		table := versionNode(fmt.Sprintf("%04X%04X", lang, charset), 1, nil, 0, strings...)
+		children = append(children, versionNode("StringFileInfo", 1, nil, 0, table))
+	}
+	translation := make([]byte, 4)
+	binary.LittleEndian.PutUint16(translation, lang)
+	binary.LittleEndian.PutUint16(translation[2:], charset)
+	children = append(children, versionNode("VarFileInfo", 1, nil, 0,
+		versionNode("Translation", 0, translation, 4)))
+
+	return versionNode("VS_VERSION_INFO", 0, value.Bytes(), uint16(value.Len()), children...), nil
+}
+
+// versionNode returns a node of the tree of a VERSIONINFO resource: its
+// length, the length of its value, its type, which is 1 for text and 0 for
+// binary, its key, its value and its children, each of which starts at a
+// multiple of 4 bytes.
+func versionNode(key string, typ uint16, value []byte, valueLength uint16, children ...[]byte) []byte {
+	b := make([]byte, 6)
+	binary.LittleEndian.PutUint16(b[2:], valueLength)
+	binary.LittleEndian.PutUint16(b[4:], typ)
+	b = append(b, utf16z(key)...)
+	pad := func() {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+	}
+	if len(value) > 0 {
+		pad()
+		b = append(b, value...)
+	}
+	for _, child := range children {
+		pad()
+		b = append(b, child...)
+	}
+
+	binary.LittleEndian.PutUint16(b, uint16(len(b)))
+	return b
+}
+
+// utf16z returns s in UTF-16, little-endian, with a zero at the end.
+func utf16z(s string) []byte {
+	chars := append(utf16.Encode([]rune(s)), 0)
+	b := make([]byte, 2*len(chars))
+	for i, c := range chars {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+
+	return b
+}
+
+// parseHexField parses the field of a versioninfo.json file with the given
+// name, a hex number, which is def if it's empty.
+func parseHexField(name, value string, def uint32) (uint32, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	v, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q, must be a hex number", name, value)
+	}
+	return uint32(v), nil
+}
+
+// parseIcon parses a .ico file into the RT_GROUP_ICON resource that lists
+// its images and the RT_ICON resources of the images, whose IDs are their
+// index plus one.
+func parseIcon(data []byte) ([]byte, [][]byte, error) {
+	var header struct {
+		Reserved, Type, Count uint16
+	}
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil ||
+		header.Reserved != 0 || header.Type != 1 || header.Count == 0 {
+		return nil, nil, fmt.Errorf("not an icon")
+	}
+
+	var group bytes.Buffer
+	binary.Write(&group, binary.LittleEndian, header)
+	var images [][]byte
+	for i := 0; i < int(header.Count); i++ {
+		var entry struct {
+			Width, Height, ColorCount, Reserved uint8
+			Planes, BitCount                    uint16
+			BytesInRes, ImageOffset             uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+			return nil, nil, fmt.Errorf("icon is truncated")
+		}
+		end := uint64(entry.ImageOffset) + uint64(entry.BytesInRes)
+		if end > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("image %d of the icon is truncated", i+1)
+		}
+		images = append(images, data[entry.ImageOffset:end])
+
+		// The entries of the group are those of the file, with the ID of
+		// the RT_ICON resource of the image instead of its offset.
+		binary.Write(&group, binary.LittleEndian, struct {
+			Width, Height, ColorCount, Reserved uint8
+			Planes, BitCount                    uint16
+			BytesInRes                          uint32
+			ID                                  uint16
+		}{entry.Width, entry.Height, entry.ColorCount, entry.Reserved,
+			entry.Planes, entry.BitCount, entry.BytesInRes, uint16(i + 1)})
+	}
+
+	return group.Bytes(), images, nil
+}
+
+// winresSysoPrefix starts the names of the .syso files of the Windows
+// resources that are written in the directories of the packages. The
+// OS and arch that end the name keep go build from linking the file into
+// the binaries of other platforms.
+const winresSysoPrefix = "gox_winres"
+
+var (
+	winresLock  sync.Mutex
+	winresLocks = make(map[string]*sync.Mutex)
+)
+
+// writeWinResSyso writes the .syso file of the Windows resources of the
+// options into the directory of the package, for go build to link in. The
+// builds that would write the same file, for the same package and arch,
+// wait for each other, until the function that is returned removes it.
+func writeWinResSyso(opts *CompileOpts) (func(), error) {
+	syso, err := opts.WinRes.Syso(opts.Platform.Arch)
+	if err != nil {
+		return nil, err
+	}
+
+	chdir, dir := buildPackagePath(opts.PackagePath)
+	if chdir != "" {
+		dir = chdir
+	}
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("Windows resources can only be added to the "+
+			"packages of the main module, not %s", opts.PackagePath)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s_%s.syso",
+		winresSysoPrefix, opts.Platform.OS, opts.Platform.Arch))
+
+	winresLock.Lock()
+	lock, ok := winresLocks[path]
+	if !ok {
+		lock = new(sync.Mutex)
+		winresLocks[path] = lock
+	}
+	winresLock.Unlock()
+
+	lock.Lock()
+	if err := ioutil.WriteFile(path, syso, 0644); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return func() {
+		os.Remove(path)
+		lock.Unlock()
+	}, nil
+}
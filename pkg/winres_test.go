@@ -0,0 +1,180 @@
+package gox
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testIcon returns a .ico file with one image of the given contents.
+func testIcon(image []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, []uint16{0, 1, 1})
+	binary.Write(&b, binary.LittleEndian, []uint8{16, 16, 0, 0})
+	binary.Write(&b, binary.LittleEndian, []uint16{1, 32})
+	binary.Write(&b, binary.LittleEndian, []uint32{uint32(len(image)), 22})
+	b.Write(image)
+	return b.Bytes()
+}
+
+func TestReadWinRes(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	testWriteFile(t, filepath.Join(td, "app.ico"), string(testIcon([]byte("app"))))
+	testWriteFile(t, filepath.Join(td, "other.ico"), string(testIcon([]byte("other"))))
+	testWriteFile(t, filepath.Join(td, "versioninfo.json"), `{
+		"FixedFileInfo": {"FileVersion": {"Major": 1, "Minor": 2}},
+		"StringFileInfo": {"ProductName": "App"},
+		"IconPath": "app.ico"
+	}`)
+
+	// The icon of the file is relative to it
+	res, err := ReadWinRes(filepath.Join(td, "versioninfo.json"), "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.VersionInfo.FixedFileInfo.FileVersion != (FileVersion{Major: 1, Minor: 2}) {
+		t.Fatalf("bad: %#v", res.VersionInfo)
+	}
+	if res.VersionInfo.StringFileInfo["ProductName"] != "App" {
+		t.Fatalf("bad: %#v", res.VersionInfo)
+	}
+	if !bytes.HasSuffix(res.Icon, []byte("app")) {
+		t.Fatalf("bad: %q", res.Icon)
+	}
+
+	// The icon given takes precedence
+	res, err = ReadWinRes(filepath.Join(td, "versioninfo.json"), filepath.Join(td, "other.ico"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.HasSuffix(res.Icon, []byte("other")) {
+		t.Fatalf("bad: %q", res.Icon)
+	}
+
+	// Only an icon
+	res, err = ReadWinRes("", filepath.Join(td, "other.ico"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if res.VersionInfo != nil || res.Icon == nil {
+		t.Fatalf("bad: %#v", res)
+	}
+}
+
+func TestReadWinRes_invalid(t *testing.T) {
+	td := testTempDir(t)
+	defer os.RemoveAll(td)
+
+	truncated := testIcon([]byte("app"))
+	cases := []struct {
+		Name        string
+		VersionInfo string
+		Icon        string
+		Expected    string
+	}{
+		{"json", `{"FixedFileInfo": [}`, "", "error parsing"},
+		{"hex", `{"FixedFileInfo": {"FileOS": "nt"}}`, "", `invalid FileOS "nt"`},
+		{"lang", `{"VarFileInfo": {"Translation": {"LangID": "x"}}}`, "", `invalid LangID "x"`},
+		{"icon", "", "not an icon", "not an icon"},
+		{"truncated", "", string(truncated[:len(truncated)-1]), "image 1 of the icon is truncated"},
+	}
+
+	for _, tc := range cases {
+		var versionInfoPath, iconPath string
+		if tc.VersionInfo != "" {
+			versionInfoPath = filepath.Join(td, tc.Name+".json")
+			testWriteFile(t, versionInfoPath, tc.VersionInfo)
+		}
+		if tc.Icon != "" {
+			iconPath = filepath.Join(td, tc.Name+".ico")
+			testWriteFile(t, iconPath, tc.Icon)
+		}
+
+		_, err := ReadWinRes(versionInfoPath, iconPath)
+		if err == nil || !strings.Contains(err.Error(), tc.Expected) {
+			t.Fatalf("%s: bad: %v", tc.Name, err)
+		}
+	}
+}
+
+func TestWinResSyso(t *testing.T) {
+	res := &WinRes{
+		VersionInfo: &VersionInfo{StringFileInfo: map[string]string{"ProductName": "App"}},
+		Icon:        testIcon([]byte("app")),
+	}
+
+	cases := []struct {
+		Arch    string
+		Machine uint16
+	}{
+		{"386", pe.IMAGE_FILE_MACHINE_I386},
+		{"amd64", pe.IMAGE_FILE_MACHINE_AMD64},
+		{"arm", pe.IMAGE_FILE_MACHINE_ARMNT},
+		{"arm64", pe.IMAGE_FILE_MACHINE_ARM64},
+	}
+
+	for _, tc := range cases {
+		syso, err := res.Syso(tc.Arch)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Arch, err)
+		}
+
+		f, err := pe.NewFile(bytes.NewReader(syso))
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Arch, err)
+		}
+		if f.Machine != tc.Machine {
+			t.Fatalf("%s: bad: %#x", tc.Arch, f.Machine)
+		}
+		if len(f.Sections) != 1 || f.Sections[0].Name != ".rsrc" {
+			t.Fatalf("%s: bad: %#v", tc.Arch, f.Sections)
+		}
+
+		// A relocation for the version info, the icon group and the icon
+		if relocs := f.Sections[0].Relocs; len(relocs) != 3 {
+			t.Fatalf("%s: bad: %#v", tc.Arch, relocs)
+		}
+		if len(f.Symbols) != 1 || f.Symbols[0].Name != ".rsrc" {
+			t.Fatalf("%s: bad: %#v", tc.Arch, f.Symbols)
+		}
+
+		data, err := f.Sections[0].Data()
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Arch, err)
+		}
+		for _, s := range []string{"VS_VERSION_INFO", "ProductName", "App"} {
+			if !bytes.Contains(data, utf16z(s)) {
+				t.Fatalf("%s: should contain %s", tc.Arch, s)
+			}
+		}
+	}
+
+	if _, err := res.Syso("mips"); err == nil {
+		t.Fatal("should err")
+	}
+}
+
+func TestVersionNode(t *testing.T) {
+	// The key and the value are each aligned to 4 bytes, and the length
+	// covers everything but the padding after the value.
+	node := versionNode("ab", 1, utf16z("c"), 2)
+	expected := []byte{
+		16, 0, 2, 0, 1, 0,
+		'a', 0, 'b', 0, 0, 0,
+		'c', 0, 0, 0,
+	}
+	if !bytes.Equal(node, expected) {
+		t.Fatalf("bad: %v", node)
+	}
+
+	parent := versionNode("x", 1, nil, 0, node, node)
+	if len(parent) != 10+2+16+16 || int(binary.LittleEndian.Uint16(parent)) != len(parent) {
+		t.Fatalf("bad: %v", parent)
+	}
+}